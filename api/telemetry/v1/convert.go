@@ -0,0 +1,48 @@
+package telemetryv1
+
+import (
+	"github.com/LincolnG4/iot-hydra/internal/message"
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+// ToMessage converts the protobuf message into a message.Message.
+func ToMessage(pb *Message) *message.Message {
+	msg := &message.Message{
+		ID:            pb.GetId(),
+		DeviceID:      pb.GetDeviceId(),
+		Payload:       pb.GetPayload(),
+		TargetBrokers: pb.GetTargetBrokers(),
+		SourceBroker:  pb.GetSourceBroker(),
+		Topic:         pb.GetTopic(),
+		Priority:      message.Priority(pb.GetPriority()),
+		Metadata:      pb.GetMetadata(),
+	}
+	if pb.GetTimestamp() != nil {
+		msg.Timestamp = pb.GetTimestamp().AsTime()
+	}
+	if pb.GetExpiresAt() != nil {
+		msg.ExpiresAt = pb.GetExpiresAt().AsTime()
+	}
+	return msg
+}
+
+// FromMessage converts the message.Message into its protobuf representation.
+func FromMessage(msg *message.Message) *Message {
+	pb := &Message{
+		Id:            msg.ID,
+		DeviceId:      msg.DeviceID,
+		Payload:       msg.Payload,
+		TargetBrokers: msg.TargetBrokers,
+		SourceBroker:  msg.SourceBroker,
+		Topic:         msg.Topic,
+		Priority:      string(msg.Priority),
+		Metadata:      msg.Metadata,
+	}
+	if !msg.Timestamp.IsZero() {
+		pb.Timestamp = timestamppb.New(msg.Timestamp)
+	}
+	if !msg.ExpiresAt.IsZero() {
+		pb.ExpiresAt = timestamppb.New(msg.ExpiresAt)
+	}
+	return pb
+}
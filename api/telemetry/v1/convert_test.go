@@ -0,0 +1,25 @@
+package telemetryv1
+
+import (
+	"testing"
+	"time"
+
+	"github.com/LincolnG4/iot-hydra/internal/message"
+	"github.com/alecthomas/assert"
+)
+
+func TestConvert(t *testing.T) {
+	now := time.Now().UTC()
+	msg := &message.Message{
+		ID:        "1",
+		DeviceID:  "dev-1",
+		Timestamp: now,
+		Topic:     "sensors/temp",
+		Priority:  message.PriorityLow,
+		ExpiresAt: now.Add(time.Minute),
+		Metadata:  map[string]string{"k": "v"},
+	}
+
+	got := ToMessage(FromMessage(msg))
+	assert.Equal(t, msg, got)
+}
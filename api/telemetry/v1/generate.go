@@ -0,0 +1,5 @@
+// Package telemetryv1 contains the gRPC API used by devices and containers to
+// publish telemetry.
+package telemetryv1
+
+//go:generate protoc --go_out=. --go_opt=paths=source_relative --go-grpc_out=. --go-grpc_opt=paths=source_relative telemetry.proto
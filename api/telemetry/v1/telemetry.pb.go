@@ -0,0 +1,601 @@
+// Code generated by protoc-gen-go. DO NOT EDIT.
+// versions:
+// 	protoc-gen-go v1.36.10
+// 	protoc        (unknown)
+// source: telemetry.proto
+
+package telemetryv1
+
+import (
+	protoreflect "google.golang.org/protobuf/reflect/protoreflect"
+	protoimpl "google.golang.org/protobuf/runtime/protoimpl"
+	timestamppb "google.golang.org/protobuf/types/known/timestamppb"
+	reflect "reflect"
+	sync "sync"
+	unsafe "unsafe"
+)
+
+const (
+	// Verify that this generated code is sufficiently up-to-date.
+	_ = protoimpl.EnforceVersion(20 - protoimpl.MinVersion)
+	// Verify that runtime/protoimpl is sufficiently up-to-date.
+	_ = protoimpl.EnforceVersion(protoimpl.MaxVersion - 20)
+)
+
+type AckStatus int32
+
+const (
+	AckStatus_ACK_STATUS_UNSPECIFIED AckStatus = 0
+	AckStatus_ACK_STATUS_ACCEPTED    AckStatus = 1
+	AckStatus_ACK_STATUS_REJECTED    AckStatus = 2
+	// Published to the broker of the ack
+	AckStatus_ACK_STATUS_PUBLISHED AckStatus = 3
+	// Failed to be enqueued or published to the broker of the ack
+	AckStatus_ACK_STATUS_FAILED AckStatus = 4
+	// Not routed, e.g. expired or filtered by its route
+	AckStatus_ACK_STATUS_DROPPED AckStatus = 5
+	// Sequence already received on the session, not forwarded again
+	AckStatus_ACK_STATUS_DUPLICATE AckStatus = 6
+	// State of the websocket session, sent when the connection opens
+	AckStatus_ACK_STATUS_SESSION AckStatus = 7
+	// Downlink command for the device, with its topic and payload. The device replies
+	// with a message whose correlation_id is the ack id
+	AckStatus_ACK_STATUS_COMMAND AckStatus = 8
+	// Last will of the connection registered
+	AckStatus_ACK_STATUS_WILL AckStatus = 9
+)
+
+// Enum value maps for AckStatus.
+var (
+	AckStatus_name = map[int32]string{
+		0: "ACK_STATUS_UNSPECIFIED",
+		1: "ACK_STATUS_ACCEPTED",
+		2: "ACK_STATUS_REJECTED",
+		3: "ACK_STATUS_PUBLISHED",
+		4: "ACK_STATUS_FAILED",
+		5: "ACK_STATUS_DROPPED",
+		6: "ACK_STATUS_DUPLICATE",
+		7: "ACK_STATUS_SESSION",
+		8: "ACK_STATUS_COMMAND",
+		9: "ACK_STATUS_WILL",
+	}
+	AckStatus_value = map[string]int32{
+		"ACK_STATUS_UNSPECIFIED": 0,
+		"ACK_STATUS_ACCEPTED":    1,
+		"ACK_STATUS_REJECTED":    2,
+		"ACK_STATUS_PUBLISHED":   3,
+		"ACK_STATUS_FAILED":      4,
+		"ACK_STATUS_DROPPED":     5,
+		"ACK_STATUS_DUPLICATE":   6,
+		"ACK_STATUS_SESSION":     7,
+		"ACK_STATUS_COMMAND":     8,
+		"ACK_STATUS_WILL":        9,
+	}
+)
+
+func (x AckStatus) Enum() *AckStatus {
+	p := new(AckStatus)
+	*p = x
+	return p
+}
+
+func (x AckStatus) String() string {
+	return protoimpl.X.EnumStringOf(x.Descriptor(), protoreflect.EnumNumber(x))
+}
+
+func (AckStatus) Descriptor() protoreflect.EnumDescriptor {
+	return file_telemetry_proto_enumTypes[0].Descriptor()
+}
+
+func (AckStatus) Type() protoreflect.EnumType {
+	return &file_telemetry_proto_enumTypes[0]
+}
+
+func (x AckStatus) Number() protoreflect.EnumNumber {
+	return protoreflect.EnumNumber(x)
+}
+
+// Deprecated: Use AckStatus.Descriptor instead.
+func (AckStatus) EnumDescriptor() ([]byte, []int) {
+	return file_telemetry_proto_rawDescGZIP(), []int{0}
+}
+
+// Message is the protobuf representation of message.Message.
+type Message struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Id            string                 `protobuf:"bytes,1,opt,name=id,proto3" json:"id,omitempty"`
+	DeviceId      string                 `protobuf:"bytes,2,opt,name=device_id,json=deviceId,proto3" json:"device_id,omitempty"`
+	Timestamp     *timestamppb.Timestamp `protobuf:"bytes,3,opt,name=timestamp,proto3" json:"timestamp,omitempty"`
+	Payload       []byte                 `protobuf:"bytes,4,opt,name=payload,proto3" json:"payload,omitempty"`
+	TargetBrokers []string               `protobuf:"bytes,5,rep,name=target_brokers,json=targetBrokers,proto3" json:"target_brokers,omitempty"`
+	SourceBroker  string                 `protobuf:"bytes,6,opt,name=source_broker,json=sourceBroker,proto3" json:"source_broker,omitempty"`
+	Topic         string                 `protobuf:"bytes,7,opt,name=topic,proto3" json:"topic,omitempty"`
+	// alarm, normal or low
+	Priority  string                 `protobuf:"bytes,8,opt,name=priority,proto3" json:"priority,omitempty"`
+	ExpiresAt *timestamppb.Timestamp `protobuf:"bytes,9,opt,name=expires_at,json=expiresAt,proto3" json:"expires_at,omitempty"`
+	Metadata  map[string]string      `protobuf:"bytes,10,rep,name=metadata,proto3" json:"metadata,omitempty" protobuf_key:"bytes,1,opt,name=key" protobuf_val:"bytes,2,opt,name=value"`
+	// Sequence number of the message on a websocket session, 0 if not sequenced
+	Seq uint64 `protobuf:"varint,11,opt,name=seq,proto3" json:"seq,omitempty"`
+	// ID of the websocket command the message replies to
+	CorrelationId string `protobuf:"bytes,12,opt,name=correlation_id,json=correlationId,proto3" json:"correlation_id,omitempty"`
+	// Register the message as last will of the websocket connection, sent if the
+	// connection ends abnormally. A will without topic clears it
+	Will          bool `protobuf:"varint,13,opt,name=will,proto3" json:"will,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *Message) Reset() {
+	*x = Message{}
+	mi := &file_telemetry_proto_msgTypes[0]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *Message) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*Message) ProtoMessage() {}
+
+func (x *Message) ProtoReflect() protoreflect.Message {
+	mi := &file_telemetry_proto_msgTypes[0]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use Message.ProtoReflect.Descriptor instead.
+func (*Message) Descriptor() ([]byte, []int) {
+	return file_telemetry_proto_rawDescGZIP(), []int{0}
+}
+
+func (x *Message) GetId() string {
+	if x != nil {
+		return x.Id
+	}
+	return ""
+}
+
+func (x *Message) GetDeviceId() string {
+	if x != nil {
+		return x.DeviceId
+	}
+	return ""
+}
+
+func (x *Message) GetTimestamp() *timestamppb.Timestamp {
+	if x != nil {
+		return x.Timestamp
+	}
+	return nil
+}
+
+func (x *Message) GetPayload() []byte {
+	if x != nil {
+		return x.Payload
+	}
+	return nil
+}
+
+func (x *Message) GetTargetBrokers() []string {
+	if x != nil {
+		return x.TargetBrokers
+	}
+	return nil
+}
+
+func (x *Message) GetSourceBroker() string {
+	if x != nil {
+		return x.SourceBroker
+	}
+	return ""
+}
+
+func (x *Message) GetTopic() string {
+	if x != nil {
+		return x.Topic
+	}
+	return ""
+}
+
+func (x *Message) GetPriority() string {
+	if x != nil {
+		return x.Priority
+	}
+	return ""
+}
+
+func (x *Message) GetExpiresAt() *timestamppb.Timestamp {
+	if x != nil {
+		return x.ExpiresAt
+	}
+	return nil
+}
+
+func (x *Message) GetMetadata() map[string]string {
+	if x != nil {
+		return x.Metadata
+	}
+	return nil
+}
+
+func (x *Message) GetSeq() uint64 {
+	if x != nil {
+		return x.Seq
+	}
+	return 0
+}
+
+func (x *Message) GetCorrelationId() string {
+	if x != nil {
+		return x.CorrelationId
+	}
+	return ""
+}
+
+func (x *Message) GetWill() bool {
+	if x != nil {
+		return x.Will
+	}
+	return false
+}
+
+// Ack is the outcome of a published message. Accepted messages may carry an
+// error, e.g. when they were tagged by the schema policy.
+type Ack struct {
+	state protoimpl.MessageState `protogen:"open.v1"`
+	// Position of the message in the stream
+	Index  uint64    `protobuf:"varint,1,opt,name=index,proto3" json:"index,omitempty"`
+	Id     string    `protobuf:"bytes,2,opt,name=id,proto3" json:"id,omitempty"`
+	Status AckStatus `protobuf:"varint,3,opt,name=status,proto3,enum=telemetry.v1.AckStatus" json:"status,omitempty"`
+	Error  string    `protobuf:"bytes,4,opt,name=error,proto3" json:"error,omitempty"`
+	// Broker of the published and failed acks
+	Broker string `protobuf:"bytes,5,opt,name=broker,proto3" json:"broker,omitempty"`
+	// Sequence of the acknowledged message on a websocket session
+	Seq uint64 `protobuf:"varint,6,opt,name=seq,proto3" json:"seq,omitempty"`
+	// Websocket session of the session acks, with the sequences already received:
+	// all up to last_seq and the ones in seqs
+	Session string   `protobuf:"bytes,7,opt,name=session,proto3" json:"session,omitempty"`
+	LastSeq uint64   `protobuf:"varint,8,opt,name=last_seq,json=lastSeq,proto3" json:"last_seq,omitempty"`
+	Seqs    []uint64 `protobuf:"varint,9,rep,packed,name=seqs,proto3" json:"seqs,omitempty"`
+	// Topic and payload of the command acks
+	Topic         string `protobuf:"bytes,10,opt,name=topic,proto3" json:"topic,omitempty"`
+	Payload       []byte `protobuf:"bytes,11,opt,name=payload,proto3" json:"payload,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *Ack) Reset() {
+	*x = Ack{}
+	mi := &file_telemetry_proto_msgTypes[1]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *Ack) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*Ack) ProtoMessage() {}
+
+func (x *Ack) ProtoReflect() protoreflect.Message {
+	mi := &file_telemetry_proto_msgTypes[1]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use Ack.ProtoReflect.Descriptor instead.
+func (*Ack) Descriptor() ([]byte, []int) {
+	return file_telemetry_proto_rawDescGZIP(), []int{1}
+}
+
+func (x *Ack) GetIndex() uint64 {
+	if x != nil {
+		return x.Index
+	}
+	return 0
+}
+
+func (x *Ack) GetId() string {
+	if x != nil {
+		return x.Id
+	}
+	return ""
+}
+
+func (x *Ack) GetStatus() AckStatus {
+	if x != nil {
+		return x.Status
+	}
+	return AckStatus_ACK_STATUS_UNSPECIFIED
+}
+
+func (x *Ack) GetError() string {
+	if x != nil {
+		return x.Error
+	}
+	return ""
+}
+
+func (x *Ack) GetBroker() string {
+	if x != nil {
+		return x.Broker
+	}
+	return ""
+}
+
+func (x *Ack) GetSeq() uint64 {
+	if x != nil {
+		return x.Seq
+	}
+	return 0
+}
+
+func (x *Ack) GetSession() string {
+	if x != nil {
+		return x.Session
+	}
+	return ""
+}
+
+func (x *Ack) GetLastSeq() uint64 {
+	if x != nil {
+		return x.LastSeq
+	}
+	return 0
+}
+
+func (x *Ack) GetSeqs() []uint64 {
+	if x != nil {
+		return x.Seqs
+	}
+	return nil
+}
+
+func (x *Ack) GetTopic() string {
+	if x != nil {
+		return x.Topic
+	}
+	return ""
+}
+
+func (x *Ack) GetPayload() []byte {
+	if x != nil {
+		return x.Payload
+	}
+	return nil
+}
+
+type PublishStreamResponse struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Acks          []*Ack                 `protobuf:"bytes,1,rep,name=acks,proto3" json:"acks,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *PublishStreamResponse) Reset() {
+	*x = PublishStreamResponse{}
+	mi := &file_telemetry_proto_msgTypes[2]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *PublishStreamResponse) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*PublishStreamResponse) ProtoMessage() {}
+
+func (x *PublishStreamResponse) ProtoReflect() protoreflect.Message {
+	mi := &file_telemetry_proto_msgTypes[2]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use PublishStreamResponse.ProtoReflect.Descriptor instead.
+func (*PublishStreamResponse) Descriptor() ([]byte, []int) {
+	return file_telemetry_proto_rawDescGZIP(), []int{2}
+}
+
+func (x *PublishStreamResponse) GetAcks() []*Ack {
+	if x != nil {
+		return x.Acks
+	}
+	return nil
+}
+
+type SubscribeRequest struct {
+	state protoimpl.MessageState `protogen:"open.v1"`
+	// Broker to subscribe to. The downlink broker of the service is used if empty
+	Broker        string `protobuf:"bytes,1,opt,name=broker,proto3" json:"broker,omitempty"`
+	Topic         string `protobuf:"bytes,2,opt,name=topic,proto3" json:"topic,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *SubscribeRequest) Reset() {
+	*x = SubscribeRequest{}
+	mi := &file_telemetry_proto_msgTypes[3]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *SubscribeRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*SubscribeRequest) ProtoMessage() {}
+
+func (x *SubscribeRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_telemetry_proto_msgTypes[3]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use SubscribeRequest.ProtoReflect.Descriptor instead.
+func (*SubscribeRequest) Descriptor() ([]byte, []int) {
+	return file_telemetry_proto_rawDescGZIP(), []int{3}
+}
+
+func (x *SubscribeRequest) GetBroker() string {
+	if x != nil {
+		return x.Broker
+	}
+	return ""
+}
+
+func (x *SubscribeRequest) GetTopic() string {
+	if x != nil {
+		return x.Topic
+	}
+	return ""
+}
+
+var File_telemetry_proto protoreflect.FileDescriptor
+
+const file_telemetry_proto_rawDesc = "" +
+	"\n" +
+	"\x0ftelemetry.proto\x12\ftelemetry.v1\x1a\x1fgoogle/protobuf/timestamp.proto\"\x8e\x04\n" +
+	"\aMessage\x12\x0e\n" +
+	"\x02id\x18\x01 \x01(\tR\x02id\x12\x1b\n" +
+	"\tdevice_id\x18\x02 \x01(\tR\bdeviceId\x128\n" +
+	"\ttimestamp\x18\x03 \x01(\v2\x1a.google.protobuf.TimestampR\ttimestamp\x12\x18\n" +
+	"\apayload\x18\x04 \x01(\fR\apayload\x12%\n" +
+	"\x0etarget_brokers\x18\x05 \x03(\tR\rtargetBrokers\x12#\n" +
+	"\rsource_broker\x18\x06 \x01(\tR\fsourceBroker\x12\x14\n" +
+	"\x05topic\x18\a \x01(\tR\x05topic\x12\x1a\n" +
+	"\bpriority\x18\b \x01(\tR\bpriority\x129\n" +
+	"\n" +
+	"expires_at\x18\t \x01(\v2\x1a.google.protobuf.TimestampR\texpiresAt\x12?\n" +
+	"\bmetadata\x18\n" +
+	" \x03(\v2#.telemetry.v1.Message.MetadataEntryR\bmetadata\x12\x10\n" +
+	"\x03seq\x18\v \x01(\x04R\x03seq\x12%\n" +
+	"\x0ecorrelation_id\x18\f \x01(\tR\rcorrelationId\x12\x12\n" +
+	"\x04will\x18\r \x01(\bR\x04will\x1a;\n" +
+	"\rMetadataEntry\x12\x10\n" +
+	"\x03key\x18\x01 \x01(\tR\x03key\x12\x14\n" +
+	"\x05value\x18\x02 \x01(\tR\x05value:\x028\x01\"\x95\x02\n" +
+	"\x03Ack\x12\x14\n" +
+	"\x05index\x18\x01 \x01(\x04R\x05index\x12\x0e\n" +
+	"\x02id\x18\x02 \x01(\tR\x02id\x12/\n" +
+	"\x06status\x18\x03 \x01(\x0e2\x17.telemetry.v1.AckStatusR\x06status\x12\x14\n" +
+	"\x05error\x18\x04 \x01(\tR\x05error\x12\x16\n" +
+	"\x06broker\x18\x05 \x01(\tR\x06broker\x12\x10\n" +
+	"\x03seq\x18\x06 \x01(\x04R\x03seq\x12\x18\n" +
+	"\asession\x18\a \x01(\tR\asession\x12\x19\n" +
+	"\blast_seq\x18\b \x01(\x04R\alastSeq\x12\x12\n" +
+	"\x04seqs\x18\t \x03(\x04R\x04seqs\x12\x14\n" +
+	"\x05topic\x18\n" +
+	" \x01(\tR\x05topic\x12\x18\n" +
+	"\apayload\x18\v \x01(\fR\apayload\">\n" +
+	"\x15PublishStreamResponse\x12%\n" +
+	"\x04acks\x18\x01 \x03(\v2\x11.telemetry.v1.AckR\x04acks\"@\n" +
+	"\x10SubscribeRequest\x12\x16\n" +
+	"\x06broker\x18\x01 \x01(\tR\x06broker\x12\x14\n" +
+	"\x05topic\x18\x02 \x01(\tR\x05topic*\x81\x02\n" +
+	"\tAckStatus\x12\x1a\n" +
+	"\x16ACK_STATUS_UNSPECIFIED\x10\x00\x12\x17\n" +
+	"\x13ACK_STATUS_ACCEPTED\x10\x01\x12\x17\n" +
+	"\x13ACK_STATUS_REJECTED\x10\x02\x12\x18\n" +
+	"\x14ACK_STATUS_PUBLISHED\x10\x03\x12\x15\n" +
+	"\x11ACK_STATUS_FAILED\x10\x04\x12\x16\n" +
+	"\x12ACK_STATUS_DROPPED\x10\x05\x12\x18\n" +
+	"\x14ACK_STATUS_DUPLICATE\x10\x06\x12\x16\n" +
+	"\x12ACK_STATUS_SESSION\x10\a\x12\x16\n" +
+	"\x12ACK_STATUS_COMMAND\x10\b\x12\x13\n" +
+	"\x0fACK_STATUS_WILL\x10\t2\xdc\x01\n" +
+	"\x10TelemetryService\x123\n" +
+	"\aPublish\x12\x15.telemetry.v1.Message\x1a\x11.telemetry.v1.Ack\x12M\n" +
+	"\rPublishStream\x12\x15.telemetry.v1.Message\x1a#.telemetry.v1.PublishStreamResponse(\x01\x12D\n" +
+	"\tSubscribe\x12\x1e.telemetry.v1.SubscribeRequest\x1a\x15.telemetry.v1.Message0\x01B=Z;github.com/LincolnG4/iot-hydra/api/telemetry/v1;telemetryv1b\x06proto3"
+
+var (
+	file_telemetry_proto_rawDescOnce sync.Once
+	file_telemetry_proto_rawDescData []byte
+)
+
+func file_telemetry_proto_rawDescGZIP() []byte {
+	file_telemetry_proto_rawDescOnce.Do(func() {
+		file_telemetry_proto_rawDescData = protoimpl.X.CompressGZIP(unsafe.Slice(unsafe.StringData(file_telemetry_proto_rawDesc), len(file_telemetry_proto_rawDesc)))
+	})
+	return file_telemetry_proto_rawDescData
+}
+
+var file_telemetry_proto_enumTypes = make([]protoimpl.EnumInfo, 1)
+var file_telemetry_proto_msgTypes = make([]protoimpl.MessageInfo, 5)
+var file_telemetry_proto_goTypes = []any{
+	(AckStatus)(0),                // 0: telemetry.v1.AckStatus
+	(*Message)(nil),               // 1: telemetry.v1.Message
+	(*Ack)(nil),                   // 2: telemetry.v1.Ack
+	(*PublishStreamResponse)(nil), // 3: telemetry.v1.PublishStreamResponse
+	(*SubscribeRequest)(nil),      // 4: telemetry.v1.SubscribeRequest
+	nil,                           // 5: telemetry.v1.Message.MetadataEntry
+	(*timestamppb.Timestamp)(nil), // 6: google.protobuf.Timestamp
+}
+var file_telemetry_proto_depIdxs = []int32{
+	6, // 0: telemetry.v1.Message.timestamp:type_name -> google.protobuf.Timestamp
+	6, // 1: telemetry.v1.Message.expires_at:type_name -> google.protobuf.Timestamp
+	5, // 2: telemetry.v1.Message.metadata:type_name -> telemetry.v1.Message.MetadataEntry
+	0, // 3: telemetry.v1.Ack.status:type_name -> telemetry.v1.AckStatus
+	2, // 4: telemetry.v1.PublishStreamResponse.acks:type_name -> telemetry.v1.Ack
+	1, // 5: telemetry.v1.TelemetryService.Publish:input_type -> telemetry.v1.Message
+	1, // 6: telemetry.v1.TelemetryService.PublishStream:input_type -> telemetry.v1.Message
+	4, // 7: telemetry.v1.TelemetryService.Subscribe:input_type -> telemetry.v1.SubscribeRequest
+	2, // 8: telemetry.v1.TelemetryService.Publish:output_type -> telemetry.v1.Ack
+	3, // 9: telemetry.v1.TelemetryService.PublishStream:output_type -> telemetry.v1.PublishStreamResponse
+	1, // 10: telemetry.v1.TelemetryService.Subscribe:output_type -> telemetry.v1.Message
+	8, // [8:11] is the sub-list for method output_type
+	5, // [5:8] is the sub-list for method input_type
+	5, // [5:5] is the sub-list for extension type_name
+	5, // [5:5] is the sub-list for extension extendee
+	0, // [0:5] is the sub-list for field type_name
+}
+
+func init() { file_telemetry_proto_init() }
+func file_telemetry_proto_init() {
+	if File_telemetry_proto != nil {
+		return
+	}
+	type x struct{}
+	out := protoimpl.TypeBuilder{
+		File: protoimpl.DescBuilder{
+			GoPackagePath: reflect.TypeOf(x{}).PkgPath(),
+			RawDescriptor: unsafe.Slice(unsafe.StringData(file_telemetry_proto_rawDesc), len(file_telemetry_proto_rawDesc)),
+			NumEnums:      1,
+			NumMessages:   5,
+			NumExtensions: 0,
+			NumServices:   1,
+		},
+		GoTypes:           file_telemetry_proto_goTypes,
+		DependencyIndexes: file_telemetry_proto_depIdxs,
+		EnumInfos:         file_telemetry_proto_enumTypes,
+		MessageInfos:      file_telemetry_proto_msgTypes,
+	}.Build()
+	File_telemetry_proto = out.File
+	file_telemetry_proto_goTypes = nil
+	file_telemetry_proto_depIdxs = nil
+}
@@ -0,0 +1,48 @@
+package main
+
+import (
+	"crypto/subtle"
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+// requireAdmin is a middleware that rejects requests without the admin bearer
+// token. The admin endpoints are disabled when no token is configured.
+func (a *application) requireAdmin(c *gin.Context) {
+	token := a.config.APIService.AdminToken
+	if token == "" {
+		c.AbortWithStatusJSON(http.StatusForbidden, gin.H{"error": "admin endpoints are disabled"})
+		return
+	}
+
+	given, _ := strings.CutPrefix(c.GetHeader("Authorization"), "Bearer ")
+	if subtle.ConstantTimeCompare([]byte(strings.TrimSpace(given)), []byte(token)) != 1 {
+		a.logger.Warn().Str("remote_addr", c.Request.RemoteAddr).Msg("admin authentication failed")
+		c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "invalid admin token"})
+		return
+	}
+	c.Next()
+}
+
+// listConnections returns the websocket connections of the devices.
+func (a *application) listConnections(c *gin.Context) {
+	c.JSON(http.StatusOK, a.wsClients.list())
+}
+
+// disconnectDevice closes all websocket connections of the device.
+func (a *application) disconnectDevice(c *gin.Context) {
+	deviceID := c.Param("device_id")
+	clients := a.wsClients.device(deviceID)
+	if len(clients) == 0 {
+		c.JSON(http.StatusNotFound, gin.H{"error": "device is not connected"})
+		return
+	}
+
+	for _, client := range clients {
+		client.disconnect("disconnected by admin")
+	}
+	a.logger.Info().Str("device_id", deviceID).Int("connections", len(clients)).Msg("device disconnected by admin")
+	c.JSON(http.StatusOK, gin.H{"device_id": deviceID, "connections": len(clients)})
+}
@@ -0,0 +1,83 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/gorilla/websocket"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRequireAdmin(t *testing.T) {
+	a := newTestAgentApp(t)
+	r := gin.New()
+	r.GET("/admin", a.requireAdmin, func(c *gin.Context) { c.Status(http.StatusOK) })
+
+	tests := []struct {
+		name     string
+		token    string
+		header   string
+		expected int
+	}{
+		{"disabled", "", "Bearer secret", http.StatusForbidden},
+		{"missing token", "secret", "", http.StatusUnauthorized},
+		{"wrong token", "secret", "Bearer other", http.StatusUnauthorized},
+		{"valid token", "secret", "Bearer secret", http.StatusOK},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			a.config.APIService.AdminToken = tt.token
+			req := httptest.NewRequest(http.MethodGet, "/admin", nil)
+			if tt.header != "" {
+				req.Header.Set("Authorization", tt.header)
+			}
+			w := httptest.NewRecorder()
+			r.ServeHTTP(w, req)
+			assert.Equal(t, tt.expected, w.Code)
+		})
+	}
+}
+
+func TestAdminConnections(t *testing.T) {
+	a := newTestAgentApp(t)
+	conn := dialWebsocket(t, a, subprotocolJSON)
+	require.NoError(t, conn.WriteJSON(gin.H{"device_id": "dev1", "topic": "t"}))
+	require.NoError(t, conn.WriteJSON(gin.H{"device_id": "dev1", "topic": "strict/a", "payload": gin.H{}}))
+
+	r := gin.New()
+	r.GET("/connections", a.listConnections)
+	r.DELETE("/connections/:device_id", a.disconnectDevice)
+
+	var infos []wsConnectionInfo
+	require.Eventually(t, func() bool {
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/connections", nil))
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &infos))
+		return len(infos) == 1 && infos[0].MessagesReceived == 2
+	}, 2*time.Second, 10*time.Millisecond)
+	assert.Equal(t, "dev1", infos[0].DeviceID)
+	assert.Equal(t, subprotocolJSON, infos[0].Subprotocol)
+	assert.Equal(t, uint64(1), infos[0].MessagesQueued)
+	assert.Equal(t, uint64(1), infos[0].MessagesRejected)
+
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(http.MethodDelete, "/connections/other", nil))
+	assert.Equal(t, http.StatusNotFound, w.Code)
+
+	w = httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(http.MethodDelete, "/connections/dev1", nil))
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	// The rejected message is answered before the close frame
+	_, _, err := conn.ReadMessage()
+	require.NoError(t, err)
+	_, _, err = conn.ReadMessage()
+	assert.True(t, websocket.IsCloseError(err, websocket.ClosePolicyViolation), "unexpected error: %v", err)
+	assert.True(t, strings.Contains(err.Error(), "disconnected by admin"))
+}
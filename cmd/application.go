@@ -2,10 +2,15 @@ package main
 
 import (
 	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
 	"net/http"
+	"os"
 	"time"
 
 	"github.com/LincolnG4/iot-hydra/internal/agent"
+	"github.com/LincolnG4/iot-hydra/internal/auth"
 	"github.com/LincolnG4/iot-hydra/internal/config"
 	"github.com/LincolnG4/iot-hydra/internal/runtimer"
 	"github.com/gin-gonic/gin"
@@ -13,9 +18,15 @@ import (
 )
 
 type application struct {
-	PodmanRuntime  runtimer.PodmanRuntime // responsible to manage podman service
-	config         *config.ConfigYAML     // configuration loaded from config.yaml file
-	TelemetryAgent *agent.TelemetryAgent  // agent responsible to route telemetry messsages to the brokers
+	PodmanRuntime  runtimer.PodmanRuntime    // responsible to manage podman service
+	config         *config.ConfigYAML        // configuration loaded from config.yaml file
+	TelemetryAgent *agent.TelemetryAgent     // agent responsible to route telemetry messsages to the brokers
+	deviceAuth     *auth.DeviceAuthenticator // authenticates devices on ingestion, nil if disabled
+	wsClients      wsRegistry                // websocket connections of the devices
+	wsSessions     wsSessions                // websocket sessions resumed across connections
+	wsDownlink     *wsDownlink               // commands for the websocket devices, nil if disabled
+	presence       presenceTracker           // connection state of the websocket devices
+	reconciler     *runtimer.Reconciler      // converges the containers to the desired apps, nil if disabled
 
 	logger *zerolog.Logger
 	ctx    context.Context
@@ -29,21 +40,99 @@ func (a *application) run(ctx context.Context, r *gin.Engine) error {
 		return err
 	}
 
+	// Start polling the data sources
+	if err := a.startInputs(ctx); err != nil {
+		return err
+	}
+
+	// Converge the containers to the desired apps
+	if err := a.startDeployment(ctx); err != nil {
+		return err
+	}
+
+	// Subscribe to the commands sent to the websocket devices
+	stopDownlink, err := a.startWSDownlink()
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if err := stopDownlink(); err != nil {
+			a.logger.Error().Err(err).Msg("failed to stop websocket downlink")
+		}
+	}()
+
+	// Start the local ingestion of the containers
+	stopUnixSockets, err := a.startUnixSockets()
+	if err != nil {
+		return err
+	}
+	defer stopUnixSockets()
+
+	// Start the embedded MQTT server for devices
+	mqttServer, err := a.startMQTTService()
+	if err != nil {
+		return err
+	}
+	if mqttServer != nil {
+		defer func() {
+			if err := mqttServer.Stop(); err != nil {
+				a.logger.Error().Err(err).Msg("failed to stop mqtt server")
+			}
+		}()
+	}
+
+	// Start the gRPC ingestion service
+	grpcServer, err := a.startGRPCService()
+	if err != nil {
+		return err
+	}
+	if grpcServer != nil {
+		defer grpcServer.Stop()
+	}
+
+	// Start the CoAP server for constrained devices
+	coapServer, err := a.startCoAPService()
+	if err != nil {
+		return err
+	}
+	if coapServer != nil {
+		defer func() {
+			if err := coapServer.Stop(); err != nil {
+				a.logger.Error().Err(err).Msg("failed to stop coap server")
+			}
+		}()
+	}
+
+	tlsConfig, err := newTLSConfig(a.config.APIService.TLS)
+	if err != nil {
+		return err
+	}
+
 	srv := &http.Server{
 		Addr:         a.config.APIService.Address,
 		Handler:      r,
+		TLSConfig:    tlsConfig,
 		WriteTimeout: 30 * time.Second,
 		ReadTimeout:  10 * time.Second,
 		IdleTimeout:  time.Minute,
 	}
 
 	a.ctx = ctx
+	if a.config.APIService.AdminToken == "" {
+		a.logger.Warn().Msg("apiService.adminToken is not set, the endpoints requiring it, e.g. /v1/containers, are disabled")
+	}
 	a.logger.Info().Str("address", a.config.APIService.Address).Msg("starting server")
 
 	// Start server in a goroutine
 	serverErr := make(chan error, 1)
 	go func() {
-		if err := srv.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+		var err error
+		if tlsConfig != nil {
+			err = srv.ListenAndServeTLS(a.config.APIService.TLS.CertFile, a.config.APIService.TLS.KeyFile)
+		} else {
+			err = srv.ListenAndServe()
+		}
+		if err != nil && err != http.ErrServerClosed {
 			serverErr <- err
 		}
 	}()
@@ -67,3 +156,29 @@ func (a *application) run(ctx context.Context, r *gin.Engine) error {
 		return nil
 	}
 }
+
+// newTLSConfig returns the TLS configuration of the API server, or nil if TLS is disabled.
+// Client certificates are verified when a client CA is configured.
+func newTLSConfig(cfg *config.TLSYAML) (*tls.Config, error) {
+	if cfg == nil {
+		return nil, nil
+	}
+
+	tlsConfig := &tls.Config{MinVersion: tls.VersionTLS12}
+	if cfg.ClientCAFile == "" {
+		return tlsConfig, nil
+	}
+
+	caPEM, err := os.ReadFile(cfg.ClientCAFile)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read client CA file '%s': %w", cfg.ClientCAFile, err)
+	}
+	pool := x509.NewCertPool()
+	if !pool.AppendCertsFromPEM(caPEM) {
+		return nil, fmt.Errorf("no certificate found in client CA file '%s'", cfg.ClientCAFile)
+	}
+
+	tlsConfig.ClientCAs = pool
+	tlsConfig.ClientAuth = tls.VerifyClientCertIfGiven
+	return tlsConfig, nil
+}
@@ -0,0 +1,20 @@
+package main
+
+import (
+	"github.com/LincolnG4/iot-hydra/internal/listeners/coap"
+)
+
+// startCoAPService starts the CoAP server when it is configured. Messages
+// published by the devices are submitted to the TelemetryAgent.
+func (a *application) startCoAPService() (*coap.Server, error) {
+	if a.config.CoAPService == nil {
+		return nil, nil
+	}
+
+	srv, err := coap.NewServer(*a.config.CoAPService, a.TelemetryAgent, a.logger)
+	if err != nil {
+		return nil, err
+	}
+	srv.Start()
+	return srv, nil
+}
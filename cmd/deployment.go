@@ -0,0 +1,73 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"net/http"
+
+	"github.com/LincolnG4/iot-hydra/internal/config"
+	"github.com/LincolnG4/iot-hydra/internal/runtimer"
+	"github.com/LincolnG4/iot-hydra/internal/utils"
+	"github.com/gin-gonic/gin"
+)
+
+type deploymentPayload struct {
+	Apps []config.AppYAML `json:"apps" validate:"unique=Name,dive"`
+}
+
+// startDeployment starts reconciling the desired apps until ctx is done. It does
+// nothing if the deployment is not configured.
+func (a *application) startDeployment(ctx context.Context) error {
+	if a.config.Deployment == nil {
+		return nil
+	}
+
+	runtime, ok := a.PodmanRuntime.(runtimer.AppRuntime)
+	if !ok {
+		return errors.New("deployment requires a runtime able to list the app containers")
+	}
+	reconciler, err := runtimer.NewReconciler(*a.config.Deployment, runtime, socketMounts(a.config.APIService.UnixSockets), a.logger)
+	if err != nil {
+		return err
+	}
+	a.reconciler = reconciler
+	go reconciler.Run(ctx)
+	return nil
+}
+
+// getDeployment returns the desired apps and their status after the last reconciliation.
+func (a *application) getDeployment(c *gin.Context) {
+	if a.reconciler == nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "deployment is not configured"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"apps": a.reconciler.Apps(), "status": a.reconciler.Status()})
+}
+
+// putDeployment replaces the desired apps and starts their reconciliation.
+func (a *application) putDeployment(c *gin.Context) {
+	if a.reconciler == nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "deployment is not configured"})
+		return
+	}
+
+	var payload deploymentPayload
+	if err := c.ShouldBindJSON(&payload); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid request payload", "details": err.Error()})
+		return
+	}
+	if err := utils.Validate.Struct(&payload); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid deployment", "details": utils.FormatValidationErrors(err)})
+		return
+	}
+
+	if err := a.reconciler.SetApps(payload.Apps); err != nil {
+		a.logger.Error().Err(err).Msg("failed to update deployment")
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to update deployment", "details": err.Error()})
+		return
+	}
+
+	a.logger.Info().Int("apps", len(payload.Apps)).Msg("deployment updated")
+	c.JSON(http.StatusAccepted, gin.H{"status": "deployment accepted", "apps": payload.Apps})
+}
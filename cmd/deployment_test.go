@@ -0,0 +1,115 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/LincolnG4/iot-hydra/internal/config"
+	"github.com/LincolnG4/iot-hydra/internal/runtimer"
+	"github.com/gin-gonic/gin"
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newDeploymentRouter(t *testing.T, cfg config.DeploymentYAML) (*gin.Engine, *runtimer.Reconciler) {
+	t.Helper()
+	gin.SetMode(gin.TestMode)
+	logger := zerolog.Nop()
+	reconciler, err := runtimer.NewReconciler(cfg, new(runtimer.MockPodmanManager), nil, &logger)
+	require.NoError(t, err)
+
+	app := &application{
+		PodmanRuntime: new(runtimer.MockPodmanManager),
+		logger:        &logger,
+		reconciler:    reconciler,
+		config:        &config.ConfigYAML{APIService: config.Service{Address: ":0", AdminToken: testAdminToken}},
+	}
+	return app.routes(), reconciler
+}
+
+func TestGetDeployment(t *testing.T) {
+	r, _ := newDeploymentRouter(t, config.DeploymentYAML{Apps: []config.AppYAML{{Name: "foo", Image: "docker/foo"}}})
+
+	req := newAdminRequest(http.MethodGet, "/v1/deployment", nil)
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	require.Equal(t, http.StatusOK, w.Code)
+
+	var body struct {
+		Apps   []config.AppYAML     `json:"apps"`
+		Status []runtimer.AppStatus `json:"status"`
+	}
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &body))
+	assert.Equal(t, []config.AppYAML{{Name: "foo", Image: "docker/foo"}}, body.Apps)
+	assert.Empty(t, body.Status)
+}
+
+func TestPutDeployment(t *testing.T) {
+	r, reconciler := newDeploymentRouter(t, config.DeploymentYAML{})
+
+	// 0 replicas stops the app
+	body := `{"apps": [{"name": "collector", "image": "docker.io/acme/collector:1.2", "replicas": 0, "ports": [{"hostPort": 8080, "containerPort": 80}]}]}`
+	req := newAdminRequest(http.MethodPut, "/v1/deployment", strings.NewReader(body))
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	require.Equal(t, http.StatusAccepted, w.Code)
+
+	replicas := 0
+	assert.Equal(t, []config.AppYAML{{
+		Name:     "collector",
+		Image:    "docker.io/acme/collector:1.2",
+		Replicas: &replicas,
+		Ports:    []config.AppPortYAML{{HostPort: 8080, ContainerPort: 80}},
+	}}, reconciler.Apps())
+}
+
+func TestPutDeployment_Invalid(t *testing.T) {
+	r, reconciler := newDeploymentRouter(t, config.DeploymentYAML{})
+
+	for _, body := range []string{
+		`{`,
+		`{"apps": [{"name": "foo"}]}`,
+		`{"apps": [{"name": "Foo_1", "image": "bar"}]}`,
+		`{"apps": [{"name": "foo", "image": "bar"}, {"name": "foo", "image": "baz"}]}`,
+		`{"apps": [{"name": "foo", "image": "bar", "replicas": -1}]}`,
+		`{"apps": [{"name": "foo", "image": "bar", "volumes": [{"source": "/srv", "destination": "data"}]}]}`,
+	} {
+		req := newAdminRequest(http.MethodPut, "/v1/deployment", strings.NewReader(body))
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		assert.Equal(t, http.StatusBadRequest, w.Code, body)
+	}
+	assert.Empty(t, reconciler.Apps())
+}
+
+func TestDeployment_RequiresAdmin(t *testing.T) {
+	r, reconciler := newDeploymentRouter(t, config.DeploymentYAML{})
+
+	req := httptest.NewRequest(http.MethodPut, "/v1/deployment", strings.NewReader(`{"apps": [{"name": "foo", "image": "bar"}]}`))
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusUnauthorized, w.Code)
+	assert.Empty(t, reconciler.Apps())
+
+	w = httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/v1/deployment", nil))
+	assert.Equal(t, http.StatusUnauthorized, w.Code)
+}
+
+func TestDeployment_NotConfigured(t *testing.T) {
+	r := newTestRouter(new(runtimer.MockPodmanManager))
+
+	req := newAdminRequest(http.MethodGet, "/v1/deployment", nil)
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusNotFound, w.Code)
+
+	req = newAdminRequest(http.MethodPut, "/v1/deployment", strings.NewReader(`{"apps": []}`))
+	w = httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusNotFound, w.Code)
+}
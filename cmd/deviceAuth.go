@@ -0,0 +1,63 @@
+package main
+
+import (
+	"net/http"
+	"net/url"
+	"slices"
+
+	"github.com/LincolnG4/iot-hydra/internal/auth"
+	"github.com/gin-gonic/gin"
+)
+
+const deviceIDKey = "device_id"
+
+// authenticateDevice is a middleware that rejects requests without valid device
+// credentials and stores the authenticated device ID in the context.
+// It does nothing when device authentication is not configured or the caller is
+// a local container.
+func (a *application) authenticateDevice(c *gin.Context) {
+	// Containers on the unix sockets are identified by their cgroup
+	if a.deviceAuth == nil || c.GetString(containerKey) != "" {
+		c.Next()
+		return
+	}
+
+	deviceID, err := a.deviceAuth.Authenticate(auth.DeviceCredentialsFromRequest(c.Request))
+	if err != nil {
+		a.logger.Warn().Err(err).Str("remote_addr", c.Request.RemoteAddr).Msg("device authentication failed")
+		c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.Set(deviceIDKey, deviceID)
+	c.Next()
+}
+
+// mismatchPolicy returns the policy for the messages whose device_id doesn't match
+// the authenticated device.
+func (a *application) mismatchPolicy() string {
+	if a.config.APIService.DeviceAuth == nil {
+		return auth.MismatchReject
+	}
+	return a.config.APIService.DeviceAuth.Mismatch
+}
+
+// checkOrigin accepts websocket requests from the configured origins. If none is
+// configured, only requests without Origin or from the same host are accepted.
+func (a *application) checkOrigin(r *http.Request) bool {
+	origin := r.Header.Get("Origin")
+	if origin == "" {
+		return true
+	}
+
+	allowed := a.config.APIService.AllowedOrigins
+	if len(allowed) > 0 {
+		return slices.Contains(allowed, "*") || slices.Contains(allowed, origin)
+	}
+
+	u, err := url.Parse(origin)
+	if err != nil {
+		return false
+	}
+	return u.Host == r.Host
+}
@@ -0,0 +1,61 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/LincolnG4/iot-hydra/internal/auth"
+	"github.com/LincolnG4/iot-hydra/internal/config"
+	"github.com/gin-gonic/gin"
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newDeviceAuthApp(t *testing.T, mismatch string) *application {
+	t.Helper()
+
+	deviceAuthCfg := &config.DeviceAuthYAML{
+		Methods:  []string{"token"},
+		Tokens:   []config.DeviceTokenYAML{{DeviceID: "dev1", Token: "t1"}},
+		Mismatch: mismatch,
+	}
+	deviceAuth, err := auth.NewDeviceAuthenticator(*deviceAuthCfg)
+	require.NoError(t, err)
+
+	logger := zerolog.Nop()
+	return &application{
+		logger:     &logger,
+		deviceAuth: deviceAuth,
+		config: &config.ConfigYAML{
+			APIService: config.Service{Address: ":0", DeviceAuth: deviceAuthCfg},
+		},
+	}
+}
+
+func TestWebsocket_Unauthorized(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	r := newDeviceAuthApp(t, "").routes()
+
+	req := httptest.NewRequest(http.MethodGet, "/v1/ws", nil)
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusUnauthorized, w.Code)
+}
+
+func TestCheckOrigin(t *testing.T) {
+	a := newDeviceAuthApp(t, "")
+
+	req := httptest.NewRequest(http.MethodGet, "http://gateway:8080/v1/ws", nil)
+	assert.True(t, a.checkOrigin(req), "requests without origin are allowed")
+
+	req.Header.Set("Origin", "http://gateway:8080")
+	assert.True(t, a.checkOrigin(req), "same origin is allowed")
+
+	req.Header.Set("Origin", "http://evil.com")
+	assert.False(t, a.checkOrigin(req))
+
+	a.config.APIService.AllowedOrigins = []string{"http://evil.com"}
+	assert.True(t, a.checkOrigin(req))
+}
@@ -0,0 +1,41 @@
+package main
+
+import (
+	"crypto/tls"
+	"fmt"
+
+	"github.com/LincolnG4/iot-hydra/internal/listeners/grpc"
+)
+
+// startGRPCService starts the gRPC ingestion service when it is configured. It
+// shares the TelemetryAgent and the device authentication of the API service.
+func (a *application) startGRPCService() (*grpc.Server, error) {
+	cfg := a.config.GRPCService
+	if cfg == nil {
+		return nil, nil
+	}
+
+	tlsConfig, err := newTLSConfig(cfg.TLS)
+	if err != nil {
+		return nil, err
+	}
+	if tlsConfig != nil {
+		cert, err := tls.LoadX509KeyPair(cfg.TLS.CertFile, cfg.TLS.KeyFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to load grpc certificate '%s': %w", cfg.TLS.CertFile, err)
+		}
+		tlsConfig.Certificates = []tls.Certificate{cert}
+	}
+
+	opts := grpc.Options{DeviceAuth: a.deviceAuth, TLSConfig: tlsConfig}
+	if a.config.APIService.DeviceAuth != nil {
+		opts.Mismatch = a.config.APIService.DeviceAuth.Mismatch
+	}
+
+	srv, err := grpc.NewServer(*cfg, a.TelemetryAgent, opts, a.logger)
+	if err != nil {
+		return nil, err
+	}
+	srv.Start()
+	return srv, nil
+}
@@ -18,8 +18,8 @@ func (a *application) healthChecker(c *gin.Context) {
 	// Add queue health if telemetry agent is available
 	if a.TelemetryAgent != nil {
 		health["telemetry"] = map[string]interface{}{
-			"queue_length":      len(a.TelemetryAgent.Queue),
-			"queue_capacity":    cap(a.TelemetryAgent.Queue),
+			"queue_length":      a.TelemetryAgent.Queue.Len(),
+			"queue_capacity":    a.TelemetryAgent.Queue.Cap(),
 			"brokers_connected": len(a.TelemetryAgent.Brokers),
 		}
 	}
@@ -0,0 +1,46 @@
+package main
+
+import (
+	"time"
+
+	"github.com/LincolnG4/iot-hydra/internal/agent"
+	"github.com/LincolnG4/iot-hydra/internal/auth"
+	"github.com/LincolnG4/iot-hydra/internal/message"
+	"github.com/gin-gonic/gin"
+)
+
+// ingest stamps the message received from a device, checks it against the
+// authenticated device of the request and submits it to the TelemetryAgent.
+func (a *application) ingest(c *gin.Context, msg *message.Message, idPrefix string) error {
+	return a.submitMessage(c.GetString(deviceIDKey), c.GetString(containerKey), msg, idPrefix, nil)
+}
+
+// submitMessage stamps the message with its ID, time and the local container
+// that sent it, checks it against the authenticated device and submits it to
+// the TelemetryAgent. A local container is the device of its messages, so they
+// are bound to its name. The container metadata is only set from the peer of
+// the unix socket, never taken from the client. The delivery of the message is
+// reported to deliver when it is not nil.
+func (a *application) submitMessage(deviceID, container string, msg *message.Message, idPrefix string, deliver agent.DeliveryFunc) error {
+	msg.ID = message.NewID(idPrefix)
+	msg.Timestamp = time.Now()
+
+	delete(msg.Metadata, containerKey)
+	if container != "" {
+		msg.SetMetadata(containerKey, container)
+		if deviceID == "" {
+			deviceID = container
+		}
+	}
+
+	if err := auth.BindDevice(deviceID, a.mismatchPolicy(), msg); err != nil {
+		a.logger.Warn().Str("message", msg.ID).Str("device_id", msg.DeviceID).Str("authenticated_device", deviceID).Msg("device_id doesn't match the authenticated device")
+		return err
+	}
+
+	if err := a.TelemetryAgent.SubmitWithDelivery(msg, deliver); err != nil {
+		a.logger.Error().Err(err).Str("message", msg.ID).Str("device_id", msg.DeviceID).Str("topic", msg.Topic).Msg("failed to enqueue publish job")
+		return err
+	}
+	return nil
+}
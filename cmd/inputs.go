@@ -0,0 +1,68 @@
+package main
+
+import (
+	"context"
+	"errors"
+
+	"github.com/LincolnG4/iot-hydra/internal/inputs/hostmetrics"
+	"github.com/LincolnG4/iot-hydra/internal/inputs/modbus"
+	"github.com/LincolnG4/iot-hydra/internal/inputs/tail"
+	"github.com/LincolnG4/iot-hydra/internal/runtimer"
+)
+
+// startInputs starts polling the configured data sources until ctx is done. Their
+// readings are submitted to the TelemetryAgent.
+func (a *application) startInputs(ctx context.Context) error {
+	if a.config.Inputs == nil {
+		return nil
+	}
+
+	for _, slave := range a.config.Inputs.Modbus {
+		poller, err := modbus.NewPoller(slave, a.TelemetryAgent, a.logger)
+		if err != nil {
+			return err
+		}
+		go poller.Run(ctx)
+	}
+
+	for _, cfg := range a.config.Inputs.Tail {
+		tailer, err := tail.NewTailer(cfg, a.TelemetryAgent, a.logger)
+		if err != nil {
+			return err
+		}
+		go tailer.Run(ctx)
+	}
+
+	if cfg := a.config.Inputs.HostMetrics; cfg != nil {
+		collector, err := hostmetrics.NewCollector(*cfg, a.TelemetryAgent, a.logger)
+		if err != nil {
+			return err
+		}
+		go collector.Run(ctx)
+	}
+
+	if cfg := a.config.Inputs.ContainerLogs; cfg != nil {
+		source, ok := a.PodmanRuntime.(runtimer.LogSource)
+		if !ok {
+			return errors.New("container logs require a runtime able to follow the logs")
+		}
+		collector, err := runtimer.NewLogCollector(*cfg, source, a.TelemetryAgent, a.logger)
+		if err != nil {
+			return err
+		}
+		go collector.Run(ctx)
+	}
+
+	if cfg := a.config.Inputs.ContainerStats; cfg != nil {
+		source, ok := a.PodmanRuntime.(runtimer.StatsSource)
+		if !ok {
+			return errors.New("container stats require a runtime able to read the stats")
+		}
+		collector, err := runtimer.NewStatsCollector(*cfg, source, a.TelemetryAgent, a.logger)
+		if err != nil {
+			return err
+		}
+		go collector.Run(ctx)
+	}
+	return nil
+}
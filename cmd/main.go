@@ -7,6 +7,7 @@ import (
 	"os/signal"
 	"syscall"
 
+	"github.com/LincolnG4/iot-hydra/internal/auth"
 	"github.com/LincolnG4/iot-hydra/internal/config"
 	"github.com/LincolnG4/iot-hydra/internal/observability"
 	"github.com/LincolnG4/iot-hydra/internal/runtimer"
@@ -41,6 +42,16 @@ func main() {
 		os.Exit(1)
 	}
 
+	// Device authentication of the ingestion endpoints
+	var deviceAuth *auth.DeviceAuthenticator
+	if cfg.APIService.DeviceAuth != nil {
+		deviceAuth, err = auth.NewDeviceAuthenticator(*cfg.APIService.DeviceAuth)
+		if err != nil {
+			log.Error().Err(err).Msg("failed to configure device authentication")
+			os.Exit(1)
+		}
+	}
+
 	// OpenTelemetry setup
 	log.Debug().Msg("starting opentelemetry")
 	otelShutdown, err := observability.SetupOTelSDK(ctx)
@@ -78,6 +89,7 @@ func main() {
 		PodmanRuntime: &podmanRuntime,
 		logger:        &logger,
 		config:        &cfg,
+		deviceAuth:    deviceAuth,
 	}
 
 	mux := app.routes()
@@ -0,0 +1,23 @@
+package main
+
+import (
+	"github.com/LincolnG4/iot-hydra/internal/listeners/mqtt"
+)
+
+// startMQTTService starts the embedded MQTT server when it is configured.
+// Messages published by the devices are submitted to the TelemetryAgent.
+func (a *application) startMQTTService() (*mqtt.Server, error) {
+	if a.config.MQTTService == nil {
+		return nil, nil
+	}
+
+	srv, err := mqtt.NewServer(*a.config.MQTTService, a.TelemetryAgent, a.logger)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := srv.Start(); err != nil {
+		return nil, err
+	}
+	return srv, nil
+}
@@ -4,12 +4,87 @@ import (
 	"net/http"
 
 	"github.com/LincolnG4/iot-hydra/internal/runtimer"
+	"github.com/LincolnG4/iot-hydra/internal/utils"
 	"github.com/gin-gonic/gin"
 )
 
 type newContainerPayload struct {
 	Name  string `json:"name" uri:"name"`
-	Image string `json:"image"`
+	Image string `json:"image" validate:"required"`
+
+	Env        map[string]string `json:"env,omitempty" validate:"dive,keys,required,excludesall==,endkeys"`
+	Ports      []portPayload     `json:"ports,omitempty" validate:"dive"`
+	Volumes    []volumePayload   `json:"volumes,omitempty" validate:"dive"`
+	Command    []string          `json:"command,omitempty"`
+	Entrypoint []string          `json:"entrypoint,omitempty"`
+	Labels     map[string]string `json:"labels,omitempty" validate:"dive,keys,required,endkeys"`
+	// no, always, on-failure or unless-stopped
+	RestartPolicy  string `json:"restartPolicy,omitempty" validate:"omitempty,oneof=no always on-failure unless-stopped"`
+	RestartRetries uint   `json:"restartRetries,omitempty" validate:"excluded_unless=RestartPolicy on-failure"`
+	// bridge, host, none, private, slirp4netns or pasta
+	NetworkMode string `json:"networkMode,omitempty" validate:"omitempty,oneof=bridge host none private slirp4netns pasta"`
+	User        string `json:"user,omitempty"`
+	// Host devices, e.g. /dev/ttyUSB0 or /dev/ttyUSB0:/dev/ttyS0:rw
+	Devices   []string          `json:"devices,omitempty" validate:"dive,startswith=/dev/"`
+	Resources *resourcesPayload `json:"resources,omitempty"`
+}
+
+type portPayload struct {
+	HostIP        string `json:"hostIp,omitempty" validate:"omitempty,ip"`
+	HostPort      uint16 `json:"hostPort,omitempty"`
+	ContainerPort uint16 `json:"containerPort" validate:"required"`
+	// tcp (default), udp or sctp
+	Protocol string `json:"protocol,omitempty" validate:"omitempty,oneof=tcp udp sctp"`
+}
+
+type volumePayload struct {
+	// bind (default) mounts the host path Source, volume mounts the named volume Source
+	Type        string `json:"type,omitempty" validate:"omitempty,oneof=bind volume"`
+	Source      string `json:"source" validate:"required"`
+	Destination string `json:"destination" validate:"required,startswith=/"`
+	ReadOnly    bool   `json:"readOnly,omitempty"`
+}
+
+type resourcesPayload struct {
+	// Number of CPUs, e.g. 0.5
+	CPUs        float64 `json:"cpus,omitempty" validate:"gte=0"`
+	MemoryBytes int64   `json:"memoryBytes,omitempty" validate:"gte=0"`
+}
+
+// container returns the runtimer container of the payload.
+func (p newContainerPayload) container() runtimer.Container {
+	container := runtimer.Container{
+		Name:           p.Name,
+		Image:          p.Image,
+		Env:            p.Env,
+		Command:        p.Command,
+		Entrypoint:     p.Entrypoint,
+		Labels:         p.Labels,
+		RestartPolicy:  p.RestartPolicy,
+		RestartRetries: p.RestartRetries,
+		NetworkMode:    p.NetworkMode,
+		User:           p.User,
+		Devices:        p.Devices,
+	}
+	for _, port := range p.Ports {
+		container.Ports = append(container.Ports, runtimer.PortMapping(port))
+	}
+	for _, v := range p.Volumes {
+		mountType := v.Type
+		if mountType == "" {
+			mountType = runtimer.MountBind
+		}
+		container.Mounts = append(container.Mounts, runtimer.Mount{
+			Type:        mountType,
+			Source:      v.Source,
+			Destination: v.Destination,
+			ReadOnly:    v.ReadOnly,
+		})
+	}
+	if p.Resources != nil {
+		container.Resources = &runtimer.Resources{CPUs: p.Resources.CPUs, MemoryBytes: p.Resources.MemoryBytes}
+	}
+	return container
 }
 
 // createContaiener deploys new podman container from image.
@@ -21,12 +96,14 @@ func (a *application) createContainer(c *gin.Context) {
 		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid request payload", "details": err.Error()})
 		return
 	}
-
-	container := runtimer.Container{
-		Name:  newContainer.Name,
-		Image: newContainer.Image,
+	if err := utils.Validate.Struct(&newContainer); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid container spec", "details": utils.FormatValidationErrors(err)})
+		return
 	}
 
+	container := newContainer.container()
+	container.Mounts = append(container.Mounts, socketMounts(a.config.APIService.UnixSockets)...)
+
 	if err := a.PodmanRuntime.CreateContainer(container); err != nil {
 		a.logger.Error().Err(err).Str("container_name", container.Name).Str("image", container.Image).Msg("failed to create container")
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to create container", "details": err.Error()})
@@ -3,8 +3,10 @@ package main
 import (
 	"bytes"
 	"encoding/json"
+	"io"
 	"net/http"
 	"net/http/httptest"
+	"strings"
 	"testing"
 
 	"github.com/LincolnG4/iot-hydra/internal/config"
@@ -12,6 +14,7 @@ import (
 	"github.com/gin-gonic/gin"
 	"github.com/rs/zerolog"
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
 )
 
 func newTestRouter(m *runtimer.MockPodmanManager) *gin.Engine {
@@ -22,20 +25,46 @@ func newTestRouter(m *runtimer.MockPodmanManager) *gin.Engine {
 		logger:        &logger,
 		config: &config.ConfigYAML{
 			APIService: config.Service{
-				Address: ":0",
+				Address:    ":0",
+				AdminToken: testAdminToken,
 			},
 		},
 	}
 	return app.routes()
 }
 
+const testAdminToken = "secret"
+
+// newAdminRequest returns a request authenticated with the admin token of newTestRouter.
+func newAdminRequest(method, target string, body io.Reader) *http.Request {
+	req := httptest.NewRequest(method, target, body)
+	req.Header.Set("Authorization", "Bearer "+testAdminToken)
+	return req
+}
+
+func TestContainers_RequireAdmin(t *testing.T) {
+	m := new(runtimer.MockPodmanManager)
+	r := newTestRouter(m)
+
+	for _, req := range []*http.Request{
+		httptest.NewRequest(http.MethodGet, "/v1/containers/", nil),
+		httptest.NewRequest(http.MethodPost, "/v1/containers/", strings.NewReader(`{"name": "foo", "image": "docker/bar", "volumes": [{"source": "/", "destination": "/host"}]}`)),
+		httptest.NewRequest(http.MethodDelete, "/v1/containers/alpha", nil),
+	} {
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		assert.Equal(t, http.StatusUnauthorized, w.Code, req.Method)
+	}
+	m.AssertNotCalled(t, "CreateContainer", mock.Anything)
+}
+
 func TestCreateContainer_Success(t *testing.T) {
 	m := new(runtimer.MockPodmanManager)
 	r := newTestRouter(m)
 
 	payload := newContainerPayload{Name: "foo", Image: "docker/bar"}
 	body, _ := json.Marshal(payload)
-	req := httptest.NewRequest(http.MethodPost, "/v1/containers/", bytes.NewReader(body))
+	req := newAdminRequest(http.MethodPost, "/v1/containers/", bytes.NewReader(body))
 	w := httptest.NewRecorder()
 
 	m.On("CreateContainer", runtimer.Container{Name: "foo", Image: "docker/bar"}).Return(nil).Once()
@@ -44,11 +73,82 @@ func TestCreateContainer_Success(t *testing.T) {
 	assert.Equal(t, http.StatusCreated, w.Code)
 }
 
+func TestCreateContainer_FullSpec(t *testing.T) {
+	m := new(runtimer.MockPodmanManager)
+	r := newTestRouter(m)
+
+	body := `{
+		"name": "collector",
+		"image": "docker.io/acme/collector:1.2",
+		"env": {"LOG_LEVEL": "debug"},
+		"ports": [{"hostPort": 8080, "containerPort": 80}, {"hostIp": "127.0.0.1", "hostPort": 5020, "containerPort": 502, "protocol": "udp"}],
+		"volumes": [{"source": "/srv/data", "destination": "/data", "readOnly": true}, {"type": "volume", "source": "cache", "destination": "/cache"}],
+		"command": ["--interval", "5s"],
+		"entrypoint": ["/bin/collector"],
+		"labels": {"app": "collector"},
+		"restartPolicy": "on-failure",
+		"restartRetries": 3,
+		"networkMode": "host",
+		"user": "1000:1000",
+		"devices": ["/dev/ttyUSB0"],
+		"resources": {"cpus": 0.5, "memoryBytes": 134217728}
+	}`
+	m.On("CreateContainer", runtimer.Container{
+		Name:       "collector",
+		Image:      "docker.io/acme/collector:1.2",
+		Env:        map[string]string{"LOG_LEVEL": "debug"},
+		Ports:      []runtimer.PortMapping{{HostPort: 8080, ContainerPort: 80}, {HostIP: "127.0.0.1", HostPort: 5020, ContainerPort: 502, Protocol: "udp"}},
+		Command:    []string{"--interval", "5s"},
+		Entrypoint: []string{"/bin/collector"},
+		Labels:     map[string]string{"app": "collector"},
+		Mounts: []runtimer.Mount{
+			{Type: runtimer.MountBind, Source: "/srv/data", Destination: "/data", ReadOnly: true},
+			{Type: runtimer.MountVolume, Source: "cache", Destination: "/cache"},
+		},
+		RestartPolicy:  "on-failure",
+		RestartRetries: 3,
+		NetworkMode:    "host",
+		User:           "1000:1000",
+		Devices:        []string{"/dev/ttyUSB0"},
+		Resources:      &runtimer.Resources{CPUs: 0.5, MemoryBytes: 134217728},
+	}).Return(nil).Once()
+
+	req := newAdminRequest(http.MethodPost, "/v1/containers/", strings.NewReader(body))
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusCreated, w.Code)
+	m.AssertExpectations(t)
+}
+
+func TestCreateContainer_InvalidSpec(t *testing.T) {
+	m := new(runtimer.MockPodmanManager)
+	r := newTestRouter(m)
+
+	for _, body := range []string{
+		`{"name": "foo"}`,
+		`{"image": "bar", "restartPolicy": "sometimes"}`,
+		`{"image": "bar", "restartPolicy": "always", "restartRetries": 2}`,
+		`{"image": "bar", "ports": [{"hostPort": 80}]}`,
+		`{"image": "bar", "ports": [{"containerPort": 80, "hostIp": "localhost"}]}`,
+		`{"image": "bar", "volumes": [{"source": "/srv", "destination": "data"}]}`,
+		`{"image": "bar", "networkMode": "overlay"}`,
+		`{"image": "bar", "devices": ["ttyUSB0"]}`,
+		`{"image": "bar", "env": {"A=B": "c"}}`,
+		`{"image": "bar", "resources": {"cpus": -1}}`,
+	} {
+		req := newAdminRequest(http.MethodPost, "/v1/containers/", strings.NewReader(body))
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		assert.Equal(t, http.StatusBadRequest, w.Code, body)
+	}
+	m.AssertNotCalled(t, "CreateContainer", mock.Anything)
+}
+
 func TestCreateContainer_BadJSON(t *testing.T) {
 	m := new(runtimer.MockPodmanManager)
 	r := newTestRouter(m)
 
-	req := httptest.NewRequest(http.MethodPost, "/v1/containers/", bytes.NewBufferString("{"))
+	req := newAdminRequest(http.MethodPost, "/v1/containers/", bytes.NewBufferString("{"))
 	w := httptest.NewRecorder()
 	r.ServeHTTP(w, req)
 	assert.Equal(t, http.StatusBadRequest, w.Code)
@@ -60,7 +160,7 @@ func TestCheckContainer_Success(t *testing.T) {
 
 	m.On("CheckContainer", "alpha").Return(runtimer.Container{Name: "alpha", Image: "img", State: "running"}, nil).Once()
 
-	req := httptest.NewRequest(http.MethodGet, "/v1/containers/alpha", nil)
+	req := newAdminRequest(http.MethodGet, "/v1/containers/alpha", nil)
 	w := httptest.NewRecorder()
 	r.ServeHTTP(w, req)
 	assert.Equal(t, http.StatusOK, w.Code)
@@ -71,19 +171,19 @@ func TestStartStopDelete_Success(t *testing.T) {
 	r := newTestRouter(m)
 
 	m.On("StartContainer", "alpha").Return(nil).Once()
-	reqStart := httptest.NewRequest(http.MethodPost, "/v1/containers/alpha/start", nil)
+	reqStart := newAdminRequest(http.MethodPost, "/v1/containers/alpha/start", nil)
 	w := httptest.NewRecorder()
 	r.ServeHTTP(w, reqStart)
 	assert.Equal(t, http.StatusCreated, w.Code)
 
 	m.On("StopContainer", "alpha").Return(nil).Once()
-	reqStop := httptest.NewRequest(http.MethodPost, "/v1/containers/alpha/stop", nil)
+	reqStop := newAdminRequest(http.MethodPost, "/v1/containers/alpha/stop", nil)
 	w = httptest.NewRecorder()
 	r.ServeHTTP(w, reqStop)
 	assert.Equal(t, http.StatusCreated, w.Code)
 
 	m.On("DeleteContainer", "alpha").Return(nil).Once()
-	reqDel := httptest.NewRequest(http.MethodDelete, "/v1/containers/alpha", nil)
+	reqDel := newAdminRequest(http.MethodDelete, "/v1/containers/alpha", nil)
 	w = httptest.NewRecorder()
 	r.ServeHTTP(w, reqDel)
 	assert.Equal(t, http.StatusCreated, w.Code)
@@ -96,7 +196,7 @@ func TestListContainers_Success(t *testing.T) {
 	list := []runtimer.Container{{Name: "a", Image: "i1", State: "running"}, {Name: "b", Image: "i2", State: "exited"}}
 	m.On("ListContainers").Return(list, nil).Once()
 
-	req := httptest.NewRequest(http.MethodGet, "/v1/containers/", nil)
+	req := newAdminRequest(http.MethodGet, "/v1/containers/", nil)
 	w := httptest.NewRecorder()
 	r.ServeHTTP(w, req)
 	assert.Equal(t, http.StatusOK, w.Code)
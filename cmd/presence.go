@@ -0,0 +1,187 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"net"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/LincolnG4/iot-hydra/internal/message"
+	"github.com/gin-gonic/gin"
+	"github.com/gorilla/websocket"
+)
+
+// Presence events and the reasons of the disconnections.
+const (
+	presenceConnected    = "connected"
+	presenceDisconnected = "disconnected"
+
+	disconnectNormal   = "normal"   // close frame sent by the device
+	disconnectAbnormal = "abnormal" // connection lost or protocol error
+	disconnectTimeout  = "timeout"  // no message nor pong within the read timeout
+	disconnectEvicted  = "evicted"  // closed by an admin or a resumed session
+)
+
+// devicePresence is the connection state of a device.
+type devicePresence struct {
+	DeviceID             string    `json:"device_id"`
+	Online               bool      `json:"online"`
+	Connections          int       `json:"connections"`
+	LastConnectedAt      time.Time `json:"last_connected_at"`
+	LastDisconnectedAt   time.Time `json:"last_disconnected_at,omitzero"`
+	LastDisconnectReason string    `json:"last_disconnect_reason,omitempty"`
+}
+
+// presenceEvent is published when a device goes online or offline.
+type presenceEvent struct {
+	DeviceID  string    `json:"device_id"`
+	Event     string    `json:"event"`
+	Reason    string    `json:"reason,omitempty"`
+	Timestamp time.Time `json:"timestamp"`
+}
+
+// presenceTracker keeps the presence of the devices seen since the start.
+type presenceTracker struct {
+	mu      sync.Mutex
+	devices map[string]*devicePresence
+}
+
+// connected records a connection of the device. It returns true if the device
+// was offline.
+func (p *presenceTracker) connected(deviceID string, now time.Time) bool {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.devices == nil {
+		p.devices = make(map[string]*devicePresence)
+	}
+	d, found := p.devices[deviceID]
+	if !found {
+		d = &devicePresence{DeviceID: deviceID}
+		p.devices[deviceID] = d
+	}
+	d.Connections++
+	d.LastConnectedAt = now
+	wasOffline := !d.Online
+	d.Online = true
+	return wasOffline
+}
+
+// disconnected records the end of a connection of the device. It returns true if
+// it was the last connection of the device.
+func (p *presenceTracker) disconnected(deviceID, reason string, now time.Time) bool {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	d, found := p.devices[deviceID]
+	if !found || d.Connections == 0 {
+		return false
+	}
+	d.Connections--
+	d.LastDisconnectedAt = now
+	d.LastDisconnectReason = reason
+	d.Online = d.Connections > 0
+	return !d.Online
+}
+
+func (p *presenceTracker) get(deviceID string) (devicePresence, bool) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	d, found := p.devices[deviceID]
+	if !found {
+		return devicePresence{}, false
+	}
+	return *d, true
+}
+
+// disconnectReason classifies the read error that ended a websocket connection.
+func disconnectReason(err error) string {
+	var netErr net.Error
+	switch {
+	case errors.As(err, &netErr) && netErr.Timeout():
+		return disconnectTimeout
+	case websocket.IsCloseError(err, websocket.CloseNormalClosure, websocket.CloseGoingAway):
+		return disconnectNormal
+	default:
+		return disconnectAbnormal
+	}
+}
+
+// deviceOnline is called once the device of the connection is known. It records
+// its presence and sends the commands it missed.
+func (a *application) deviceOnline(client *wsClient) {
+	deviceID := client.deviceID()
+	if deviceID == "" || client.online.Swap(true) {
+		return
+	}
+
+	now := time.Now()
+	if a.presence.connected(deviceID, now) {
+		a.publishPresence(presenceEvent{DeviceID: deviceID, Event: presenceConnected, Timestamp: now})
+	}
+	a.flushCommands(client)
+}
+
+// deviceOffline records the end of the connection and sends its last will when
+// the connection didn't end properly.
+func (a *application) deviceOffline(c *gin.Context, client *wsClient, reason string) {
+	if !client.online.Load() {
+		return
+	}
+	deviceID := client.deviceID()
+
+	if will := client.will.Load(); will != nil && (reason == disconnectAbnormal || reason == disconnectTimeout) {
+		if will.DeviceID == "" {
+			will.DeviceID = deviceID
+		}
+		if err := a.submitMessage(c.GetString(deviceIDKey), client.container, will, "will", nil); err != nil {
+			a.logger.Error().Err(err).Str("device_id", deviceID).Str("topic", will.Topic).Msg("failed to send last will")
+		}
+	}
+
+	now := time.Now()
+	if a.presence.disconnected(deviceID, reason, now) {
+		a.publishPresence(presenceEvent{DeviceID: deviceID, Event: presenceDisconnected, Reason: reason, Timestamp: now})
+	}
+}
+
+// publishPresence submits the event to the TelemetryAgent when presence events
+// are configured.
+func (a *application) publishPresence(event presenceEvent) {
+	cfg := a.config.APIService.Websocket.Presence
+	if cfg == nil {
+		return
+	}
+
+	payload, err := json.Marshal(event)
+	if err != nil {
+		a.logger.Error().Err(err).Str("device_id", event.DeviceID).Msg("failed to encode presence event")
+		return
+	}
+
+	msg := &message.Message{
+		ID:            message.NewID("presence"),
+		DeviceID:      event.DeviceID,
+		Timestamp:     event.Timestamp,
+		Payload:       payload,
+		Topic:         strings.ReplaceAll(cfg.Topic, devicePlaceholder, event.DeviceID),
+		TargetBrokers: cfg.TargetBrokers,
+	}
+	if err := a.TelemetryAgent.Submit(msg); err != nil {
+		a.logger.Error().Err(err).Str("device_id", event.DeviceID).Str("event", event.Event).Msg("failed to publish presence event")
+	}
+}
+
+// getPresence returns the presence of the device.
+func (a *application) getPresence(c *gin.Context) {
+	presence, found := a.presence.get(c.Param("id"))
+	if !found {
+		c.JSON(http.StatusNotFound, gin.H{"error": "device was never connected"})
+		return
+	}
+	c.JSON(http.StatusOK, presence)
+}
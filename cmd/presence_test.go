@@ -0,0 +1,111 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/LincolnG4/iot-hydra/internal/config"
+	"github.com/gin-gonic/gin"
+	"github.com/gorilla/websocket"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPresenceTracker(t *testing.T) {
+	var p presenceTracker
+	now := time.Now()
+
+	assert.True(t, p.connected("dev1", now))
+	assert.False(t, p.connected("dev1", now), "already online")
+	assert.False(t, p.disconnected("dev1", disconnectEvicted, now), "still has a connection")
+	assert.True(t, p.disconnected("dev1", disconnectTimeout, now))
+	assert.False(t, p.disconnected("dev2", disconnectNormal, now), "never connected")
+
+	presence, found := p.get("dev1")
+	require.True(t, found)
+	assert.False(t, presence.Online)
+	assert.Equal(t, disconnectTimeout, presence.LastDisconnectReason)
+}
+
+func TestDisconnectReason(t *testing.T) {
+	assert.Equal(t, disconnectNormal, disconnectReason(&websocket.CloseError{Code: websocket.CloseNormalClosure}))
+	assert.Equal(t, disconnectNormal, disconnectReason(&websocket.CloseError{Code: websocket.CloseGoingAway}))
+	assert.Equal(t, disconnectAbnormal, disconnectReason(&websocket.CloseError{Code: websocket.CloseAbnormalClosure}))
+	assert.Equal(t, disconnectAbnormal, disconnectReason(errors.New("connection reset by peer")))
+	assert.Equal(t, disconnectTimeout, disconnectReason(os.ErrDeadlineExceeded))
+}
+
+func TestPresence_RequiresAdmin(t *testing.T) {
+	a := newTestAgentApp(t)
+	a.presence.connected("dev1", time.Now())
+	a.config.APIService.AdminToken = "secret"
+	r := a.routes()
+
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/v1/devices/dev1/presence", nil))
+	assert.Equal(t, http.StatusUnauthorized, w.Code)
+
+	req := httptest.NewRequest(http.MethodGet, "/v1/devices/dev1/presence", nil)
+	req.Header.Set("Authorization", "Bearer secret")
+	w = httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusOK, w.Code)
+}
+
+func TestWebsocket_PresenceAndWill(t *testing.T) {
+	a := newTestAgentApp(t)
+	a.config.APIService.Websocket.Presence = &config.PresenceYAML{Topic: "devices/{device}/presence", TargetBrokers: []string{"fake"}}
+
+	getPresence := func() devicePresence {
+		r := gin.New()
+		r.GET("/v1/devices/:id/presence", a.getPresence)
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/v1/devices/dev1/presence", nil))
+		require.Equal(t, http.StatusOK, w.Code)
+
+		var presence devicePresence
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &presence))
+		return presence
+	}
+	nextEvent := func() presenceEvent {
+		msg := popQueued(t, a)
+		require.Equal(t, "devices/dev1/presence", msg.Topic)
+		var event presenceEvent
+		require.NoError(t, json.Unmarshal(msg.Payload, &event))
+		return event
+	}
+
+	// The device is online with its first message, then registers its last will
+	conn := dialWebsocket(t, a, "")
+	require.NoError(t, conn.WriteJSON(gin.H{"device_id": "dev1", "topic": "t"}))
+	require.NoError(t, conn.WriteJSON(gin.H{"will": true, "topic": "devices/dev1/status", "payload": gin.H{"online": false}}))
+	popQueued(t, a)
+	assert.Equal(t, presenceConnected, nextEvent().Event)
+	assert.True(t, getPresence().Online)
+
+	// Lost connection sends the will
+	require.NoError(t, conn.UnderlyingConn().Close())
+	will := popQueued(t, a)
+	assert.Equal(t, "devices/dev1/status", will.Topic)
+	assert.Equal(t, "dev1", will.DeviceID)
+	event := nextEvent()
+	assert.Equal(t, presenceDisconnected, event.Event)
+	assert.Equal(t, disconnectAbnormal, event.Reason)
+	assert.False(t, getPresence().Online)
+
+	// Normal close doesn't
+	conn = dialWebsocket(t, a, "")
+	require.NoError(t, conn.WriteJSON(gin.H{"device_id": "dev1", "topic": "t"}))
+	require.NoError(t, conn.WriteJSON(gin.H{"will": true, "topic": "devices/dev1/status"}))
+	popQueued(t, a)
+	assert.Equal(t, presenceConnected, nextEvent().Event)
+	require.NoError(t, conn.WriteMessage(websocket.CloseMessage, websocket.FormatCloseMessage(websocket.CloseNormalClosure, "")))
+	event = nextEvent()
+	assert.Equal(t, disconnectNormal, event.Reason)
+	assert.Equal(t, disconnectNormal, getPresence().LastDisconnectReason)
+}
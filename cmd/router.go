@@ -16,8 +16,8 @@ func (a *application) routes() *gin.Engine {
 	{
 		v1 := router.Group("/v1")
 		{
-			// Podman Route
-			containers := v1.Group("/containers")
+			// Podman Route, requires the admin token as containers can use the host
+			containers := v1.Group("/containers", a.requireAdmin)
 			containers.POST("/", a.createContainer)           // Create Container
 			containers.GET("/", a.listContainer)              // List all containers
 			containers.GET("/:name", a.checkContainer)        // Check status container
@@ -25,13 +25,40 @@ func (a *application) routes() *gin.Engine {
 			containers.POST("/:name/stop", a.stopContainer)   // Stop container
 			containers.DELETE("/:name", a.deleteContainer)    // Delete container
 
+			// Desired apps converged by the reconciler, requires the admin token
+			deployment := v1.Group("/deployment", a.requireAdmin)
+			deployment.GET("", a.getDeployment) // Desired apps and their status
+			deployment.PUT("", a.putDeployment) // Replace the desired apps
+
+			// JSON Schemas used to validate payloads per topic, requires the admin token
+			schemas := v1.Group("/schemas", a.requireAdmin)
+			schemas.GET("/", a.listSchemas)     // List schemas
+			schemas.PUT("/", a.registerSchema)  // Register or replace a schema
+			schemas.DELETE("/", a.deleteSchema) // Remove the schema of ?topic=
+
 			// health endpoint
 			health := v1.Group("/health")
 			health.GET("/", a.healthChecker) // Check Health
 
 			// websocket message driven
-			iotAgent := v1.Group("/ws")
+			iotAgent := v1.Group("/ws", a.authenticateDevice)
 			iotAgent.GET("", a.websocketIoTHandler) // Websocket message driven
+
+			// Connection state of the websocket devices, requires the admin token
+			devices := v1.Group("/devices", a.requireAdmin)
+			devices.GET("/:id/presence", a.getPresence)
+
+			// HTTP ingestion of single or batch messages
+			telemetry := v1.Group("/telemetry", a.authenticateDevice)
+			telemetry.POST("", a.postTelemetry)
+
+			// Live stream of the routed messages, requires the admin token
+			v1.GET("/telemetry/tail", a.requireAdmin, a.tailTelemetry)
+
+			// Administration of the connected devices, requires the admin token
+			admin := v1.Group("/admin", a.requireAdmin)
+			admin.GET("/connections", a.listConnections)                // List websocket connections
+			admin.DELETE("/connections/:device_id", a.disconnectDevice) // Disconnect all connections of the device
 		}
 
 	}
@@ -0,0 +1,64 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+type schemaPayload struct {
+	Topic  string          `json:"topic" binding:"required"`
+	Schema json.RawMessage `json:"schema" binding:"required"`
+}
+
+// listSchemas returns all JSON Schemas registered by topic pattern.
+func (a *application) listSchemas(c *gin.Context) {
+	if a.TelemetryAgent == nil {
+		c.JSON(http.StatusServiceUnavailable, gin.H{"error": "telemetry agent is not running"})
+		return
+	}
+
+	schemas := a.TelemetryAgent.Schemas.List()
+	c.JSON(http.StatusOK, gin.H{"schemas": schemas, "count": len(schemas)})
+}
+
+// registerSchema adds or replaces the JSON Schema of a topic pattern.
+func (a *application) registerSchema(c *gin.Context) {
+	if a.TelemetryAgent == nil {
+		c.JSON(http.StatusServiceUnavailable, gin.H{"error": "telemetry agent is not running"})
+		return
+	}
+
+	var payload schemaPayload
+	if err := c.ShouldBindJSON(&payload); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid request payload", "details": err.Error()})
+		return
+	}
+
+	if err := a.TelemetryAgent.Schemas.Register(payload.Topic, payload.Schema); err != nil {
+		a.logger.Error().Err(err).Str("topic", payload.Topic).Msg("failed to register schema")
+		c.JSON(http.StatusBadRequest, gin.H{"error": "failed to register schema", "details": err.Error()})
+		return
+	}
+
+	a.logger.Info().Str("topic", payload.Topic).Msg("schema registered")
+	c.JSON(http.StatusCreated, gin.H{"status": "schema registered", "topic": payload.Topic})
+}
+
+// deleteSchema removes the JSON Schema of the topic pattern given in the query.
+func (a *application) deleteSchema(c *gin.Context) {
+	if a.TelemetryAgent == nil {
+		c.JSON(http.StatusServiceUnavailable, gin.H{"error": "telemetry agent is not running"})
+		return
+	}
+
+	topic := c.Query("topic")
+	if !a.TelemetryAgent.Schemas.Remove(topic) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "schema not found", "topic": topic})
+		return
+	}
+
+	a.logger.Info().Str("topic", topic).Msg("schema removed")
+	c.JSON(http.StatusOK, gin.H{"status": "schema removed", "topic": topic})
+}
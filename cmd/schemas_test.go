@@ -0,0 +1,27 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/LincolnG4/iot-hydra/internal/runtimer"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSchemas_RequireAdmin(t *testing.T) {
+	r := newTestRouter(new(runtimer.MockPodmanManager))
+	body := `{"topic": "sensors.>", "schema": {"type": "object"}}`
+
+	for _, method := range []string{http.MethodGet, http.MethodPut, http.MethodDelete} {
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, httptest.NewRequest(method, "/v1/schemas/?topic=sensors.>", strings.NewReader(body)))
+		assert.Equal(t, http.StatusUnauthorized, w.Code, method)
+
+		// The admin reaches the handler, which has no agent here
+		w = httptest.NewRecorder()
+		r.ServeHTTP(w, newAdminRequest(method, "/v1/schemas/?topic=sensors.>", strings.NewReader(body)))
+		assert.Equal(t, http.StatusServiceUnavailable, w.Code, method)
+	}
+}
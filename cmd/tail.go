@@ -0,0 +1,126 @@
+package main
+
+import (
+	"io"
+	"maps"
+	"math/rand/v2"
+	"net/http"
+	"slices"
+	"strconv"
+	"sync/atomic"
+	"time"
+
+	"github.com/LincolnG4/iot-hydra/internal/message"
+	"github.com/gin-gonic/gin"
+	"golang.org/x/time/rate"
+)
+
+const (
+	defaultTailRate = 100 // messages per second
+	maxTailRate     = 1000
+	tailBufferSize  = 256
+	tailDropsPeriod = 5 * time.Second
+)
+
+// tailFilter selects the routed messages streamed by the tail.
+type tailFilter struct {
+	deviceID string
+	topic    string // pattern with wildcards
+	broker   string
+	sample   float64 // fraction of the matching messages
+}
+
+func (f tailFilter) match(msg *message.Message) bool {
+	if f.deviceID != "" && msg.DeviceID != f.deviceID {
+		return false
+	}
+	if f.topic != "" && !message.MatchTopic(f.topic, msg.Topic) {
+		return false
+	}
+	if f.broker != "" && !slices.Contains(msg.TargetBrokers, f.broker) {
+		return false
+	}
+	return f.sample >= 1 || rand.Float64() < f.sample
+}
+
+// tailTelemetry streams the messages routed to the brokers as server-sent events,
+// filtered by the device_id, topic and broker query parameters. Only the sample
+// fraction of the matching messages is kept, up to rate messages per second;
+// messages over the limit are dropped and counted in "dropped" events.
+func (a *application) tailTelemetry(c *gin.Context) {
+	filter := tailFilter{
+		deviceID: c.Query("device_id"),
+		topic:    c.Query("topic"),
+		broker:   c.Query("broker"),
+		sample:   1,
+	}
+	if s := c.Query("sample"); s != "" {
+		sample, err := strconv.ParseFloat(s, 64)
+		if err != nil || sample <= 0 || sample > 1 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "sample must be a fraction in (0, 1]"})
+			return
+		}
+		filter.sample = sample
+	}
+	limit := defaultTailRate
+	if r := c.Query("rate"); r != "" {
+		n, err := strconv.Atoi(r)
+		if err != nil || n <= 0 || n > maxTailRate {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "rate must be between 1 and " + strconv.Itoa(maxTailRate)})
+			return
+		}
+		limit = n
+	}
+
+	// The stream outlives the write timeout of the server
+	if err := http.NewResponseController(c.Writer).SetWriteDeadline(time.Time{}); err != nil {
+		a.logger.Warn().Err(err).Msg("failed to clear the write deadline of the tail")
+	}
+
+	// Copies are streamed, the dispatcher keeps routing the originals
+	messages := make(chan message.Message, tailBufferSize)
+	limiter := rate.NewLimiter(rate.Limit(limit), limit)
+	var dropped atomic.Int64
+	remove := a.TelemetryAgent.Tap(func(msg *message.Message) {
+		if !filter.match(msg) {
+			return
+		}
+		if !limiter.Allow() {
+			dropped.Add(1)
+			return
+		}
+		m := *msg
+		m.Metadata = maps.Clone(msg.Metadata)
+		select {
+		case messages <- m:
+		default:
+			dropped.Add(1)
+		}
+	})
+	defer remove()
+
+	a.logger.Info().Str("remote_addr", c.Request.RemoteAddr).Str("device_id", filter.deviceID).Str("topic", filter.topic).Str("broker", filter.broker).Msg("telemetry tail started")
+	ticker := time.NewTicker(tailDropsPeriod)
+	defer ticker.Stop()
+
+	// Send the headers now, the client waits for them until the first event
+	c.Header("Content-Type", "text/event-stream")
+	c.Header("Cache-Control", "no-cache")
+	c.Status(http.StatusOK)
+	c.Writer.Flush()
+
+	c.Stream(func(w io.Writer) bool {
+		select {
+		case msg := <-messages:
+			c.SSEvent("message", msg)
+		case <-ticker.C:
+			if n := dropped.Swap(0); n > 0 {
+				c.SSEvent("dropped", gin.H{"count": n})
+			}
+		case <-c.Request.Context().Done():
+			return false
+		}
+		return true
+	})
+	a.logger.Info().Str("remote_addr", c.Request.RemoteAddr).Msg("telemetry tail ended")
+}
@@ -0,0 +1,78 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/LincolnG4/iot-hydra/internal/message"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestTailFilter(t *testing.T) {
+	msg := &message.Message{DeviceID: "dev1", Topic: "sensors/dev1/temp", TargetBrokers: []string{"cloud"}}
+
+	assert.True(t, tailFilter{sample: 1}.match(msg))
+	assert.True(t, tailFilter{deviceID: "dev1", topic: "sensors/#", broker: "cloud", sample: 1}.match(msg))
+	assert.False(t, tailFilter{deviceID: "dev2", sample: 1}.match(msg))
+	assert.False(t, tailFilter{topic: "alarms/#", sample: 1}.match(msg))
+	assert.False(t, tailFilter{broker: "archive", sample: 1}.match(msg))
+}
+
+func TestTailTelemetry(t *testing.T) {
+	a := newTestAgentApp(t)
+	a.config.APIService.AdminToken = "secret"
+	srv := httptest.NewServer(a.routes())
+	defer srv.Close()
+
+	resp, err := http.Get(srv.URL + "/v1/telemetry/tail")
+	require.NoError(t, err)
+	resp.Body.Close()
+	assert.Equal(t, http.StatusUnauthorized, resp.StatusCode)
+
+	req, err := http.NewRequest(http.MethodGet, srv.URL+"/v1/telemetry/tail?topic=sensors/%23&broker=fake", nil)
+	require.NoError(t, err)
+	req.Header.Set("Authorization", "Bearer secret")
+	resp, err = http.DefaultClient.Do(req)
+	require.NoError(t, err)
+	defer resp.Body.Close()
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+
+	// The tap is registered once the stream started
+	route := func() {
+		require.NoError(t, a.TelemetryAgent.RouteMessage(&message.Message{ID: "other", Topic: "alarms/a", TargetBrokers: []string{"fake"}}))
+		require.NoError(t, a.TelemetryAgent.RouteMessage(&message.Message{ID: "tailed", Topic: "sensors/a", TargetBrokers: []string{"fake"}}))
+	}
+	done := make(chan struct{})
+	defer close(done)
+	go func() {
+		for {
+			select {
+			case <-done:
+				return
+			case <-time.After(20 * time.Millisecond):
+				route()
+			}
+		}
+	}()
+
+	reader := bufio.NewReader(resp.Body)
+	for {
+		line, err := reader.ReadString('\n')
+		require.NoError(t, err)
+		data, found := strings.CutPrefix(line, "data:")
+		if !found {
+			continue
+		}
+
+		var msg message.Message
+		require.NoError(t, json.Unmarshal([]byte(data), &msg))
+		assert.Equal(t, "tailed", msg.ID)
+		return
+	}
+}
@@ -0,0 +1,120 @@
+package main
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+
+	"github.com/LincolnG4/iot-hydra/internal/agent"
+	"github.com/LincolnG4/iot-hydra/internal/message"
+	"github.com/gin-gonic/gin"
+)
+
+// maxTelemetryBodySize limits the decompressed body of the ingestion requests.
+const maxTelemetryBodySize = 10 << 20
+
+const (
+	statusAccepted = "accepted"
+	statusRejected = "rejected"
+)
+
+// telemetryResult is the outcome of one message sent to POST /v1/telemetry.
+type telemetryResult struct {
+	Index  int    `json:"index"`
+	ID     string `json:"id,omitempty"`
+	Status string `json:"status"`
+	Error  string `json:"error,omitempty"`
+}
+
+// postTelemetry receives a message or a JSON array of messages and submits them
+// to the TelemetryAgent. Gzip bodies are accepted with Content-Encoding: gzip.
+// It responds 202 if all messages were accepted, otherwise 207 with the result
+// of each message.
+func (a *application) postTelemetry(c *gin.Context) {
+	msgs, err := readTelemetryBody(c.Request)
+	if err != nil {
+		a.logger.Error().Err(err).Msg("failed to read telemetry payload")
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid request payload", "details": err.Error()})
+		return
+	}
+
+	results := make([]telemetryResult, 0, len(msgs))
+	allAccepted := true
+	for i, msg := range msgs {
+		result := telemetryResult{Index: i, Status: statusAccepted}
+		if msg == nil {
+			results = append(results, telemetryResult{Index: i, Status: statusRejected, Error: "empty message"})
+			allAccepted = false
+			continue
+		}
+
+		err := a.ingest(c, msg, "http")
+		result.ID = msg.ID
+
+		switch {
+		case err == nil:
+		case agent.IsQueued(err):
+			// Tagged or deadlettered messages were still accepted
+			result.Error = err.Error()
+		default:
+			result.Status = statusRejected
+			result.Error = err.Error()
+			allAccepted = false
+		}
+		results = append(results, result)
+	}
+
+	statusCode := http.StatusAccepted
+	if !allAccepted {
+		statusCode = http.StatusMultiStatus
+	}
+	c.JSON(statusCode, gin.H{"results": results, "count": len(results)})
+}
+
+// readTelemetryBody decodes a single message or an array of messages from the body.
+func readTelemetryBody(r *http.Request) ([]*message.Message, error) {
+	var body io.Reader = r.Body
+	switch strings.ToLower(r.Header.Get("Content-Encoding")) {
+	case "":
+	case "gzip":
+		gz, err := gzip.NewReader(r.Body)
+		if err != nil {
+			return nil, fmt.Errorf("invalid gzip body: %w", err)
+		}
+		defer gz.Close()
+		body = gz
+	default:
+		return nil, fmt.Errorf("content encoding '%s' is not supported", r.Header.Get("Content-Encoding"))
+	}
+
+	raw, err := io.ReadAll(io.LimitReader(body, maxTelemetryBodySize+1))
+	if err != nil {
+		return nil, err
+	}
+	if len(raw) > maxTelemetryBodySize {
+		return nil, fmt.Errorf("body is larger than %d bytes", maxTelemetryBodySize)
+	}
+
+	raw = bytes.TrimSpace(raw)
+	if len(raw) > 0 && raw[0] == '[' {
+		var msgs []*message.Message
+		if err := json.Unmarshal(raw, &msgs); err != nil {
+			return nil, err
+		}
+		if len(msgs) == 0 {
+			return nil, errors.New("no message in the request")
+		}
+		return msgs, nil
+	}
+
+	var msg message.Message
+	if err := json.Unmarshal(raw, &msg); err != nil {
+		return nil, err
+	}
+	return []*message.Message{&msg}, nil
+}
@@ -0,0 +1,136 @@
+package main
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/LincolnG4/iot-hydra/internal/agent"
+	"github.com/LincolnG4/iot-hydra/internal/brokers"
+	"github.com/LincolnG4/iot-hydra/internal/config"
+	"github.com/LincolnG4/iot-hydra/internal/message"
+	"github.com/gin-gonic/gin"
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// fakeBroker accepts all messages and keeps the handler of the last subscription.
+type fakeBroker struct {
+	name    string
+	mu      sync.Mutex
+	handler func(*message.Message)
+}
+
+func (f *fakeBroker) Name() string                                    { return f.name }
+func (f *fakeBroker) Type() string                                    { return "fake" }
+func (f *fakeBroker) Connect() error                                  { return nil }
+func (f *fakeBroker) Stop() error                                     { return nil }
+func (f *fakeBroker) Publish(context.Context, *message.Message) error { return nil }
+func (f *fakeBroker) SubscribeAndWait(string, time.Duration) (*message.Message, error) {
+	return nil, nil
+}
+func (f *fakeBroker) Subscribe(_ string, handler func(*message.Message)) (func() error, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.handler = handler
+	return func() error { return nil }, nil
+}
+
+// deliver sends the message to the subscription.
+func (f *fakeBroker) deliver(msg *message.Message) {
+	f.mu.Lock()
+	handler := f.handler
+	f.mu.Unlock()
+	handler(msg)
+}
+
+// newTestAgentApp returns an application with a telemetry agent that is not started,
+// so submitted messages stay in its queue.
+func newTestAgentApp(t *testing.T) *application {
+	t.Helper()
+	gin.SetMode(gin.TestMode)
+
+	logger := zerolog.Nop()
+	ctx, cancel := context.WithCancel(context.Background())
+	t.Cleanup(cancel)
+
+	ag, err := agent.NewTelemetryAgentWithBrokers(ctx,
+		&config.TelemetryAgentYAML{QueueSize: 10, MaxWorkers: 1},
+		map[string]brokers.Broker{"fake": &fakeBroker{name: "fake"}},
+		&logger,
+	)
+	require.NoError(t, err)
+	require.NoError(t, ag.Schemas.Register("strict/#", []byte(`{"type": "object", "required": ["v"]}`)))
+
+	return &application{
+		TelemetryAgent: ag,
+		logger:         &logger,
+		config:         &config.ConfigYAML{APIService: config.Service{Address: ":0"}},
+	}
+}
+
+func TestPostTelemetry(t *testing.T) {
+	gzipBody := func(s string) *bytes.Buffer {
+		var buf bytes.Buffer
+		gz := gzip.NewWriter(&buf)
+		_, _ = gz.Write([]byte(s))
+		_ = gz.Close()
+		return &buf
+	}
+
+	tests := []struct {
+		name       string
+		body       *bytes.Buffer
+		encoding   string
+		statusCode int
+		statuses   []string
+	}{
+		{"single message", bytes.NewBufferString(`{"device_id": "dev1", "topic": "t"}`), "", http.StatusAccepted, []string{statusAccepted}},
+		{
+			"batch with rejected message",
+			bytes.NewBufferString(`[{"topic": "t"}, {"topic": "strict/a", "payload": "e30="}, null]`), "",
+			http.StatusMultiStatus, []string{statusAccepted, statusRejected, statusRejected},
+		},
+		{"gzip batch", gzipBody(`[{"topic": "t"}, {"topic": "t"}]`), "gzip", http.StatusAccepted, []string{statusAccepted, statusAccepted}},
+		{"invalid json", bytes.NewBufferString(`{`), "", http.StatusBadRequest, nil},
+		{"invalid gzip", bytes.NewBufferString(`{}`), "gzip", http.StatusBadRequest, nil},
+		{"empty batch", bytes.NewBufferString(`[]`), "", http.StatusBadRequest, nil},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			a := newTestAgentApp(t)
+			req := httptest.NewRequest(http.MethodPost, "/v1/telemetry", tt.body)
+			if tt.encoding != "" {
+				req.Header.Set("Content-Encoding", tt.encoding)
+			}
+			w := httptest.NewRecorder()
+			a.routes().ServeHTTP(w, req)
+			assert.Equal(t, tt.statusCode, w.Code)
+
+			if tt.statuses == nil {
+				return
+			}
+			var resp struct {
+				Results []telemetryResult `json:"results"`
+			}
+			require.NoError(t, json.Unmarshal(w.Body.Bytes(), &resp))
+			accepted := 0
+			for i, result := range resp.Results {
+				assert.Equal(t, tt.statuses[i], result.Status)
+				if result.Status == statusAccepted {
+					assert.NotEmpty(t, result.ID)
+					accepted++
+				}
+			}
+			assert.Equal(t, accepted, a.TelemetryAgent.Queue.Len())
+		})
+	}
+}
@@ -0,0 +1,214 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"net"
+	"net/http"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/LincolnG4/iot-hydra/internal/agent"
+	"github.com/LincolnG4/iot-hydra/internal/config"
+	"github.com/LincolnG4/iot-hydra/internal/listeners/unixsock"
+	"github.com/LincolnG4/iot-hydra/internal/message"
+	"github.com/LincolnG4/iot-hydra/internal/runtimer"
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	containerKey = "container"
+
+	unixModeWebsocket = "websocket"
+	unixModeLines     = "lines"
+
+	// maxLineSize limits the messages of the lines mode
+	maxLineSize = 1 << 20
+)
+
+type containerCtxKey struct{}
+
+// startUnixSockets serves the ingestion on the configured unix sockets. The
+// returned function stops all of them.
+func (a *application) startUnixSockets() (func(), error) {
+	resolver := unixsock.NewResolver(func(id string) (string, error) {
+		c, err := a.PodmanRuntime.CheckContainer(id)
+		return c.Name, err
+	})
+
+	var stops []func()
+	stopAll := func() {
+		for _, stop := range stops {
+			stop()
+		}
+	}
+
+	for _, socket := range a.config.APIService.UnixSockets {
+		listener, err := unixsock.Listen(socket.Path)
+		if err != nil {
+			stopAll()
+			return nil, err
+		}
+
+		a.logger.Info().Str("path", socket.Path).Str("mode", socket.Mode).Msg("starting unix socket")
+		if socket.Mode == unixModeLines {
+			stops = append(stops, a.serveLines(listener, resolver))
+		} else {
+			stops = append(stops, a.serveUnixHTTP(listener, resolver))
+		}
+	}
+	return stopAll, nil
+}
+
+// serveUnixHTTP serves the websocket and HTTP ingestion endpoints on the listener.
+func (a *application) serveUnixHTTP(listener net.Listener, resolver *unixsock.Resolver) func() {
+	srv := &http.Server{
+		Handler:     a.unixRoutes(),
+		ReadTimeout: 10 * time.Second,
+		ConnContext: func(ctx context.Context, conn net.Conn) context.Context {
+			return context.WithValue(ctx, containerCtxKey{}, a.peerContainer(resolver, conn))
+		},
+	}
+
+	go func() {
+		if err := srv.Serve(listener); err != nil && err != http.ErrServerClosed {
+			a.logger.Error().Err(err).Str("path", listener.Addr().String()).Msg("unix socket server failed")
+		}
+	}()
+
+	return func() {
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		if err := srv.Shutdown(ctx); err != nil {
+			a.logger.Error().Err(err).Str("path", listener.Addr().String()).Msg("failed to stop unix socket server")
+		}
+	}
+}
+
+// unixRoutes only exposes the ingestion endpoints to the local containers.
+func (a *application) unixRoutes() *gin.Engine {
+	router := gin.New()
+	router.Use(gin.Recovery(), a.identifyContainer)
+
+	v1 := router.Group("/v1", a.authenticateDevice)
+	v1.GET("/ws", a.websocketIoTHandler)
+	v1.POST("/telemetry", a.postTelemetry)
+	return router
+}
+
+// identifyContainer stores the container of the unix socket peer in the context.
+func (a *application) identifyContainer(c *gin.Context) {
+	if name, _ := c.Request.Context().Value(containerCtxKey{}).(string); name != "" {
+		c.Set(containerKey, name)
+	}
+	c.Next()
+}
+
+// peerContainer returns the name of the container connected to the socket, or ""
+// if the peer is not a known container.
+func (a *application) peerContainer(resolver *unixsock.Resolver, conn net.Conn) string {
+	name, err := resolver.ContainerName(conn)
+	if err != nil {
+		a.logger.Debug().Err(err).Msg("unix socket peer is not identified")
+		return ""
+	}
+	return name
+}
+
+// serveLines reads one JSON message per line and answers each one with a JSON line
+// holding its result.
+func (a *application) serveLines(listener net.Listener, resolver *unixsock.Resolver) func() {
+	var (
+		mu    sync.Mutex
+		conns = make(map[net.Conn]struct{})
+		wg    sync.WaitGroup
+	)
+
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				if !errors.Is(err, net.ErrClosed) {
+					a.logger.Error().Err(err).Str("path", listener.Addr().String()).Msg("failed to accept unix socket connection")
+				}
+				return
+			}
+
+			mu.Lock()
+			conns[conn] = struct{}{}
+			mu.Unlock()
+
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				a.handleLines(conn, a.peerContainer(resolver, conn))
+
+				mu.Lock()
+				delete(conns, conn)
+				mu.Unlock()
+			}()
+		}
+	}()
+
+	return func() {
+		listener.Close()
+		mu.Lock()
+		for conn := range conns {
+			conn.Close()
+		}
+		mu.Unlock()
+		wg.Wait()
+	}
+}
+
+// handleLines submits the messages of the connection until it is closed.
+func (a *application) handleLines(conn net.Conn, container string) {
+	defer conn.Close()
+
+	scanner := bufio.NewScanner(conn)
+	scanner.Buffer(make([]byte, 0, 64<<10), maxLineSize)
+	encoder := json.NewEncoder(conn)
+
+	for index := 0; scanner.Scan(); index++ {
+		result := telemetryResult{Index: index, Status: statusAccepted}
+
+		var msg message.Message
+		if err := json.Unmarshal(scanner.Bytes(), &msg); err != nil {
+			result.Status = statusRejected
+			result.Error = err.Error()
+		} else {
+			err := a.submitMessage("", container, &msg, "unix", nil)
+			result.ID = msg.ID
+			if err != nil {
+				result.Error = err.Error()
+				if !agent.IsQueued(err) {
+					result.Status = statusRejected
+				}
+			}
+		}
+
+		if err := encoder.Encode(result); err != nil {
+			a.logger.Error().Err(err).Str("container", container).Msg("failed to write unix socket result")
+			return
+		}
+	}
+
+	if err := scanner.Err(); err != nil && !errors.Is(err, net.ErrClosed) {
+		a.logger.Error().Err(err).Str("container", container).Msg("failed to read unix socket")
+	}
+}
+
+// socketMounts returns the mounts exposing the unix sockets to a new container.
+func socketMounts(sockets []config.UnixSocketYAML) []runtimer.Mount {
+	var mounts []runtimer.Mount
+	for _, socket := range sockets {
+		if socket.MountDir == "" {
+			continue
+		}
+		mounts = append(mounts, runtimer.Mount{Source: filepath.Dir(socket.Path), Destination: socket.MountDir})
+	}
+	return mounts
+}
@@ -0,0 +1,162 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/LincolnG4/iot-hydra/internal/agent"
+	"github.com/LincolnG4/iot-hydra/internal/auth"
+	"github.com/LincolnG4/iot-hydra/internal/brokers"
+	natsbroker "github.com/LincolnG4/iot-hydra/internal/brokers/nats"
+	"github.com/LincolnG4/iot-hydra/internal/config"
+	"github.com/LincolnG4/iot-hydra/internal/message"
+	"github.com/LincolnG4/iot-hydra/internal/runtimer"
+	"github.com/gin-gonic/gin"
+	"github.com/nats-io/nats.go"
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+func TestUnixSocket_Lines(t *testing.T) {
+	a := newTestAgentApp(t)
+	m := new(runtimer.MockPodmanManager)
+	// The test may run inside a container unknown to podman
+	m.On("CheckContainer", mock.Anything).Return(runtimer.Container{}, errors.New("no such container")).Maybe()
+	a.PodmanRuntime = m
+
+	path := filepath.Join(t.TempDir(), "agent.sock")
+	a.config.APIService.UnixSockets = []config.UnixSocketYAML{{Path: path, Mode: unixModeLines}}
+	stop, err := a.startUnixSockets()
+	require.NoError(t, err)
+	defer stop()
+
+	conn, err := net.Dial("unix", path)
+	require.NoError(t, err)
+	defer conn.Close()
+
+	_, err = conn.Write([]byte("{\"device_id\": \"dev1\", \"topic\": \"t\"}\n{\n{\"topic\": \"strict/a\", \"payload\": \"e30=\"}\n"))
+	require.NoError(t, err)
+
+	reader := bufio.NewReader(conn)
+	statuses := []string{statusAccepted, statusRejected, statusRejected}
+	for i, status := range statuses {
+		line, err := reader.ReadBytes('\n')
+		require.NoError(t, err)
+
+		var result telemetryResult
+		require.NoError(t, json.Unmarshal(line, &result))
+		assert.Equal(t, i, result.Index)
+		assert.Equal(t, status, result.Status)
+	}
+	assert.Equal(t, 1, a.TelemetryAgent.Queue.Len())
+}
+
+func TestSubmitMessage_Container(t *testing.T) {
+	a := newTestAgentApp(t)
+	c, _ := gin.CreateTestContext(httptest.NewRecorder())
+	c.Set(containerKey, "sensor-app")
+
+	msgs := []*message.Message{{Topic: "t"}, {DeviceID: "sensor-app", Topic: "t", Metadata: map[string]string{containerKey: "other-app"}}}
+	for _, msg := range msgs {
+		require.NoError(t, a.ingest(c, msg, "unix"))
+		assert.Equal(t, "sensor-app", msg.Metadata[containerKey])
+		assert.Equal(t, "sensor-app", msg.DeviceID)
+	}
+
+	// A container can't publish as another device
+	err := a.ingest(c, &message.Message{DeviceID: "dev1", Topic: "t"}, "unix")
+	assert.ErrorIs(t, err, auth.ErrDeviceMismatch)
+
+	a.config.APIService.DeviceAuth = &config.DeviceAuthYAML{Mismatch: auth.MismatchOverwrite}
+	msg := &message.Message{DeviceID: "dev1", Topic: "t"}
+	require.NoError(t, a.ingest(c, msg, "unix"))
+	assert.Equal(t, "sensor-app", msg.DeviceID)
+}
+
+func TestSubmitMessage_ForgedContainer(t *testing.T) {
+	a := newTestAgentApp(t)
+	c, _ := gin.CreateTestContext(httptest.NewRecorder())
+
+	msg := &message.Message{DeviceID: "dev1", Topic: "t", Metadata: map[string]string{containerKey: "sensor-app", "site": "a"}}
+	require.NoError(t, a.ingest(c, msg, "http"))
+	assert.Equal(t, map[string]string{"site": "a"}, msg.Metadata)
+}
+
+func TestUnixRoutes_SkipDeviceAuth(t *testing.T) {
+	a := newDeviceAuthApp(t, "")
+	a.TelemetryAgent = newTestAgentApp(t).TelemetryAgent
+
+	req := httptest.NewRequest(http.MethodPost, "/v1/telemetry", strings.NewReader(`{"topic": "t"}`))
+	w := httptest.NewRecorder()
+	a.unixRoutes().ServeHTTP(w, req)
+	assert.Equal(t, http.StatusUnauthorized, w.Code, "peers that are not containers must authenticate")
+
+	req = httptest.NewRequest(http.MethodPost, "/v1/telemetry", strings.NewReader(`{"topic": "t"}`))
+	req = req.WithContext(context.WithValue(req.Context(), containerCtxKey{}, "sensor-app"))
+	w = httptest.NewRecorder()
+	a.unixRoutes().ServeHTTP(w, req)
+	assert.Equal(t, http.StatusAccepted, w.Code)
+}
+
+func TestSocketMounts(t *testing.T) {
+	mounts := socketMounts([]config.UnixSocketYAML{
+		{Path: "/run/iot-hydra/agent.sock", MountDir: "/run/hydra"},
+		{Path: "/run/iot-hydra/lines.sock"},
+	})
+	assert.Equal(t, []runtimer.Mount{{Source: "/run/iot-hydra", Destination: "/run/hydra"}}, mounts)
+}
+
+// natsConn records the messages published by the NATS broker.
+type natsConn struct {
+	published chan *nats.Msg
+}
+
+func (c *natsConn) PublishMsg(msg *nats.Msg) error {
+	c.published <- msg
+	return nil
+}
+func (c *natsConn) SubscribeSync(string) (*nats.Subscription, error)              { return nil, nil }
+func (c *natsConn) Subscribe(string, nats.MsgHandler) (*nats.Subscription, error) { return nil, nil }
+func (c *natsConn) Close()                                                        {}
+
+func TestSubmitMessage_ContainerHeader(t *testing.T) {
+	logger := zerolog.Nop()
+	ctx, cancel := context.WithCancel(context.Background())
+	t.Cleanup(cancel)
+
+	conn := &natsConn{published: make(chan *nats.Msg, 1)}
+	ag, err := agent.NewTelemetryAgentWithBrokers(ctx,
+		&config.TelemetryAgentYAML{QueueSize: 10, MaxWorkers: 1},
+		map[string]brokers.Broker{"nats": natsbroker.NewBrokerWithConnector(natsbroker.Config{Name: "nats"}, conn)},
+		&logger,
+	)
+	require.NoError(t, err)
+	ag.StartWorkerPool()
+	ag.Start()
+
+	a := newTestAgentApp(t)
+	a.TelemetryAgent = ag
+	c, _ := gin.CreateTestContext(httptest.NewRecorder())
+	c.Set(containerKey, "sensor-app")
+	require.NoError(t, a.ingest(c, &message.Message{Topic: "t", TargetBrokers: []string{"nats"}, Payload: []byte("{}")}, "unix"))
+
+	// The container name reaches the broker as a header
+	select {
+	case msg := <-conn.published:
+		assert.Equal(t, "t", msg.Subject)
+		assert.Equal(t, "sensor-app", msg.Header.Get(containerKey))
+	case <-time.After(5 * time.Second):
+		t.Fatal("message was not published")
+	}
+}
@@ -1,51 +1,440 @@
 package main
 
 import (
+	"errors"
 	"fmt"
+	"net/http"
+	"slices"
+	"strconv"
+	"sync"
+	"sync/atomic"
 	"time"
 
+	"github.com/LincolnG4/iot-hydra/internal/agent"
+	"github.com/LincolnG4/iot-hydra/internal/auth"
+	"github.com/LincolnG4/iot-hydra/internal/config"
 	"github.com/LincolnG4/iot-hydra/internal/message"
 	"github.com/gin-gonic/gin"
 	"github.com/gorilla/websocket"
 )
 
-var wsupgrader = websocket.Upgrader{
-	ReadBufferSize:  1024,
-	WriteBufferSize: 1024,
+// Acknowledgement modes chosen by the client with the ack query parameter.
+const (
+	ackNone      = "none"      // fire-and-forget, only errors are sent back
+	ackQueued    = "queued"    // one ack per message once it is enqueued
+	ackPublished = "published" // also one ack per target broker once published
+)
+
+// Statuses of the websocket acks, besides statusRejected.
+const (
+	statusQueued    = "queued"
+	statusPublished = "published"
+	statusFailed    = "failed"
+	statusDropped   = "dropped"   // expired or filtered by its route
+	statusDuplicate = "duplicate" // sequence already received on the session
+	statusSession   = "session"   // state of the session, first frame of the connection
+	statusCommand   = "command"   // downlink command, not an ack
+	statusWill      = "will"      // last will registered
+)
+
+var ackModes = []string{ackNone, ackQueued, ackPublished}
+
+const (
+	defaultWSPingInterval   = 30 * time.Second
+	defaultWSWriteTimeout   = 10 * time.Second
+	defaultWSMaxMessageSize = 1 << 20
+	defaultWSSessionTTL     = 10 * time.Minute
+)
+
+// wsSettings returns the websocket configuration with the defaults applied.
+func wsSettings(cfg config.WebsocketYAML) config.WebsocketYAML {
+	if cfg.PingInterval == 0 {
+		cfg.PingInterval = defaultWSPingInterval
+	}
+	if cfg.ReadTimeout == 0 {
+		cfg.ReadTimeout = 2 * cfg.PingInterval
+	}
+	if cfg.WriteTimeout == 0 {
+		cfg.WriteTimeout = defaultWSWriteTimeout
+	}
+	if cfg.MaxMessageSize == 0 {
+		cfg.MaxMessageSize = defaultWSMaxMessageSize
+	}
+	if cfg.SessionTTL == 0 {
+		cfg.SessionTTL = defaultWSSessionTTL
+	}
+	return cfg
+}
+
+// wsUpgrader returns the websocket upgrader checking the allowed origins.
+func (a *application) wsUpgrader() *websocket.Upgrader {
+	return &websocket.Upgrader{
+		ReadBufferSize:    1024,
+		WriteBufferSize:   1024,
+		CheckOrigin:       a.checkOrigin,
+		Subprotocols:      wsSubprotocols,
+		EnableCompression: a.config.APIService.Websocket.Compression,
+	}
+}
+
+// wsClient is a device connected to the websocket.
+type wsClient struct {
+	id          string
+	conn        *websocket.Conn
+	codec       wsCodec
+	ack         string
+	settings    config.WebsocketYAML
+	container   string
+	connectedAt time.Time
+	session     *wsSession // nil without session
+	// Identity authenticated or taken from the peer container. Devices known from
+	// their first message could claim any ID, they don't receive commands
+	authenticated bool
+
+	device   atomic.Value // string, authenticated or taken from the first message
+	online   atomic.Bool  // presence of the device recorded
+	evicted  atomic.Bool  // closed by the server
+	will     atomic.Pointer[message.Message]
+	received atomic.Uint64
+	queued   atomic.Uint64
+	rejected atomic.Uint64
+
+	mu   sync.Mutex    // writes come from the reader and the delivery reports
+	done chan struct{} // closed when the connection ends
+}
+
+func (w *wsClient) deviceID() string {
+	id, _ := w.device.Load().(string)
+	return id
+}
+
+func (w *wsClient) info() wsConnectionInfo {
+	return wsConnectionInfo{
+		ID:               w.id,
+		DeviceID:         w.deviceID(),
+		Container:        w.container,
+		RemoteAddr:       w.conn.RemoteAddr().String(),
+		Subprotocol:      w.conn.Subprotocol(),
+		ConnectedAt:      w.connectedAt,
+		MessagesReceived: w.received.Load(),
+		MessagesQueued:   w.queued.Load(),
+		MessagesRejected: w.rejected.Load(),
+	}
+}
+
+// send writes the response encoded with the codec of the connection.
+func (w *wsClient) send(resp wsResponse) error {
+	data, err := w.codec.encode(resp)
+	if err != nil {
+		return err
+	}
+
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if err := w.conn.SetWriteDeadline(time.Now().Add(w.settings.WriteTimeout)); err != nil {
+		return err
+	}
+	return w.conn.WriteMessage(w.codec.frameType(), data)
+}
+
+// keepalive pings the device until the connection ends. The read deadline is
+// extended by every pong and message, so dead devices time out.
+func (w *wsClient) keepalive() {
+	ticker := time.NewTicker(w.settings.PingInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			if err := w.conn.WriteControl(websocket.PingMessage, nil, time.Now().Add(w.settings.WriteTimeout)); err != nil {
+				return
+			}
+		case <-w.done:
+			return
+		}
+	}
+}
+
+// extendDeadline postpones the read timeout of the connection.
+func (w *wsClient) extendDeadline() error {
+	return w.conn.SetReadDeadline(time.Now().Add(w.settings.ReadTimeout))
+}
+
+// disconnect closes the connection, sending the reason to the device.
+func (w *wsClient) disconnect(reason string) {
+	w.evicted.Store(true)
+	msg := websocket.FormatCloseMessage(websocket.ClosePolicyViolation, reason)
+	_ = w.conn.WriteControl(websocket.CloseMessage, msg, time.Now().Add(w.settings.WriteTimeout))
+	_ = w.conn.Close()
+}
+
+// setWill registers the message as last will of the connection. A message
+// without topic clears it.
+func (w *wsClient) setWill(msg *message.Message) wsResponse {
+	if msg.Topic == "" {
+		w.will.Store(nil)
+	} else {
+		w.will.Store(msg)
+	}
+	return wsResponse{Status: statusWill}
+}
+
+// reply sends the response to the message at index. Without acknowledgements only
+// the errors about the message itself are sent.
+func (w *wsClient) reply(index int, resp wsResponse) error {
+	if w.ack == ackNone {
+		if resp.Error == "" || resp.Status == statusFailed {
+			return nil
+		}
+		resp.Status = ""
+		return w.send(resp)
+	}
+
+	resp.Index = &index
+	return w.send(resp)
+}
+
+// deliveryReport returns the function sending the published acks of the message
+// at index, once its queued ack was sent.
+func (w *wsClient) deliveryReport(index int, seq uint64, queued <-chan struct{}) agent.DeliveryFunc {
+	return func(msg *message.Message, broker string, err error) {
+		resp := wsResponse{ID: msg.ID, Index: &index, Seq: seq, Status: statusPublished, Broker: broker}
+		switch {
+		case errors.Is(err, agent.ErrMessageExpired), errors.Is(err, agent.ErrMessageFiltered), errors.Is(err, agent.ErrNoTargetBrokers):
+			resp.Status, resp.Error = statusDropped, err.Error()
+		case err != nil:
+			resp.Status, resp.Error = statusFailed, err.Error()
+		}
+
+		// Called from the workers, the write must not hold them
+		go func() {
+			select {
+			case <-queued:
+			case <-w.done:
+				return
+			}
+			_ = w.send(resp)
+		}()
+	}
 }
 
 // websocketIoTHandler is handler to establish connection with external pods.
-// It receives messages and foward to the TelemetryAgent
+// It receives messages and foward to the TelemetryAgent. When device authentication
+// is enabled, the connection is bound to the authenticated device. The encoding of
+// the messages is negotiated with the websocket subprotocol, JSON by default, and
+// the acknowledgements with the ack query parameter (none, queued or published).
+// With the session query parameter (new or the ID of a session to resume), the
+// sequenced messages already received on the session are not forwarded again.
+// The downlink commands of authenticated devices are written to the connection,
+// and its last will is sent when the connection ends abnormally.
 func (a *application) websocketIoTHandler(c *gin.Context) {
-	conn, err := wsupgrader.Upgrade(c.Writer, c.Request, nil)
+	ack := c.DefaultQuery("ack", ackNone)
+	if !slices.Contains(ackModes, ack) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("ack must be one of %v", ackModes)})
+		return
+	}
+	lastAck, err := strconv.ParseUint(c.DefaultQuery("last_ack", "0"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "last_ack must be a sequence number"})
+		return
+	}
+
+	conn, err := a.wsUpgrader().Upgrade(c.Writer, c.Request, nil)
 	if err != nil {
 		a.logger.Error().Err(fmt.Errorf("failed to set websocket upgrade: %+v", err)).Msg("")
 		return
 	}
 	defer conn.Close()
 
-	a.logger.Info().Msg("Client connected to Web Socket")
-	for {
-		msg := message.Message{}
-		err := conn.ReadJSON(&msg)
+	client := &wsClient{
+		id:          message.NewID("conn"),
+		conn:        conn,
+		codec:       newWSCodec(conn.Subprotocol()),
+		ack:         ack,
+		settings:    wsSettings(a.config.APIService.Websocket),
+		container:   c.GetString(containerKey),
+		connectedAt: time.Now(),
+		done:        make(chan struct{}),
+	}
+	client.device.Store(c.GetString(deviceIDKey))
+	if client.container != "" && client.deviceID() == "" {
+		client.device.Store(client.container)
+	}
+	client.authenticated = client.deviceID() != ""
+	defer close(client.done)
+
+	a.wsClients.add(client)
+	defer a.wsClients.remove(client)
+
+	logger := a.logger.With().Str("connection", client.id).Str("remote_addr", conn.RemoteAddr().String()).Logger()
+	if c.Request.URL.Query().Has("session") {
+		if err := a.startWSSession(client, c.Query("session"), lastAck); err != nil {
+			logger.Warn().Err(err).Str("device_id", client.deviceID()).Msg("failed to start websocket session")
+			client.disconnect(err.Error())
+			return
+		}
+		defer a.wsSessions.detach(client.session, client)
+	}
+
+	conn.SetReadLimit(client.settings.MaxMessageSize)
+	conn.SetPongHandler(func(string) error { return client.extendDeadline() })
+	if err := client.extendDeadline(); err != nil {
+		logger.Error().Err(err).Msg("failed to set websocket read deadline")
+		return
+	}
+	go client.keepalive()
+
+	logger.Info().Str("device_id", client.deviceID()).Str("subprotocol", conn.Subprotocol()).Str("ack", ack).Msg("Client connected to Web Socket")
+	a.deviceOnline(client)
+
+	reason := disconnectAbnormal
+	defer func() { a.deviceOffline(c, client, reason) }()
+	for index := 0; ; index++ {
+		_, data, err := conn.ReadMessage()
 		if err != nil {
-			if websocket.IsUnexpectedCloseError(err, websocket.CloseGoingAway, websocket.CloseAbnormalClosure) {
+			reason = disconnectReason(err)
+			if client.evicted.Load() {
+				reason = disconnectEvicted
+			}
+
+			switch {
+			case reason == disconnectEvicted:
+				logger.Info().Str("device_id", client.deviceID()).Msg("WebSocket client evicted")
+			case reason == disconnectTimeout:
+				logger.Warn().Str("device_id", client.deviceID()).Msg("WebSocket keepalive timeout")
+			case errors.Is(err, websocket.ErrReadLimit):
+				logger.Warn().Str("device_id", client.deviceID()).Int64("max_message_size", client.settings.MaxMessageSize).Msg("WebSocket message too large")
+			case websocket.IsUnexpectedCloseError(err, websocket.CloseGoingAway, websocket.CloseAbnormalClosure):
 				// This is a real error (e.g., network failure).
-				a.logger.Error().Err(err).Msg("Unexpected WebSocket close error")
-			} else {
+				logger.Error().Err(err).Msg("Unexpected WebSocket close error")
+			case reason == disconnectAbnormal:
+				logger.Warn().Err(err).Str("device_id", client.deviceID()).Msg("WebSocket connection lost")
+			default:
 				// This is a normal disconnect from the client.
-				a.logger.Info().Msg("WebSocket client disconnected normally.")
+				logger.Info().Msg("WebSocket client disconnected normally.")
 			}
 			break
 		}
-		msg.ID = fmt.Sprintf("ws-%d", time.Now().UnixNano())
-		msg.Timestamp = time.Now()
+		client.received.Add(1)
+		if err := client.extendDeadline(); err != nil {
+			logger.Error().Err(err).Msg("failed to set websocket read deadline")
+			break
+		}
 
-		submitted := a.TelemetryAgent.Submit(&msg)
-		if !submitted {
-			a.logger.Error().Str("message", msg.ID).Str("device_id", msg.DeviceID).Str("topic", msg.Topic).Msg("failed to enqueue publish job")
+		msg := message.Message{}
+		env, err := client.codec.decode(data, &msg)
+		if err != nil {
+			client.rejected.Add(1)
+			logger.Warn().Err(err).Msg("failed to decode websocket message")
+			if err := client.reply(index, wsResponse{Status: statusRejected, Error: err.Error(), Code: http.StatusBadRequest}); err != nil {
+				logger.Error().Err(err).Msg("failed to send decoding error")
+			}
+			continue
+		}
+
+		queued := make(chan struct{})
+		var resp wsResponse
+		switch {
+		case env.Will:
+			resp = client.setWill(&msg)
+		case client.session != nil && env.Seq > 0:
+			isNew := client.session.submit(env.Seq, func() bool {
+				resp = a.submitWSMessage(c, client, &msg, index, env, queued)
+				return resp.Status == statusQueued
+			})
+			if !isNew {
+				resp = wsResponse{Status: statusDuplicate}
+			}
+		default:
+			resp = a.submitWSMessage(c, client, &msg, index, env, queued)
 		}
+		resp.Seq = env.Seq
 
-		a.logger.Debug().Msg("Message received via WebSocket:" + msg.ID)
+		switch resp.Status {
+		case statusQueued:
+			client.queued.Add(1)
+		case statusRejected, statusFailed:
+			client.rejected.Add(1)
+		}
+
+		if err := client.reply(index, resp); err != nil {
+			logger.Error().Err(err).Str("message", msg.ID).Msg("failed to send websocket ack")
+		}
+		close(queued)
+
+		logger.Debug().Msg("Message received via WebSocket:" + msg.ID)
+	}
+}
+
+// submitWSMessage submits the message received at index and returns its ack. The
+// published acks wait for queued to be closed. Replies to commands are published
+// on the reply topic of their command.
+func (a *application) submitWSMessage(c *gin.Context, client *wsClient, msg *message.Message, index int, env wsEnvelope, queued <-chan struct{}) wsResponse {
+	if env.CorrelationID != "" {
+		if a.wsDownlink == nil {
+			return wsResponse{Status: statusRejected, Error: "downlink is not configured", Code: http.StatusNotFound}
+		}
+		if !client.authenticated {
+			return wsResponse{Status: statusRejected, Error: errUnauthenticatedDevice.Error(), Code: http.StatusForbidden}
+		}
+		if err := a.wsDownlink.reply(env.CorrelationID, client.deviceID(), msg, time.Now()); err != nil {
+			return wsResponse{Status: statusRejected, Error: err.Error(), Code: http.StatusNotFound}
+		}
+	}
+
+	var deliver agent.DeliveryFunc
+	if client.ack == ackPublished {
+		deliver = client.deliveryReport(index, env.Seq, queued)
+	}
+
+	err := a.submitMessage(c.GetString(deviceIDKey), client.container, msg, "ws", deliver)
+	if env.CorrelationID != "" && (err == nil || agent.IsQueued(err)) {
+		a.wsDownlink.replied(env.CorrelationID)
 	}
+	if client.deviceID() == "" && msg.DeviceID != "" {
+		// The device is known from its first message
+		client.device.Store(msg.DeviceID)
+		a.deviceOnline(client)
+	}
+
+	resp := wsResponse{ID: msg.ID, Status: statusQueued}
+	var vErr *agent.ValidationError
+	switch {
+	case errors.Is(err, auth.ErrDeviceMismatch):
+		resp.Status, resp.Error, resp.Code = statusRejected, err.Error(), http.StatusForbidden
+	case errors.As(err, &vErr):
+		// Let the client know that its payload doesn't match the topic schema
+		resp.Action, resp.Error = vErr.Action, vErr.Error()
+		if !agent.IsQueued(err) {
+			resp.Status = statusRejected
+		}
+	case err != nil:
+		resp.Status, resp.Error = statusFailed, err.Error()
+	}
+	return resp
+}
+
+// startWSSession attaches the connection to the session, "new" or empty creating
+// one, and sends the sequences already received. The sequences up to lastAck are
+// acknowledged by the device and won't be resent.
+func (a *application) startWSSession(client *wsClient, id string, lastAck uint64) error {
+	if id == "new" {
+		id = ""
+	}
+
+	ttl := client.settings.SessionTTL
+	session, previous, err := a.wsSessions.attach(id, client.deviceID(), client, ttl)
+	if err != nil {
+		return err
+	}
+	client.session = session
+
+	// A half-open connection may still hold the session
+	if previous != nil {
+		previous.disconnect("session resumed by another connection")
+	}
+
+	session.ack(lastAck)
+	lastSeq, seqs := session.state()
+	return client.send(wsResponse{Status: statusSession, Session: session.id, LastSeq: lastSeq, Seqs: seqs})
 }
@@ -0,0 +1,208 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	telemetryv1 "github.com/LincolnG4/iot-hydra/api/telemetry/v1"
+	"github.com/LincolnG4/iot-hydra/internal/config"
+	"github.com/LincolnG4/iot-hydra/internal/message"
+	"github.com/fxamacker/cbor/v2"
+	"github.com/gin-gonic/gin"
+	"github.com/gorilla/websocket"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/vmihailenco/msgpack/v5"
+	"google.golang.org/protobuf/proto"
+)
+
+// newWSServer serves the handler and returns the websocket URL of /v1/ws.
+func newWSServer(t *testing.T, handler http.Handler) string {
+	t.Helper()
+
+	srv := httptest.NewServer(handler)
+	t.Cleanup(srv.Close)
+	return "ws" + strings.TrimPrefix(srv.URL, "http") + "/v1/ws"
+}
+
+// dialWebsocket serves the websocket handler and connects with the subprotocol.
+func dialWebsocket(t *testing.T, a *application, subprotocol string) *websocket.Conn {
+	t.Helper()
+
+	r := gin.New()
+	r.GET("/v1/ws", a.websocketIoTHandler)
+	url := newWSServer(t, r)
+
+	dialer := websocket.Dialer{}
+	if subprotocol != "" {
+		dialer.Subprotocols = []string{subprotocol}
+	}
+	conn, _, err := dialer.Dial(url, nil)
+	require.NoError(t, err)
+	t.Cleanup(func() { conn.Close() })
+	require.Equal(t, subprotocol, conn.Subprotocol())
+	return conn
+}
+
+func TestWebsocket_Encodings(t *testing.T) {
+	type envelope struct {
+		Topic   string `json:"topic"`
+		Payload []byte `json:"payload"`
+	}
+	msgpackMarshal := func(v any) ([]byte, error) {
+		var b bytes.Buffer
+		enc := msgpack.NewEncoder(&b)
+		enc.SetCustomStructTag("json")
+		err := enc.Encode(v)
+		return b.Bytes(), err
+	}
+	protobufMarshal := func(v any) ([]byte, error) {
+		e := v.(envelope)
+		return proto.Marshal(&telemetryv1.Message{Topic: e.Topic, Payload: e.Payload})
+	}
+
+	tests := []struct {
+		subprotocol string
+		frameType   int
+		marshal     func(any) ([]byte, error)
+		unmarshal   func([]byte) (wsResponse, error)
+	}{
+		{"", websocket.TextMessage, json.Marshal, func(b []byte) (r wsResponse, err error) {
+			return r, json.Unmarshal(b, &r)
+		}},
+		{subprotocolJSON, websocket.TextMessage, json.Marshal, func(b []byte) (r wsResponse, err error) {
+			return r, json.Unmarshal(b, &r)
+		}},
+		{subprotocolCBOR, websocket.BinaryMessage, cbor.Marshal, func(b []byte) (r wsResponse, err error) {
+			return r, cbor.Unmarshal(b, &r)
+		}},
+		{subprotocolMsgpack, websocket.BinaryMessage, msgpackMarshal, func(b []byte) (r wsResponse, err error) {
+			return r, msgpack.Unmarshal(b, &r)
+		}},
+		{subprotocolProtobuf, websocket.BinaryMessage, protobufMarshal, func(b []byte) (wsResponse, error) {
+			var ack telemetryv1.Ack
+			err := proto.Unmarshal(b, &ack)
+			return wsResponse{ID: ack.Id, Error: ack.Error}, err
+		}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.subprotocol, func(t *testing.T) {
+			a := newTestAgentApp(t)
+			conn := dialWebsocket(t, a, tt.subprotocol)
+
+			// Rejected by the schema of the topic, the client gets a response
+			data, err := tt.marshal(envelope{Topic: "strict/a", Payload: []byte(`{}`)})
+			require.NoError(t, err)
+			require.NoError(t, conn.WriteMessage(tt.frameType, data))
+
+			frameType, data, err := conn.ReadMessage()
+			require.NoError(t, err)
+			assert.Equal(t, tt.frameType, frameType)
+			resp, err := tt.unmarshal(data)
+			require.NoError(t, err)
+			assert.NotEmpty(t, resp.ID)
+			assert.NotEmpty(t, resp.Error)
+
+			data, err = tt.marshal(envelope{Topic: "strict/a", Payload: []byte(`{"v": 1}`)})
+			require.NoError(t, err)
+			require.NoError(t, conn.WriteMessage(tt.frameType, data))
+
+			msg := popQueued(t, a)
+			assert.JSONEq(t, `{"v": 1}`, string(msg.Payload))
+		})
+	}
+}
+
+func TestWebsocket_RawJSONPayload(t *testing.T) {
+	a := newTestAgentApp(t)
+	conn := dialWebsocket(t, a, "")
+
+	require.NoError(t, conn.WriteMessage(websocket.TextMessage, []byte(`{"topic": "t", "payload": {"v": 1}}`)))
+	msg := popQueued(t, a)
+	assert.JSONEq(t, `{"v": 1}`, string(msg.Payload))
+
+	// Invalid messages are answered without closing the connection
+	require.NoError(t, conn.WriteMessage(websocket.TextMessage, []byte(`{"payload": 1}`)))
+	var resp map[string]any
+	require.NoError(t, conn.ReadJSON(&resp))
+	assert.Equal(t, float64(http.StatusBadRequest), resp["code"])
+}
+
+// popQueued waits for the next message submitted to the agent.
+func popQueued(t *testing.T, a *application) *message.Message {
+	t.Helper()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+	msg, ok := a.TelemetryAgent.Queue.Pop(ctx)
+	require.True(t, ok, "no message submitted")
+	return msg
+}
+
+func TestWebsocket_Acks(t *testing.T) {
+	a := newTestAgentApp(t)
+	a.TelemetryAgent.StartWorkerPool()
+	a.TelemetryAgent.Start()
+
+	r := gin.New()
+	r.GET("/v1/ws", a.websocketIoTHandler)
+	url := newWSServer(t, r)
+
+	_, resp, err := websocket.DefaultDialer.Dial(url+"?ack=always", nil)
+	require.Error(t, err)
+	assert.Equal(t, http.StatusBadRequest, resp.StatusCode)
+
+	conn, _, err := websocket.DefaultDialer.Dial(url+"?ack=published", nil)
+	require.NoError(t, err)
+	defer conn.Close()
+
+	require.NoError(t, conn.WriteJSON(gin.H{"topic": "t", "target_brokers": []string{"fake", "missing"}}))
+	require.NoError(t, conn.WriteJSON(gin.H{"topic": "strict/a", "payload": gin.H{}}))
+
+	acks := make(map[string]wsResponse)
+	for range 4 {
+		var ack wsResponse
+		require.NoError(t, conn.ReadJSON(&ack))
+		require.NotNil(t, ack.Index)
+		acks[fmt.Sprintf("%d/%s/%s", *ack.Index, ack.Status, ack.Broker)] = ack
+	}
+	assert.Contains(t, acks, "0/queued/")
+	assert.Contains(t, acks, "0/published/fake")
+	assert.Contains(t, acks, "0/failed/missing")
+	assert.Contains(t, acks, "1/rejected/")
+	assert.Equal(t, acks["0/queued/"].ID, acks["0/published/fake"].ID)
+}
+
+func TestWebsocket_Keepalive(t *testing.T) {
+	a := newTestAgentApp(t)
+	a.config.APIService.Websocket = config.WebsocketYAML{PingInterval: 20 * time.Millisecond, ReadTimeout: 100 * time.Millisecond, MaxMessageSize: 64}
+
+	// Reading answers the pings, so the connection stays open
+	alive := dialWebsocket(t, a, "")
+	go func() {
+		for {
+			if _, _, err := alive.ReadMessage(); err != nil {
+				return
+			}
+		}
+	}()
+
+	// Never reads, so its pongs are missing
+	dialWebsocket(t, a, "")
+
+	require.Eventually(t, func() bool { return len(a.wsClients.list()) == 1 }, 2*time.Second, 10*time.Millisecond)
+	time.Sleep(200 * time.Millisecond)
+	assert.Len(t, a.wsClients.list(), 1)
+
+	// Messages over the limit close the connection
+	require.NoError(t, alive.WriteMessage(websocket.TextMessage, []byte(`{"topic": "`+strings.Repeat("t", 64)+`"}`)))
+	require.Eventually(t, func() bool { return len(a.wsClients.list()) == 0 }, 2*time.Second, 10*time.Millisecond)
+}
@@ -0,0 +1,195 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+
+	telemetryv1 "github.com/LincolnG4/iot-hydra/api/telemetry/v1"
+	"github.com/LincolnG4/iot-hydra/internal/agent"
+	"github.com/LincolnG4/iot-hydra/internal/message"
+	"github.com/fxamacker/cbor/v2"
+	"github.com/gorilla/websocket"
+	"github.com/vmihailenco/msgpack/v5"
+	"google.golang.org/protobuf/proto"
+)
+
+// Websocket subprotocols selecting the encoding of the messages. Without
+// subprotocol, messages are JSON text frames.
+const (
+	subprotocolJSON     = "hydra.json"
+	subprotocolCBOR     = "hydra.cbor"
+	subprotocolMsgpack  = "hydra.msgpack"
+	subprotocolProtobuf = "hydra.protobuf"
+)
+
+var wsSubprotocols = []string{subprotocolJSON, subprotocolCBOR, subprotocolMsgpack, subprotocolProtobuf}
+
+// wsResponse is sent back to the client when a message is not accepted as is and,
+// with acknowledgements, for each message and delivery.
+type wsResponse struct {
+	ID     string `json:"id" msgpack:"id"`
+	Index  *int   `json:"index,omitempty" msgpack:"index,omitempty"` // position of the message on the connection
+	Seq    uint64 `json:"seq,omitempty" msgpack:"seq,omitempty"`     // sequence of the message on the session
+	Status string `json:"status,omitempty" msgpack:"status,omitempty"`
+	Broker string `json:"broker,omitempty" msgpack:"broker,omitempty"`
+	Action string `json:"action,omitempty" msgpack:"action,omitempty"`
+	Error  string `json:"error" msgpack:"error"`
+	Code   int    `json:"code,omitempty" msgpack:"code,omitempty"`
+
+	// State of the session: all sequences up to LastSeq and the ones in Seqs were received
+	Session string   `json:"session,omitempty" msgpack:"session,omitempty"`
+	LastSeq uint64   `json:"last_seq,omitempty" msgpack:"last_seq,omitempty"`
+	Seqs    []uint64 `json:"seqs,omitempty" msgpack:"seqs,omitempty"`
+
+	// Downlink command, replied with its ID as correlation_id
+	Topic   string `json:"topic,omitempty" msgpack:"topic,omitempty"`
+	Payload []byte `json:"payload,omitempty" msgpack:"payload,omitempty"`
+}
+
+// wsEnvelope holds the protocol fields sent along the message fields.
+type wsEnvelope struct {
+	Seq           uint64 `json:"seq"`            // sequence of the message on the session, 0 if not sequenced
+	CorrelationID string `json:"correlation_id"` // command the message replies to
+	Will          bool   `json:"will"`           // message is the last will of the connection
+}
+
+// wsCodec decodes the messages and encodes the responses of a websocket subprotocol.
+type wsCodec interface {
+	// websocket.TextMessage or websocket.BinaryMessage
+	frameType() int
+	decode(data []byte, msg *message.Message) (wsEnvelope, error)
+	encode(resp wsResponse) ([]byte, error)
+}
+
+// newWSCodec returns the codec of the negotiated subprotocol.
+func newWSCodec(subprotocol string) wsCodec {
+	switch subprotocol {
+	case subprotocolCBOR:
+		return cborCodec{}
+	case subprotocolMsgpack:
+		return msgpackCodec{}
+	case subprotocolProtobuf:
+		return protobufCodec{}
+	default:
+		return jsonCodec{}
+	}
+}
+
+type jsonCodec struct{}
+
+func (jsonCodec) frameType() int { return websocket.TextMessage }
+
+func (jsonCodec) decode(data []byte, msg *message.Message) (wsEnvelope, error) {
+	var env wsEnvelope
+	if err := json.Unmarshal(data, msg); err != nil {
+		return env, err
+	}
+	err := json.Unmarshal(data, &env)
+	return env, err
+}
+
+func (jsonCodec) encode(resp wsResponse) ([]byte, error) {
+	return json.Marshal(resp)
+}
+
+// cborCodec uses the JSON field names of the message.
+type cborCodec struct{}
+
+func (cborCodec) frameType() int { return websocket.BinaryMessage }
+
+func (cborCodec) decode(data []byte, msg *message.Message) (wsEnvelope, error) {
+	var env wsEnvelope
+	if err := cbor.Unmarshal(data, msg); err != nil {
+		return env, err
+	}
+	err := cbor.Unmarshal(data, &env)
+	return env, err
+}
+
+func (cborCodec) encode(resp wsResponse) ([]byte, error) {
+	return cbor.Marshal(resp)
+}
+
+// msgpackCodec uses the JSON field names of the message.
+type msgpackCodec struct{}
+
+func (msgpackCodec) frameType() int { return websocket.BinaryMessage }
+
+func (msgpackCodec) decode(data []byte, msg *message.Message) (wsEnvelope, error) {
+	var env wsEnvelope
+	for _, v := range []any{msg, &env} {
+		dec := msgpack.NewDecoder(bytes.NewReader(data))
+		dec.SetCustomStructTag("json")
+		if err := dec.Decode(v); err != nil {
+			return env, err
+		}
+	}
+	return env, nil
+}
+
+func (msgpackCodec) encode(resp wsResponse) ([]byte, error) {
+	return msgpack.Marshal(resp)
+}
+
+// protobufCodec uses the messages of the gRPC API. Responses are acks.
+type protobufCodec struct{}
+
+func (protobufCodec) frameType() int { return websocket.BinaryMessage }
+
+func (protobufCodec) decode(data []byte, msg *message.Message) (wsEnvelope, error) {
+	var pb telemetryv1.Message
+	if err := proto.Unmarshal(data, &pb); err != nil {
+		return wsEnvelope{}, err
+	}
+	*msg = *telemetryv1.ToMessage(&pb)
+	return wsEnvelope{Seq: pb.Seq, CorrelationID: pb.CorrelationId, Will: pb.Will}, nil
+}
+
+func (protobufCodec) encode(resp wsResponse) ([]byte, error) {
+	ack := &telemetryv1.Ack{
+		Id:      resp.ID,
+		Status:  ackStatus(resp),
+		Error:   resp.Error,
+		Broker:  resp.Broker,
+		Seq:     resp.Seq,
+		Session: resp.Session,
+		LastSeq: resp.LastSeq,
+		Seqs:    resp.Seqs,
+		Topic:   resp.Topic,
+		Payload: resp.Payload,
+	}
+	if resp.Index != nil {
+		ack.Index = uint64(*resp.Index)
+	}
+	return proto.Marshal(ack)
+}
+
+// ackStatus returns the protobuf status of the response. Responses without status
+// are the errors sent without acknowledgements.
+func ackStatus(resp wsResponse) telemetryv1.AckStatus {
+	switch resp.Status {
+	case statusQueued:
+		return telemetryv1.AckStatus_ACK_STATUS_ACCEPTED
+	case statusRejected:
+		return telemetryv1.AckStatus_ACK_STATUS_REJECTED
+	case statusPublished:
+		return telemetryv1.AckStatus_ACK_STATUS_PUBLISHED
+	case statusFailed:
+		return telemetryv1.AckStatus_ACK_STATUS_FAILED
+	case statusDropped:
+		return telemetryv1.AckStatus_ACK_STATUS_DROPPED
+	case statusDuplicate:
+		return telemetryv1.AckStatus_ACK_STATUS_DUPLICATE
+	case statusSession:
+		return telemetryv1.AckStatus_ACK_STATUS_SESSION
+	case statusCommand:
+		return telemetryv1.AckStatus_ACK_STATUS_COMMAND
+	case statusWill:
+		return telemetryv1.AckStatus_ACK_STATUS_WILL
+	}
+
+	if resp.Action != "" && resp.Action != agent.SchemaActionReject {
+		return telemetryv1.AckStatus_ACK_STATUS_ACCEPTED
+	}
+	return telemetryv1.AckStatus_ACK_STATUS_REJECTED
+}
@@ -0,0 +1,272 @@
+package main
+
+import (
+	"errors"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/LincolnG4/iot-hydra/internal/config"
+	"github.com/LincolnG4/iot-hydra/internal/message"
+)
+
+const (
+	devicePlaceholder = "{device}"
+
+	defaultCommandQueueSize = 100
+	defaultCommandTTL       = time.Hour
+	// Interval between the removals of the expired commands
+	commandPurgeInterval = time.Minute
+)
+
+var (
+	errUnknownCommand = errors.New("unknown or expired command")
+	errNoReplyTopic   = errors.New("command has no reply topic")
+
+	errUnauthenticatedDevice = errors.New("commands require an authenticated device")
+)
+
+// wsCommand is a downlink command for a device.
+type wsCommand struct {
+	id        string
+	deviceID  string
+	topic     string
+	payload   []byte
+	replyTo   string // topic of the reply
+	expiresAt time.Time
+}
+
+// wsDownlink keeps the commands of the offline devices and the commands waiting
+// for the reply of their device.
+type wsDownlink struct {
+	cfg config.WebsocketDownlinkYAML
+
+	mu      sync.Mutex
+	offline map[string][]*wsCommand // by device, oldest first
+	pending map[string]*wsCommand   // sent and waiting for the reply, by ID
+}
+
+func newWSDownlink(cfg config.WebsocketDownlinkYAML) *wsDownlink {
+	if cfg.OfflineQueueSize == 0 {
+		cfg.OfflineQueueSize = defaultCommandQueueSize
+	}
+	if cfg.CommandTTL == 0 {
+		cfg.CommandTTL = defaultCommandTTL
+	}
+	return &wsDownlink{
+		cfg:     cfg,
+		offline: make(map[string][]*wsCommand),
+		pending: make(map[string]*wsCommand),
+	}
+}
+
+// command returns the command of the broker message. Its ID is the correlation_id
+// set by the backend, e.g. as NATS header, or a new one. It returns false if the
+// topic doesn't identify the device.
+func (d *wsDownlink) command(msg *message.Message, now time.Time) (*wsCommand, bool) {
+	deviceID, ok := message.TopicToken(d.cfg.Topic, msg.Topic, devicePlaceholder)
+	if !ok {
+		return nil, false
+	}
+
+	replyTo := msg.Metadata[message.MetadataReplyTo]
+	if replyTo == "" {
+		replyTo = strings.ReplaceAll(d.cfg.ReplyTopic, devicePlaceholder, deviceID)
+	}
+	id := msg.Metadata[message.MetadataCorrelationID]
+	if id == "" {
+		id = message.NewID("cmd")
+	}
+	return &wsCommand{
+		id:        id,
+		deviceID:  deviceID,
+		topic:     msg.Topic,
+		payload:   msg.Payload,
+		replyTo:   replyTo,
+		expiresAt: now.Add(d.cfg.CommandTTL),
+	}, true
+}
+
+// queue keeps the command until its device connects, dropping the oldest command
+// when the queue of the device is full.
+func (d *wsDownlink) queue(cmd *wsCommand) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	cmds := append(d.offline[cmd.deviceID], cmd)
+	if len(cmds) > d.cfg.OfflineQueueSize {
+		cmds = cmds[len(cmds)-d.cfg.OfflineQueueSize:]
+	}
+	d.offline[cmd.deviceID] = cmds
+}
+
+// take removes and returns the commands queued for the device that are not expired.
+func (d *wsDownlink) take(deviceID string, now time.Time) []*wsCommand {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	var cmds []*wsCommand
+	for _, cmd := range d.offline[deviceID] {
+		if now.Before(cmd.expiresAt) {
+			cmds = append(cmds, cmd)
+		}
+	}
+	delete(d.offline, deviceID)
+	return cmds
+}
+
+// sent records the command as waiting for its reply.
+func (d *wsDownlink) sent(cmd *wsCommand, now time.Time) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	cmd.expiresAt = now.Add(d.cfg.CommandTTL)
+	d.pending[cmd.id] = cmd
+}
+
+// purge removes the expired commands, including the ones queued for devices
+// that never connect again.
+func (d *wsDownlink) purge(now time.Time) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	for deviceID, cmds := range d.offline {
+		cmds = slices.DeleteFunc(cmds, func(cmd *wsCommand) bool { return !now.Before(cmd.expiresAt) })
+		if len(cmds) == 0 {
+			delete(d.offline, deviceID)
+			continue
+		}
+		d.offline[deviceID] = cmds
+	}
+	for id, pending := range d.pending {
+		if !now.Before(pending.expiresAt) {
+			delete(d.pending, id)
+		}
+	}
+}
+
+// reply turns the message of the device into the reply of the command, to be
+// published on the reply topic of the command. The command waits for another
+// reply until replied is called.
+func (d *wsDownlink) reply(correlationID, deviceID string, msg *message.Message, now time.Time) error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	cmd, found := d.pending[correlationID]
+	if !found || cmd.deviceID != deviceID || !now.Before(cmd.expiresAt) {
+		return errUnknownCommand
+	}
+	if cmd.replyTo == "" {
+		return errNoReplyTopic
+	}
+
+	if msg.DeviceID == "" {
+		msg.DeviceID = cmd.deviceID
+	}
+	msg.Topic = cmd.replyTo
+	msg.TargetBrokers = []string{d.cfg.Broker}
+	msg.SetMetadata(message.MetadataCorrelationID, correlationID)
+	return nil
+}
+
+// replied removes the command once its reply is enqueued, so it is replied once.
+func (d *wsDownlink) replied(correlationID string) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	delete(d.pending, correlationID)
+}
+
+// startWSDownlink subscribes to the commands of the devices when the websocket
+// downlink is configured. The returned function ends the subscription.
+func (a *application) startWSDownlink() (func() error, error) {
+	cfg := a.config.APIService.Websocket.Downlink
+	if cfg == nil {
+		return func() error { return nil }, nil
+	}
+
+	if a.deviceAuth == nil {
+		a.logger.Warn().Msg("websocket device authentication is disabled, only the containers receive commands")
+	}
+
+	a.wsDownlink = newWSDownlink(*cfg)
+	topic := strings.ReplaceAll(cfg.Topic, devicePlaceholder, "*")
+	unsubscribe, err := a.TelemetryAgent.Subscribe(cfg.Broker, topic, a.handleCommand)
+	if err != nil {
+		return nil, err
+	}
+
+	done := make(chan struct{})
+	go func() {
+		ticker := time.NewTicker(commandPurgeInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-done:
+				return
+			case now := <-ticker.C:
+				a.wsDownlink.purge(now)
+			}
+		}
+	}()
+
+	return func() error {
+		close(done)
+		return unsubscribe()
+	}, nil
+}
+
+// handleCommand writes the command to the websocket of its device, or queues it
+// while the device is offline.
+func (a *application) handleCommand(msg *message.Message) {
+	cmd, ok := a.wsDownlink.command(msg, time.Now())
+	if !ok {
+		a.logger.Warn().Str("topic", msg.Topic).Msg("command topic doesn't identify the device")
+		return
+	}
+
+	if !a.sendCommand(cmd) {
+		a.logger.Debug().Str("device_id", cmd.deviceID).Str("command", cmd.id).Msg("device offline, command queued")
+		a.wsDownlink.queue(cmd)
+	}
+}
+
+// sendCommand writes the command to the authenticated connections of its device.
+// It returns false if no connection received it.
+func (a *application) sendCommand(cmd *wsCommand) bool {
+	sent := false
+	for _, client := range a.wsClients.device(cmd.deviceID) {
+		if !client.authenticated {
+			continue
+		}
+		err := client.send(wsResponse{ID: cmd.id, Status: statusCommand, Topic: cmd.topic, Payload: cmd.payload})
+		if err != nil {
+			a.logger.Warn().Err(err).Str("device_id", cmd.deviceID).Str("command", cmd.id).Str("connection", client.id).Msg("failed to send command")
+			continue
+		}
+		sent = true
+	}
+
+	if sent {
+		a.wsDownlink.sent(cmd, time.Now())
+		a.logger.Debug().Str("device_id", cmd.deviceID).Str("command", cmd.id).Msg("command sent")
+	}
+	return sent
+}
+
+// flushCommands sends the commands queued while the device of the connection was offline.
+func (a *application) flushCommands(client *wsClient) {
+	if a.wsDownlink == nil || !client.authenticated {
+		return
+	}
+
+	cmds := a.wsDownlink.take(client.deviceID(), time.Now())
+	for i, cmd := range cmds {
+		if !a.sendCommand(cmd) {
+			for _, left := range cmds[i:] {
+				a.wsDownlink.queue(left)
+			}
+			return
+		}
+	}
+}
@@ -0,0 +1,192 @@
+package main
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/LincolnG4/iot-hydra/internal/agent"
+	"github.com/LincolnG4/iot-hydra/internal/brokers"
+	natsbroker "github.com/LincolnG4/iot-hydra/internal/brokers/nats"
+	"github.com/LincolnG4/iot-hydra/internal/config"
+	"github.com/LincolnG4/iot-hydra/internal/message"
+	"github.com/gin-gonic/gin"
+	"github.com/gorilla/websocket"
+	"github.com/nats-io/nats.go"
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestWSDownlink_Queue(t *testing.T) {
+	d := newWSDownlink(config.WebsocketDownlinkYAML{Topic: "devices.{device}.cmd", OfflineQueueSize: 2, CommandTTL: time.Minute})
+	now := time.Now()
+
+	_, ok := d.command(&message.Message{Topic: "devices.dev1.config"}, now)
+	assert.False(t, ok)
+
+	for _, payload := range []string{"a", "b", "c"} {
+		cmd, ok := d.command(&message.Message{Topic: "devices.dev1.cmd", Payload: []byte(payload)}, now)
+		require.True(t, ok)
+		assert.Equal(t, "dev1", cmd.deviceID)
+		d.queue(cmd)
+	}
+
+	cmds := d.take("dev1", now)
+	require.Len(t, cmds, 2, "the oldest command is dropped")
+	assert.Equal(t, "b", string(cmds[0].payload))
+	assert.Empty(t, d.take("dev1", now))
+
+	d.queue(cmds[0])
+	assert.Empty(t, d.take("dev1", now.Add(2*time.Minute)), "expired commands are dropped")
+}
+
+func TestWSDownlink_Purge(t *testing.T) {
+	d := newWSDownlink(config.WebsocketDownlinkYAML{Topic: "devices.{device}.cmd", CommandTTL: time.Minute})
+	now := time.Now()
+
+	old, _ := d.command(&message.Message{Topic: "devices.gone.cmd"}, now)
+	d.queue(old)
+	pending, _ := d.command(&message.Message{Topic: "devices.dev1.cmd"}, now)
+	d.sent(pending, now)
+	fresh, _ := d.command(&message.Message{Topic: "devices.dev2.cmd"}, now.Add(time.Minute))
+	d.queue(fresh)
+
+	d.purge(now.Add(90 * time.Second))
+	assert.NotContains(t, d.offline, "gone", "devices that never connect don't keep their expired commands")
+	assert.Empty(t, d.pending)
+	assert.Equal(t, []*wsCommand{fresh}, d.offline["dev2"])
+}
+
+func TestWSDownlink_Reply(t *testing.T) {
+	d := newWSDownlink(config.WebsocketDownlinkYAML{Broker: "nats", Topic: "devices.{device}.cmd", ReplyTopic: "devices.{device}.reply"})
+	now := time.Now()
+
+	cmd, _ := d.command(&message.Message{Topic: "devices.dev1.cmd"}, now)
+	request, _ := d.command(&message.Message{Topic: "devices.dev1.cmd", Metadata: map[string]string{message.MetadataReplyTo: "_INBOX.1"}}, now)
+	d.sent(cmd, now)
+	d.sent(request, now)
+
+	msg := &message.Message{}
+	assert.ErrorIs(t, d.reply(cmd.id, "dev2", msg, now), errUnknownCommand, "commands of other devices can't be replied")
+	require.NoError(t, d.reply(cmd.id, "dev1", msg, now))
+	assert.Equal(t, "devices.dev1.reply", msg.Topic)
+	assert.Equal(t, []string{"nats"}, msg.TargetBrokers)
+	assert.Equal(t, cmd.id, msg.Metadata[message.MetadataCorrelationID])
+	require.NoError(t, d.reply(cmd.id, "dev1", msg, now), "the reply can be retried until it is enqueued")
+	d.replied(cmd.id)
+	assert.ErrorIs(t, d.reply(cmd.id, "dev1", msg, now), errUnknownCommand, "commands are replied once")
+
+	require.NoError(t, d.reply(request.id, "dev1", msg, now))
+	assert.Equal(t, "_INBOX.1", msg.Topic)
+}
+
+// dialDeviceWebsocket connects to the websocket as the authenticated device.
+func dialDeviceWebsocket(t *testing.T, a *application, deviceID string) *websocket.Conn {
+	t.Helper()
+
+	r := gin.New()
+	r.GET("/v1/ws", func(c *gin.Context) { c.Set(deviceIDKey, deviceID) }, a.websocketIoTHandler)
+	conn, _, err := websocket.DefaultDialer.Dial(newWSServer(t, r), nil)
+	require.NoError(t, err)
+	t.Cleanup(func() { conn.Close() })
+	return conn
+}
+
+func TestWebsocket_Downlink(t *testing.T) {
+	a := newTestAgentApp(t)
+	a.config.APIService.Websocket.Downlink = &config.WebsocketDownlinkYAML{Broker: "fake", Topic: "devices.{device}.cmd", ReplyTopic: "devices.{device}.reply"}
+	stop, err := a.startWSDownlink()
+	require.NoError(t, err)
+	defer stop()
+
+	broker := a.TelemetryAgent.Brokers["fake"].(*fakeBroker)
+	broker.deliver(&message.Message{Topic: "devices.dev1.cmd", Payload: []byte("reboot")})
+
+	// The queued command is sent once the device is connected
+	conn := dialDeviceWebsocket(t, a, "dev1")
+	var cmd wsResponse
+	require.NoError(t, conn.ReadJSON(&cmd))
+	assert.Equal(t, statusCommand, cmd.Status)
+	assert.Equal(t, "devices.dev1.cmd", cmd.Topic)
+	assert.Equal(t, "reboot", string(cmd.Payload))
+
+	// Online devices receive the commands right away, with the ID of the backend
+	broker.deliver(&message.Message{Topic: "devices.dev1.cmd", Payload: []byte("ping"), Metadata: map[string]string{message.MetadataCorrelationID: "backend-1"}})
+	require.NoError(t, conn.ReadJSON(&cmd))
+	assert.Equal(t, "ping", string(cmd.Payload))
+	assert.Equal(t, "backend-1", cmd.ID)
+
+	require.NoError(t, conn.WriteJSON(gin.H{"correlation_id": cmd.ID, "payload": gin.H{"ok": true}}))
+	reply := popQueued(t, a)
+	assert.Equal(t, "devices.dev1.reply", reply.Topic)
+	assert.Equal(t, "dev1", reply.DeviceID)
+	assert.Equal(t, []string{"fake"}, reply.TargetBrokers)
+	assert.Equal(t, cmd.ID, reply.Metadata[message.MetadataCorrelationID])
+	assert.JSONEq(t, `{"ok": true}`, string(reply.Payload))
+
+	// Unknown commands are rejected
+	require.NoError(t, conn.WriteJSON(gin.H{"correlation_id": "cmd-1"}))
+	var resp wsResponse
+	require.NoError(t, conn.ReadJSON(&resp))
+	assert.Equal(t, errUnknownCommand.Error(), resp.Error)
+}
+
+func TestWebsocket_DownlinkUnauthenticated(t *testing.T) {
+	a := newTestAgentApp(t)
+	a.config.APIService.Websocket.Downlink = &config.WebsocketDownlinkYAML{Broker: "fake", Topic: "devices.{device}.cmd", ReplyTopic: "devices.{device}.reply"}
+	stop, err := a.startWSDownlink()
+	require.NoError(t, err)
+	defer stop()
+
+	broker := a.TelemetryAgent.Brokers["fake"].(*fakeBroker)
+	broker.deliver(&message.Message{Topic: "devices.dev1.cmd", Payload: []byte("reboot"), Metadata: map[string]string{message.MetadataCorrelationID: "backend-1"}})
+
+	// A connection claiming the device in its messages doesn't get its commands
+	conn := dialWebsocket(t, a, "")
+	require.NoError(t, conn.WriteJSON(gin.H{"device_id": "dev1", "topic": "t"}))
+	popQueued(t, a)
+	require.NoError(t, conn.WriteJSON(gin.H{"correlation_id": "backend-1"}))
+	var resp wsResponse
+	require.NoError(t, conn.ReadJSON(&resp))
+	assert.Equal(t, errUnauthenticatedDevice.Error(), resp.Error)
+
+	// The command waits for the authenticated device
+	device := dialDeviceWebsocket(t, a, "dev1")
+	var cmd wsResponse
+	require.NoError(t, device.ReadJSON(&cmd))
+	assert.Equal(t, "backend-1", cmd.ID)
+}
+
+func TestWSDownlink_ReplyHeader(t *testing.T) {
+	logger := zerolog.Nop()
+	ctx, cancel := context.WithCancel(context.Background())
+	t.Cleanup(cancel)
+
+	conn := &natsConn{published: make(chan *nats.Msg, 1)}
+	ag, err := agent.NewTelemetryAgentWithBrokers(ctx,
+		&config.TelemetryAgentYAML{QueueSize: 10, MaxWorkers: 1},
+		map[string]brokers.Broker{"nats": natsbroker.NewBrokerWithConnector(natsbroker.Config{Name: "nats"}, conn)},
+		&logger,
+	)
+	require.NoError(t, err)
+	ag.StartWorkerPool()
+	ag.Start()
+
+	d := newWSDownlink(config.WebsocketDownlinkYAML{Broker: "nats", Topic: "devices.{device}.cmd", ReplyTopic: "devices.{device}.reply"})
+	cmd, _ := d.command(&message.Message{Topic: "devices.dev1.cmd", Metadata: map[string]string{message.MetadataCorrelationID: "backend-1"}}, time.Now())
+	d.sent(cmd, time.Now())
+
+	msg := &message.Message{Payload: []byte("{}")}
+	require.NoError(t, d.reply(cmd.id, "dev1", msg, time.Now()))
+	require.NoError(t, ag.Submit(msg))
+
+	// The backend matches the reply with the correlation_id header
+	select {
+	case published := <-conn.published:
+		assert.Equal(t, "devices.dev1.reply", published.Subject)
+		assert.Equal(t, "backend-1", published.Header.Get(message.MetadataCorrelationID))
+	case <-time.After(5 * time.Second):
+		t.Fatal("reply was not published")
+	}
+}
@@ -0,0 +1,70 @@
+package main
+
+import (
+	"slices"
+	"sync"
+	"time"
+)
+
+// wsRegistry keeps the websocket connections of the process.
+type wsRegistry struct {
+	mu      sync.RWMutex
+	clients map[string]*wsClient // by connection ID
+}
+
+// wsConnectionInfo describes a connection on the admin endpoints.
+type wsConnectionInfo struct {
+	ID               string    `json:"id"`
+	DeviceID         string    `json:"device_id"`
+	Container        string    `json:"container,omitempty"`
+	RemoteAddr       string    `json:"remote_addr"`
+	Subprotocol      string    `json:"subprotocol,omitempty"`
+	ConnectedAt      time.Time `json:"connected_at"`
+	MessagesReceived uint64    `json:"messages_received"`
+	MessagesQueued   uint64    `json:"messages_queued"`
+	MessagesRejected uint64    `json:"messages_rejected"`
+}
+
+func (r *wsRegistry) add(c *wsClient) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.clients == nil {
+		r.clients = make(map[string]*wsClient)
+	}
+	r.clients[c.id] = c
+}
+
+func (r *wsRegistry) remove(c *wsClient) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	delete(r.clients, c.id)
+}
+
+// device returns the connections of the device.
+func (r *wsRegistry) device(deviceID string) []*wsClient {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	var clients []*wsClient
+	for _, c := range r.clients {
+		if c.deviceID() == deviceID {
+			clients = append(clients, c)
+		}
+	}
+	return clients
+}
+
+// list returns the connections from the oldest to the newest.
+func (r *wsRegistry) list() []wsConnectionInfo {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	infos := make([]wsConnectionInfo, 0, len(r.clients))
+	for _, c := range r.clients {
+		infos = append(infos, c.info())
+	}
+	slices.SortFunc(infos, func(a, b wsConnectionInfo) int {
+		return a.ConnectedAt.Compare(b.ConnectedAt)
+	})
+	return infos
+}
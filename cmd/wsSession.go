@@ -0,0 +1,158 @@
+package main
+
+import (
+	"crypto/rand"
+	"errors"
+	"slices"
+	"sync"
+	"time"
+)
+
+// maxSessionGaps is the number of out-of-order sequences kept per session. Past
+// it, the oldest missing sequences are given up.
+const maxSessionGaps = 1024
+
+var errSessionDevice = errors.New("session belongs to another device")
+
+// wsSession remembers the sequences received from a device across its websocket
+// connections, so messages resent after a reconnection are not forwarded twice.
+type wsSession struct {
+	id       string
+	deviceID string
+
+	mu      sync.Mutex
+	started bool
+	lastSeq uint64              // all sequences up to lastSeq were received
+	seqs    map[uint64]struct{} // received sequences above lastSeq
+
+	client     *wsClient // connection using the session, nil once detached
+	detachedAt time.Time
+}
+
+// state returns the sequences received: all up to lastSeq and seqs.
+func (s *wsSession) state() (uint64, []uint64) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.lastSeq, s.sorted()
+}
+
+// sorted returns the sequences received above lastSeq in order.
+func (s *wsSession) sorted() []uint64 {
+	seqs := make([]uint64, 0, len(s.seqs))
+	for seq := range s.seqs {
+		seqs = append(seqs, seq)
+	}
+	slices.Sort(seqs)
+	return seqs
+}
+
+// ack forgets the sequences up to lastAck, which the device won't resend.
+func (s *wsSession) ack(lastAck uint64) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if lastAck > s.lastSeq {
+		s.started = true
+		s.lastSeq = lastAck
+		s.compact()
+	}
+}
+
+// submit calls submit for the sequence unless it was already received. The
+// sequence is recorded when submit returns true. It returns false for duplicates.
+func (s *wsSession) submit(seq uint64, submit func() bool) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	// A new session starts at the first sequence sent
+	if !s.started {
+		s.started = true
+		s.lastSeq = seq - 1
+	}
+
+	if _, found := s.seqs[seq]; found || seq <= s.lastSeq {
+		return false
+	}
+	if submit() {
+		s.seqs[seq] = struct{}{}
+		s.compact()
+	}
+	return true
+}
+
+// compact moves lastSeq over the contiguous sequences received, giving up the
+// oldest gaps when too many sequences are out of order.
+func (s *wsSession) compact() {
+	for seq := range s.seqs {
+		if seq <= s.lastSeq {
+			delete(s.seqs, seq)
+		}
+	}
+	if len(s.seqs) > maxSessionGaps {
+		given := s.sorted()[:len(s.seqs)-maxSessionGaps]
+		for _, seq := range given {
+			delete(s.seqs, seq)
+		}
+		s.lastSeq = given[len(given)-1]
+	}
+	for {
+		if _, found := s.seqs[s.lastSeq+1]; !found {
+			return
+		}
+		s.lastSeq++
+		delete(s.seqs, s.lastSeq)
+	}
+}
+
+// wsSessions keeps the sessions of the process. Detached sessions expire after ttl.
+type wsSessions struct {
+	mu       sync.Mutex
+	sessions map[string]*wsSession
+}
+
+// attach binds the connection to the session, creating a new one when the ID is
+// empty or unknown. The connection that was using the session is returned so it
+// can be closed.
+func (r *wsSessions) attach(id, deviceID string, c *wsClient, ttl time.Duration) (*wsSession, *wsClient, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.sessions == nil {
+		r.sessions = make(map[string]*wsSession)
+	}
+	r.expire(time.Now(), ttl)
+
+	s, found := r.sessions[id]
+	if !found {
+		// Random IDs, so sessions of other devices can't be guessed
+		s = &wsSession{id: rand.Text(), deviceID: deviceID, seqs: make(map[uint64]struct{})}
+		r.sessions[s.id] = s
+	}
+	if s.deviceID != deviceID {
+		return nil, nil, errSessionDevice
+	}
+
+	previous := s.client
+	s.client = c
+	return s, previous, nil
+}
+
+// detach releases the session if the connection still uses it.
+func (r *wsSessions) detach(s *wsSession, c *wsClient) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if s.client == c {
+		s.client = nil
+		s.detachedAt = time.Now()
+	}
+}
+
+// expire removes the sessions detached for longer than ttl.
+func (r *wsSessions) expire(now time.Time, ttl time.Duration) {
+	for id, s := range r.sessions {
+		if s.client == nil && now.Sub(s.detachedAt) > ttl {
+			delete(r.sessions, id)
+		}
+	}
+}
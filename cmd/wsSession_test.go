@@ -0,0 +1,125 @@
+package main
+
+import (
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/gorilla/websocket"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestWSSession_Submit(t *testing.T) {
+	s := &wsSession{seqs: make(map[uint64]struct{})}
+	accept := func() bool { return true }
+
+	// The session starts at the first sequence, then gaps are kept apart
+	for _, seq := range []uint64{5, 6, 8, 10} {
+		assert.True(t, s.submit(seq, accept))
+	}
+	lastSeq, seqs := s.state()
+	assert.Equal(t, uint64(6), lastSeq)
+	assert.Equal(t, []uint64{8, 10}, seqs)
+
+	assert.False(t, s.submit(6, accept), "sequence already received")
+	assert.False(t, s.submit(8, accept), "sequence already received")
+	assert.False(t, s.submit(4, accept), "sequence before the session")
+
+	// Sequences not queued are not recorded
+	assert.True(t, s.submit(7, func() bool { return false }))
+	assert.True(t, s.submit(7, accept))
+	lastSeq, seqs = s.state()
+	assert.Equal(t, uint64(8), lastSeq)
+	assert.Equal(t, []uint64{10}, seqs)
+
+	// The device won't resend up to its last ack
+	s.ack(11)
+	lastSeq, seqs = s.state()
+	assert.Equal(t, uint64(11), lastSeq)
+	assert.Empty(t, seqs)
+}
+
+func TestWSSession_MaxGaps(t *testing.T) {
+	s := &wsSession{seqs: make(map[uint64]struct{})}
+	s.submit(1, func() bool { return true })
+	for i := range uint64(maxSessionGaps + 1) {
+		s.submit(3+2*i, func() bool { return true })
+	}
+
+	lastSeq, seqs := s.state()
+	assert.Equal(t, uint64(3), lastSeq, "the oldest gap is given up")
+	assert.Len(t, seqs, maxSessionGaps)
+}
+
+func TestWSSessions_Attach(t *testing.T) {
+	var sessions wsSessions
+	first, second := &wsClient{}, &wsClient{}
+
+	s, previous, err := sessions.attach("", "dev1", first, time.Minute)
+	require.NoError(t, err)
+	assert.Nil(t, previous)
+	assert.NotEmpty(t, s.id)
+
+	resumed, previous, err := sessions.attach(s.id, "dev1", second, time.Minute)
+	require.NoError(t, err)
+	assert.Same(t, s, resumed)
+	assert.Same(t, first, previous)
+
+	_, _, err = sessions.attach(s.id, "dev2", first, time.Minute)
+	assert.ErrorIs(t, err, errSessionDevice)
+
+	// Detached sessions expire
+	sessions.detach(s, first)
+	assert.Same(t, second, s.client, "the session is used by the second connection")
+	sessions.detach(s, second)
+	unknown, _, err := sessions.attach(s.id, "dev1", first, 0)
+	require.NoError(t, err)
+	assert.NotEqual(t, s.id, unknown.id)
+}
+
+func TestWebsocket_SessionResume(t *testing.T) {
+	a := newTestAgentApp(t)
+	r := gin.New()
+	r.GET("/v1/ws", a.websocketIoTHandler)
+	srv := newWSServer(t, r)
+
+	conn, _, err := websocket.DefaultDialer.Dial(srv+"?ack=queued&session=new", nil)
+	require.NoError(t, err)
+
+	var session wsResponse
+	require.NoError(t, conn.ReadJSON(&session))
+	assert.Equal(t, statusSession, session.Status)
+	require.NotEmpty(t, session.Session)
+
+	for seq := 1; seq <= 3; seq++ {
+		require.NoError(t, conn.WriteJSON(gin.H{"seq": seq, "topic": "t"}))
+		var ack wsResponse
+		require.NoError(t, conn.ReadJSON(&ack))
+		assert.Equal(t, uint64(seq), ack.Seq)
+		assert.Equal(t, statusQueued, ack.Status)
+	}
+	// Seq 4 is lost with the link, seq 5 arrives but its ack doesn't
+	require.NoError(t, conn.WriteJSON(gin.H{"seq": 5, "topic": "t"}))
+	require.Eventually(t, func() bool { return a.TelemetryAgent.Queue.Len() == 4 }, 2*time.Second, 10*time.Millisecond)
+	conn.Close()
+
+	conn, _, err = websocket.DefaultDialer.Dial(srv+"?ack=queued&session="+session.Session+"&last_ack=3", nil)
+	require.NoError(t, err)
+	defer conn.Close()
+
+	require.NoError(t, conn.ReadJSON(&session))
+	assert.Equal(t, uint64(3), session.LastSeq)
+	assert.Equal(t, []uint64{5}, session.Seqs)
+
+	for _, seq := range []uint64{4, 5} {
+		require.NoError(t, conn.WriteJSON(gin.H{"seq": seq, "topic": "t"}))
+	}
+	var ack wsResponse
+	require.NoError(t, conn.ReadJSON(&ack))
+	assert.Equal(t, statusQueued, ack.Status)
+	require.NoError(t, conn.ReadJSON(&ack))
+	assert.Equal(t, statusDuplicate, ack.Status)
+	assert.Equal(t, uint64(5), ack.Seq)
+	assert.Equal(t, 5, a.TelemetryAgent.Queue.Len())
+}
@@ -0,0 +1,220 @@
+package agent
+
+import (
+	"encoding/json"
+	"math"
+	"sync"
+	"time"
+
+	"github.com/LincolnG4/iot-hydra/internal/config"
+	"github.com/LincolnG4/iot-hydra/internal/message"
+)
+
+type seriesKey struct {
+	deviceID string
+	topic    string
+}
+
+type sample struct {
+	at    time.Time
+	value float64
+}
+
+// series holds the samples of one device and topic inside the current window.
+type series struct {
+	brokers []string
+	fields  map[string][]sample
+}
+
+// FieldStats are the statistics of a numeric field over a window.
+type FieldStats struct {
+	Min   float64 `json:"min"`
+	Max   float64 `json:"max"`
+	Mean  float64 `json:"mean"`
+	Count int     `json:"count"`
+	Last  float64 `json:"last"`
+}
+
+// AggregatedPayload is the payload of the messages emitted by the aggregation stage.
+type AggregatedPayload struct {
+	SourceTopic string                `json:"source_topic"`
+	WindowStart time.Time             `json:"window_start"`
+	WindowEnd   time.Time             `json:"window_end"`
+	Fields      map[string]FieldStats `json:"fields"`
+}
+
+// aggregator groups numeric payload fields by device and topic over tumbling
+// or sliding windows.
+type aggregator struct {
+	cfg    config.AggregationYAML
+	mu     sync.Mutex
+	series map[seriesKey]*series
+}
+
+func newAggregator(cfg config.AggregationYAML) *aggregator {
+	if cfg.Slide == 0 {
+		cfg.Slide = cfg.Window
+	}
+	return &aggregator{
+		cfg:    cfg,
+		series: make(map[seriesKey]*series),
+	}
+}
+
+// add stores the numeric fields of the message payload. Payloads that are not a
+// JSON object are ignored.
+func (a *aggregator) add(msg *message.Message, now time.Time) {
+	fields := numericFields(msg.Payload)
+	if len(fields) == 0 {
+		return
+	}
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	key := seriesKey{deviceID: msg.DeviceID, topic: msg.Topic}
+	s, exist := a.series[key]
+	if !exist {
+		s = &series{fields: make(map[string][]sample)}
+		a.series[key] = s
+	}
+	s.brokers = msg.TargetBrokers
+	for name, value := range fields {
+		s.fields[name] = append(s.fields[name], sample{at: now, value: value})
+	}
+}
+
+// flush computes the window ending at now for every series and returns the aggregated
+// messages. Samples that won't be part of the next window are discarded.
+func (a *aggregator) flush(now time.Time) []*message.Message {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	start := now.Add(-a.cfg.Window)
+	// Samples before keepFrom are out of the next window
+	keepFrom := start.Add(a.cfg.Slide)
+
+	var out []*message.Message
+	for key, s := range a.series {
+		stats := make(map[string]FieldStats)
+		for name, samples := range s.fields {
+			if st, ok := computeStats(samples, start); ok {
+				stats[name] = st
+			}
+
+			kept := samples[:0]
+			for _, smp := range samples {
+				if smp.at.After(keepFrom) {
+					kept = append(kept, smp)
+				}
+			}
+			if len(kept) == 0 {
+				delete(s.fields, name)
+			} else {
+				s.fields[name] = kept
+			}
+		}
+
+		if len(s.fields) == 0 {
+			delete(a.series, key)
+		}
+
+		if len(stats) == 0 {
+			continue
+		}
+
+		msg, err := a.newAggregatedMessage(key, s.brokers, start, now, stats)
+		if err != nil {
+			continue
+		}
+		out = append(out, msg)
+	}
+	return out
+}
+
+func (a *aggregator) newAggregatedMessage(key seriesKey, brokers []string, start, end time.Time, stats map[string]FieldStats) (*message.Message, error) {
+	payload, err := json.Marshal(AggregatedPayload{
+		SourceTopic: key.topic,
+		WindowStart: start,
+		WindowEnd:   end,
+		Fields:      stats,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	topic := a.cfg.Topic
+	if topic == "" {
+		topic = key.topic + "/agg"
+	}
+	if len(a.cfg.Brokers) > 0 {
+		brokers = a.cfg.Brokers
+	}
+
+	return &message.Message{
+		ID:            message.NewID("agg"),
+		DeviceID:      key.deviceID,
+		Timestamp:     end,
+		Payload:       payload,
+		TargetBrokers: brokers,
+		Topic:         topic,
+		Metadata:      map[string]string{"aggregation_window": a.cfg.Window.String()},
+	}, nil
+}
+
+// computeStats returns the statistics of the samples taken after start.
+func computeStats(samples []sample, start time.Time) (FieldStats, bool) {
+	st := FieldStats{Min: math.Inf(1), Max: math.Inf(-1)}
+	var sum float64
+	for _, smp := range samples {
+		if !smp.at.After(start) {
+			continue
+		}
+		st.Min = math.Min(st.Min, smp.value)
+		st.Max = math.Max(st.Max, smp.value)
+		st.Last = smp.value
+		sum += smp.value
+		st.Count++
+	}
+
+	if st.Count == 0 {
+		return FieldStats{}, false
+	}
+	st.Mean = sum / float64(st.Count)
+	return st, true
+}
+
+// run emits the aggregated messages every slide until the agent stops.
+func (a *aggregator) run(t *TelemetryAgent) {
+	ticker := time.NewTicker(a.cfg.Slide)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case now := <-ticker.C:
+			for _, msg := range a.flush(now) {
+				if err := t.RouteMessage(msg); err != nil {
+					t.logger.Error().Err(err).Str("message_id", msg.ID).Msg("failed to route aggregated message")
+				}
+			}
+		case <-t.ctx.Done():
+			return
+		}
+	}
+}
+
+// numericFields returns the top level numeric fields of a JSON object payload.
+func numericFields(payload []byte) map[string]float64 {
+	var obj map[string]any
+	if err := json.Unmarshal(payload, &obj); err != nil {
+		return nil
+	}
+
+	fields := make(map[string]float64)
+	for name, value := range obj {
+		if v, ok := value.(float64); ok {
+			fields[name] = v
+		}
+	}
+	return fields
+}
@@ -0,0 +1,87 @@
+package agent
+
+import (
+	"encoding/json"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/LincolnG4/iot-hydra/internal/config"
+	"github.com/LincolnG4/iot-hydra/internal/message"
+	"github.com/alecthomas/assert"
+)
+
+func TestAggregator_Tumbling(t *testing.T) {
+	a := newAggregator(config.AggregationYAML{Window: 10 * time.Second, Brokers: []string{"cloud"}})
+	start := time.Unix(1000, 0)
+
+	for i, v := range []float64{3, 1, 2} {
+		a.add(&message.Message{
+			DeviceID: "dev1",
+			Topic:    "sensors/temp",
+			Payload:  []byte(fmt.Sprintf(`{"temp": %v, "unit": "C"}`, v)),
+		}, start.Add(time.Duration(i+1)*time.Second))
+	}
+	a.add(&message.Message{DeviceID: "dev1", Topic: "sensors/temp", Payload: []byte(`not json`)}, start)
+
+	out := a.flush(start.Add(10 * time.Second))
+	assert.Equal(t, 1, len(out))
+	assert.Equal(t, "sensors/temp/agg", out[0].Topic)
+	assert.Equal(t, []string{"cloud"}, out[0].TargetBrokers)
+
+	var payload AggregatedPayload
+	assert.NoError(t, json.Unmarshal(out[0].Payload, &payload))
+	assert.Equal(t, FieldStats{Min: 1, Max: 3, Mean: 2, Count: 3, Last: 2}, payload.Fields["temp"])
+	_, exist := payload.Fields["unit"]
+	assert.False(t, exist, "non numeric fields are not aggregated")
+
+	// Tumbling window starts empty
+	assert.Equal(t, 0, len(a.flush(start.Add(20*time.Second))))
+	assert.Equal(t, 0, len(a.series), "empty series must be released")
+}
+
+func TestAggregator_UniqueIDs(t *testing.T) {
+	a := newAggregator(config.AggregationYAML{Window: 10 * time.Second})
+	start := time.Unix(1000, 0)
+	a.add(&message.Message{DeviceID: "dev1", Topic: "t", Payload: []byte(`{"v": 1}`)}, start.Add(time.Second))
+	a.add(&message.Message{DeviceID: "dev2", Topic: "t", Payload: []byte(`{"v": 1}`)}, start.Add(time.Second))
+
+	out := a.flush(start.Add(10 * time.Second))
+	assert.Equal(t, 2, len(out))
+	assert.NotEqual(t, out[0].ID, out[1].ID)
+}
+
+func TestAggregator_Sliding(t *testing.T) {
+	a := newAggregator(config.AggregationYAML{Window: 10 * time.Second, Slide: 5 * time.Second, Topic: "agg"})
+	start := time.Unix(1000, 0)
+
+	a.add(&message.Message{DeviceID: "dev1", Topic: "t", Payload: []byte(`{"v": 1}`)}, start.Add(2*time.Second))
+	a.add(&message.Message{DeviceID: "dev1", Topic: "t", Payload: []byte(`{"v": 5}`)}, start.Add(7*time.Second))
+
+	out := a.flush(start.Add(10 * time.Second))
+	var payload AggregatedPayload
+	assert.NoError(t, json.Unmarshal(out[0].Payload, &payload))
+	assert.Equal(t, 2, payload.Fields["v"].Count)
+
+	// The sample at 7s still belongs to the next window
+	out = a.flush(start.Add(15 * time.Second))
+	assert.NoError(t, json.Unmarshal(out[0].Payload, &payload))
+	assert.Equal(t, FieldStats{Min: 5, Max: 5, Mean: 5, Count: 1, Last: 5}, payload.Fields["v"])
+	assert.Equal(t, "agg", out[0].Topic)
+}
+
+func TestHandleMessage_Aggregation(t *testing.T) {
+	ag, mocks := newTestAgent(t, "cloud", "local")
+	ag.routes = newRoutes([]config.RouteYAML{
+		{Topic: "raw/#", Aggregation: &config.AggregationYAML{Window: time.Minute, RawBrokers: []string{"local"}}},
+		{Topic: "dropped/#", Aggregation: &config.AggregationYAML{Window: time.Minute}},
+	})
+
+	assert.NoError(t, ag.handleMessage(&message.Message{Topic: "raw/a", Payload: []byte(`{"v": 1}`), TargetBrokers: []string{"cloud"}}))
+	assert.NoError(t, ag.handleMessage(&message.Message{Topic: "dropped/a", Payload: []byte(`{"v": 1}`), TargetBrokers: []string{"cloud"}}))
+	assert.NoError(t, ag.handleMessage(&message.Message{Topic: "other", TargetBrokers: []string{"cloud"}}))
+
+	waitPublished(t, mocks["local"], 1)
+	published := waitPublished(t, mocks["cloud"], 1)
+	assert.Equal(t, "other", published[0].Topic)
+}
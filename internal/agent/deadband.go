@@ -0,0 +1,120 @@
+package agent
+
+import (
+	"container/list"
+	"math"
+	"sync"
+	"time"
+
+	"github.com/LincolnG4/iot-hydra/internal/config"
+	"github.com/LincolnG4/iot-hydra/internal/message"
+)
+
+const defaultDeadbandEntries = 10000
+
+type fieldKey struct {
+	deviceID string
+	topic    string
+	field    string
+}
+
+// fieldState is the last forwarded value of a field.
+type fieldState struct {
+	key         fieldKey
+	value       float64
+	forwardedAt time.Time
+}
+
+// deadbandFilter implements report-by-exception. The states are kept in a LRU list,
+// so the least recently updated field is evicted when the limit is reached.
+type deadbandFilter struct {
+	cfg     config.DeadbandYAML
+	mu      sync.Mutex
+	lru     *list.List // front is the most recently used state
+	entries map[fieldKey]*list.Element
+}
+
+func newDeadbandFilter(cfg config.DeadbandYAML) *deadbandFilter {
+	if cfg.MaxEntries <= 0 {
+		cfg.MaxEntries = defaultDeadbandEntries
+	}
+	return &deadbandFilter{
+		cfg:     cfg,
+		lru:     list.New(),
+		entries: make(map[fieldKey]*list.Element),
+	}
+}
+
+// allow reports whether the message must be forwarded. Messages without numeric
+// fields are always forwarded. When the message is forwarded because of the
+// heartbeat, it is tagged in the metadata.
+func (d *deadbandFilter) allow(msg *message.Message, now time.Time) bool {
+	fields := numericFields(msg.Payload)
+	if len(fields) == 0 {
+		return true
+	}
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	changed, heartbeat := false, false
+	for name, value := range fields {
+		elem, exist := d.entries[fieldKey{deviceID: msg.DeviceID, topic: msg.Topic, field: name}]
+		if !exist {
+			changed = true
+			continue
+		}
+
+		state := elem.Value.(*fieldState)
+		if d.exceeds(state.value, value) {
+			changed = true
+		} else if d.cfg.Heartbeat > 0 && now.Sub(state.forwardedAt) >= d.cfg.Heartbeat {
+			heartbeat = true
+		}
+	}
+
+	if !changed && !heartbeat {
+		return false
+	}
+	if !changed {
+		msg.SetMetadata("deadband", "heartbeat")
+	}
+
+	for name, value := range fields {
+		d.store(fieldKey{deviceID: msg.DeviceID, topic: msg.Topic, field: name}, value, now)
+	}
+	return true
+}
+
+// exceeds reports whether the value moved out of the deadband around last.
+func (d *deadbandFilter) exceeds(last, value float64) bool {
+	diff := math.Abs(value - last)
+	switch {
+	case d.cfg.Absolute == 0 && d.cfg.Percent == 0:
+		return diff > 0
+	case d.cfg.Absolute > 0 && diff > d.cfg.Absolute:
+		return true
+	case d.cfg.Percent > 0 && diff > math.Abs(last)*d.cfg.Percent/100:
+		return true
+	default:
+		return false
+	}
+}
+
+// store saves the forwarded value, evicting the least recently used state if needed.
+func (d *deadbandFilter) store(key fieldKey, value float64, now time.Time) {
+	if elem, exist := d.entries[key]; exist {
+		state := elem.Value.(*fieldState)
+		state.value = value
+		state.forwardedAt = now
+		d.lru.MoveToFront(elem)
+		return
+	}
+
+	if d.lru.Len() >= d.cfg.MaxEntries {
+		oldest := d.lru.Back()
+		d.lru.Remove(oldest)
+		delete(d.entries, oldest.Value.(*fieldState).key)
+	}
+	d.entries[key] = d.lru.PushFront(&fieldState{key: key, value: value, forwardedAt: now})
+}
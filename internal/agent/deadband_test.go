@@ -0,0 +1,78 @@
+package agent
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/LincolnG4/iot-hydra/internal/config"
+	"github.com/LincolnG4/iot-hydra/internal/message"
+	"github.com/alecthomas/assert"
+)
+
+func reading(deviceID string, value float64) *message.Message {
+	return &message.Message{
+		DeviceID: deviceID,
+		Topic:    "sensors/temp",
+		Payload:  []byte(fmt.Sprintf(`{"temp": %v}`, value)),
+	}
+}
+
+func TestDeadbandFilter(t *testing.T) {
+	start := time.Unix(1000, 0)
+
+	tests := []struct {
+		name     string
+		cfg      config.DeadbandYAML
+		values   []float64
+		expected []bool
+	}{
+		{"report on change", config.DeadbandYAML{}, []float64{20, 20, 20.1}, []bool{true, false, true}},
+		{"absolute", config.DeadbandYAML{Absolute: 1}, []float64{20, 20.5, 20.9, 21.5}, []bool{true, false, false, true}},
+		{"compares with last forwarded value", config.DeadbandYAML{Absolute: 1}, []float64{20, 20.6, 21.2}, []bool{true, false, true}},
+		{"percent", config.DeadbandYAML{Percent: 10}, []float64{100, 105, 111}, []bool{true, false, true}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			d := newDeadbandFilter(tt.cfg)
+			for i, v := range tt.values {
+				assert.Equal(t, tt.expected[i], d.allow(reading("dev1", v), start), "reading %d", i)
+			}
+		})
+	}
+}
+
+func TestDeadbandFilter_Heartbeat(t *testing.T) {
+	d := newDeadbandFilter(config.DeadbandYAML{Absolute: 1, Heartbeat: time.Minute})
+	start := time.Unix(1000, 0)
+
+	assert.True(t, d.allow(reading("dev1", 20), start))
+	assert.False(t, d.allow(reading("dev1", 20), start.Add(30*time.Second)))
+
+	msg := reading("dev1", 20)
+	assert.True(t, d.allow(msg, start.Add(time.Minute)))
+	assert.Equal(t, "heartbeat", msg.Metadata["deadband"])
+	assert.False(t, d.allow(reading("dev1", 20), start.Add(90*time.Second)), "heartbeat restarts the silence")
+}
+
+func TestDeadbandFilter_BoundedMemory(t *testing.T) {
+	d := newDeadbandFilter(config.DeadbandYAML{MaxEntries: 2})
+	now := time.Unix(1000, 0)
+
+	assert.True(t, d.allow(reading("dev1", 1), now))
+	assert.True(t, d.allow(reading("dev2", 1), now))
+	assert.True(t, d.allow(reading("dev3", 1), now))
+	assert.Equal(t, 2, d.lru.Len())
+
+	// dev1 was evicted, so it is seen as new
+	assert.True(t, d.allow(reading("dev1", 1), now))
+	assert.False(t, d.allow(reading("dev3", 1), now))
+}
+
+func TestDeadbandFilter_NonNumeric(t *testing.T) {
+	d := newDeadbandFilter(config.DeadbandYAML{})
+	msg := &message.Message{Topic: "logs", Payload: []byte("hello")}
+	assert.True(t, d.allow(msg, time.Now()))
+	assert.True(t, d.allow(msg, time.Now()))
+}
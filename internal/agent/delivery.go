@@ -0,0 +1,46 @@
+package agent
+
+import (
+	"errors"
+
+	"github.com/LincolnG4/iot-hydra/internal/message"
+)
+
+var (
+	// ErrMessageExpired is reported when the message expired in the queue.
+	ErrMessageExpired = errors.New("message expired before being routed")
+	// ErrMessageFiltered is reported when the stages of the route consumed the message.
+	ErrMessageFiltered = errors.New("message filtered by its route")
+	// ErrNoTargetBrokers is reported when the message has no target broker.
+	ErrNoTargetBrokers = errors.New("message has no target broker")
+)
+
+// DeliveryFunc reports the outcome of a message. It is called once per target
+// broker with the publish error, or once with an empty broker and the error telling
+// why the message was not routed. It is called from the workers, so it must not block.
+type DeliveryFunc func(msg *message.Message, broker string, err error)
+
+// SubmitWithDelivery works as Submit and reports the delivery of the message to
+// fn when it is enqueued.
+func (t *TelemetryAgent) SubmitWithDelivery(m *message.Message, fn DeliveryFunc) error {
+	if fn == nil {
+		return t.Submit(m)
+	}
+
+	t.deliveries.Store(m, fn)
+	err := t.Submit(m)
+	if err != nil && !IsQueued(err) {
+		t.deliveries.Delete(m)
+	}
+	return err
+}
+
+// takeDelivery removes and returns the delivery function of the message. Without
+// one, it returns a function doing nothing.
+func (t *TelemetryAgent) takeDelivery(m *message.Message) DeliveryFunc {
+	fn, ok := t.deliveries.LoadAndDelete(m)
+	if !ok {
+		return func(*message.Message, string, error) {}
+	}
+	return fn.(DeliveryFunc)
+}
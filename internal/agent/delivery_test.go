@@ -0,0 +1,65 @@
+package agent
+
+import (
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/LincolnG4/iot-hydra/internal/message"
+	"github.com/alecthomas/assert"
+)
+
+func TestSubmitWithDelivery(t *testing.T) {
+	ag, _ := newTestAgent(t, "cloud")
+
+	var mu sync.Mutex
+	results := make(map[string]error)
+	done := make(chan struct{}, 3)
+	deliver := func(_ *message.Message, broker string, err error) {
+		mu.Lock()
+		results[broker] = err
+		mu.Unlock()
+		done <- struct{}{}
+	}
+
+	msg := &message.Message{ID: "m1", Topic: "t", TargetBrokers: []string{"cloud", "missing"}}
+	assert.NoError(t, ag.SubmitWithDelivery(msg, deliver))
+	popped, _ := ag.Queue.Pop(ag.ctx)
+	assert.NoError(t, ag.handleMessage(popped))
+
+	for range 2 {
+		select {
+		case <-done:
+		case <-time.After(2 * time.Second):
+			t.Fatal("delivery not reported")
+		}
+	}
+	mu.Lock()
+	defer mu.Unlock()
+	assert.NoError(t, results["cloud"])
+	assert.Error(t, results["missing"])
+
+	_, pending := ag.deliveries.Load(msg)
+	assert.False(t, pending, "delivery must be forgotten once routed")
+}
+
+func TestSubmitWithDelivery_NotRouted(t *testing.T) {
+	ag, _ := newTestAgent(t, "cloud")
+
+	var reported error
+	deliver := func(_ *message.Message, broker string, err error) {
+		assert.Equal(t, "", broker)
+		reported = err
+	}
+
+	expired := &message.Message{Topic: "t", TargetBrokers: []string{"cloud"}, ExpiresAt: time.Now().Add(-time.Second)}
+	assert.NoError(t, ag.SubmitWithDelivery(expired, deliver))
+	popped, _ := ag.Queue.Pop(ag.ctx)
+	assert.True(t, ag.dropExpired(popped, time.Now()))
+	assert.Equal(t, ErrMessageExpired, reported)
+
+	assert.NoError(t, ag.SubmitWithDelivery(&message.Message{Topic: "t"}, deliver))
+	popped, _ = ag.Queue.Pop(ag.ctx)
+	assert.NoError(t, ag.handleMessage(popped))
+	assert.Equal(t, ErrNoTargetBrokers, reported)
+}
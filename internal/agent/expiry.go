@@ -0,0 +1,54 @@
+package agent
+
+import (
+	"time"
+
+	"github.com/LincolnG4/iot-hydra/internal/message"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/metric"
+)
+
+const (
+	ExpiryActionDiscard = "discard"
+	ExpiryActionArchive = "archive"
+)
+
+// applyTTL sets the expiration time of the message from the TTL of its route when
+// the message doesn't set one.
+func (t *TelemetryAgent) applyTTL(msg *message.Message, r *route) {
+	if r == nil || r.ttl == 0 || !msg.ExpiresAt.IsZero() {
+		return
+	}
+
+	from := msg.Timestamp
+	if from.IsZero() {
+		from = time.Now()
+	}
+	msg.ExpiresAt = from.Add(r.ttl)
+}
+
+// dropExpired discards or archives the message if it is expired. It returns true
+// when the message must not be routed. The queue is only kept in memory, there is
+// no persisted backlog to expire when the agent starts.
+func (t *TelemetryAgent) dropExpired(msg *message.Message, now time.Time) bool {
+	if !msg.Expired(now) {
+		return false
+	}
+	t.takeDelivery(msg)(msg, "", ErrMessageExpired)
+
+	action := t.expiry.Action
+	if action == "" {
+		action = ExpiryActionDiscard
+	}
+	t.expiredCnt.Add(t.ctx, 1, metric.WithAttributes(attribute.String("action", action)))
+	t.logger.Debug().Str("device_id", msg.DeviceID).Str("topic", msg.Topic).Str("message_id", msg.ID).Str("action", action).Msg("message expired")
+
+	if action == ExpiryActionArchive {
+		msg.SetMetadata("expired", msg.ExpiresAt.Format(time.RFC3339Nano))
+		msg.TargetBrokers = t.expiry.ArchiveBrokers
+		if err := t.RouteMessage(msg); err != nil {
+			t.logger.Error().Err(err).Str("message_id", msg.ID).Msg("failed to archive expired message")
+		}
+	}
+	return true
+}
@@ -0,0 +1,59 @@
+package agent
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/LincolnG4/iot-hydra/internal/config"
+	"github.com/LincolnG4/iot-hydra/internal/message"
+	"github.com/alecthomas/assert"
+)
+
+func TestSubmit_RouteTTL(t *testing.T) {
+	ag, _ := newTestAgent(t)
+	ag.routes = newRoutes([]config.RouteYAML{{Topic: "dashboards/#", TTL: time.Minute}})
+
+	now := time.Now()
+	fixed := now.Add(time.Hour)
+	assert.NoError(t, ag.Submit(&message.Message{ID: "route", Topic: "dashboards/temp", Timestamp: now}))
+	assert.NoError(t, ag.Submit(&message.Message{ID: "own", Topic: "dashboards/temp", ExpiresAt: fixed}))
+	assert.NoError(t, ag.Submit(&message.Message{ID: "none", Topic: "other"}))
+
+	msg, _ := ag.Queue.Pop(context.Background())
+	assert.Equal(t, now.Add(time.Minute), msg.ExpiresAt)
+	msg, _ = ag.Queue.Pop(context.Background())
+	assert.Equal(t, fixed, msg.ExpiresAt, "message expiration time has precedence")
+	msg, _ = ag.Queue.Pop(context.Background())
+	assert.True(t, msg.ExpiresAt.IsZero())
+}
+
+func TestDropExpired(t *testing.T) {
+	now := time.Now()
+
+	t.Run("not expired", func(t *testing.T) {
+		ag, _ := newTestAgent(t)
+		assert.False(t, ag.dropExpired(&message.Message{}, now))
+		assert.False(t, ag.dropExpired(&message.Message{ExpiresAt: now.Add(time.Second)}, now))
+	})
+
+	t.Run("discard", func(t *testing.T) {
+		ag, mocks := newTestAgent(t, "cloud")
+		msg := &message.Message{ExpiresAt: now.Add(-time.Second), TargetBrokers: []string{"cloud"}}
+		assert.True(t, ag.dropExpired(msg, now))
+		time.Sleep(20 * time.Millisecond)
+		assert.Equal(t, 0, len(mocks["cloud"].Published()))
+	})
+
+	t.Run("archive", func(t *testing.T) {
+		ag, mocks := newTestAgent(t, "cloud", "archive")
+		ag.expiry = config.ExpiryYAML{Action: ExpiryActionArchive, ArchiveBrokers: []string{"archive"}}
+
+		msg := &message.Message{ExpiresAt: now.Add(-time.Second), TargetBrokers: []string{"cloud"}}
+		assert.True(t, ag.dropExpired(msg, now))
+
+		archived := waitPublished(t, mocks["archive"], 1)
+		assert.NotZero(t, archived[0].Metadata["expired"])
+		assert.Equal(t, 0, len(mocks["cloud"].Published()))
+	})
+}
@@ -0,0 +1,23 @@
+package agent
+
+import (
+	"fmt"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/metric"
+)
+
+const name = "telemetryagent"
+
+// newExpiredCounter creates the counter of the expired messages with the global
+// meter provider.
+func newExpiredCounter() (metric.Int64Counter, error) {
+	counter, err := otel.Meter(name).Int64Counter("telemetryagent.messages_expired",
+		metric.WithDescription("Number of messages that expired before being routed"),
+		metric.WithUnit("{messages}"),
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create counter 'telemetryagent.messages_expired': %w", err)
+	}
+	return counter, nil
+}
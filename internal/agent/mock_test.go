@@ -0,0 +1,112 @@
+package agent
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/LincolnG4/iot-hydra/internal/brokers"
+	"github.com/LincolnG4/iot-hydra/internal/message"
+	"github.com/LincolnG4/iot-hydra/internal/workerpool"
+	"github.com/rs/zerolog"
+)
+
+// mockBroker records all published messages.
+type mockBroker struct {
+	name      string
+	mu        sync.Mutex
+	published []*message.Message
+	handlers  map[string]func(*message.Message) // subscriptions by topic
+}
+
+func (m *mockBroker) Name() string   { return m.name }
+func (m *mockBroker) Type() string   { return "mock" }
+func (m *mockBroker) Connect() error { return nil }
+func (m *mockBroker) Stop() error    { return nil }
+func (m *mockBroker) Publish(_ context.Context, msg *message.Message) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.published = append(m.published, msg)
+	return nil
+}
+
+func (m *mockBroker) SubscribeAndWait(string, time.Duration) (*message.Message, error) {
+	return nil, nil
+}
+
+func (m *mockBroker) Subscribe(topic string, handler func(*message.Message)) (func() error, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.handlers == nil {
+		m.handlers = make(map[string]func(*message.Message))
+	}
+	m.handlers[topic] = handler
+	return func() error {
+		m.mu.Lock()
+		defer m.mu.Unlock()
+		delete(m.handlers, topic)
+		return nil
+	}, nil
+}
+
+func (m *mockBroker) Published() []*message.Message {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return append([]*message.Message(nil), m.published...)
+}
+
+// newTestAgent returns an agent with a running workerpool publishing to mock brokers.
+func newTestAgent(t *testing.T, brokerNames ...string) (*TelemetryAgent, map[string]*mockBroker) {
+	t.Helper()
+
+	logger := zerolog.Nop()
+	ctx, cancel := context.WithCancel(context.Background())
+	wp, err := workerpool.NewPool(ctx, 10, 1, &logger)
+	if err != nil {
+		t.Fatal(err)
+	}
+	wp.Start()
+	t.Cleanup(func() {
+		cancel()
+		wp.Stop()
+	})
+
+	mocks := make(map[string]*mockBroker)
+	brokerMap := make(map[string]brokers.Broker)
+	for _, name := range brokerNames {
+		mocks[name] = &mockBroker{name: name}
+		brokerMap[name] = mocks[name]
+	}
+
+	expiredCnt, err := newExpiredCounter()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return &TelemetryAgent{
+		ctx:        ctx,
+		Cancel:     cancel,
+		logger:     &logger,
+		Queue:      NewPriorityQueue(10, 0),
+		Brokers:    brokerMap,
+		WorkerPool: wp,
+		Schemas:    NewSchemaRegistry(),
+		expiredCnt: expiredCnt,
+	}, mocks
+}
+
+// waitPublished waits until the broker received n messages.
+func waitPublished(t *testing.T, b *mockBroker, n int) []*message.Message {
+	t.Helper()
+
+	deadline := time.Now().Add(2 * time.Second)
+	for time.Now().Before(deadline) {
+		if published := b.Published(); len(published) >= n {
+			return published
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+	t.Fatalf("broker '%s' received %d messages, expected %d", b.name, len(b.Published()), n)
+	return nil
+}
@@ -0,0 +1,46 @@
+package agent
+
+import (
+	"sync"
+
+	"github.com/LincolnG4/iot-hydra/internal/message"
+)
+
+// MockSubmitter records the submitted messages and returns the error set with SetErr.
+type MockSubmitter struct {
+	mu       sync.Mutex
+	messages []*message.Message
+	err      error
+}
+
+func (m *MockSubmitter) Submit(msg *message.Message) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.messages = append(m.messages, msg)
+	return m.err
+}
+
+// SetErr sets the error returned by the next submits.
+func (m *MockSubmitter) SetErr(err error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.err = err
+}
+
+// Messages returns the messages submitted so far.
+func (m *MockSubmitter) Messages() []*message.Message {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return append([]*message.Message(nil), m.messages...)
+}
+
+// Payloads returns the payloads submitted so far as strings.
+func (m *MockSubmitter) Payloads() []string {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	payloads := make([]string, 0, len(m.messages))
+	for _, msg := range m.messages {
+		payloads = append(payloads, string(msg.Payload))
+	}
+	return payloads
+}
@@ -0,0 +1,132 @@
+package agent
+
+import (
+	"context"
+	"sync"
+
+	"github.com/LincolnG4/iot-hydra/internal/message"
+)
+
+const defaultStarvationLimit = 10
+
+// lanes ordered from the highest to the lowest priority
+var lanePriorities = []message.Priority{message.PriorityAlarm, message.PriorityNormal, message.PriorityLow}
+
+// PriorityQueue keeps one lane per message priority. Higher lanes are always
+// drained first, but a lower lane that was skipped starvationLimit times while it
+// had messages waiting is served once, so low priority traffic keeps flowing.
+type PriorityQueue struct {
+	lanes           []chan *message.Message
+	mu              sync.Mutex
+	skipped         []int // times each lane was passed over while not empty
+	starvationLimit int
+}
+
+// NewPriorityQueue creates a queue where each lane holds up to size messages.
+func NewPriorityQueue(size int, starvationLimit int) *PriorityQueue {
+	if starvationLimit <= 0 {
+		starvationLimit = defaultStarvationLimit
+	}
+
+	lanes := make([]chan *message.Message, len(lanePriorities))
+	for i := range lanes {
+		lanes[i] = make(chan *message.Message, size)
+	}
+	return &PriorityQueue{
+		lanes:           lanes,
+		skipped:         make([]int, len(lanes)),
+		starvationLimit: starvationLimit,
+	}
+}
+
+// laneIndex returns the lane of the priority. Unknown priorities use the normal lane.
+func laneIndex(p message.Priority) int {
+	for i, lp := range lanePriorities {
+		if lp == p {
+			return i
+		}
+	}
+	return laneIndex(message.PriorityNormal)
+}
+
+// Push adds the message to the lane of its priority, waiting for room until ctx is done.
+func (q *PriorityQueue) Push(ctx context.Context, msg *message.Message) error {
+	select {
+	case q.lanes[laneIndex(msg.Priority)] <- msg:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// Pop returns the next message to be routed, waiting until a message arrives or
+// ctx is done. It returns false if ctx is done.
+func (q *PriorityQueue) Pop(ctx context.Context) (*message.Message, bool) {
+	if msg := q.next(); msg != nil {
+		return msg, true
+	}
+
+	// All lanes are empty, wait for the first message
+	select {
+	case msg := <-q.lanes[0]:
+		return msg, true
+	case msg := <-q.lanes[1]:
+		return msg, true
+	case msg := <-q.lanes[2]:
+		return msg, true
+	case <-ctx.Done():
+		return nil, false
+	}
+}
+
+// next returns the next message without blocking, or nil if all lanes are empty.
+func (q *PriorityQueue) next() *message.Message {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	// Serve the lowest starving lane first
+	for i := len(q.lanes) - 1; i > 0; i-- {
+		if q.skipped[i] < q.starvationLimit {
+			continue
+		}
+		q.skipped[i] = 0
+		select {
+		case msg := <-q.lanes[i]:
+			return msg
+		default:
+		}
+	}
+
+	for i, lane := range q.lanes {
+		select {
+		case msg := <-lane:
+			q.skipped[i] = 0
+			for j := i + 1; j < len(q.lanes); j++ {
+				if len(q.lanes[j]) > 0 {
+					q.skipped[j]++
+				}
+			}
+			return msg
+		default:
+		}
+	}
+	return nil
+}
+
+// Len returns the number of messages waiting in all lanes.
+func (q *PriorityQueue) Len() int {
+	n := 0
+	for _, lane := range q.lanes {
+		n += len(lane)
+	}
+	return n
+}
+
+// Cap returns the capacity of all lanes.
+func (q *PriorityQueue) Cap() int {
+	n := 0
+	for _, lane := range q.lanes {
+		n += cap(lane)
+	}
+	return n
+}
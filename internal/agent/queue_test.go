@@ -0,0 +1,75 @@
+package agent
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/LincolnG4/iot-hydra/internal/config"
+	"github.com/LincolnG4/iot-hydra/internal/message"
+	"github.com/alecthomas/assert"
+)
+
+func TestPriorityQueue_AlarmFirst(t *testing.T) {
+	q := NewPriorityQueue(10, 100)
+	ctx := context.Background()
+
+	assert.NoError(t, q.Push(ctx, &message.Message{ID: "low", Priority: message.PriorityLow}))
+	assert.NoError(t, q.Push(ctx, &message.Message{ID: "normal"}))
+	assert.NoError(t, q.Push(ctx, &message.Message{ID: "alarm", Priority: message.PriorityAlarm}))
+	assert.Equal(t, 3, q.Len())
+	assert.Equal(t, 30, q.Cap())
+
+	for _, expected := range []string{"alarm", "normal", "low"} {
+		msg, ok := q.Pop(ctx)
+		assert.True(t, ok)
+		assert.Equal(t, expected, msg.ID)
+	}
+}
+
+func TestPriorityQueue_StarvationProtection(t *testing.T) {
+	q := NewPriorityQueue(10, 2)
+	ctx := context.Background()
+
+	assert.NoError(t, q.Push(ctx, &message.Message{ID: "low", Priority: message.PriorityLow}))
+	for range 5 {
+		assert.NoError(t, q.Push(ctx, &message.Message{ID: "alarm", Priority: message.PriorityAlarm}))
+	}
+
+	var order []string
+	for range 6 {
+		msg, _ := q.Pop(ctx)
+		order = append(order, msg.ID)
+	}
+	assert.Equal(t, []string{"alarm", "alarm", "low", "alarm", "alarm", "alarm"}, order)
+}
+
+func TestPriorityQueue_PopWaits(t *testing.T) {
+	q := NewPriorityQueue(1, 0)
+
+	go func() {
+		time.Sleep(10 * time.Millisecond)
+		_ = q.Push(context.Background(), &message.Message{ID: "late", Priority: message.PriorityLow})
+	}()
+	msg, ok := q.Pop(context.Background())
+	assert.True(t, ok)
+	assert.Equal(t, "late", msg.ID)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	_, ok = q.Pop(ctx)
+	assert.False(t, ok, "pop must stop when context is done")
+}
+
+func TestSubmit_RoutePriority(t *testing.T) {
+	ag, _ := newTestAgent(t)
+	ag.routes = newRoutes([]config.RouteYAML{{Topic: "alarms/#", Priority: "alarm"}})
+
+	assert.NoError(t, ag.Submit(&message.Message{ID: "routine", Topic: "sensors/temp"}))
+	assert.NoError(t, ag.Submit(&message.Message{ID: "alarm", Topic: "alarms/fire"}))
+	assert.NoError(t, ag.Submit(&message.Message{ID: "explicit", Topic: "alarms/fire", Priority: message.PriorityLow}))
+
+	msg, _ := ag.Queue.Pop(context.Background())
+	assert.Equal(t, "alarm", msg.ID)
+	assert.Equal(t, message.PriorityAlarm, msg.Priority)
+}
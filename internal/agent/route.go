@@ -0,0 +1,80 @@
+package agent
+
+import (
+	"time"
+
+	"github.com/LincolnG4/iot-hydra/internal/config"
+	"github.com/LincolnG4/iot-hydra/internal/message"
+)
+
+// route holds the processing stages configured for a topic pattern.
+type route struct {
+	topic      string
+	priority   message.Priority
+	ttl        time.Duration
+	aggregator *aggregator
+	deadband   *deadbandFilter
+}
+
+func newRoutes(cfg []config.RouteYAML) []*route {
+	routes := make([]*route, 0, len(cfg))
+	for _, routeCfg := range cfg {
+		r := &route{topic: routeCfg.Topic, priority: message.Priority(routeCfg.Priority), ttl: routeCfg.TTL}
+		if routeCfg.Aggregation != nil {
+			r.aggregator = newAggregator(*routeCfg.Aggregation)
+		}
+		if routeCfg.Deadband != nil {
+			r.deadband = newDeadbandFilter(*routeCfg.Deadband)
+		}
+		routes = append(routes, r)
+	}
+	return routes
+}
+
+// matchRoute returns the first route matching the message topic, or nil.
+func (t *TelemetryAgent) matchRoute(msg *message.Message) *route {
+	for _, r := range t.routes {
+		if message.MatchTopic(r.topic, msg.Topic) {
+			return r
+		}
+	}
+	return nil
+}
+
+// startRoutes spawns the background stages of the routes.
+func (t *TelemetryAgent) startRoutes() {
+	for _, r := range t.routes {
+		if r.aggregator != nil {
+			go r.aggregator.run(t)
+		}
+	}
+}
+
+// handleMessage applies the stages of the matching route to the message and routes
+// what is left to the brokers. The aggregation receives every reading, while the
+// deadband only filters the raw stream forwarded to the brokers.
+func (t *TelemetryAgent) handleMessage(msg *message.Message) error {
+	r := t.matchRoute(msg)
+	if r == nil {
+		return t.RouteMessage(msg)
+	}
+
+	if r.aggregator != nil {
+		r.aggregator.add(msg, time.Now())
+
+		// Raw stream is only forwarded when brokers are configured for it
+		if len(r.aggregator.cfg.RawBrokers) == 0 {
+			t.takeDelivery(msg)(msg, "", ErrMessageFiltered)
+			return nil
+		}
+		msg.TargetBrokers = r.aggregator.cfg.RawBrokers
+	}
+
+	if r.deadband != nil && !r.deadband.allow(msg, time.Now()) {
+		t.logger.Debug().Str("device_id", msg.DeviceID).Str("topic", msg.Topic).Str("message_id", msg.ID).Msg("message inside deadband")
+		t.takeDelivery(msg)(msg, "", ErrMessageFiltered)
+		return nil
+	}
+
+	return t.RouteMessage(msg)
+}
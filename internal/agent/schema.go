@@ -0,0 +1,191 @@
+package agent
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"sync"
+
+	"github.com/LincolnG4/iot-hydra/internal/config"
+	"github.com/LincolnG4/iot-hydra/internal/message"
+	"github.com/santhosh-tekuri/jsonschema/v6"
+)
+
+const (
+	SchemaActionReject     = "reject"
+	SchemaActionTag        = "tag"
+	SchemaActionDeadLetter = "deadletter"
+)
+
+// ValidationError is returned by Submit when the payload of a message doesn't
+// match the schema registered for its topic.
+type ValidationError struct {
+	Topic  string
+	Action string // policy applied to the message
+	Err    error
+}
+
+func (e *ValidationError) Error() string {
+	return fmt.Sprintf("payload of topic '%s' failed schema validation (%s): %v", e.Topic, e.Action, e.Err)
+}
+
+func (e *ValidationError) Unwrap() error {
+	return e.Err
+}
+
+// IsQueued reports whether a message submitted with the returned error was still
+// enqueued, i.e. the error is nil or a validation error of the tag or deadletter policies.
+func IsQueued(err error) bool {
+	var vErr *ValidationError
+	if errors.As(err, &vErr) {
+		return vErr.Action != SchemaActionReject
+	}
+	return err == nil
+}
+
+type topicSchema struct {
+	topic  string
+	raw    json.RawMessage
+	schema *jsonschema.Schema
+}
+
+// SchemaRegistry keeps the JSON Schemas registered per topic pattern.
+type SchemaRegistry struct {
+	mu      sync.RWMutex
+	schemas []topicSchema
+}
+
+func NewSchemaRegistry() *SchemaRegistry {
+	return &SchemaRegistry{}
+}
+
+// loadSchemas reads all schema files from the configuration and registers them.
+func loadSchemas(cfg []config.SchemaYAML) (*SchemaRegistry, error) {
+	registry := NewSchemaRegistry()
+	for _, schemaCfg := range cfg {
+		raw, err := os.ReadFile(schemaCfg.File)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read schema file '%s': %w", schemaCfg.File, err)
+		}
+
+		if err := registry.Register(schemaCfg.Topic, raw); err != nil {
+			return nil, fmt.Errorf("failed to register schema file '%s': %w", schemaCfg.File, err)
+		}
+	}
+	return registry, nil
+}
+
+// Register compiles the schema and binds it to the topic pattern. A schema already
+// registered for the same pattern is replaced.
+func (r *SchemaRegistry) Register(topic string, raw []byte) error {
+	if topic == "" {
+		return fmt.Errorf("topic cannot be empty")
+	}
+
+	doc, err := jsonschema.UnmarshalJSON(bytes.NewReader(raw))
+	if err != nil {
+		return fmt.Errorf("invalid schema: %w", err)
+	}
+
+	compiler := jsonschema.NewCompiler()
+	if err := compiler.AddResource("schema.json", doc); err != nil {
+		return fmt.Errorf("invalid schema: %w", err)
+	}
+	schema, err := compiler.Compile("schema.json")
+	if err != nil {
+		return fmt.Errorf("failed to compile schema: %w", err)
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	entry := topicSchema{topic: topic, raw: raw, schema: schema}
+	for i, s := range r.schemas {
+		if s.topic == topic {
+			r.schemas[i] = entry
+			return nil
+		}
+	}
+	r.schemas = append(r.schemas, entry)
+	return nil
+}
+
+// Remove deletes the schema of the topic pattern. It returns false if it was not registered.
+func (r *SchemaRegistry) Remove(topic string) bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for i, s := range r.schemas {
+		if s.topic == topic {
+			r.schemas = append(r.schemas[:i], r.schemas[i+1:]...)
+			return true
+		}
+	}
+	return false
+}
+
+// List returns the raw schemas indexed by topic pattern.
+func (r *SchemaRegistry) List() map[string]json.RawMessage {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	schemas := make(map[string]json.RawMessage, len(r.schemas))
+	for _, s := range r.schemas {
+		schemas[s.topic] = s.raw
+	}
+	return schemas
+}
+
+// Validate checks the payload of the message against the first schema matching its topic.
+// Messages without a matching schema are always valid.
+func (r *SchemaRegistry) Validate(msg *message.Message) error {
+	r.mu.RLock()
+	var schema *jsonschema.Schema
+	for _, s := range r.schemas {
+		if message.MatchTopic(s.topic, msg.Topic) {
+			schema = s.schema
+			break
+		}
+	}
+	r.mu.RUnlock()
+
+	if schema == nil {
+		return nil
+	}
+
+	payload, err := jsonschema.UnmarshalJSON(bytes.NewReader(msg.Payload))
+	if err != nil {
+		return fmt.Errorf("payload is not valid JSON: %w", err)
+	}
+	return schema.Validate(payload)
+}
+
+// applySchemaPolicy validates the message and applies the configured policy when it is
+// invalid. Tagged messages get the error in their metadata, published as the
+// schema_error header, and deadlettered messages are redirected to the dead letter
+// topic and brokers with their original_topic.
+func (t *TelemetryAgent) applySchemaPolicy(msg *message.Message) *ValidationError {
+	err := t.Schemas.Validate(msg)
+	if err == nil {
+		return nil
+	}
+
+	action := t.schemaPolicy.Action
+	if action == "" {
+		action = SchemaActionReject
+	}
+	vErr := &ValidationError{Topic: msg.Topic, Action: action, Err: err}
+
+	switch action {
+	case SchemaActionTag:
+		msg.SetMetadata("schema_error", err.Error())
+	case SchemaActionDeadLetter:
+		msg.SetMetadata("schema_error", err.Error())
+		msg.SetMetadata("original_topic", msg.Topic)
+		msg.Topic = t.schemaPolicy.DeadLetterTopic
+		msg.TargetBrokers = t.schemaPolicy.DeadLetterBrokers
+	}
+	return vErr
+}
@@ -0,0 +1,108 @@
+package agent
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/LincolnG4/iot-hydra/internal/config"
+	"github.com/LincolnG4/iot-hydra/internal/message"
+	"github.com/alecthomas/assert"
+)
+
+const tempSchema = `{
+	"type": "object",
+	"properties": {"temp": {"type": "number"}},
+	"required": ["temp"]
+}`
+
+func TestSchemaRegistry(t *testing.T) {
+	r := NewSchemaRegistry()
+	assert.NoError(t, r.Register("sensors/+/temp", []byte(tempSchema)))
+	assert.Error(t, r.Register("sensors/bad", []byte(`{"type": 1}`)), "invalid schema must not compile")
+	assert.Error(t, r.Register("", []byte(tempSchema)), "topic is required")
+
+	tests := []struct {
+		name    string
+		msg     message.Message
+		wantErr bool
+	}{
+		{"valid payload", message.Message{Topic: "sensors/dev1/temp", Payload: []byte(`{"temp": 21.5}`)}, false},
+		{"missing field", message.Message{Topic: "sensors/dev1/temp", Payload: []byte(`{"hum": 40}`)}, true},
+		{"not json", message.Message{Topic: "sensors/dev1/temp", Payload: []byte(`hello`)}, true},
+		{"no schema for topic", message.Message{Topic: "other", Payload: []byte(`hello`)}, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := r.Validate(&tt.msg)
+			if tt.wantErr {
+				assert.Error(t, err)
+			} else {
+				assert.NoError(t, err)
+			}
+		})
+	}
+
+	assert.Equal(t, 1, len(r.List()))
+	assert.True(t, r.Remove("sensors/+/temp"))
+	assert.False(t, r.Remove("sensors/+/temp"))
+	assert.NoError(t, r.Validate(&message.Message{Topic: "sensors/dev1/temp", Payload: []byte(`hello`)}))
+}
+
+func TestLoadSchemas(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "temp.json")
+	assert.NoError(t, os.WriteFile(path, []byte(tempSchema), 0o600))
+
+	r, err := loadSchemas([]config.SchemaYAML{{Topic: "sensors/#", File: path}})
+	assert.NoError(t, err)
+	assert.Equal(t, 1, len(r.List()))
+
+	_, err = loadSchemas([]config.SchemaYAML{{Topic: "sensors/#", File: "missing.json"}})
+	assert.Error(t, err)
+}
+
+func TestSubmit_SchemaPolicy(t *testing.T) {
+	tests := []struct {
+		name          string
+		policy        config.SchemaPolicyYAML
+		queued        bool
+		expectedTopic string
+	}{
+		{"reject", config.SchemaPolicyYAML{}, false, ""},
+		{"tag", config.SchemaPolicyYAML{Action: SchemaActionTag}, true, "sensors/dev1/temp"},
+		{
+			"deadletter",
+			config.SchemaPolicyYAML{Action: SchemaActionDeadLetter, DeadLetterTopic: "dlq", DeadLetterBrokers: []string{"archive"}},
+			true,
+			"dlq",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			schemas := NewSchemaRegistry()
+			assert.NoError(t, schemas.Register("sensors/#", []byte(tempSchema)))
+
+			ag := &TelemetryAgent{
+				ctx:          context.Background(),
+				Queue:        NewPriorityQueue(1, 0),
+				Schemas:      schemas,
+				schemaPolicy: tt.policy,
+			}
+
+			err := ag.Submit(&message.Message{Topic: "sensors/dev1/temp", Payload: []byte(`{}`)})
+			var vErr *ValidationError
+			assert.True(t, errors.As(err, &vErr), "should return a validation error")
+
+			if !tt.queued {
+				assert.Equal(t, 0, ag.Queue.Len())
+				return
+			}
+			msg, _ := ag.Queue.Pop(context.Background())
+			assert.Equal(t, tt.expectedTopic, msg.Topic)
+			assert.NotZero(t, msg.Metadata["schema_error"])
+		})
+	}
+}
@@ -0,0 +1,9 @@
+package agent
+
+import "github.com/LincolnG4/iot-hydra/internal/message"
+
+// Submitter receives the messages of the inputs and listeners, e.g. the
+// TelemetryAgent. Errors for which IsQueued is true don't lose the message.
+type Submitter interface {
+	Submit(*message.Message) error
+}
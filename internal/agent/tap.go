@@ -0,0 +1,45 @@
+package agent
+
+import (
+	"sync"
+
+	"github.com/LincolnG4/iot-hydra/internal/message"
+)
+
+// taps are the functions observing the messages routed to the brokers.
+type taps struct {
+	mu   sync.RWMutex
+	next int
+	fns  map[int]func(*message.Message)
+}
+
+// Tap calls fn with every message passing through RouteMessage, e.g. to stream
+// them for debugging. fn is called by the dispatcher, so it must not block nor
+// modify the message. The tap is removed by the returned function.
+func (t *TelemetryAgent) Tap(fn func(*message.Message)) func() {
+	t.taps.mu.Lock()
+	defer t.taps.mu.Unlock()
+
+	if t.taps.fns == nil {
+		t.taps.fns = make(map[int]func(*message.Message))
+	}
+	id := t.taps.next
+	t.taps.next++
+	t.taps.fns[id] = fn
+
+	return func() {
+		t.taps.mu.Lock()
+		defer t.taps.mu.Unlock()
+		delete(t.taps.fns, id)
+	}
+}
+
+// tap passes the message to the taps.
+func (t *TelemetryAgent) tap(msg *message.Message) {
+	t.taps.mu.RLock()
+	defer t.taps.mu.RUnlock()
+
+	for _, fn := range t.taps.fns {
+		fn(msg)
+	}
+}
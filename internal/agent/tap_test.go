@@ -0,0 +1,22 @@
+package agent
+
+import (
+	"testing"
+
+	"github.com/LincolnG4/iot-hydra/internal/message"
+	"github.com/alecthomas/assert"
+)
+
+func TestTap(t *testing.T) {
+	ag, _ := newTestAgent(t, "cloud")
+
+	var tapped []string
+	remove := ag.Tap(func(msg *message.Message) {
+		tapped = append(tapped, msg.ID)
+	})
+
+	assert.NoError(t, ag.RouteMessage(&message.Message{ID: "m1", TargetBrokers: []string{"cloud"}}))
+	remove()
+	assert.NoError(t, ag.RouteMessage(&message.Message{ID: "m2", TargetBrokers: []string{"cloud"}}))
+	assert.Equal(t, []string{"m1"}, tapped)
+}
@@ -2,7 +2,10 @@ package agent
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"sync"
+	"time"
 
 	"github.com/LincolnG4/iot-hydra/internal/auth"
 	"github.com/LincolnG4/iot-hydra/internal/brokers"
@@ -10,17 +13,29 @@ import (
 	"github.com/LincolnG4/iot-hydra/internal/message"
 	"github.com/LincolnG4/iot-hydra/internal/workerpool"
 	"github.com/rs/zerolog"
+	"go.opentelemetry.io/otel/metric"
 )
 
 type TelemetryAgent struct {
 	ctx        context.Context
 	Cancel     context.CancelFunc
 	logger     *zerolog.Logger
-	Queue      chan *message.Message     // Queue telemetry messages
+	Queue      *PriorityQueue            // Queue telemetry messages, one lane per priority
 	Brokers    map[string]brokers.Broker // Map of brokers connected
 	WorkerPool *workerpool.Workerpool
+	Schemas    *SchemaRegistry // JSON Schemas used to validate payloads per topic
+
+	schemaPolicy config.SchemaPolicyYAML
+	routes       []*route // processing stages per topic pattern
+	expiry       config.ExpiryYAML
+	deliveries   sync.Map // DeliveryFunc by *message.Message waiting in the queue
+	taps         taps     // observers of the routed messages
+	expiredCnt   metric.Int64Counter
 }
 
+// ErrAgentStopped is returned by Submit when the agent context is done.
+var ErrAgentStopped = errors.New("telemetry agent is stopped")
+
 // NewTelemetryAgent creates and configures a new TelemetryAgent.
 func NewTelemetryAgent(ctx context.Context, cfg *config.TelemetryAgentYAML, logger *zerolog.Logger) (*TelemetryAgent, error) {
 	if cfg == nil {
@@ -33,7 +48,28 @@ func NewTelemetryAgent(ctx context.Context, cfg *config.TelemetryAgentYAML, logg
 		return nil, err
 	}
 
-	wp, err := workerpool.NewPool(ctx, cfg.QueueSize, cfg.MaxWorkers, logger)
+	return NewTelemetryAgentWithBrokers(ctx, cfg, brokerMap, logger)
+}
+
+// NewTelemetryAgentWithBrokers creates a TelemetryAgent routing to already connected
+// brokers. The brokers of the configuration are ignored.
+func NewTelemetryAgentWithBrokers(ctx context.Context, cfg *config.TelemetryAgentYAML, brokerMap map[string]brokers.Broker, logger *zerolog.Logger) (*TelemetryAgent, error) {
+	if cfg == nil {
+		return nil, fmt.Errorf("configuration cannot be nil")
+	}
+
+	schemas, err := loadSchemas(cfg.Schemas)
+	if err != nil {
+		return nil, err
+	}
+	expiredCnt, err := newExpiredCounter()
+	if err != nil {
+		return nil, err
+	}
+
+	// The backlog waits in the priority lanes, so the workerpool only buffers
+	// one job per worker and alarms don't wait behind routine readings.
+	wp, err := workerpool.NewPool(ctx, cfg.MaxWorkers, cfg.MaxWorkers, logger)
 	if err != nil {
 		return nil, err
 	}
@@ -41,12 +77,18 @@ func NewTelemetryAgent(ctx context.Context, cfg *config.TelemetryAgentYAML, logg
 	ctx, cancel := context.WithCancel(ctx)
 	// The agent is assembled with the created brokers and a properly sized message queue.
 	agent := &TelemetryAgent{
-		Queue:      make(chan *message.Message, cfg.QueueSize),
+		Queue:      NewPriorityQueue(cfg.QueueSize, cfg.StarvationLimit),
 		Brokers:    brokerMap,
 		ctx:        ctx,
 		Cancel:     cancel,
 		WorkerPool: wp,
+		Schemas:    schemas,
 		logger:     logger,
+
+		schemaPolicy: cfg.SchemaPolicy,
+		routes:       newRoutes(cfg.Routes),
+		expiry:       cfg.Expiry,
+		expiredCnt:   expiredCnt,
 	}
 
 	return agent, nil
@@ -97,57 +139,106 @@ func (t *TelemetryAgent) StartWorkerPool() {
 
 // Start initiate a go routine that will receive message from the Queue. The function only if context is cancel
 func (t *TelemetryAgent) Start() {
+	t.startRoutes()
+
+	// Log worker errors. Drained apart so workers never block while the
+	// dispatcher waits for room in the workerpool.
+	go func() {
+		for failedResult := range t.WorkerPool.ResultQueue {
+			t.logger.Error().Err(failedResult.Error).Msg("failed to publish message")
+		}
+	}()
+
 	go func() {
 		for {
-			select {
-			case msg := <-t.Queue: // Read messsages from the Channel
-				err := t.RouteMessage(msg)
-				if err != nil {
-					t.logger.Error().Err(err).Str("message_id", msg.ID)
-				}
-			case failedResult := <-t.WorkerPool.ResultQueue: // Log worker error
-				t.logger.Error().Err(failedResult.Error)
-			case <-t.ctx.Done(): // Context Canceled, finalizing Channel
+			msg, ok := t.Queue.Pop(t.ctx) // Read messsages from the priority lanes
+			if !ok {                      // Context Canceled, finalizing workerpool
 				t.logger.Info().Msg("telemetry agent stopping")
 				t.WorkerPool.Stop()
 				return
 			}
+
+			// Stale messages are dropped at dequeue time
+			if t.dropExpired(msg, time.Now()) {
+				continue
+			}
+
+			err := t.handleMessage(msg)
+			if err != nil {
+				t.logger.Error().Err(err).Str("message_id", msg.ID).Msg("failed to route message")
+			}
 		}
 	}()
 }
 
 // RouteMessage distribute the message over all brokers.
 func (t *TelemetryAgent) RouteMessage(msg *message.Message) error {
+	deliver := t.takeDelivery(msg)
+	t.tap(msg)
+	if len(msg.TargetBrokers) == 0 {
+		deliver(msg, "", ErrNoTargetBrokers)
+	}
+
 	// Distribute message for the routers
 	for _, brokerName := range msg.TargetBrokers {
 		// Check if router exist
 		b, exist := t.Brokers[brokerName]
 		if !exist {
 			t.logger.Error().Str("broker", brokerName).Str("device_id", msg.DeviceID).Str("topic", msg.Topic).Str("message_id", msg.ID).Msg("broker not configured")
+			deliver(msg, brokerName, fmt.Errorf("broker '%s' is not configured", brokerName))
 			continue
 		}
 
-		// Submit messsage to the router
-		err := t.WorkerPool.Submit(
+		// Submit messsage to the router, waiting for a free worker
+		err := t.WorkerPool.SubmitWait(t.ctx,
 			func() error {
 				t.logger.Debug().Str("broker", brokerName).Str("device_id", msg.DeviceID).Str("topic", msg.Topic).Str("message_id", msg.ID).Msg("publishing telemetry")
-				return b.Publish(t.ctx, msg)
+				err := b.Publish(t.ctx, msg)
+				deliver(msg, brokerName, err)
+				return err
 			},
 		)
 		if err != nil {
 			t.logger.Error().Err(err).Str("broker", brokerName).Str("device_id", msg.DeviceID).Str("topic", msg.Topic).Str("message_id", msg.ID).Msg("failed to enqueue publish job")
+			deliver(msg, brokerName, err)
 		}
 	}
 	return nil
 }
 
-// Submit tries to send message to the Queue, if successed it returns True,
-// otherwise it will return false meaning that queue is full.
-func (t *TelemetryAgent) Submit(m *message.Message) bool {
-	select {
-	case t.Queue <- m:
-		return true
-	case <-t.ctx.Done():
-		return false
+// Submit validates the message payload and sends it to the Queue lane of its
+// priority. Messages without priority or expiration time take the ones of their
+// route. It returns a *ValidationError if the payload doesn't match the schema
+// of its topic; with the tag and deadletter policies the message is still
+// enqueued and the error only informs the caller. ErrAgentStopped is returned if
+// the agent is stopping.
+func (t *TelemetryAgent) Submit(m *message.Message) error {
+	vErr := t.applySchemaPolicy(m)
+	if vErr != nil && vErr.Action == SchemaActionReject {
+		return vErr
+	}
+
+	r := t.matchRoute(m)
+	if r != nil && m.Priority == "" {
+		m.Priority = r.priority
+	}
+	t.applyTTL(m, r)
+
+	if err := t.Queue.Push(t.ctx, m); err != nil {
+		return ErrAgentStopped
+	}
+	if vErr != nil {
+		return vErr
+	}
+	return nil
+}
+
+// Subscribe receives the messages of the topic from the broker, e.g. the downlink
+// commands of a device. The subscription ends when the returned function is called.
+func (t *TelemetryAgent) Subscribe(brokerName, topic string, handler func(*message.Message)) (func() error, error) {
+	b, exist := t.Brokers[brokerName]
+	if !exist {
+		return nil, fmt.Errorf("broker '%s' is not configured", brokerName)
 	}
+	return b.Subscribe(topic, handler)
 }
@@ -9,6 +9,7 @@ import (
 
 	"github.com/LincolnG4/iot-hydra/internal/brokers/nats"
 	"github.com/LincolnG4/iot-hydra/internal/config"
+	"github.com/LincolnG4/iot-hydra/internal/message"
 	"github.com/alecthomas/assert"
 	"github.com/rs/zerolog"
 )
@@ -115,3 +116,17 @@ func TestContextCancel(t *testing.T) {
 	time.Sleep(1 * time.Second)
 	cancel()
 }
+
+func TestSubscribe(t *testing.T) {
+	ag, mocks := newTestAgent(t, "nats")
+
+	unsubscribe, err := ag.Subscribe("nats", "devices/1/cmd", func(*message.Message) {})
+	assert.NoError(t, err)
+	assert.Equal(t, 1, len(mocks["nats"].handlers))
+
+	assert.NoError(t, unsubscribe())
+	assert.Equal(t, 0, len(mocks["nats"].handlers))
+
+	_, err = ag.Subscribe("missing", "devices/1/cmd", func(*message.Message) {})
+	assert.Error(t, err)
+}
@@ -0,0 +1,187 @@
+package auth
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"crypto/subtle"
+	"crypto/x509"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/LincolnG4/iot-hydra/internal/config"
+	"github.com/LincolnG4/iot-hydra/internal/message"
+)
+
+const (
+	DeviceTokenType = "token"
+	DeviceHMACType  = "hmac"
+	DeviceCertType  = "cert"
+)
+
+// Policies for the messages whose device_id doesn't match the authenticated device
+const (
+	MismatchReject    = "reject"
+	MismatchOverwrite = "overwrite"
+)
+
+var (
+	ErrDeviceUnauthorized = errors.New("device is not authenticated")
+	ErrDeviceMismatch     = errors.New("device_id doesn't match the authenticated device")
+)
+
+// DeviceCredentials are the credentials presented by a device when connecting.
+type DeviceCredentials struct {
+	// Bearer token
+	Token string
+	// HMAC signed query token
+	DeviceID  string
+	Expires   string
+	Signature string
+	// Verified client certificates
+	Certificates []*x509.Certificate
+}
+
+// DeviceCredentialsFromRequest extracts the device credentials from the request:
+// the Authorization bearer token, the device_id/expires/signature query parameters
+// and the verified TLS client certificate.
+func DeviceCredentialsFromRequest(r *http.Request) DeviceCredentials {
+	creds := DeviceCredentials{
+		DeviceID:  r.URL.Query().Get("device_id"),
+		Expires:   r.URL.Query().Get("expires"),
+		Signature: r.URL.Query().Get("signature"),
+	}
+
+	if token, found := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer "); found {
+		creds.Token = strings.TrimSpace(token)
+	}
+
+	if r.TLS != nil && len(r.TLS.VerifiedChains) > 0 {
+		creds.Certificates = r.TLS.PeerCertificates
+	}
+	return creds
+}
+
+// DeviceAuthenticator resolves the identity of a device from its credentials.
+type DeviceAuthenticator struct {
+	methods    []string
+	tokens     map[string]string // token -> device ID
+	hmacSecret []byte
+	now        func() time.Time
+}
+
+// NewDeviceAuthenticator creates the authenticator for the configured methods.
+func NewDeviceAuthenticator(cfg config.DeviceAuthYAML) (*DeviceAuthenticator, error) {
+	d := &DeviceAuthenticator{
+		methods:    cfg.Methods,
+		tokens:     make(map[string]string),
+		hmacSecret: []byte(cfg.HMACSecret),
+		now:        time.Now,
+	}
+
+	for _, method := range cfg.Methods {
+		switch method {
+		case DeviceTokenType:
+			if len(cfg.Tokens) == 0 {
+				return nil, errors.New("token device authentication requires at least one token")
+			}
+		case DeviceHMACType:
+			if strings.TrimSpace(cfg.HMACSecret) == "" {
+				return nil, errors.New("hmac device authentication requires a secret")
+			}
+		case DeviceCertType:
+		default:
+			return nil, fmt.Errorf("device authentication method '%s' is not supported", method)
+		}
+	}
+
+	for _, t := range cfg.Tokens {
+		if _, exist := d.tokens[t.Token]; exist {
+			return nil, fmt.Errorf("duplicate token for device '%s'", t.DeviceID)
+		}
+		d.tokens[t.Token] = t.DeviceID
+	}
+	return d, nil
+}
+
+// Authenticate returns the device ID of the first method accepting the credentials.
+func (d *DeviceAuthenticator) Authenticate(creds DeviceCredentials) (string, error) {
+	for _, method := range d.methods {
+		var deviceID string
+		switch method {
+		case DeviceTokenType:
+			deviceID = d.authenticateToken(creds.Token)
+		case DeviceHMACType:
+			deviceID = d.authenticateHMAC(creds.DeviceID, creds.Expires, creds.Signature)
+		case DeviceCertType:
+			if len(creds.Certificates) > 0 {
+				deviceID = creds.Certificates[0].Subject.CommonName
+			}
+		}
+
+		if deviceID != "" {
+			return deviceID, nil
+		}
+	}
+	return "", ErrDeviceUnauthorized
+}
+
+func (d *DeviceAuthenticator) authenticateToken(token string) string {
+	if token == "" {
+		return ""
+	}
+	for known, deviceID := range d.tokens {
+		if subtle.ConstantTimeCompare([]byte(known), []byte(token)) == 1 {
+			return deviceID
+		}
+	}
+	return ""
+}
+
+func (d *DeviceAuthenticator) authenticateHMAC(deviceID, expires, signature string) string {
+	if deviceID == "" || signature == "" {
+		return ""
+	}
+
+	unix, err := strconv.ParseInt(expires, 10, 64)
+	if err != nil || d.now().After(time.Unix(unix, 0)) {
+		return ""
+	}
+
+	expected := signDevice(d.hmacSecret, deviceID, expires)
+	if !hmac.Equal([]byte(expected), []byte(signature)) {
+		return ""
+	}
+	return deviceID
+}
+
+// SignDeviceToken returns the signature of the hmac method for a device, valid until expires.
+func SignDeviceToken(secret []byte, deviceID string, expires time.Time) string {
+	return signDevice(secret, deviceID, strconv.FormatInt(expires.Unix(), 10))
+}
+
+func signDevice(secret []byte, deviceID, expires string) string {
+	mac := hmac.New(sha256.New, secret)
+	mac.Write([]byte(deviceID + ":" + expires))
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// BindDevice checks the message against the authenticated device. Messages without
+// device_id get the authenticated one. On mismatch, the device_id is overwritten
+// with the overwrite policy, otherwise ErrDeviceMismatch is returned. It does
+// nothing without authenticated device.
+func BindDevice(deviceID, mismatch string, msg *message.Message) error {
+	if deviceID == "" || msg.DeviceID == deviceID {
+		return nil
+	}
+
+	if msg.DeviceID == "" || mismatch == MismatchOverwrite {
+		msg.DeviceID = deviceID
+		return nil
+	}
+	return ErrDeviceMismatch
+}
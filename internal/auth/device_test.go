@@ -0,0 +1,150 @@
+package auth
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"errors"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/LincolnG4/iot-hydra/internal/config"
+	"github.com/LincolnG4/iot-hydra/internal/message"
+)
+
+func TestNewDeviceAuthenticator(t *testing.T) {
+	tests := []struct {
+		name    string
+		cfg     config.DeviceAuthYAML
+		wantErr bool
+	}{
+		{"token", config.DeviceAuthYAML{Methods: []string{"token"}, Tokens: []config.DeviceTokenYAML{{DeviceID: "dev1", Token: "t1"}}}, false},
+		{"token without tokens", config.DeviceAuthYAML{Methods: []string{"token"}}, true},
+		{"hmac without secret", config.DeviceAuthYAML{Methods: []string{"hmac"}}, true},
+		{"cert", config.DeviceAuthYAML{Methods: []string{"cert"}}, false},
+		{"unknown method", config.DeviceAuthYAML{Methods: []string{"magic"}}, true},
+		{
+			"duplicate token",
+			config.DeviceAuthYAML{Methods: []string{"token"}, Tokens: []config.DeviceTokenYAML{{DeviceID: "dev1", Token: "t1"}, {DeviceID: "dev2", Token: "t1"}}},
+			true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := NewDeviceAuthenticator(tt.cfg)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("NewDeviceAuthenticator() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestDeviceAuthenticator_Authenticate(t *testing.T) {
+	secret := []byte("s3cr3t")
+	now := time.Unix(1000, 0)
+
+	d, err := NewDeviceAuthenticator(config.DeviceAuthYAML{
+		Methods:    []string{"token", "hmac", "cert"},
+		Tokens:     []config.DeviceTokenYAML{{DeviceID: "dev-token", Token: "t1"}},
+		HMACSecret: string(secret),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	d.now = func() time.Time { return now }
+
+	expires := now.Add(time.Minute)
+	validSig := SignDeviceToken(secret, "dev-hmac", expires)
+
+	tests := []struct {
+		name     string
+		creds    DeviceCredentials
+		expected string
+		wantErr  bool
+	}{
+		{"valid token", DeviceCredentials{Token: "t1"}, "dev-token", false},
+		{"invalid token", DeviceCredentials{Token: "t2"}, "", true},
+		{
+			"valid hmac",
+			DeviceCredentials{DeviceID: "dev-hmac", Expires: strconv.FormatInt(expires.Unix(), 10), Signature: validSig},
+			"dev-hmac", false,
+		},
+		{
+			"hmac signed for another device",
+			DeviceCredentials{DeviceID: "dev-other", Expires: strconv.FormatInt(expires.Unix(), 10), Signature: validSig},
+			"", true,
+		},
+		{
+			"expired hmac",
+			DeviceCredentials{
+				DeviceID:  "dev-hmac",
+				Expires:   strconv.FormatInt(now.Add(-time.Second).Unix(), 10),
+				Signature: SignDeviceToken(secret, "dev-hmac", now.Add(-time.Second)),
+			},
+			"", true,
+		},
+		{"client certificate", DeviceCredentials{Certificates: []*x509.Certificate{{Subject: pkix.Name{CommonName: "dev-cert"}}}}, "dev-cert", false},
+		{"no credentials", DeviceCredentials{}, "", true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			deviceID, err := d.Authenticate(tt.creds)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Authenticate() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if deviceID != tt.expected {
+				t.Errorf("Authenticate() got = %s, want %s", deviceID, tt.expected)
+			}
+		})
+	}
+}
+
+func TestDeviceCredentialsFromRequest(t *testing.T) {
+	r := httptest.NewRequest("GET", "/v1/ws?device_id=dev1&expires=10&signature=abc", nil)
+	r.Header.Set("Authorization", "Bearer t1")
+
+	creds := DeviceCredentialsFromRequest(r)
+	if creds.Token != "t1" || creds.DeviceID != "dev1" || creds.Expires != "10" || creds.Signature != "abc" {
+		t.Errorf("unexpected credentials: %+v", creds)
+	}
+
+	// Certificates are only used when verified
+	r.TLS = &tls.ConnectionState{PeerCertificates: []*x509.Certificate{{}}}
+	if creds := DeviceCredentialsFromRequest(r); len(creds.Certificates) != 0 {
+		t.Error("unverified certificates must be ignored")
+	}
+}
+
+func TestBindDevice(t *testing.T) {
+	tests := []struct {
+		name     string
+		auth     string
+		mismatch string
+		deviceID string
+		wantErr  error
+		expected string
+	}{
+		{"not authenticated", "", MismatchReject, "dev2", nil, "dev2"},
+		{"empty device_id takes the authenticated one", "dev1", MismatchReject, "", nil, "dev1"},
+		{"matching device_id", "dev1", MismatchReject, "dev1", nil, "dev1"},
+		{"mismatch rejected", "dev1", MismatchReject, "dev2", ErrDeviceMismatch, "dev2"},
+		{"mismatch rejected by default", "dev1", "", "dev2", ErrDeviceMismatch, "dev2"},
+		{"mismatch overwritten", "dev1", MismatchOverwrite, "dev2", nil, "dev1"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			msg := message.Message{DeviceID: tt.deviceID}
+			if err := BindDevice(tt.auth, tt.mismatch, &msg); !errors.Is(err, tt.wantErr) {
+				t.Errorf("expected error %v, got %v", tt.wantErr, err)
+			}
+			if msg.DeviceID != tt.expected {
+				t.Errorf("expected device_id %q, got %q", tt.expected, msg.DeviceID)
+			}
+		})
+	}
+}
@@ -28,6 +28,10 @@ type Broker interface {
 	// Subscribe to broker and wait T seconds to receive the message, otherwise
 	// returns nil and timeout
 	SubscribeAndWait(string, time.Duration) (*message.Message, error)
+
+	// Subscribe to the topic and call the handler for each message received, until
+	// the returned unsubscribe function is called
+	Subscribe(string, func(*message.Message)) (func() error, error)
 }
 
 type Config struct {
@@ -3,8 +3,9 @@ package nats
 import "github.com/nats-io/nats.go"
 
 type Connector interface {
-	Publish(string, []byte) error
+	PublishMsg(*nats.Msg) error
 	SubscribeSync(string) (*nats.Subscription, error)
+	Subscribe(string, nats.MsgHandler) (*nats.Subscription, error)
 
 	Close()
 }
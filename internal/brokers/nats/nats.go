@@ -27,6 +27,15 @@ func NewBroker(cfg Config) *NATS {
 	}
 }
 
+// NewBrokerWithConnector returns a broker publishing with an established connection.
+func NewBrokerWithConnector(cfg Config, conn Connector) *NATS {
+	return &NATS{
+		conn:        conn,
+		isConnected: true,
+		Config:      cfg,
+	}
+}
+
 type Config struct {
 	Name string             `json:"name" yaml:"name"`
 	URL  string             `json:"url" yaml:"url"`
@@ -72,7 +81,9 @@ func (n *NATS) Publish(ctx context.Context, msg *message.Message) error {
 		return fmt.Errorf("NATS broker '%s' is not connected", n.Config.Name)
 	}
 
-	if err := n.conn.Publish(msg.Topic, msg.Payload); err != nil {
+	// The metadata travels as headers, e.g. the schema error of a tagged message
+	natsMsg := &nats.Msg{Subject: msg.Topic, Data: msg.Payload, Header: header(msg.Metadata)}
+	if err := n.conn.PublishMsg(natsMsg); err != nil {
 		return fmt.Errorf("failed to publish message to topic '%s' on broker '%s': %w", msg.Topic, n.Config.Name, err)
 	}
 
@@ -106,6 +117,49 @@ func (n *NATS) SubscribeAndWait(topic string, waitSecond time.Duration) (*messag
 	}, nil
 }
 
+func (n *NATS) Subscribe(topic string, handler func(*message.Message)) (func() error, error) {
+	if n.conn == nil {
+		return nil, fmt.Errorf("NATS connection is not established for broker '%s'", n.Config.Name)
+	}
+
+	if !n.isConnected {
+		return nil, fmt.Errorf("NATS broker '%s' is not connected", n.Config.Name)
+	}
+
+	s, err := n.conn.Subscribe(topic, func(msg *nats.Msg) {
+		m := &message.Message{
+			Payload:      msg.Data,
+			Topic:        msg.Subject,
+			SourceBroker: n.Name(),
+		}
+		for key := range msg.Header {
+			m.SetMetadata(key, msg.Header.Get(key))
+		}
+		// Requests carry the subject of their reply
+		if msg.Reply != "" {
+			m.SetMetadata(message.MetadataReplyTo, msg.Reply)
+		}
+		handler(m)
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to subscribe to topic '%s' on broker '%s': %w", topic, n.Config.Name, err)
+	}
+
+	return s.Unsubscribe, nil
+}
+
+// header returns the metadata as NATS headers, nil if there is none.
+func header(metadata map[string]string) nats.Header {
+	if len(metadata) == 0 {
+		return nil
+	}
+	h := make(nats.Header, len(metadata))
+	for key, value := range metadata {
+		h.Set(key, value)
+	}
+	return h
+}
+
 // getCredentials identify the type of authentication and returns the credentials for the broker.
 func getCredentials(a auth.Authenticator) ([]nats.Option, error) {
 	var natsOpts []nats.Option
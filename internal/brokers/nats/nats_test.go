@@ -17,7 +17,8 @@ import (
 // MockNATSConn is a mock implementation of the NATSConn interface
 type MockNATSConn struct {
 	SubscribeSyncFunc func(subj string) (*nats.Subscription, error)
-	PublishFunc       func(subject string, data []byte) error
+	SubscribeFunc     func(subj string, cb nats.MsgHandler) (*nats.Subscription, error)
+	PublishMsgFunc    func(msg *nats.Msg) error
 	CloseFunc         func()
 }
 
@@ -28,9 +29,16 @@ func (m *MockNATSConn) SubscribeSync(subject string) (*nats.Subscription, error)
 	return nil, nil
 }
 
-func (m *MockNATSConn) Publish(subject string, data []byte) error {
-	if m.PublishFunc != nil {
-		return m.PublishFunc(subject, data)
+func (m *MockNATSConn) Subscribe(subject string, cb nats.MsgHandler) (*nats.Subscription, error) {
+	if m.SubscribeFunc != nil {
+		return m.SubscribeFunc(subject, cb)
+	}
+	return nil, nil
+}
+
+func (m *MockNATSConn) PublishMsg(msg *nats.Msg) error {
+	if m.PublishMsgFunc != nil {
+		return m.PublishMsgFunc(msg)
 	}
 	return nil
 }
@@ -43,23 +51,33 @@ func (m *MockNATSConn) Close() {
 
 func TestNATS_Publish(t *testing.T) {
 	tests := []struct {
-		name          string
-		msg           message.Message
-		publishFunc   func(subject string, data []byte) error
-		expectedError bool
+		name           string
+		msg            message.Message
+		publishMsgFunc func(msg *nats.Msg) error
+		expectedHeader nats.Header
+		expectedError  bool
 	}{
 		{
-			name: "Successful Publish",
-			msg:  message.Message{Topic: "test/topic"},
-			publishFunc: func(subject string, data []byte) error {
-				return nil
+			name:          "Successful Publish",
+			msg:           message.Message{Topic: "test/topic"},
+			expectedError: false,
+		},
+		{
+			name: "Metadata as headers",
+			msg: message.Message{Topic: "test/topic", Metadata: map[string]string{
+				"schema_error":   "missing properties: 'value'",
+				"original_topic": "sensors.1",
+			}},
+			expectedHeader: nats.Header{
+				"schema_error":   []string{"missing properties: 'value'"},
+				"original_topic": []string{"sensors.1"},
 			},
 			expectedError: false,
 		},
 		{
 			name: "Failed Publish",
 			msg:  message.Message{Topic: "test/topic"},
-			publishFunc: func(subject string, data []byte) error {
+			publishMsgFunc: func(msg *nats.Msg) error {
 				return errors.New("publish error")
 			},
 			expectedError: true,
@@ -68,8 +86,15 @@ func TestNATS_Publish(t *testing.T) {
 
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
+			var published *nats.Msg
 			mockConn := &MockNATSConn{
-				PublishFunc: tt.publishFunc,
+				PublishMsgFunc: func(msg *nats.Msg) error {
+					published = msg
+					if tt.publishMsgFunc != nil {
+						return tt.publishMsgFunc(msg)
+					}
+					return nil
+				},
 			}
 
 			n := &NATS{
@@ -83,6 +108,8 @@ func TestNATS_Publish(t *testing.T) {
 				assert.Error(t, err)
 			} else {
 				assert.NoError(t, err)
+				assert.Equal(t, tt.msg.Topic, published.Subject)
+				assert.Equal(t, tt.expectedHeader, published.Header)
 			}
 		})
 	}
@@ -167,6 +194,39 @@ func TestNATS_Integration(t *testing.T) {
 	}
 }
 
+func TestNATS_Subscribe(t *testing.T) {
+	broker := &NATS{
+		Config:      Config{Name: "nats"},
+		isConnected: true,
+		conn: &MockNATSConn{
+			SubscribeFunc: func(subj string, cb nats.MsgHandler) (*nats.Subscription, error) {
+				cb(&nats.Msg{Subject: "devices.1.cmd", Data: []byte("reboot"), Reply: "_INBOX.1", Header: nats.Header{"priority": []string{"high"}}})
+				return &nats.Subscription{}, nil
+			},
+		},
+	}
+
+	var received []*message.Message
+	unsubscribe, err := broker.Subscribe("devices.*.cmd", func(msg *message.Message) {
+		received = append(received, msg)
+	})
+	assert.NoError(t, err)
+	assert.NotZero(t, unsubscribe)
+	assert.Equal(t, 1, len(received))
+	assert.Equal(t, "devices.1.cmd", received[0].Topic)
+	assert.Equal(t, "reboot", string(received[0].Payload))
+	assert.Equal(t, "nats", received[0].SourceBroker)
+	assert.Equal(t, map[string]string{message.MetadataReplyTo: "_INBOX.1", "priority": "high"}, received[0].Metadata)
+
+	broker.conn = &MockNATSConn{
+		SubscribeFunc: func(string, nats.MsgHandler) (*nats.Subscription, error) {
+			return nil, errors.New("subscription failed")
+		},
+	}
+	_, err = broker.Subscribe("devices.*.cmd", func(*message.Message) {})
+	assert.Error(t, err)
+}
+
 // Lightweight negative cases (no container needed)
 func TestNATS_ConnectFailures(t *testing.T) {
 	tests := []struct {
@@ -0,0 +1,23 @@
+package config
+
+// CoAPServiceYAML configures the CoAP server used by constrained devices. Devices
+// publish with POST /t/{topic} and observe GET /cmd to receive downlink commands.
+type CoAPServiceYAML struct {
+	Address string `yaml:"address" validate:"required"`
+	// DTLS with certificates. The common name of verified client certificates is
+	// used as device_id
+	DTLS *TLSYAML `yaml:"dtls,omitempty"`
+	// Number of the request option carrying the device_id of the published
+	// messages, ignored with DTLS. Use an elective number from the experimental
+	// range, e.g. 65000
+	DeviceIDOption uint16 `yaml:"deviceIdOption,omitempty"`
+	// Prefix added to the topic of the messages routed by the agent
+	TopicPrefix string `yaml:"topicPrefix,omitempty"`
+	// Brokers receiving the messages published by the devices
+	TargetBrokers []string `yaml:"targetBrokers" validate:"required,min=1"`
+	// Broker and topic observed by GET /cmd. The placeholder {device} is replaced
+	// by the device ID. Observe is disabled without broker and requires DTLS, only
+	// devices identified by their client certificate can observe
+	DownlinkBroker string `yaml:"downlinkBroker,omitempty"`
+	DownlinkTopic  string `yaml:"downlinkTopic,omitempty"`
+}
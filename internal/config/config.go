@@ -12,6 +12,11 @@ import (
 type ConfigYAML struct {
 	APIService     Service            `yaml:"apiService" validate:"required"`
 	TelemetryAgent TelemetryAgentYAML `yaml:"telemetryAgent" validate:"required"`
+	MQTTService    *MQTTServiceYAML   `yaml:"mqttService,omitempty"`
+	GRPCService    *GRPCServiceYAML   `yaml:"grpcService,omitempty"`
+	CoAPService    *CoAPServiceYAML   `yaml:"coapService,omitempty"`
+	Inputs         *InputsYAML        `yaml:"inputs,omitempty"`
+	Deployment     *DeploymentYAML    `yaml:"deployment,omitempty"`
 }
 
 // NewConfigFromYAML reads, unmarshals, and validates the YAML configuration file from a given path.
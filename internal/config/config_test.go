@@ -1,8 +1,10 @@
 package config_test
 
 import (
+	"fmt"
 	"os"
 	"testing"
+	"time"
 
 	"github.com/LincolnG4/iot-hydra/internal/config"
 	"github.com/stretchr/testify/require"
@@ -72,3 +74,44 @@ telemetryAgent:
 	require.Error(t, err)
 	require.Contains(t, err.Error(), "the configuration file is invalid")
 }
+
+func TestNewConfigFromYAML_ModbusInputs(t *testing.T) {
+	base := `
+apiService:
+  address: ":8080"
+telemetryAgent:
+  queueSize: 6
+  maxWorkers: 1
+  brokers:
+    - name: nats
+      type: nats
+      address: "nats_main:4222"
+      auth:
+        method: plain
+inputs:
+  modbus:
+    - name: meter-1
+      address: "10.0.0.5:502"
+      unitId: 3
+      interval: 5s
+      topic: sites/1/meter
+      targetBrokers: [nats]
+      registers:
+        - name: voltage
+          address: 0
+          scale: 0.1
+        - name: energy
+          table: input
+          address: 10
+          dataType: %s
+`
+	cfg, err := config.NewConfigFromYAML(writeTmpFile(t, fmt.Sprintf(base, "uint32")))
+	require.NoError(t, err)
+	require.Len(t, cfg.Inputs.Modbus, 1)
+	require.Equal(t, uint8(3), cfg.Inputs.Modbus[0].UnitID)
+	require.Equal(t, 5*time.Second, cfg.Inputs.Modbus[0].Interval)
+	require.Equal(t, "input", cfg.Inputs.Modbus[0].Registers[1].Table)
+
+	_, err = config.NewConfigFromYAML(writeTmpFile(t, fmt.Sprintf(base, "float64")))
+	require.Error(t, err)
+}
@@ -0,0 +1,63 @@
+package config
+
+import "time"
+
+// DeploymentYAML is the desired state of the containers. The apps are created,
+// updated and removed to converge, the containers created through /v1/containers
+// aren't touched.
+type DeploymentYAML struct {
+	// Interval between the reconciliations. Defaults to 30s
+	Interval time.Duration `yaml:"interval,omitempty" validate:"gte=0"`
+	// File where the apps put through the API are saved. They replace the apps of
+	// the configuration at start. Not saved if empty
+	ManifestFile string    `yaml:"manifestFile,omitempty"`
+	Apps         []AppYAML `yaml:"apps,omitempty" validate:"unique=Name,dive"`
+}
+
+// AppYAML is an app of the deployment, run as Replicas containers named
+// <name>-<replica>.
+type AppYAML struct {
+	Name  string `yaml:"name" json:"name" validate:"required,hostname_rfc1123"`
+	Image string `yaml:"image" json:"image" validate:"required"`
+	// Containers of the app, 0 stops the app and keeps it in the manifest.
+	// Defaults to 1
+	Replicas *int `yaml:"replicas,omitempty" json:"replicas,omitempty" validate:"omitempty,gte=0"`
+
+	Env        map[string]string `yaml:"env,omitempty" json:"env,omitempty" validate:"dive,keys,required,excludesall==,endkeys"`
+	Ports      []AppPortYAML     `yaml:"ports,omitempty" json:"ports,omitempty" validate:"dive"`
+	Volumes    []AppVolumeYAML   `yaml:"volumes,omitempty" json:"volumes,omitempty" validate:"dive"`
+	Command    []string          `yaml:"command,omitempty" json:"command,omitempty"`
+	Entrypoint []string          `yaml:"entrypoint,omitempty" json:"entrypoint,omitempty"`
+	Labels     map[string]string `yaml:"labels,omitempty" json:"labels,omitempty" validate:"dive,keys,required,endkeys"`
+	// no, always, on-failure or unless-stopped
+	RestartPolicy  string `yaml:"restartPolicy,omitempty" json:"restartPolicy,omitempty" validate:"omitempty,oneof=no always on-failure unless-stopped"`
+	RestartRetries uint   `yaml:"restartRetries,omitempty" json:"restartRetries,omitempty" validate:"excluded_unless=RestartPolicy on-failure"`
+	// bridge, host, none, private, slirp4netns or pasta
+	NetworkMode string `yaml:"networkMode,omitempty" json:"networkMode,omitempty" validate:"omitempty,oneof=bridge host none private slirp4netns pasta"`
+	User        string `yaml:"user,omitempty" json:"user,omitempty"`
+	// Host devices, e.g. /dev/ttyUSB0 or /dev/ttyUSB0:/dev/ttyS0:rw
+	Devices   []string          `yaml:"devices,omitempty" json:"devices,omitempty" validate:"dive,startswith=/dev/"`
+	Resources *AppResourcesYAML `yaml:"resources,omitempty" json:"resources,omitempty"`
+}
+
+type AppPortYAML struct {
+	HostIP        string `yaml:"hostIp,omitempty" json:"hostIp,omitempty" validate:"omitempty,ip"`
+	HostPort      uint16 `yaml:"hostPort,omitempty" json:"hostPort,omitempty"`
+	ContainerPort uint16 `yaml:"containerPort" json:"containerPort" validate:"required"`
+	// tcp (default), udp or sctp
+	Protocol string `yaml:"protocol,omitempty" json:"protocol,omitempty" validate:"omitempty,oneof=tcp udp sctp"`
+}
+
+type AppVolumeYAML struct {
+	// bind (default) mounts the host path Source, volume mounts the named volume Source
+	Type        string `yaml:"type,omitempty" json:"type,omitempty" validate:"omitempty,oneof=bind volume"`
+	Source      string `yaml:"source" json:"source" validate:"required"`
+	Destination string `yaml:"destination" json:"destination" validate:"required,startswith=/"`
+	ReadOnly    bool   `yaml:"readOnly,omitempty" json:"readOnly,omitempty"`
+}
+
+type AppResourcesYAML struct {
+	// Number of CPUs, e.g. 0.5
+	CPUs        float64 `yaml:"cpus,omitempty" json:"cpus,omitempty" validate:"gte=0"`
+	MemoryBytes int64   `yaml:"memoryBytes,omitempty" json:"memoryBytes,omitempty" validate:"gte=0"`
+}
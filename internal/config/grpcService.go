@@ -0,0 +1,13 @@
+package config
+
+// GRPCServiceYAML configures the gRPC ingestion service. Devices are authenticated
+// with the deviceAuth of the apiService.
+type GRPCServiceYAML struct {
+	Address string   `yaml:"address" validate:"required"`
+	TLS     *TLSYAML `yaml:"tls,omitempty"`
+	// Broker used by Subscribe when the request doesn't name one
+	DownlinkBroker string `yaml:"downlinkBroker,omitempty"`
+	// Topic filters devices can subscribe to. The placeholder {device} is replaced
+	// by the authenticated device ID
+	SubscribeACL []string `yaml:"subscribeAcl,omitempty"`
+}
@@ -0,0 +1,138 @@
+package config
+
+import "time"
+
+// InputsYAML configures the data sources polled by iot-hydra itself. Their readings
+// are submitted to the telemetry agent like the messages of the devices.
+type InputsYAML struct {
+	Modbus []ModbusSlaveYAML `yaml:"modbus,omitempty" validate:"dive"`
+	// Logs of the containers created through /v1/containers. Not collected if not set
+	ContainerLogs *ContainerLogsYAML `yaml:"containerLogs,omitempty"`
+	// Resource usage of the running containers. Not collected if not set
+	ContainerStats *ContainerStatsYAML `yaml:"containerStats,omitempty"`
+	// Health of the gateway itself. Not collected if not set
+	HostMetrics *HostMetricsYAML `yaml:"hostMetrics,omitempty"`
+	// Files and serial consoles whose lines are submitted
+	Tail []TailYAML `yaml:"tail,omitempty" validate:"dive"`
+}
+
+// TailYAML reads the lines written to a file or to a character device, e.g. a
+// serial console bridged to a pty. Each parsed line is submitted as one message.
+type TailYAML struct {
+	// File, character device or named pipe
+	Path          string   `yaml:"path" validate:"required"`
+	DeviceID      string   `yaml:"deviceId" validate:"required"`
+	Topic         string   `yaml:"topic" validate:"required"`
+	TargetBrokers []string `yaml:"targetBrokers" validate:"required,min=1"`
+	// Read a file from its start when there is no saved offset, instead of its end
+	FromStart bool `yaml:"fromStart,omitempty"`
+	// File where the offset read in the file is saved to resume after a restart.
+	// A file replaced while stopped is read from its start. Not saved if empty
+	OffsetFile string `yaml:"offsetFile,omitempty"`
+	// Interval between the checks of new lines and rotation of a file, and between
+	// the reopens of a failed device. Defaults to 1s
+	PollInterval time.Duration  `yaml:"pollInterval,omitempty" validate:"gte=0"`
+	Parser       TailParserYAML `yaml:"parser,omitempty"`
+}
+
+// TailParserYAML converts a line to the JSON object of the payload. Numeric csv and
+// regex fields are sent as numbers.
+type TailParserYAML struct {
+	// raw (default) sends {"line": ...}, json sends the JSON object of the line, csv
+	// maps the columns and regex the named groups of Pattern
+	Format string `yaml:"format,omitempty" validate:"omitempty,oneof=raw json csv regex"`
+	// Names of the csv columns. The first line is the header if empty, they are
+	// required to read a character device or named pipe
+	Columns []string `yaml:"columns,omitempty"`
+	// Separator of the csv columns. Defaults to a comma
+	Delimiter string `yaml:"delimiter,omitempty" validate:"omitempty,len=1"`
+	// Regular expression whose named groups are the fields, required by regex
+	Pattern string `yaml:"pattern,omitempty" validate:"required_if=Format regex"`
+}
+
+// HostMetricsYAML reads the CPU, load, memory, disks, temperatures, network and
+// uptime of the gateway from procfs and sysfs every Interval. Each reading is
+// submitted as one message of the gateway.
+type HostMetricsYAML struct {
+	// device_id of the gateway. Defaults to the hostname
+	DeviceID string `yaml:"deviceId,omitempty"`
+	// Defaults to 30s
+	Interval      time.Duration `yaml:"interval,omitempty" validate:"gte=0"`
+	Topic         string        `yaml:"topic" validate:"required"`
+	TargetBrokers []string      `yaml:"targetBrokers" validate:"required,min=1"`
+	// Mount points of procfs and sysfs, e.g. the host ones mounted in a container.
+	// Default to /proc and /sys
+	ProcPath string `yaml:"procPath,omitempty"`
+	SysPath  string `yaml:"sysPath,omitempty"`
+	// Mount points whose disk usage is read. All the mounted block devices if empty
+	Mounts []string `yaml:"mounts,omitempty"`
+}
+
+// ContainerStatsYAML reads the CPU, memory, network and block I/O of the running
+// containers every Interval. Each container emits one message, using its name as
+// device_id, and the values are exported as OTel gauges.
+type ContainerStatsYAML struct {
+	// Defaults to 30s
+	Interval time.Duration `yaml:"interval,omitempty" validate:"gte=0"`
+	// Topic of the stats, {container} is replaced by the container name
+	Topic         string   `yaml:"topic" validate:"required"`
+	TargetBrokers []string `yaml:"targetBrokers" validate:"required,min=1"`
+}
+
+// ContainerLogsYAML follows the stdout and stderr of the managed containers. Each
+// log record is submitted as one message, using the container name as device_id.
+type ContainerLogsYAML struct {
+	// Topic of the records, {container} is replaced by the container name
+	Topic         string   `yaml:"topic" validate:"required"`
+	TargetBrokers []string `yaml:"targetBrokers" validate:"required,min=1"`
+	// Names of the followed containers. All managed containers are followed if empty
+	Containers []string `yaml:"containers,omitempty"`
+	// Interval between the lookups of started containers. Defaults to 10s
+	DiscoveryInterval time.Duration `yaml:"discoveryInterval,omitempty" validate:"gte=0"`
+	// Records per second of each container, the extra ones are dropped. Defaults to 100
+	RateLimit int `yaml:"rateLimit,omitempty" validate:"gte=0"`
+	// Records sent at once over the rate limit. Defaults to the rate limit
+	Burst     int            `yaml:"burst,omitempty" validate:"gte=0"`
+	Multiline *MultilineYAML `yaml:"multiline,omitempty"`
+}
+
+// MultilineYAML joins the lines of a record, e.g. a stack trace. A record starts
+// with a line matching Start and takes the following lines until the next start.
+type MultilineYAML struct {
+	// Regular expression of the first line of a record
+	Start string `yaml:"start" validate:"required"`
+	// Lines of a record before it is sent. Defaults to 500
+	MaxLines int `yaml:"maxLines,omitempty" validate:"gte=0"`
+	// Time without new lines before a record is sent. Defaults to 1s
+	Timeout time.Duration `yaml:"timeout,omitempty" validate:"gte=0"`
+}
+
+// ModbusSlaveYAML is a Modbus TCP slave polled every Interval. Each poll emits one
+// message with the scaled value of all registers, using Name as device_id.
+type ModbusSlaveYAML struct {
+	Name    string `yaml:"name" validate:"required"`
+	Address string `yaml:"address" validate:"required,hostname_port"`
+	UnitID  uint8  `yaml:"unitId,omitempty"`
+	// Poll interval and timeout of each request. Timeout defaults to the interval
+	Interval time.Duration `yaml:"interval" validate:"gt=0"`
+	Timeout  time.Duration `yaml:"timeout,omitempty" validate:"gte=0"`
+	// Longest wait between polls of a failing slave. Defaults to 5 minutes
+	MaxBackoff    time.Duration        `yaml:"maxBackoff,omitempty" validate:"gte=0"`
+	Topic         string               `yaml:"topic" validate:"required"`
+	TargetBrokers []string             `yaml:"targetBrokers" validate:"required,min=1"`
+	Registers     []ModbusRegisterYAML `yaml:"registers" validate:"required,min=1,dive"`
+}
+
+// ModbusRegisterYAML maps registers to a payload field. The value is raw*Scale+Offset.
+type ModbusRegisterYAML struct {
+	Name string `yaml:"name" validate:"required"`
+	// Register table: holding (default) or input
+	Table   string `yaml:"table,omitempty" validate:"omitempty,oneof=holding input"`
+	Address uint16 `yaml:"address"`
+	// uint16 (default), int16, uint32, int32 or float32. 32 bits types use two registers
+	DataType string `yaml:"dataType,omitempty" validate:"omitempty,oneof=uint16 int16 uint32 int32 float32"`
+	// Order of the registers of 32 bits types: big (default, high word first) or little
+	WordOrder string  `yaml:"wordOrder,omitempty" validate:"omitempty,oneof=big little"`
+	Scale     float64 `yaml:"scale,omitempty"`
+	Offset    float64 `yaml:"offset,omitempty"`
+}
@@ -0,0 +1,27 @@
+package config
+
+// MQTTServiceYAML configures the embedded MQTT server used by devices to publish telemetry.
+type MQTTServiceYAML struct {
+	Address string `yaml:"address" validate:"required"`
+	// Prefix added to the MQTT topic of the messages routed by the agent
+	TopicPrefix string `yaml:"topicPrefix,omitempty"`
+	// Brokers receiving the messages published by the devices
+	TargetBrokers []string `yaml:"targetBrokers" validate:"required,min=1"`
+	// Accept clients without credentials. They can only use the anonymous ACL
+	AllowAnonymous bool           `yaml:"allowAnonymous,omitempty"`
+	Devices        []MQTTUserYAML `yaml:"devices,omitempty" validate:"dive"`
+	AnonymousACL   MQTTACLYAML    `yaml:"anonymousAcl,omitempty"`
+}
+
+type MQTTUserYAML struct {
+	Username string      `yaml:"username" validate:"required"`
+	Password string      `yaml:"password" validate:"required"`
+	ACL      MQTTACLYAML `yaml:"acl,omitempty"`
+}
+
+// MQTTACLYAML lists the topic filters a client can publish or subscribe to.
+// The placeholder {device} is replaced by the device ID of the client.
+type MQTTACLYAML struct {
+	Publish   []string `yaml:"publish,omitempty"`
+	Subscribe []string `yaml:"subscribe,omitempty"`
+}
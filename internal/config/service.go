@@ -1,5 +1,103 @@
 package config
 
+import "time"
+
 type Service struct {
-	Address string `yaml:"address" validate:"required"`
+	Address string   `yaml:"address" validate:"required"`
+	TLS     *TLSYAML `yaml:"tls,omitempty"`
+	// Devices authentication on the ingestion endpoints. Disabled if not set
+	DeviceAuth *DeviceAuthYAML `yaml:"deviceAuth,omitempty"`
+	// Origins allowed to open a websocket. If empty, only same origin requests are accepted
+	AllowedOrigins []string `yaml:"allowedOrigins,omitempty"`
+	// Local ingestion for the containers running on the same host
+	UnixSockets []UnixSocketYAML `yaml:"unixSockets,omitempty" validate:"dive"`
+	// Keepalive, limits and compression of the websocket connections
+	Websocket WebsocketYAML `yaml:"websocket,omitempty"`
+	// Bearer token of the admin endpoints under /v1/admin. They are disabled if not set
+	AdminToken string `yaml:"adminToken,omitempty"`
+}
+
+// WebsocketYAML configures the websocket connections of the devices. Zero values
+// take the defaults.
+type WebsocketYAML struct {
+	// Interval between pings sent to the device. Defaults to 30s
+	PingInterval time.Duration `yaml:"pingInterval,omitempty" validate:"gte=0"`
+	// Time without any message or pong before the connection is closed. Defaults
+	// to twice the ping interval
+	ReadTimeout time.Duration `yaml:"readTimeout,omitempty" validate:"gte=0"`
+	// Timeout of each write to the device. Defaults to 10s
+	WriteTimeout time.Duration `yaml:"writeTimeout,omitempty" validate:"gte=0"`
+	// Largest message accepted, in bytes. Defaults to 1 MiB
+	MaxMessageSize int64 `yaml:"maxMessageSize,omitempty" validate:"gte=0"`
+	// Negotiate permessage-deflate with the devices that support it
+	Compression bool `yaml:"compression,omitempty"`
+	// How long the sequences of a disconnected session are kept for its resume.
+	// Defaults to 10m
+	SessionTTL time.Duration `yaml:"sessionTTL,omitempty" validate:"gte=0"`
+	// Commands sent from the brokers to the devices. Disabled if not set
+	Downlink *WebsocketDownlinkYAML `yaml:"downlink,omitempty"`
+	// Events sent when the devices connect and disconnect. Not published if not set
+	Presence *PresenceYAML `yaml:"presence,omitempty"`
+}
+
+// PresenceYAML publishes the connect and disconnect events of the devices.
+type PresenceYAML struct {
+	// Topic of the events, {device} is replaced by the device_id
+	Topic         string   `yaml:"topic" validate:"required"`
+	TargetBrokers []string `yaml:"targetBrokers" validate:"required,min=1"`
+}
+
+// WebsocketDownlinkYAML forwards the commands received from a broker to the
+// websocket of their device. Only the devices authenticated with deviceAuth or
+// connected from a container receive commands. The ID of a command is its
+// correlation_id header, or a generated one, and devices reply with a message
+// carrying it. The reply is published with the correlation_id header.
+type WebsocketDownlinkYAML struct {
+	// Broker of the commands and the replies
+	Broker string `yaml:"broker" validate:"required"`
+	// Topic of the commands, e.g. devices.{device}.cmd. The {device} token is the
+	// device_id of the command and is subscribed as the * wildcard
+	Topic string `yaml:"topic" validate:"required,contains={device}"`
+	// Topic of the replies, {device} is replaced by the device_id. Replies to NATS
+	// requests go to the reply subject of the request instead
+	ReplyTopic string `yaml:"replyTopic,omitempty"`
+	// Commands kept per offline device, the oldest are dropped. Defaults to 100
+	OfflineQueueSize int `yaml:"offlineQueueSize,omitempty" validate:"gte=0"`
+	// How long a command waits for its device and then for its reply. Defaults to 1h
+	CommandTTL time.Duration `yaml:"commandTTL,omitempty" validate:"gte=0"`
+}
+
+// UnixSocketYAML serves the ingestion on a Unix domain socket. Callers are identified
+// by their container, whose name is stamped on the messages.
+type UnixSocketYAML struct {
+	Path string `yaml:"path" validate:"required"`
+	// websocket (default) serves /v1/ws and /v1/telemetry, lines reads one JSON message per line
+	Mode string `yaml:"mode,omitempty" validate:"omitempty,oneof=websocket lines"`
+	// Directory of the containers created through /v1/containers where the directory
+	// of the socket is mounted. Not mounted if empty
+	MountDir string `yaml:"mountDir,omitempty"`
+}
+
+// TLSYAML enables HTTPS. When ClientCAFile is set, client certificates signed by
+// it are verified and can be used to authenticate devices.
+type TLSYAML struct {
+	CertFile     string `yaml:"certFile" validate:"required"`
+	KeyFile      string `yaml:"keyFile" validate:"required"`
+	ClientCAFile string `yaml:"clientCAFile,omitempty"`
+}
+
+type DeviceAuthYAML struct {
+	// Accepted methods: token, hmac and cert
+	Methods []string          `yaml:"methods" validate:"required,min=1,dive,oneof=token hmac cert"`
+	Tokens  []DeviceTokenYAML `yaml:"tokens,omitempty" validate:"dive"`
+	// Secret used to sign the query tokens of the hmac method
+	HMACSecret string `yaml:"hmacSecret,omitempty"`
+	// What to do with messages whose device_id doesn't match the authenticated
+	// device: reject (default) or overwrite
+	Mismatch string `yaml:"mismatch,omitempty" validate:"omitempty,oneof=reject overwrite"`
+}
+
+type DeviceTokenYAML struct {
+	DeviceID string `yaml:"deviceId" validate:"required"`
+	Token    string `yaml:"token" validate:"required"`
 }
@@ -1,9 +1,19 @@
 package config
 
+import "time"
+
 type TelemetryAgentYAML struct {
-	QueueSize  int          `yaml:"queueSize" validate:"gt=0"`
-	MaxWorkers int          `yaml:"maxWorkers" validate:"gt=0"`
-	Brokers    []BrokerYAML `yaml:"brokers" validate:"required,min=1,dive"`
+	QueueSize    int              `yaml:"queueSize" validate:"gt=0"`
+	MaxWorkers   int              `yaml:"maxWorkers" validate:"gt=0"`
+	Brokers      []BrokerYAML     `yaml:"brokers" validate:"required,min=1,dive"`
+	Schemas      []SchemaYAML     `yaml:"schemas,omitempty" validate:"dive"`
+	SchemaPolicy SchemaPolicyYAML `yaml:"schemaPolicy,omitempty"`
+	Routes       []RouteYAML      `yaml:"routes,omitempty" validate:"dive"`
+	// Consecutive higher priority messages routed while a lower lane waits before
+	// the lower lane is served once. Defaults to 10
+	StarvationLimit int `yaml:"starvationLimit,omitempty" validate:"gte=0"`
+	// What to do with messages that expired while waiting in the queue
+	Expiry ExpiryYAML `yaml:"expiry,omitempty"`
 }
 
 type BrokerYAML struct {
@@ -18,3 +28,62 @@ type AuthYAML struct {
 	Password string `yaml:"password,omitempty"`
 	Token    string `yaml:"token,omitempty"`
 }
+
+// SchemaYAML binds a JSON Schema file to the messages of a topic pattern.
+type SchemaYAML struct {
+	Topic string `yaml:"topic" validate:"required"`
+	File  string `yaml:"file" validate:"required"`
+}
+
+// SchemaPolicyYAML defines what happens with messages that fail the schema validation.
+type SchemaPolicyYAML struct {
+	// reject (default), tag or deadletter. Tagged and deadlettered messages carry
+	// the schema_error header
+	Action            string   `yaml:"action,omitempty" validate:"omitempty,oneof=reject tag deadletter"`
+	DeadLetterTopic   string   `yaml:"deadLetterTopic,omitempty" validate:"required_if=Action deadletter"`
+	DeadLetterBrokers []string `yaml:"deadLetterBrokers,omitempty" validate:"required_if=Action deadletter"`
+}
+
+// RouteYAML configures the processing applied to the messages of a topic pattern.
+// The first route matching the message topic is used.
+type RouteYAML struct {
+	Topic string `yaml:"topic" validate:"required"`
+	// Priority of the messages that don't set one (alarm, normal or low)
+	Priority string `yaml:"priority,omitempty" validate:"omitempty,oneof=alarm normal low"`
+	// Time to live of the messages that don't set an expiration time
+	TTL         time.Duration    `yaml:"ttl,omitempty" validate:"gte=0"`
+	Aggregation *AggregationYAML `yaml:"aggregation,omitempty"`
+	Deadband    *DeadbandYAML    `yaml:"deadband,omitempty"`
+}
+
+// AggregationYAML groups the numeric payload fields per device and topic over a window.
+// When Slide is zero the window is tumbling, otherwise a window is emitted every Slide.
+type AggregationYAML struct {
+	Window time.Duration `yaml:"window" validate:"gt=0"`
+	Slide  time.Duration `yaml:"slide,omitempty" validate:"gte=0,ltefield=Window"`
+	// Topic of the aggregated messages, defaults to the source topic with '/agg' suffix
+	Topic string `yaml:"topic,omitempty"`
+	// Brokers receiving the aggregated messages, defaults to the source message brokers
+	Brokers []string `yaml:"brokers,omitempty"`
+	// Brokers that still receive the raw stream. If empty, raw messages are dropped
+	RawBrokers []string `yaml:"rawBrokers,omitempty"`
+}
+
+// DeadbandYAML forwards a reading only when a numeric field changed more than the
+// absolute or the percentage deadband since the last forwarded value. With no
+// deadband set, any change is forwarded.
+type DeadbandYAML struct {
+	Absolute float64 `yaml:"absolute,omitempty" validate:"gte=0"`
+	Percent  float64 `yaml:"percent,omitempty" validate:"gte=0"`
+	// Forward the reading anyway when nothing was forwarded for this long
+	Heartbeat time.Duration `yaml:"heartbeat,omitempty" validate:"gte=0"`
+	// Maximum number of device/topic/field states kept in memory, defaults to 10000
+	MaxEntries int `yaml:"maxEntries,omitempty" validate:"gte=0"`
+}
+
+// ExpiryYAML defines what happens with expired messages.
+type ExpiryYAML struct {
+	// discard (default) or archive
+	Action         string   `yaml:"action,omitempty" validate:"omitempty,oneof=discard archive"`
+	ArchiveBrokers []string `yaml:"archiveBrokers,omitempty" validate:"required_if=Action archive"`
+}
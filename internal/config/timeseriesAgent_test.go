@@ -2,6 +2,7 @@ package config
 
 import (
 	"testing"
+	"time"
 
 	"github.com/LincolnG4/iot-hydra/internal/utils"
 	"github.com/alecthomas/assert"
@@ -217,3 +218,43 @@ telemetryAgent:
 	err := yaml.Unmarshal(y, &wrapper)
 	assert.NoError(t, err, "yaml.Unmarshal ignores unknown fields by default")
 }
+
+func TestUnmarshalYAML_Routes(t *testing.T) {
+	y := []byte(`
+telemetryAgent:
+  queueSize: 100
+  maxWorkers: 2
+  brokers:
+    - name: foo
+      type: nats
+      address: "localhost:9999"
+      auth:
+        method: token
+        token: my-secret-token
+  routes:
+    - topic: "sensors/#"
+      aggregation:
+        window: 10s
+        slide: 5s
+        rawBrokers: [foo]
+`)
+
+	var wrapper struct {
+		TelemetryAgent TelemetryAgentYAML `yaml:"telemetryAgent"`
+	}
+	err := yaml.Unmarshal(y, &wrapper)
+	assert.NoError(t, err)
+
+	err = utils.Validate.Struct(wrapper.TelemetryAgent)
+	assert.NoError(t, err)
+
+	aggregation := wrapper.TelemetryAgent.Routes[0].Aggregation
+	assert.Equal(t, 10*time.Second, aggregation.Window)
+	assert.Equal(t, 5*time.Second, aggregation.Slide)
+	assert.Equal(t, []string{"foo"}, aggregation.RawBrokers)
+
+	// Slide can't be greater than the window
+	aggregation.Slide = time.Minute
+	err = utils.Validate.Struct(wrapper.TelemetryAgent)
+	assert.Error(t, err)
+}
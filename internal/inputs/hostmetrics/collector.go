@@ -0,0 +1,189 @@
+package hostmetrics
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/LincolnG4/iot-hydra/internal/agent"
+	"github.com/LincolnG4/iot-hydra/internal/config"
+	"github.com/LincolnG4/iot-hydra/internal/message"
+	"github.com/rs/zerolog"
+)
+
+const (
+	defaultInterval = 30 * time.Second
+	defaultProcPath = "/proc"
+	defaultSysPath  = "/sys"
+)
+
+// Disk is the usage in bytes of a mounted file system.
+type Disk struct {
+	Total       uint64  `json:"total"`
+	Free        uint64  `json:"free"`
+	UsedPercent float64 `json:"used_percent"`
+}
+
+// Reading is the payload of the messages. Metrics that can't be read are omitted.
+type Reading struct {
+	// Busy percentage of all CPUs since the previous reading
+	CPUPercent   *float64             `json:"cpu_percent,omitempty"`
+	Load         *Load                `json:"load,omitempty"`
+	Memory       *Memory              `json:"memory,omitempty"`
+	Disks        map[string]Disk      `json:"disks,omitempty"`
+	Temperatures map[string]float64   `json:"temperatures,omitempty"`
+	Network      map[string]Interface `json:"network,omitempty"`
+	// Seconds since the boot
+	Uptime *float64 `json:"uptime,omitempty"`
+}
+
+// Collector reads the metrics of the gateway every interval and submits them as
+// messages of the gateway device.
+type Collector struct {
+	cfg       config.HostMetricsYAML
+	submitter agent.Submitter
+	logger    *zerolog.Logger
+	statfs    func(path string) (Disk, error)
+
+	prevCPU *cpuTimes // times of the previous reading, nil before the first one
+}
+
+// NewCollector creates the collector of the host metrics.
+func NewCollector(cfg config.HostMetricsYAML, submitter agent.Submitter, parentLogger *zerolog.Logger) (*Collector, error) {
+	if parentLogger == nil {
+		return nil, errors.New("logger can't be nil")
+	}
+	if cfg.DeviceID == "" {
+		hostname, err := os.Hostname()
+		if err != nil {
+			return nil, fmt.Errorf("failed to read hostname for the gateway device_id: %w", err)
+		}
+		cfg.DeviceID = hostname
+	}
+	if cfg.Interval == 0 {
+		cfg.Interval = defaultInterval
+	}
+	if cfg.ProcPath == "" {
+		cfg.ProcPath = defaultProcPath
+	}
+	if cfg.SysPath == "" {
+		cfg.SysPath = defaultSysPath
+	}
+	logger := parentLogger.With().Str("component", "hostmetrics").Str("device_id", cfg.DeviceID).Logger()
+
+	return &Collector{
+		cfg:       cfg,
+		submitter: submitter,
+		logger:    &logger,
+		statfs:    statfs,
+	}, nil
+}
+
+// Run submits a reading every interval until ctx is done.
+func (c *Collector) Run(ctx context.Context) {
+	ticker := time.NewTicker(c.cfg.Interval)
+	defer ticker.Stop()
+
+	for {
+		c.submit(c.read())
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// read collects the metrics. A metric that fails is logged and left out of the reading.
+func (c *Collector) read() Reading {
+	var reading Reading
+	warn := func(err error, metric string) {
+		c.logger.Warn().Err(err).Str("metric", metric).Msg("failed to read host metric")
+	}
+
+	if times, err := readCPUTimes(c.cfg.ProcPath); err != nil {
+		warn(err, "cpu")
+	} else {
+		if c.prevCPU != nil {
+			if usage, ok := times.usage(*c.prevCPU); ok {
+				reading.CPUPercent = &usage
+			}
+		}
+		c.prevCPU = &times
+	}
+
+	if load, err := readLoad(c.cfg.ProcPath); err != nil {
+		warn(err, "load")
+	} else {
+		reading.Load = &load
+	}
+
+	if mem, err := readMemory(c.cfg.ProcPath); err != nil {
+		warn(err, "memory")
+	} else {
+		reading.Memory = &mem
+	}
+
+	mounts := c.cfg.Mounts
+	if len(mounts) == 0 {
+		var err error
+		if mounts, err = readMounts(c.cfg.ProcPath); err != nil {
+			warn(err, "disks")
+		}
+	}
+	for _, mount := range mounts {
+		disk, err := c.statfs(mount)
+		if err != nil {
+			warn(fmt.Errorf("failed to read usage of '%s': %w", mount, err), "disks")
+			continue
+		}
+		if reading.Disks == nil {
+			reading.Disks = make(map[string]Disk, len(mounts))
+		}
+		reading.Disks[mount] = disk
+	}
+
+	if temperatures, err := readTemperatures(c.cfg.SysPath); err != nil {
+		warn(err, "temperatures")
+	} else if len(temperatures) > 0 {
+		reading.Temperatures = temperatures
+	}
+
+	if interfaces, err := readInterfaces(c.cfg.ProcPath); err != nil {
+		warn(err, "network")
+	} else if len(interfaces) > 0 {
+		reading.Network = interfaces
+	}
+
+	if uptime, err := readUptime(c.cfg.ProcPath); err != nil {
+		warn(err, "uptime")
+	} else {
+		reading.Uptime = &uptime
+	}
+	return reading
+}
+
+// submit sends the reading as a message of the gateway.
+func (c *Collector) submit(reading Reading) {
+	payload, err := json.Marshal(reading)
+	if err != nil {
+		c.logger.Error().Err(err).Msg("failed to encode host metrics")
+		return
+	}
+
+	msg := &message.Message{
+		ID:            message.NewID("host"),
+		DeviceID:      c.cfg.DeviceID,
+		Timestamp:     time.Now(),
+		Payload:       payload,
+		TargetBrokers: c.cfg.TargetBrokers,
+		Topic:         c.cfg.Topic,
+	}
+	if err := c.submitter.Submit(msg); err != nil && !agent.IsQueued(err) {
+		c.logger.Error().Err(err).Str("message", msg.ID).Str("topic", msg.Topic).Msg("failed to submit host metrics")
+	}
+}
@@ -0,0 +1,166 @@
+package hostmetrics
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"math"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/LincolnG4/iot-hydra/internal/agent"
+	"github.com/LincolnG4/iot-hydra/internal/config"
+	"github.com/alecthomas/assert"
+	"github.com/rs/zerolog"
+)
+
+const (
+	testProcPath = "testdata/proc"
+	testSysPath  = "testdata/sys"
+)
+
+func TestReadCPUTimes(t *testing.T) {
+	times, err := readCPUTimes(testProcPath)
+	assert.NoError(t, err)
+	assert.Equal(t, cpuTimes{idle: 8500, total: 10000}, times)
+
+	// 600 busy jiffies out of 1000
+	usage, ok := cpuTimes{idle: 8900, total: 11000}.usage(times)
+	assert.True(t, ok)
+	assert.True(t, math.Abs(usage-60) < 1e-9)
+
+	_, ok = times.usage(times)
+	assert.False(t, ok)
+}
+
+func TestReadProcfs(t *testing.T) {
+	load, err := readLoad(testProcPath)
+	assert.NoError(t, err)
+	assert.Equal(t, Load{Load1: 0.52, Load5: 0.41, Load15: 0.30}, load)
+
+	mem, err := readMemory(testProcPath)
+	assert.NoError(t, err)
+	assert.Equal(t, uint64(4000000*1024), mem.Total)
+	assert.Equal(t, uint64(1000000*1024), mem.Available)
+	assert.Equal(t, 75.0, mem.UsedPercent)
+	assert.Equal(t, 25.0, mem.SwapUsedPercent)
+
+	// Without MemAvailable, the free memory and the caches are available
+	oldProc := t.TempDir()
+	meminfo := "MemTotal: 4000000 kB\nMemFree: 500000 kB\nBuffers: 100000 kB\nCached: 400000 kB\n"
+	assert.NoError(t, os.WriteFile(filepath.Join(oldProc, "meminfo"), []byte(meminfo), 0o644))
+	mem, err = readMemory(oldProc)
+	assert.NoError(t, err)
+	assert.Equal(t, uint64(1000000*1024), mem.Available)
+	assert.Equal(t, 75.0, mem.UsedPercent)
+
+	mounts, err := readMounts(testProcPath)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"/", "/boot/firmware", "/mnt/usb data", "/var/lib/containers"}, mounts)
+
+	interfaces, err := readInterfaces(testProcPath)
+	assert.NoError(t, err)
+	assert.Equal(t, 2, len(interfaces))
+	assert.Equal(t, Interface{
+		RxBytes: 987654321, RxPackets: 654321, RxErrors: 1, RxDropped: 2,
+		TxBytes: 123456789, TxPackets: 321654, TxErrors: 3, TxDropped: 4,
+	}, interfaces["eth0"])
+
+	uptime, err := readUptime(testProcPath)
+	assert.NoError(t, err)
+	assert.Equal(t, 354321.42, uptime)
+
+	_, err = readLoad("testdata/missing")
+	assert.Error(t, err)
+}
+
+func TestReadTemperatures(t *testing.T) {
+	temperatures, err := readTemperatures(testSysPath)
+	assert.NoError(t, err)
+	// The zone without temp is skipped, the duplicated type gets the zone number
+	assert.Equal(t, map[string]float64{"cpu-thermal": 48.312, "cpu-thermal_1": 50}, temperatures)
+
+	temperatures, err = readTemperatures("testdata/missing")
+	assert.NoError(t, err)
+	assert.Equal(t, 0, len(temperatures))
+}
+
+func TestCollector_Run(t *testing.T) {
+	submitter := &agent.MockSubmitter{}
+	logger := zerolog.Nop()
+	c, err := NewCollector(config.HostMetricsYAML{
+		DeviceID:      "gateway-1",
+		Interval:      10 * time.Millisecond,
+		Topic:         "gateways/gateway-1/health",
+		TargetBrokers: []string{"nats"},
+		ProcPath:      testProcPath,
+		SysPath:       testSysPath,
+	}, submitter, &logger)
+	assert.NoError(t, err)
+	c.statfs = func(path string) (Disk, error) {
+		if path == "/mnt/usb data" {
+			return Disk{}, errors.New("not mounted")
+		}
+		return Disk{Total: 1000, Free: 250, UsedPercent: 75}, nil
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		c.Run(ctx)
+		close(done)
+	}()
+
+	deadline := time.Now().Add(5 * time.Second)
+	for len(submitter.Messages()) < 2 && time.Now().Before(deadline) {
+		time.Sleep(5 * time.Millisecond)
+	}
+	cancel()
+	<-done
+
+	msgs := submitter.Messages()
+	assert.True(t, len(msgs) >= 2)
+	assert.Equal(t, "gateway-1", msgs[0].DeviceID)
+	assert.Equal(t, "gateways/gateway-1/health", msgs[0].Topic)
+	assert.Equal(t, []string{"nats"}, msgs[0].TargetBrokers)
+
+	var reading Reading
+	assert.NoError(t, json.Unmarshal(msgs[0].Payload, &reading))
+	// The CPU usage needs two readings, the fixture doesn't change
+	assert.Zero(t, reading.CPUPercent)
+	assert.Equal(t, 0.52, reading.Load.Load1)
+	assert.Equal(t, 75.0, reading.Memory.UsedPercent)
+	assert.Equal(t, 3, len(reading.Disks))
+	assert.Equal(t, Disk{Total: 1000, Free: 250, UsedPercent: 75}, reading.Disks["/"])
+	assert.Equal(t, 48.312, reading.Temperatures["cpu-thermal"])
+	assert.Equal(t, uint64(5000), reading.Network["wlan0"].RxBytes)
+	assert.Equal(t, 354321.42, *reading.Uptime)
+}
+
+func TestCollector_ConfiguredMounts(t *testing.T) {
+	logger := zerolog.Nop()
+	c, err := NewCollector(config.HostMetricsYAML{
+		DeviceID:      "gateway-1",
+		Topic:         "health",
+		TargetBrokers: []string{"nats"},
+		ProcPath:      "testdata/missing",
+		SysPath:       "testdata/missing",
+		Mounts:        []string{"/data"},
+	}, &agent.MockSubmitter{}, &logger)
+	assert.NoError(t, err)
+	var paths []string
+	c.statfs = func(path string) (Disk, error) {
+		paths = append(paths, path)
+		return Disk{Total: 10}, nil
+	}
+
+	// Missing files leave their metrics out
+	reading := c.read()
+	assert.Equal(t, []string{"/data"}, paths)
+	assert.Zero(t, reading.Load)
+	assert.Zero(t, reading.Memory)
+	assert.Zero(t, reading.Uptime)
+	assert.Equal(t, map[string]Disk{"/data": {Total: 10}}, reading.Disks)
+}
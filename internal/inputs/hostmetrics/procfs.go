@@ -0,0 +1,281 @@
+package hostmetrics
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// cpuTimes are the cumulated jiffies of all CPUs from /proc/stat.
+type cpuTimes struct {
+	idle  uint64 // idle and iowait
+	total uint64
+}
+
+// usage returns the busy percentage between the previous times and t.
+func (t cpuTimes) usage(prev cpuTimes) (float64, bool) {
+	if t.total <= prev.total || t.idle < prev.idle {
+		return 0, false
+	}
+	total := t.total - prev.total
+	idle := t.idle - prev.idle
+	return float64(total-min(idle, total)) / float64(total) * 100, true
+}
+
+func readCPUTimes(procPath string) (cpuTimes, error) {
+	path := filepath.Join(procPath, "stat")
+	var times cpuTimes
+	var parseErr error
+	found := false
+	err := scanLines(path, func(line string) bool {
+		fields := strings.Fields(line)
+		if len(fields) < 5 || fields[0] != "cpu" {
+			return true
+		}
+		// user nice system idle iowait irq softirq steal, guest is already in user
+		for i, field := range fields[1:min(len(fields), 9)] {
+			v, err := strconv.ParseUint(field, 10, 64)
+			if err != nil {
+				parseErr = fmt.Errorf("invalid cpu times in '%s': %w", path, err)
+				return false
+			}
+			times.total += v
+			if i == 3 || i == 4 {
+				times.idle += v
+			}
+		}
+		found = true
+		return false
+	})
+	if err != nil {
+		return cpuTimes{}, err
+	}
+	if parseErr != nil {
+		return cpuTimes{}, parseErr
+	}
+	if !found {
+		return cpuTimes{}, fmt.Errorf("no cpu line in '%s'", path)
+	}
+	return times, nil
+}
+
+// Load is the load average over 1, 5 and 15 minutes.
+type Load struct {
+	Load1  float64 `json:"load1"`
+	Load5  float64 `json:"load5"`
+	Load15 float64 `json:"load15"`
+}
+
+func readLoad(procPath string) (Load, error) {
+	path := filepath.Join(procPath, "loadavg")
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return Load{}, err
+	}
+
+	fields := strings.Fields(string(data))
+	if len(fields) < 3 {
+		return Load{}, fmt.Errorf("invalid load average in '%s'", path)
+	}
+	var values [3]float64
+	for i := range values {
+		values[i], err = strconv.ParseFloat(fields[i], 64)
+		if err != nil {
+			return Load{}, fmt.Errorf("invalid load average in '%s': %w", path, err)
+		}
+	}
+	return Load{Load1: values[0], Load5: values[1], Load15: values[2]}, nil
+}
+
+// Memory is the RAM and swap usage in bytes.
+type Memory struct {
+	Total           uint64  `json:"total"`
+	Available       uint64  `json:"available"`
+	UsedPercent     float64 `json:"used_percent"`
+	SwapTotal       uint64  `json:"swap_total"`
+	SwapFree        uint64  `json:"swap_free"`
+	SwapUsedPercent float64 `json:"swap_used_percent"`
+}
+
+func readMemory(procPath string) (Memory, error) {
+	path := filepath.Join(procPath, "meminfo")
+	values := make(map[string]uint64)
+	err := scanLines(path, func(line string) bool {
+		key, rest, found := strings.Cut(line, ":")
+		if !found {
+			return true
+		}
+		fields := strings.Fields(rest)
+		if len(fields) == 0 {
+			return true
+		}
+		v, err := strconv.ParseUint(fields[0], 10, 64)
+		if err != nil {
+			return true
+		}
+		if len(fields) > 1 && fields[1] == "kB" {
+			v *= 1024
+		}
+		values[key] = v
+		return true
+	})
+	if err != nil {
+		return Memory{}, err
+	}
+	if values["MemTotal"] == 0 {
+		return Memory{}, fmt.Errorf("no MemTotal in '%s'", path)
+	}
+
+	mem := Memory{
+		Total:     values["MemTotal"],
+		Available: values["MemAvailable"],
+		SwapTotal: values["SwapTotal"],
+		SwapFree:  values["SwapFree"],
+	}
+	// Kernels before 3.14 don't estimate the available memory
+	if _, found := values["MemAvailable"]; !found {
+		mem.Available = values["MemFree"] + values["Buffers"] + values["Cached"]
+	}
+	mem.UsedPercent = usedPercent(mem.Total, mem.Available)
+	mem.SwapUsedPercent = usedPercent(mem.SwapTotal, mem.SwapFree)
+	return mem, nil
+}
+
+// readMounts returns the mount points of the block devices from the mount table.
+func readMounts(procPath string) ([]string, error) {
+	var mounts []string
+	seen := make(map[string]bool)
+	err := scanLines(filepath.Join(procPath, "self", "mounts"), func(line string) bool {
+		fields := strings.Fields(line)
+		if len(fields) < 2 || !strings.HasPrefix(fields[0], "/dev/") {
+			return true
+		}
+		// Spaces of the path are escaped as \040
+		mount := strings.ReplaceAll(fields[1], `\040`, " ")
+		if !seen[mount] {
+			seen[mount] = true
+			mounts = append(mounts, mount)
+		}
+		return true
+	})
+	return mounts, err
+}
+
+// Interface are the counters of a network interface since the boot.
+type Interface struct {
+	RxBytes   uint64 `json:"rx_bytes"`
+	RxPackets uint64 `json:"rx_packets"`
+	RxErrors  uint64 `json:"rx_errors"`
+	RxDropped uint64 `json:"rx_dropped"`
+	TxBytes   uint64 `json:"tx_bytes"`
+	TxPackets uint64 `json:"tx_packets"`
+	TxErrors  uint64 `json:"tx_errors"`
+	TxDropped uint64 `json:"tx_dropped"`
+}
+
+// readInterfaces returns the counters of the interfaces, except the loopback.
+func readInterfaces(procPath string) (map[string]Interface, error) {
+	interfaces := make(map[string]Interface)
+	err := scanLines(filepath.Join(procPath, "net", "dev"), func(line string) bool {
+		name, rest, found := strings.Cut(line, ":")
+		name = strings.TrimSpace(name)
+		if !found || name == "lo" {
+			return true
+		}
+		fields := strings.Fields(rest)
+		if len(fields) < 16 {
+			return true
+		}
+		var v [16]uint64
+		for i := range v {
+			v[i], _ = strconv.ParseUint(fields[i], 10, 64)
+		}
+		interfaces[name] = Interface{
+			RxBytes: v[0], RxPackets: v[1], RxErrors: v[2], RxDropped: v[3],
+			TxBytes: v[8], TxPackets: v[9], TxErrors: v[10], TxDropped: v[11],
+		}
+		return true
+	})
+	return interfaces, err
+}
+
+func readUptime(procPath string) (float64, error) {
+	path := filepath.Join(procPath, "uptime")
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return 0, err
+	}
+
+	fields := strings.Fields(string(data))
+	if len(fields) == 0 {
+		return 0, fmt.Errorf("invalid uptime in '%s'", path)
+	}
+	uptime, err := strconv.ParseFloat(fields[0], 64)
+	if err != nil {
+		return 0, fmt.Errorf("invalid uptime in '%s': %w", path, err)
+	}
+	return uptime, nil
+}
+
+// readTemperatures returns the temperature in °C of the thermal zones by type.
+// Zones whose sensor can't be read are skipped.
+func readTemperatures(sysPath string) (map[string]float64, error) {
+	zones, err := filepath.Glob(filepath.Join(sysPath, "class", "thermal", "thermal_zone*"))
+	if err != nil {
+		return nil, err
+	}
+
+	temperatures := make(map[string]float64, len(zones))
+	for _, zone := range zones {
+		data, err := os.ReadFile(filepath.Join(zone, "temp"))
+		if err != nil {
+			continue
+		}
+		milli, err := strconv.ParseInt(strings.TrimSpace(string(data)), 10, 64)
+		if err != nil {
+			continue
+		}
+
+		name := filepath.Base(zone)
+		if t, err := os.ReadFile(filepath.Join(zone, "type")); err == nil && len(strings.TrimSpace(string(t))) > 0 {
+			name = strings.TrimSpace(string(t))
+		}
+		// Several zones may have the same type
+		if _, exists := temperatures[name]; exists {
+			name += "_" + strings.TrimPrefix(filepath.Base(zone), "thermal_zone")
+		}
+		temperatures[name] = float64(milli) / 1000
+	}
+	return temperatures, nil
+}
+
+// scanLines calls fn with each line of the file until it returns false.
+func scanLines(path string, fn func(line string) bool) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		if !fn(scanner.Text()) {
+			break
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return fmt.Errorf("failed to read '%s': %w", path, err)
+	}
+	return nil
+}
+
+// usedPercent returns the used percentage of total given the free amount.
+func usedPercent(total, free uint64) float64 {
+	if total == 0 {
+		return 0
+	}
+	return float64(total-min(free, total)) / float64(total) * 100
+}
@@ -0,0 +1,21 @@
+//go:build linux
+
+package hostmetrics
+
+import "syscall"
+
+// statfs returns the usage of the file system mounted on path.
+func statfs(path string) (Disk, error) {
+	var st syscall.Statfs_t
+	if err := syscall.Statfs(path, &st); err != nil {
+		return Disk{}, err
+	}
+
+	bsize := uint64(st.Bsize)
+	disk := Disk{
+		Total: st.Blocks * bsize,
+		Free:  st.Bavail * bsize,
+	}
+	disk.UsedPercent = usedPercent(disk.Total, disk.Free)
+	return disk, nil
+}
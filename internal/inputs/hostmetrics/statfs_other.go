@@ -0,0 +1,10 @@
+//go:build !linux
+
+package hostmetrics
+
+import "errors"
+
+// statfs is only supported on Linux.
+func statfs(string) (Disk, error) {
+	return Disk{}, errors.New("disk usage is not supported on this platform")
+}
@@ -0,0 +1,126 @@
+package modbus
+
+import (
+	"encoding/binary"
+	"fmt"
+	"io"
+	"net"
+	"time"
+)
+
+// Function codes of the register reads
+const (
+	funcReadHoldingRegisters byte = 0x03
+	funcReadInputRegisters   byte = 0x04
+)
+
+// maxReadQuantity is the most registers a single request can read.
+const maxReadQuantity = 125
+
+// ExceptionError is an exception response of the slave.
+type ExceptionError struct {
+	Function byte
+	Code     byte
+}
+
+func (e *ExceptionError) Error() string {
+	return fmt.Sprintf("modbus exception %d on function %d", e.Code, e.Function)
+}
+
+// client is a Modbus TCP client of one slave.
+type client struct {
+	address string
+	unitID  uint8
+	timeout time.Duration
+
+	conn          net.Conn
+	transactionID uint16
+}
+
+func newClient(address string, unitID uint8, timeout time.Duration) *client {
+	return &client{address: address, unitID: unitID, timeout: timeout}
+}
+
+// readRegisters reads quantity registers of the table of the function code,
+// connecting to the slave if needed.
+func (c *client) readRegisters(function byte, address, quantity uint16) ([]uint16, error) {
+	if quantity == 0 || quantity > maxReadQuantity {
+		return nil, fmt.Errorf("invalid quantity of registers %d", quantity)
+	}
+
+	if c.conn == nil {
+		conn, err := net.DialTimeout("tcp", c.address, c.timeout)
+		if err != nil {
+			return nil, fmt.Errorf("failed to connect to '%s': %w", c.address, err)
+		}
+		c.conn = conn
+	}
+
+	c.transactionID++
+	req := make([]byte, 12)
+	binary.BigEndian.PutUint16(req[0:], c.transactionID)
+	binary.BigEndian.PutUint16(req[2:], 0) // protocol
+	binary.BigEndian.PutUint16(req[4:], 6) // length of unit ID and PDU
+	req[6] = c.unitID
+	req[7] = function
+	binary.BigEndian.PutUint16(req[8:], address)
+	binary.BigEndian.PutUint16(req[10:], quantity)
+
+	if err := c.conn.SetDeadline(time.Now().Add(c.timeout)); err != nil {
+		return nil, err
+	}
+	if _, err := c.conn.Write(req); err != nil {
+		return nil, fmt.Errorf("failed to send request to '%s': %w", c.address, err)
+	}
+
+	pdu, err := c.readResponse()
+	if err != nil {
+		return nil, fmt.Errorf("failed to read response from '%s': %w", c.address, err)
+	}
+
+	if pdu[0] == function|0x80 {
+		if len(pdu) < 2 {
+			return nil, fmt.Errorf("invalid exception response")
+		}
+		return nil, &ExceptionError{Function: function, Code: pdu[1]}
+	}
+	if pdu[0] != function || len(pdu) < 2 || int(pdu[1]) != 2*int(quantity) || len(pdu) != 2+int(pdu[1]) {
+		return nil, fmt.Errorf("invalid response for function %d", function)
+	}
+
+	registers := make([]uint16, quantity)
+	for i := range registers {
+		registers[i] = binary.BigEndian.Uint16(pdu[2+2*i:])
+	}
+	return registers, nil
+}
+
+// readResponse reads the response of the current transaction and returns its PDU.
+func (c *client) readResponse() ([]byte, error) {
+	header := make([]byte, 7)
+	if _, err := io.ReadFull(c.conn, header); err != nil {
+		return nil, err
+	}
+
+	length := binary.BigEndian.Uint16(header[4:])
+	if length < 2 || length > 254 {
+		return nil, fmt.Errorf("invalid response length %d", length)
+	}
+	pdu := make([]byte, length-1)
+	if _, err := io.ReadFull(c.conn, pdu); err != nil {
+		return nil, err
+	}
+
+	if binary.BigEndian.Uint16(header[0:]) != c.transactionID || header[6] != c.unitID {
+		return nil, fmt.Errorf("response doesn't match the request")
+	}
+	return pdu, nil
+}
+
+// close drops the connection. The next read reconnects.
+func (c *client) close() {
+	if c.conn != nil {
+		c.conn.Close()
+		c.conn = nil
+	}
+}
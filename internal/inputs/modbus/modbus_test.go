@@ -0,0 +1,147 @@
+package modbus
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"math"
+	"testing"
+	"time"
+
+	"github.com/LincolnG4/iot-hydra/internal/agent"
+	"github.com/LincolnG4/iot-hydra/internal/config"
+	"github.com/alecthomas/assert"
+	"github.com/rs/zerolog"
+)
+
+func TestReadRegisters(t *testing.T) {
+	sim := newSimulator(t)
+	sim.setHolding(100, 1, 2, 3)
+	sim.setInput(7, 42)
+
+	c := newClient(sim.Addr(), 1, time.Second)
+	defer c.close()
+
+	registers, err := c.readRegisters(funcReadHoldingRegisters, 100, 3)
+	assert.NoError(t, err)
+	assert.Equal(t, []uint16{1, 2, 3}, registers)
+
+	registers, err = c.readRegisters(funcReadInputRegisters, 7, 1)
+	assert.NoError(t, err)
+	assert.Equal(t, []uint16{42}, registers)
+
+	_, err = c.readRegisters(funcReadHoldingRegisters, 500, 1)
+	var exception *ExceptionError
+	assert.True(t, errors.As(err, &exception))
+	assert.Equal(t, byte(0x02), exception.Code)
+
+	_, err = c.readRegisters(funcReadHoldingRegisters, 0, maxReadQuantity+1)
+	assert.Error(t, err)
+}
+
+func TestDecode(t *testing.T) {
+	f := math.Float32bits(21.5)
+	tests := []struct {
+		name  string
+		reg   config.ModbusRegisterYAML
+		words []uint16
+		want  float64
+	}{
+		{"uint16", config.ModbusRegisterYAML{}, []uint16{65535}, 65535},
+		{"int16", config.ModbusRegisterYAML{DataType: "int16"}, []uint16{0xfffe}, -2},
+		{"uint32", config.ModbusRegisterYAML{DataType: "uint32"}, []uint16{0x0001, 0x0002}, 65538},
+		{"int32 little", config.ModbusRegisterYAML{DataType: "int32", WordOrder: "little"}, []uint16{0xfffe, 0xffff}, -2},
+		{"float32", config.ModbusRegisterYAML{DataType: "float32"}, []uint16{uint16(f >> 16), uint16(f)}, 21.5},
+		{"scale and offset", config.ModbusRegisterYAML{Scale: 0.1, Offset: -40}, []uint16{650}, 25},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.True(t, math.Abs(tt.want-decode(tt.reg, tt.words)) < 1e-9)
+		})
+	}
+}
+
+func TestBackoff(t *testing.T) {
+	logger := zerolog.Nop()
+	p, err := NewPoller(config.ModbusSlaveYAML{Name: "plc", Interval: time.Second, MaxBackoff: 10 * time.Second}, &agent.MockSubmitter{}, &logger)
+	assert.NoError(t, err)
+
+	assert.Equal(t, 2*time.Second, p.backoff(1))
+	assert.Equal(t, 8*time.Second, p.backoff(3))
+	assert.Equal(t, 10*time.Second, p.backoff(4))
+	assert.Equal(t, 10*time.Second, p.backoff(100))
+}
+
+func TestPoller_Run(t *testing.T) {
+	sim := newSimulator(t)
+	sim.setHolding(0, 215)
+	sim.setHolding(2, 0x7fc0, 0x0000) // float32 NaN
+	sim.setInput(10, 0x0001, 0x86a0)
+
+	submitter := &agent.MockSubmitter{}
+	logger := zerolog.Nop()
+	p, err := NewPoller(config.ModbusSlaveYAML{
+		Name:          "meter-1",
+		Address:       sim.Addr(),
+		Interval:      10 * time.Millisecond,
+		Topic:         "sites/1/meter",
+		TargetBrokers: []string{"nats"},
+		Registers: []config.ModbusRegisterYAML{
+			{Name: "temperature", Address: 0, Scale: 0.1},
+			{Name: "energy", Table: TableInput, Address: 10, DataType: "uint32"},
+			{Name: "pressure", Address: 2, DataType: "float32"},
+		},
+	}, submitter, &logger)
+	assert.NoError(t, err)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		p.Run(ctx)
+		close(done)
+	}()
+
+	deadline := time.Now().Add(5 * time.Second)
+	for len(submitter.Messages()) < 2 && time.Now().Before(deadline) {
+		time.Sleep(5 * time.Millisecond)
+	}
+	cancel()
+	<-done
+
+	msgs := submitter.Messages()
+	assert.True(t, len(msgs) >= 2)
+	assert.Equal(t, "meter-1", msgs[0].DeviceID)
+	assert.Equal(t, "sites/1/meter", msgs[0].Topic)
+	assert.Equal(t, []string{"nats"}, msgs[0].TargetBrokers)
+
+	var values map[string]*float64
+	assert.NoError(t, json.Unmarshal(msgs[0].Payload, &values))
+	assert.True(t, math.Abs(*values["temperature"]-21.5) < 1e-9)
+	assert.Equal(t, float64(100000), *values["energy"])
+
+	// A NaN reading doesn't fail the poll, it is sent as null
+	pressure, exist := values["pressure"]
+	assert.True(t, exist)
+	assert.Zero(t, pressure)
+}
+
+func TestPoller_BackoffOnError(t *testing.T) {
+	sim := newSimulator(t) // no registers, every read fails
+
+	logger := zerolog.Nop()
+	p, err := NewPoller(config.ModbusSlaveYAML{
+		Name:       "meter-1",
+		Address:    sim.Addr(),
+		Interval:   10 * time.Millisecond,
+		MaxBackoff: time.Hour,
+		Registers:  []config.ModbusRegisterYAML{{Name: "temperature"}},
+	}, &agent.MockSubmitter{}, &logger)
+	assert.NoError(t, err)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 200*time.Millisecond)
+	defer cancel()
+	p.Run(ctx)
+
+	// Polls at 0, 20, 60 and 140ms; without backoff it would be about 20 polls
+	assert.True(t, sim.Requests() <= 5)
+}
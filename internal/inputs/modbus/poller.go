@@ -0,0 +1,176 @@
+package modbus
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"time"
+
+	"github.com/LincolnG4/iot-hydra/internal/agent"
+	"github.com/LincolnG4/iot-hydra/internal/config"
+	"github.com/LincolnG4/iot-hydra/internal/message"
+	"github.com/rs/zerolog"
+)
+
+const (
+	TableHolding = "holding"
+	TableInput   = "input"
+
+	defaultMaxBackoff = 5 * time.Minute
+)
+
+// Poller reads the registers of a slave every interval and submits them as one message.
+type Poller struct {
+	cfg       config.ModbusSlaveYAML
+	client    *client
+	submitter agent.Submitter
+	logger    *zerolog.Logger
+}
+
+// NewPoller creates the poller of the slave.
+func NewPoller(cfg config.ModbusSlaveYAML, submitter agent.Submitter, parentLogger *zerolog.Logger) (*Poller, error) {
+	if parentLogger == nil {
+		return nil, errors.New("logger can't be nil")
+	}
+	if cfg.Interval <= 0 {
+		return nil, fmt.Errorf("poll interval of slave '%s' must be positive", cfg.Name)
+	}
+	if cfg.Timeout == 0 {
+		cfg.Timeout = cfg.Interval
+	}
+	if cfg.MaxBackoff == 0 {
+		cfg.MaxBackoff = defaultMaxBackoff
+	}
+	logger := parentLogger.With().Str("component", "modbus").Str("slave", cfg.Name).Logger()
+
+	return &Poller{
+		cfg:       cfg,
+		client:    newClient(cfg.Address, cfg.UnitID, cfg.Timeout),
+		submitter: submitter,
+		logger:    &logger,
+	}, nil
+}
+
+// Run polls the slave until ctx is done. After a failed poll the next one waits
+// twice as long, up to MaxBackoff.
+func (p *Poller) Run(ctx context.Context) {
+	defer p.client.close()
+
+	failures := 0
+	timer := time.NewTimer(0)
+	defer timer.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-timer.C:
+		}
+
+		if err := p.poll(); err != nil {
+			failures++
+			p.client.close()
+			wait := p.backoff(failures)
+			p.logger.Warn().Err(err).Int("failures", failures).Dur("retry_in", wait).Msg("failed to poll modbus slave")
+			timer.Reset(wait)
+			continue
+		}
+
+		failures = 0
+		timer.Reset(p.cfg.Interval)
+	}
+}
+
+// backoff returns the wait after the consecutive failures.
+func (p *Poller) backoff(failures int) time.Duration {
+	wait := p.cfg.Interval
+	for i := 0; i < failures && wait < p.cfg.MaxBackoff; i++ {
+		wait *= 2
+	}
+	return min(wait, p.cfg.MaxBackoff)
+}
+
+// poll reads all registers and submits the reading. Values that JSON can't hold,
+// e.g. a float32 register reading NaN, are sent as null.
+func (p *Poller) poll() error {
+	values := make(map[string]any, len(p.cfg.Registers))
+	for _, reg := range p.cfg.Registers {
+		function := funcReadHoldingRegisters
+		if reg.Table == TableInput {
+			function = funcReadInputRegisters
+		}
+
+		words, err := p.client.readRegisters(function, reg.Address, registerCount(reg.DataType))
+		if err != nil {
+			return fmt.Errorf("failed to read register '%s': %w", reg.Name, err)
+		}
+		v := decode(reg, words)
+		if math.IsNaN(v) || math.IsInf(v, 0) {
+			values[reg.Name] = nil
+			continue
+		}
+		values[reg.Name] = v
+	}
+
+	payload, err := json.Marshal(values)
+	if err != nil {
+		return err
+	}
+
+	msg := &message.Message{
+		ID:            message.NewID("modbus"),
+		DeviceID:      p.cfg.Name,
+		Timestamp:     time.Now(),
+		Payload:       payload,
+		TargetBrokers: p.cfg.TargetBrokers,
+		Topic:         p.cfg.Topic,
+	}
+	if err := p.submitter.Submit(msg); err != nil && !agent.IsQueued(err) {
+		// The slave is fine, only the reading is lost
+		p.logger.Error().Err(err).Str("message", msg.ID).Str("topic", msg.Topic).Msg("failed to submit modbus reading")
+	}
+	return nil
+}
+
+// registerCount returns the number of registers holding a value of the data type.
+func registerCount(dataType string) uint16 {
+	switch dataType {
+	case "uint32", "int32", "float32":
+		return 2
+	default:
+		return 1
+	}
+}
+
+// decode converts the registers to the scaled value of the register map.
+func decode(reg config.ModbusRegisterYAML, words []uint16) float64 {
+	var raw float64
+	switch reg.DataType {
+	case "int16":
+		raw = float64(int16(words[0]))
+	case "uint32", "int32", "float32":
+		hi, lo := words[0], words[1]
+		if reg.WordOrder == "little" {
+			hi, lo = lo, hi
+		}
+		bits := uint32(hi)<<16 | uint32(lo)
+		switch reg.DataType {
+		case "uint32":
+			raw = float64(bits)
+		case "int32":
+			raw = float64(int32(bits))
+		default:
+			raw = float64(math.Float32frombits(bits))
+		}
+	default:
+		raw = float64(words[0])
+	}
+
+	scale := reg.Scale
+	if scale == 0 {
+		scale = 1
+	}
+	return raw*scale + reg.Offset
+}
@@ -0,0 +1,115 @@
+package modbus
+
+import (
+	"encoding/binary"
+	"io"
+	"net"
+	"sync"
+	"testing"
+)
+
+// simulator is an in-process Modbus TCP slave serving fixed register tables.
+// Reads outside the tables get the illegal data address exception.
+type simulator struct {
+	listener net.Listener
+	mu       sync.Mutex
+	holding  map[uint16]uint16
+	input    map[uint16]uint16
+	requests int
+}
+
+func newSimulator(t *testing.T) *simulator {
+	t.Helper()
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	s := &simulator{listener: listener, holding: make(map[uint16]uint16), input: make(map[uint16]uint16)}
+	t.Cleanup(func() { listener.Close() })
+	go s.serve()
+	return s
+}
+
+func (s *simulator) Addr() string {
+	return s.listener.Addr().String()
+}
+
+func (s *simulator) setHolding(address uint16, values ...uint16) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for i, v := range values {
+		s.holding[address+uint16(i)] = v
+	}
+}
+
+func (s *simulator) setInput(address uint16, values ...uint16) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for i, v := range values {
+		s.input[address+uint16(i)] = v
+	}
+}
+
+func (s *simulator) Requests() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.requests
+}
+
+func (s *simulator) serve() {
+	for {
+		conn, err := s.listener.Accept()
+		if err != nil {
+			return
+		}
+		go s.handle(conn)
+	}
+}
+
+func (s *simulator) handle(conn net.Conn) {
+	defer conn.Close()
+	for {
+		req := make([]byte, 12)
+		if _, err := io.ReadFull(conn, req); err != nil {
+			return
+		}
+		function := req[7]
+		address := binary.BigEndian.Uint16(req[8:])
+		quantity := binary.BigEndian.Uint16(req[10:])
+
+		pdu := s.read(function, address, quantity)
+		resp := make([]byte, 7, 7+len(pdu))
+		copy(resp, req[:4])
+		binary.BigEndian.PutUint16(resp[4:], uint16(len(pdu)+1))
+		resp[6] = req[6]
+		if _, err := conn.Write(append(resp, pdu...)); err != nil {
+			return
+		}
+	}
+}
+
+func (s *simulator) read(function byte, address, quantity uint16) []byte {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.requests++
+
+	table := s.holding
+	switch function {
+	case funcReadHoldingRegisters:
+	case funcReadInputRegisters:
+		table = s.input
+	default:
+		return []byte{function | 0x80, 0x01} // illegal function
+	}
+
+	pdu := []byte{function, byte(2 * quantity)}
+	for i := uint16(0); i < quantity; i++ {
+		v, exist := table[address+i]
+		if !exist {
+			return []byte{function | 0x80, 0x02} // illegal data address
+		}
+		pdu = binary.BigEndian.AppendUint16(pdu, v)
+	}
+	return pdu
+}
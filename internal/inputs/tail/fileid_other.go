@@ -0,0 +1,11 @@
+//go:build !unix
+
+package tail
+
+import "os"
+
+// fileIdentity is only supported on Unix, the saved offset is then only checked
+// against the size of the file.
+func fileIdentity(os.FileInfo) (fileID, bool) {
+	return fileID{}, false
+}
@@ -0,0 +1,18 @@
+//go:build unix
+
+package tail
+
+import (
+	"os"
+	"syscall"
+)
+
+// fileIdentity returns the device and inode of the file.
+func fileIdentity(info os.FileInfo) (fileID, bool) {
+	st, ok := info.Sys().(*syscall.Stat_t)
+	if !ok {
+		return fileID{}, false
+	}
+	// Dev isn't an uint64 on every platform
+	return fileID{Device: uint64(st.Dev), Inode: st.Ino}, true
+}
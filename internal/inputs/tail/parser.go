@@ -0,0 +1,144 @@
+package tail
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/LincolnG4/iot-hydra/internal/config"
+)
+
+// Formats of the lines
+const (
+	FormatRaw   = "raw"
+	FormatJSON  = "json"
+	FormatCSV   = "csv"
+	FormatRegex = "regex"
+)
+
+// errHeader is returned for the csv header, which isn't a record.
+var errHeader = errors.New("csv header")
+
+// parser converts the lines to the payload of the messages.
+type parser struct {
+	format    string
+	columns   []string // csv columns, read from the header if not configured
+	header    bool     // the columns come from the header of the file
+	delimiter rune
+	pattern   *regexp.Regexp
+}
+
+func newParser(cfg config.TailParserYAML) (*parser, error) {
+	p := &parser{format: cfg.Format, columns: cfg.Columns, delimiter: ','}
+	if p.format == "" {
+		p.format = FormatRaw
+	}
+
+	switch p.format {
+	case FormatRaw, FormatJSON:
+	case FormatCSV:
+		p.header = len(cfg.Columns) == 0
+		if cfg.Delimiter != "" {
+			p.delimiter = []rune(cfg.Delimiter)[0]
+		}
+	case FormatRegex:
+		pattern, err := regexp.Compile(cfg.Pattern)
+		if err != nil {
+			return nil, fmt.Errorf("failed to compile pattern '%s': %w", cfg.Pattern, err)
+		}
+		if pattern.NumSubexp() == 0 {
+			return nil, fmt.Errorf("pattern '%s' has no group", cfg.Pattern)
+		}
+		p.pattern = pattern
+	default:
+		return nil, fmt.Errorf("unknown line format '%s'", p.format)
+	}
+	return p, nil
+}
+
+// needsHeader reports whether the csv columns must be read from the next line.
+func (p *parser) needsHeader() bool {
+	return p.header && p.columns == nil
+}
+
+// resetHeader forgets the columns of the header, e.g. when a new file is opened.
+func (p *parser) resetHeader() {
+	if p.header {
+		p.columns = nil
+	}
+}
+
+// parse returns the JSON payload of the line.
+func (p *parser) parse(line string) ([]byte, error) {
+	switch p.format {
+	case FormatJSON:
+		line = strings.TrimSpace(line)
+		if !strings.HasPrefix(line, "{") || !json.Valid([]byte(line)) {
+			return nil, errors.New("line is not a JSON object")
+		}
+		return []byte(line), nil
+	case FormatCSV:
+		return p.parseCSV(line)
+	case FormatRegex:
+		return p.parseRegex(line)
+	default:
+		return json.Marshal(map[string]string{"line": line})
+	}
+}
+
+func (p *parser) parseCSV(line string) ([]byte, error) {
+	r := csv.NewReader(strings.NewReader(line))
+	r.Comma = p.delimiter
+	r.FieldsPerRecord = -1
+	r.TrimLeadingSpace = true
+	values, err := r.Read()
+	if err != nil {
+		return nil, fmt.Errorf("invalid csv line: %w", err)
+	}
+
+	if p.needsHeader() {
+		p.columns = values
+		return nil, errHeader
+	}
+	if len(values) != len(p.columns) {
+		return nil, fmt.Errorf("csv line has %d columns instead of %d", len(values), len(p.columns))
+	}
+
+	fields := make(map[string]any, len(values))
+	for i, value := range values {
+		fields[p.columns[i]] = fieldValue(value)
+	}
+	return json.Marshal(fields)
+}
+
+func (p *parser) parseRegex(line string) ([]byte, error) {
+	match := p.pattern.FindStringSubmatch(line)
+	if match == nil {
+		return nil, errors.New("line doesn't match the pattern")
+	}
+
+	fields := make(map[string]any, len(match)-1)
+	for i, name := range p.pattern.SubexpNames() {
+		if i == 0 {
+			continue
+		}
+		if name == "" {
+			name = strconv.Itoa(i)
+		}
+		fields[name] = fieldValue(match[i])
+	}
+	return json.Marshal(fields)
+}
+
+// fieldValue returns the number of a numeric field, or the field as is.
+func fieldValue(value string) any {
+	if f, err := strconv.ParseFloat(value, 64); err == nil && !math.IsNaN(f) && !math.IsInf(f, 0) {
+		return f
+	}
+	return value
+}
@@ -0,0 +1,361 @@
+package tail
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/LincolnG4/iot-hydra/internal/agent"
+	"github.com/LincolnG4/iot-hydra/internal/config"
+	"github.com/LincolnG4/iot-hydra/internal/message"
+	"github.com/LincolnG4/iot-hydra/internal/utils"
+	"github.com/rs/zerolog"
+)
+
+const defaultPollInterval = time.Second
+
+// errStreamHeader is returned for a csv stream without columns: its first line
+// read is usually a data line or a fragment, not a header.
+var errStreamHeader = errors.New("csv columns are required to read a character device or named pipe")
+
+// Tailer follows a file or reads a character device and submits each line.
+type Tailer struct {
+	cfg       config.TailYAML
+	parser    *parser
+	submitter agent.Submitter
+	logger    *zerolog.Logger
+}
+
+// NewTailer creates the tailer of the path.
+func NewTailer(cfg config.TailYAML, submitter agent.Submitter, parentLogger *zerolog.Logger) (*Tailer, error) {
+	if parentLogger == nil {
+		return nil, errors.New("logger can't be nil")
+	}
+	if cfg.PollInterval == 0 {
+		cfg.PollInterval = defaultPollInterval
+	}
+	p, err := newParser(cfg.Parser)
+	if err != nil {
+		return nil, fmt.Errorf("invalid parser of '%s': %w", cfg.Path, err)
+	}
+	if info, err := os.Stat(cfg.Path); err == nil && isStream(info) && p.header {
+		return nil, fmt.Errorf("invalid parser of '%s': %w", cfg.Path, errStreamHeader)
+	}
+	logger := parentLogger.With().Str("component", "tail").Str("path", cfg.Path).Logger()
+
+	return &Tailer{
+		cfg:       cfg,
+		parser:    p,
+		submitter: submitter,
+		logger:    &logger,
+	}, nil
+}
+
+// Run reads the lines until ctx is done. The path is opened again after an error,
+// e.g. a file that doesn't exist yet or a device that was unplugged.
+func (t *Tailer) Run(ctx context.Context) {
+	for {
+		err := t.read(ctx)
+		if ctx.Err() != nil {
+			return
+		}
+		t.logger.Warn().Err(err).Dur("retry_in", t.cfg.PollInterval).Msg("failed to tail path")
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(t.cfg.PollInterval):
+		}
+	}
+}
+
+// read follows a regular file or reads a stream until ctx is done or it fails.
+func (t *Tailer) read(ctx context.Context) error {
+	info, err := os.Stat(t.cfg.Path)
+	if err != nil {
+		return err
+	}
+	if isStream(info) {
+		return t.readStream(ctx)
+	}
+	if !info.Mode().IsRegular() {
+		return fmt.Errorf("'%s' is not a file nor a character device", t.cfg.Path)
+	}
+	return t.followFile(ctx)
+}
+
+// isStream reports whether the file is a character device or a named pipe.
+func isStream(info os.FileInfo) bool {
+	return info.Mode()&(os.ModeCharDevice|os.ModeNamedPipe) != 0
+}
+
+// readStream reads the lines of a character device or named pipe. There is no
+// offset, only the lines written while it is open are read.
+func (t *Tailer) readStream(ctx context.Context) error {
+	// The path may have become a stream since the tailer was created
+	if t.parser.header {
+		return errStreamHeader
+	}
+
+	f, err := os.Open(t.cfg.Path)
+	if err != nil {
+		return err
+	}
+	// Unblocks the read when ctx is done
+	stop := context.AfterFunc(ctx, func() { f.Close() })
+	defer stop()
+	defer f.Close()
+
+	t.logger.Info().Msg("reading device")
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		t.emit(scanner.Text())
+	}
+	if err := scanner.Err(); err != nil {
+		return err
+	}
+	return io.EOF
+}
+
+// followFile reads the lines appended to the file every poll interval. A rotated
+// file is read to its end before the new file is opened, and a truncated one is
+// read again from its start.
+func (t *Tailer) followFile(ctx context.Context) error {
+	f, info, offset, err := t.openFile()
+	if err != nil {
+		return err
+	}
+	defer func() { f.Close() }()
+	t.logger.Info().Int64("offset", offset).Msg("following file")
+
+	r := bufio.NewReader(f)
+	partial := ""
+	saved := offset
+	ticker := time.NewTicker(t.cfg.PollInterval)
+	defer ticker.Stop()
+
+	for {
+		// Only complete lines move the offset
+		for {
+			chunk, err := r.ReadString('\n')
+			if err == io.EOF {
+				partial += chunk
+				break
+			}
+			if err != nil {
+				return fmt.Errorf("failed to read '%s': %w", t.cfg.Path, err)
+			}
+			line := partial + chunk
+			partial = ""
+			offset += int64(len(line))
+			t.emit(line)
+		}
+		if offset != saved {
+			t.saveOffset(info, offset)
+			saved = offset
+		}
+
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-ticker.C:
+		}
+
+		current, err := f.Stat()
+		if err != nil {
+			return err
+		}
+		latest, err := os.Stat(t.cfg.Path)
+		switch {
+		case err != nil:
+			// Removed and not created again yet, the old file may still grow
+		case !os.SameFile(current, latest):
+			// Rotated, the rest of the old file is read before the switch
+			if _, err := io.Copy(lineWriter{t, &partial}, r); err != nil {
+				return fmt.Errorf("failed to read '%s': %w", t.cfg.Path, err)
+			}
+			if partial != "" {
+				t.emit(partial)
+				partial = ""
+			}
+			t.logger.Info().Msg("file rotated")
+			f.Close()
+			if f, err = os.Open(t.cfg.Path); err != nil {
+				return err
+			}
+			if info, err = f.Stat(); err != nil {
+				return err
+			}
+			r.Reset(f)
+			t.parser.resetHeader()
+			offset, saved = 0, -1
+		case current.Size() < offset:
+			t.logger.Info().Msg("file truncated")
+			if _, err := f.Seek(0, io.SeekStart); err != nil {
+				return err
+			}
+			r.Reset(f)
+			t.parser.resetHeader()
+			partial = ""
+			offset, saved = 0, -1
+		}
+	}
+}
+
+// openFile opens the file at the saved offset. Without saved offset it starts at
+// the end of the file, or at its start with FromStart. A saved offset of another
+// file or after the end means the file was rotated or truncated while stopped, so
+// it starts again.
+func (t *Tailer) openFile() (*os.File, os.FileInfo, int64, error) {
+	f, err := os.Open(t.cfg.Path)
+	if err != nil {
+		return nil, nil, 0, err
+	}
+	info, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return nil, nil, 0, err
+	}
+
+	offset, found := t.loadOffset(info)
+	switch {
+	case found && offset > info.Size():
+		offset = 0
+	case !found && !t.cfg.FromStart:
+		offset = info.Size()
+	case !found:
+		offset = 0
+	}
+
+	// The csv header is the first line of the file
+	t.parser.resetHeader()
+	if t.parser.needsHeader() && offset > 0 {
+		header, err := bufio.NewReader(f).ReadString('\n')
+		if err != nil && err != io.EOF {
+			f.Close()
+			return nil, nil, 0, fmt.Errorf("failed to read header of '%s': %w", t.cfg.Path, err)
+		}
+		t.emit(header)
+	}
+
+	if _, err := f.Seek(offset, io.SeekStart); err != nil {
+		f.Close()
+		return nil, nil, 0, err
+	}
+	return f, info, offset, nil
+}
+
+// emit submits the parsed line. Empty and invalid lines are skipped.
+func (t *Tailer) emit(line string) {
+	line = strings.TrimRight(line, "\r\n")
+	if strings.TrimSpace(line) == "" {
+		return
+	}
+
+	payload, err := t.parser.parse(line)
+	if errors.Is(err, errHeader) {
+		return
+	}
+	if err != nil {
+		t.logger.Warn().Err(err).Str("line", line).Msg("failed to parse line")
+		return
+	}
+
+	msg := &message.Message{
+		ID:            message.NewID("tail"),
+		DeviceID:      t.cfg.DeviceID,
+		Timestamp:     time.Now(),
+		Payload:       payload,
+		TargetBrokers: t.cfg.TargetBrokers,
+		Topic:         t.cfg.Topic,
+	}
+	if err := t.submitter.Submit(msg); err != nil && !agent.IsQueued(err) {
+		t.logger.Error().Err(err).Str("message", msg.ID).Str("topic", msg.Topic).Msg("failed to submit line")
+	}
+}
+
+// lineWriter emits the complete lines written to it and keeps the rest in partial.
+type lineWriter struct {
+	t       *Tailer
+	partial *string
+}
+
+func (w lineWriter) Write(p []byte) (int, error) {
+	text := *w.partial + string(p)
+	for {
+		line, rest, found := strings.Cut(text, "\n")
+		if !found {
+			break
+		}
+		w.t.emit(line)
+		text = rest
+	}
+	*w.partial = text
+	return len(p), nil
+}
+
+// fileID identifies a file across renames, so a file replaced while the tailer
+// was stopped isn't read at the offset of the previous one.
+type fileID struct {
+	Device uint64 `json:"device,omitempty"`
+	Inode  uint64 `json:"inode,omitempty"`
+}
+
+// offsetState is the content of the offset file.
+type offsetState struct {
+	Path   string `json:"path"`
+	Offset int64  `json:"offset"`
+	fileID
+}
+
+// loadOffset returns the offset saved for the path, if any. The offset of another
+// file than info, e.g. rotated while stopped, is 0.
+func (t *Tailer) loadOffset(info os.FileInfo) (int64, bool) {
+	if t.cfg.OffsetFile == "" {
+		return 0, false
+	}
+	data, err := os.ReadFile(t.cfg.OffsetFile)
+	if err != nil {
+		if !errors.Is(err, os.ErrNotExist) {
+			t.logger.Warn().Err(err).Msg("failed to read offset file")
+		}
+		return 0, false
+	}
+
+	var state offsetState
+	if err := json.Unmarshal(data, &state); err != nil {
+		t.logger.Warn().Err(err).Msg("failed to decode offset file")
+		return 0, false
+	}
+	if state.Path != t.cfg.Path || state.Offset < 0 {
+		return 0, false
+	}
+	if id, ok := fileIdentity(info); ok && state.fileID != (fileID{}) && state.fileID != id {
+		t.logger.Info().Msg("file replaced while stopped")
+		return 0, true
+	}
+	return state.Offset, true
+}
+
+// saveOffset writes the offset in the file described by info to the offset file.
+func (t *Tailer) saveOffset(info os.FileInfo, offset int64) {
+	if t.cfg.OffsetFile == "" {
+		return
+	}
+	state := offsetState{Path: t.cfg.Path, Offset: offset}
+	state.fileID, _ = fileIdentity(info)
+	data, err := json.Marshal(state)
+	if err != nil {
+		t.logger.Error().Err(err).Msg("failed to encode offset")
+		return
+	}
+	if err := utils.WriteFileAtomic(t.cfg.OffsetFile, data); err != nil {
+		t.logger.Error().Err(err).Msg("failed to save offset")
+	}
+}
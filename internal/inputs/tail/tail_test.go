@@ -0,0 +1,222 @@
+package tail
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"sync"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/LincolnG4/iot-hydra/internal/agent"
+	"github.com/LincolnG4/iot-hydra/internal/config"
+	"github.com/alecthomas/assert"
+	"github.com/rs/zerolog"
+)
+
+// waitPayloads waits until n payloads were submitted and returns them.
+func waitPayloads(t *testing.T, submitter *agent.MockSubmitter, n int) []string {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for len(submitter.Payloads()) < n && time.Now().Before(deadline) {
+		time.Sleep(5 * time.Millisecond)
+	}
+	return submitter.Payloads()
+}
+
+// startTailer runs the tailer until the returned stop is called or the test ends.
+func startTailer(t *testing.T, cfg config.TailYAML, submitter *agent.MockSubmitter) (stop func()) {
+	t.Helper()
+	cfg.DeviceID = "plc-1"
+	cfg.Topic = "legacy/plc-1"
+	cfg.TargetBrokers = []string{"nats"}
+	cfg.PollInterval = 10 * time.Millisecond
+	logger := zerolog.Nop()
+	tailer, err := NewTailer(cfg, submitter, &logger)
+	assert.NoError(t, err)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		tailer.Run(ctx)
+		close(done)
+	}()
+	stop = sync.OnceFunc(func() {
+		cancel()
+		<-done
+	})
+	t.Cleanup(stop)
+	return stop
+}
+
+func appendFile(t *testing.T, path, data string) {
+	t.Helper()
+	f, err := os.OpenFile(path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0o644)
+	assert.NoError(t, err)
+	_, err = f.WriteString(data)
+	assert.NoError(t, err)
+	assert.NoError(t, f.Close())
+}
+
+func TestParser(t *testing.T) {
+	tests := []struct {
+		name string
+		cfg  config.TailParserYAML
+		line string
+		want string
+	}{
+		{"raw", config.TailParserYAML{}, "motor started", `{"line":"motor started"}`},
+		{"json", config.TailParserYAML{Format: FormatJSON}, ` {"rpm": 1500} `, `{"rpm": 1500}`},
+		{"csv", config.TailParserYAML{Format: FormatCSV, Columns: []string{"time", "rpm", "state"}}, "10:00, 1500,\"on, auto\"", `{"rpm":1500,"state":"on, auto","time":"10:00"}`},
+		{"csv delimiter", config.TailParserYAML{Format: FormatCSV, Columns: []string{"a", "b"}, Delimiter: ";"}, "1.5;NaN", `{"a":1.5,"b":"NaN"}`},
+		{"regex", config.TailParserYAML{Format: FormatRegex, Pattern: `^T=(?P<temp>[\d.]+) (\w+)$`}, "T=21.5 ok", `{"2":"ok","temp":21.5}`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p, err := newParser(tt.cfg)
+			assert.NoError(t, err)
+			payload, err := p.parse(tt.line)
+			assert.NoError(t, err)
+			assert.Equal(t, tt.want, string(payload))
+		})
+	}
+}
+
+func TestParser_Errors(t *testing.T) {
+	_, err := newParser(config.TailParserYAML{Format: FormatRegex, Pattern: "no group"})
+	assert.Error(t, err)
+	_, err = newParser(config.TailParserYAML{Format: FormatRegex, Pattern: "("})
+	assert.Error(t, err)
+
+	p, err := newParser(config.TailParserYAML{Format: FormatJSON})
+	assert.NoError(t, err)
+	_, err = p.parse("[1, 2]")
+	assert.Error(t, err)
+
+	p, err = newParser(config.TailParserYAML{Format: FormatRegex, Pattern: `^(\d+)$`})
+	assert.NoError(t, err)
+	_, err = p.parse("abc")
+	assert.Error(t, err)
+
+	// Without columns the first line is the header
+	p, err = newParser(config.TailParserYAML{Format: FormatCSV})
+	assert.NoError(t, err)
+	_, err = p.parse("a,b")
+	assert.True(t, errors.Is(err, errHeader))
+	payload, err := p.parse("1,x")
+	assert.NoError(t, err)
+	assert.Equal(t, `{"a":1,"b":"x"}`, string(payload))
+	_, err = p.parse("1,2,3")
+	assert.Error(t, err)
+}
+
+func TestTailer_FollowFile(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "plc.log")
+	appendFile(t, path, "old line\n")
+
+	submitter := &agent.MockSubmitter{}
+	startTailer(t, config.TailYAML{Path: path}, submitter)
+	time.Sleep(30 * time.Millisecond)
+
+	// Lines already in the file are skipped, a partial line waits for its end
+	appendFile(t, path, "first\nsec")
+	time.Sleep(30 * time.Millisecond)
+	appendFile(t, path, "ond\n")
+	assert.Equal(t, []string{`{"line":"first"}`, `{"line":"second"}`}, waitPayloads(t, submitter, 2))
+
+	// The end of the rotated file is read before the new one
+	appendFile(t, path, "before rotation\n")
+	assert.NoError(t, os.Rename(path, path+".1"))
+	appendFile(t, path+".1", "last of old\n")
+	appendFile(t, path, "new file\n")
+	payloads := waitPayloads(t, submitter, 5)
+	assert.Equal(t, []string{`{"line":"before rotation"}`, `{"line":"last of old"}`, `{"line":"new file"}`}, payloads[2:])
+
+	// A truncated file is read again from its start
+	time.Sleep(30 * time.Millisecond)
+	assert.NoError(t, os.WriteFile(path, []byte("x\n"), 0o644))
+	payloads = waitPayloads(t, submitter, 6)
+	assert.Equal(t, `{"line":"x"}`, payloads[5])
+
+	msg := submitter.Messages()[0]
+	assert.Equal(t, "plc-1", msg.DeviceID)
+	assert.Equal(t, "legacy/plc-1", msg.Topic)
+	assert.Equal(t, []string{"nats"}, msg.TargetBrokers)
+}
+
+func TestTailer_SavedOffset(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "plc.csv")
+	offsetFile := filepath.Join(dir, "plc.offset")
+	appendFile(t, path, "time,rpm\n10:00,1500\n")
+	cfg := config.TailYAML{
+		Path:       path,
+		OffsetFile: offsetFile,
+		FromStart:  true,
+		Parser:     config.TailParserYAML{Format: FormatCSV},
+	}
+
+	submitter := &agent.MockSubmitter{}
+	stop := startTailer(t, cfg, submitter)
+	assert.Equal(t, []string{`{"rpm":1500,"time":"10:00"}`}, waitPayloads(t, submitter, 1))
+	stop()
+
+	data, err := os.ReadFile(offsetFile)
+	assert.NoError(t, err)
+	var state offsetState
+	assert.NoError(t, json.Unmarshal(data, &state))
+	assert.Equal(t, path, state.Path)
+	assert.Equal(t, int64(20), state.Offset)
+	assert.NotZero(t, state.Inode)
+
+	// Lines written while stopped are read after the restart, with the header of the file
+	appendFile(t, path, "10:01,1600\n")
+	submitter = &agent.MockSubmitter{}
+	stop = startTailer(t, cfg, submitter)
+	assert.Equal(t, []string{`{"rpm":1600,"time":"10:01"}`}, waitPayloads(t, submitter, 1))
+	stop()
+
+	// Rotated while stopped, the new file is read from its start even though it is
+	// longer than the saved offset
+	assert.NoError(t, os.Rename(path, path+".1"))
+	appendFile(t, path, "time,rpm\n10:02,1700\n10:03,1800\n10:04,1900\n")
+	submitter = &agent.MockSubmitter{}
+	startTailer(t, cfg, submitter)
+	assert.Equal(t, []string{
+		`{"rpm":1700,"time":"10:02"}`,
+		`{"rpm":1800,"time":"10:03"}`,
+		`{"rpm":1900,"time":"10:04"}`,
+	}, waitPayloads(t, submitter, 3))
+}
+
+func TestTailer_NamedPipe(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "console")
+	assert.NoError(t, syscall.Mkfifo(path, 0o600))
+
+	submitter := &agent.MockSubmitter{}
+	startTailer(t, config.TailYAML{Path: path, Parser: config.TailParserYAML{Format: FormatJSON}}, submitter)
+
+	f, err := os.OpenFile(path, os.O_WRONLY, 0)
+	assert.NoError(t, err)
+	_, err = f.WriteString("{\"v\":1}\r\nnot json\n{\"v\":2}\n")
+	assert.NoError(t, err)
+	assert.NoError(t, f.Close())
+
+	assert.Equal(t, []string{`{"v":1}`, `{"v":2}`}, waitPayloads(t, submitter, 2))
+}
+
+func TestTailer_StreamWithoutColumns(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "console")
+	assert.NoError(t, syscall.Mkfifo(path, 0o600))
+	logger := zerolog.Nop()
+
+	_, err := NewTailer(config.TailYAML{Path: path, Parser: config.TailParserYAML{Format: FormatCSV}}, &agent.MockSubmitter{}, &logger)
+	assert.True(t, errors.Is(err, errStreamHeader))
+
+	_, err = NewTailer(config.TailYAML{Path: path, Parser: config.TailParserYAML{Format: FormatCSV, Columns: []string{"rpm"}}}, &agent.MockSubmitter{}, &logger)
+	assert.NoError(t, err)
+}
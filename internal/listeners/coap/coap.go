@@ -0,0 +1,609 @@
+package coap
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/LincolnG4/iot-hydra/internal/agent"
+	"github.com/LincolnG4/iot-hydra/internal/config"
+	"github.com/LincolnG4/iot-hydra/internal/message"
+	"github.com/pion/dtls/v3"
+	coapdtls "github.com/plgd-dev/go-coap/v3/dtls"
+	dtlsserver "github.com/plgd-dev/go-coap/v3/dtls/server"
+	coapmessage "github.com/plgd-dev/go-coap/v3/message"
+	"github.com/plgd-dev/go-coap/v3/message/codes"
+	"github.com/plgd-dev/go-coap/v3/message/pool"
+	"github.com/plgd-dev/go-coap/v3/mux"
+	coapnet "github.com/plgd-dev/go-coap/v3/net"
+	"github.com/plgd-dev/go-coap/v3/net/blockwise"
+	"github.com/plgd-dev/go-coap/v3/options"
+	"github.com/plgd-dev/go-coap/v3/udp"
+	udpclient "github.com/plgd-dev/go-coap/v3/udp/client"
+	udpserver "github.com/plgd-dev/go-coap/v3/udp/server"
+	"github.com/rs/zerolog"
+)
+
+const (
+	devicePlaceholder    = "{device}"
+	defaultDownlinkTopic = "devices/{device}/cmd"
+
+	// Limit of the payloads received with block-wise transfers
+	maxPayloadSize = 1 << 20
+	// Limits of the block-wise transfers received at the same time, so their
+	// payloads can't take more than maxTransfers*maxPayloadSize of memory
+	maxPeerTransfers = 4
+	maxTransfers     = 64
+	transferTimeout  = 30 * time.Second
+
+	// Limit of the peers (UDP addresses or DTLS sessions) served at the same time.
+	// Sessions are closed after sessionTimeout without request, observing devices
+	// must ping the server to keep their observation
+	maxSessions    = 256
+	sessionTimeout = 5 * time.Minute
+	// Limit of the confirmable requests of a peer per exchange lifetime. The
+	// responses are cached for the exchange lifetime to answer retransmissions,
+	// the cache can't hold more than maxSessions*maxPeerExchanges responses
+	maxPeerExchanges = 2048
+
+	// Limits of the downlink observations
+	maxPeerObservers = 4
+	maxObservers     = 1024
+
+	handshakeTimeout = 10 * time.Second
+)
+
+// Agent receives the published messages and provides the downlink subscriptions.
+type Agent interface {
+	Submit(*message.Message) error
+	Subscribe(broker, topic string, handler func(*message.Message)) (func() error, error)
+}
+
+// Server is a CoAP server forwarding the messages published by the devices to
+// the telemetry agent.
+type Server struct {
+	cfg    config.CoAPServiceYAML
+	agent  Agent
+	logger *zerolog.Logger
+
+	addr  net.Addr
+	serve func() error
+	stop  func()
+
+	mu            sync.Mutex
+	sessions      map[mux.Conn]*session
+	transfers     map[transferKey]time.Time // block-wise uploads and their deadline
+	observerCount int
+
+	wg sync.WaitGroup
+}
+
+// session is the state of a peer.
+type session struct {
+	// DTLS identity, or "" without DTLS
+	deviceID  string
+	observers map[string]*observer // by token
+
+	exchanges   int
+	windowStart time.Time
+}
+
+type transferKey struct {
+	session *session
+	token   string
+}
+
+// observer is a device observing its downlink topic.
+type observer struct {
+	conn        mux.Conn
+	token       []byte
+	seq         uint32
+	lastMID     int32
+	unsubscribe func() error
+}
+
+// NewServer creates the CoAP server listening on the configured address, with DTLS
+// when it is configured.
+func NewServer(cfg config.CoAPServiceYAML, agent Agent, parentLogger *zerolog.Logger) (*Server, error) {
+	if parentLogger == nil {
+		return nil, errors.New("logger can't be nil")
+	}
+	logger := parentLogger.With().Str("component", "coap").Logger()
+
+	if cfg.DownlinkTopic == "" {
+		cfg.DownlinkTopic = defaultDownlinkTopic
+	}
+
+	s := &Server{
+		cfg:       cfg,
+		agent:     agent,
+		logger:    &logger,
+		sessions:  make(map[mux.Conn]*session),
+		transfers: make(map[transferKey]time.Time),
+	}
+
+	router := mux.NewRouter()
+	router.HandleFunc("/t/{topic:.+}", s.publish)
+	router.HandleFunc("/cmd", s.observe)
+
+	opts := []serverOption{
+		options.WithMux(router),
+		options.WithMaxMessageSize(maxPayloadSize),
+		options.WithBlockwise(true, blockwise.SZX1024, transferTimeout),
+		options.WithInactivityMonitor(sessionTimeout, func(cc *udpclient.Conn) {
+			_ = cc.Close()
+		}),
+		options.WithOnNewConn(s.onNewConn),
+		options.WithRequestMonitor(s.monitorRequest),
+		options.WithErrors(func(err error) {
+			s.logger.Debug().Err(err).Msg("coap error")
+		}),
+	}
+
+	if cfg.DTLS == nil {
+		conn, err := coapnet.NewListenUDP("udp", cfg.Address)
+		if err != nil {
+			return nil, fmt.Errorf("failed to listen on '%s': %w", cfg.Address, err)
+		}
+		udpOpts := make([]udpserver.Option, 0, len(opts))
+		for _, o := range opts {
+			udpOpts = append(udpOpts, o)
+		}
+		srv := udp.NewServer(udpOpts...)
+		s.addr = conn.LocalAddr()
+		s.serve = func() error { return srv.Serve(conn) }
+		s.stop = func() {
+			srv.Stop()
+			conn.Close()
+		}
+		return s, nil
+	}
+
+	dtlsConfig, err := newDTLSConfig(cfg.DTLS)
+	if err != nil {
+		return nil, err
+	}
+	listener, err := coapnet.NewDTLSListener("udp", cfg.Address, dtlsConfig)
+	if err != nil {
+		return nil, fmt.Errorf("failed to listen on '%s': %w", cfg.Address, err)
+	}
+	dtlsOpts := make([]dtlsserver.Option, 0, len(opts))
+	for _, o := range opts {
+		dtlsOpts = append(dtlsOpts, o)
+	}
+	srv := coapdtls.NewServer(dtlsOpts...)
+	s.addr = listener.Addr()
+	s.serve = func() error { return srv.Serve(listener) }
+	s.stop = srv.Stop
+	return s, nil
+}
+
+// serverOption is an option shared by the UDP and DTLS servers.
+type serverOption interface {
+	udpserver.Option
+	dtlsserver.Option
+}
+
+// newDTLSConfig loads the server certificate and the CA verifying the devices.
+func newDTLSConfig(cfg *config.TLSYAML) (*dtls.Config, error) {
+	cert, err := tls.LoadX509KeyPair(cfg.CertFile, cfg.KeyFile)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load dtls certificate '%s': %w", cfg.CertFile, err)
+	}
+
+	dtlsConfig := &dtls.Config{
+		Certificates:         []tls.Certificate{cert},
+		ExtendedMasterSecret: dtls.RequireExtendedMasterSecret,
+	}
+	if cfg.ClientCAFile == "" {
+		return dtlsConfig, nil
+	}
+
+	pool, err := loadCertPool(cfg.ClientCAFile)
+	if err != nil {
+		return nil, err
+	}
+	dtlsConfig.ClientCAs = pool
+	dtlsConfig.ClientAuth = dtls.VerifyClientCertIfGiven
+	return dtlsConfig, nil
+}
+
+func loadCertPool(file string) (*x509.CertPool, error) {
+	caPEM, err := os.ReadFile(file)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read client CA file '%s': %w", file, err)
+	}
+	pool := x509.NewCertPool()
+	if !pool.AppendCertsFromPEM(caPEM) {
+		return nil, fmt.Errorf("no certificate found in client CA file '%s'", file)
+	}
+	return pool, nil
+}
+
+// Start serves the requests in background.
+func (s *Server) Start() {
+	s.logger.Info().Str("address", s.Addr()).Bool("dtls", s.cfg.DTLS != nil).Msg("starting coap server")
+
+	s.wg.Add(1)
+	go func() {
+		defer s.wg.Done()
+		if err := s.serve(); err != nil {
+			s.logger.Error().Err(err).Msg("coap server stopped")
+		}
+	}()
+}
+
+// Stop closes the listener and cancels the observations.
+func (s *Server) Stop() error {
+	s.logger.Info().Msg("stopping coap server")
+	s.stop()
+	s.wg.Wait()
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for conn := range s.sessions {
+		s.closeSession(conn)
+	}
+	return nil
+}
+
+// Addr returns the address the server is listening on.
+func (s *Server) Addr() string {
+	return s.addr.String()
+}
+
+// onNewConn registers the session of a new peer, or closes it when the server
+// has too many peers. DTLS sessions are identified by their client certificate.
+func (s *Server) onNewConn(cc *udpclient.Conn) {
+	sess := &session{}
+	if conn, ok := cc.NetConn().(*dtls.Conn); ok {
+		ctx, cancel := context.WithTimeout(cc.Context(), handshakeTimeout)
+		err := conn.HandshakeContext(ctx)
+		cancel()
+		if err != nil {
+			s.logger.Warn().Err(err).Str("remote_addr", cc.RemoteAddr().String()).Msg("dtls handshake failed")
+			_ = cc.Close()
+			return
+		}
+		sess.deviceID = dtlsIdentity(conn)
+	}
+
+	s.mu.Lock()
+	if len(s.sessions) >= maxSessions {
+		s.mu.Unlock()
+		s.logger.Warn().Str("remote_addr", cc.RemoteAddr().String()).Msg("too many coap sessions")
+		_ = cc.Close()
+		return
+	}
+	s.sessions[cc] = sess
+	s.mu.Unlock()
+
+	cc.AddOnClose(func() {
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		s.closeSession(cc)
+	})
+}
+
+// closeSession cancels the observations and transfers of the peer. Must be
+// called with mu held.
+func (s *Server) closeSession(conn mux.Conn) {
+	sess, exist := s.sessions[conn]
+	if !exist {
+		return
+	}
+	delete(s.sessions, conn)
+	for token, obs := range sess.observers {
+		s.cancelObserver(sess, token, obs)
+	}
+	for key := range s.transfers {
+		if key.session == sess {
+			delete(s.transfers, key)
+		}
+	}
+}
+
+// monitorRequest runs before the request is processed. It drops the requests over
+// the limits of the peer and cancels the observations rejected with a reset.
+func (s *Server) monitorRequest(cc *udpclient.Conn, req *pool.Message) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	sess, exist := s.sessions[cc]
+	if !exist {
+		return true, nil
+	}
+
+	if req.Type() == coapmessage.Reset {
+		for token, obs := range sess.observers {
+			if obs.lastMID == req.MessageID() {
+				s.cancelObserver(sess, token, obs)
+			}
+		}
+		return true, nil
+	}
+
+	now := time.Now()
+	if req.Type() == coapmessage.Confirmable && req.Code() != codes.Empty {
+		if now.Sub(sess.windowStart) > udpclient.ExchangeLifetime {
+			sess.windowStart = now
+			sess.exchanges = 0
+		}
+		sess.exchanges++
+		if sess.exchanges > maxPeerExchanges {
+			return true, nil
+		}
+	}
+
+	if v, err := req.GetOptionUint32(coapmessage.Block1); err == nil {
+		return !s.acceptBlock(sess, string(req.Token()), v, now), nil
+	}
+	return false, nil
+}
+
+// acceptBlock tracks the Block1 transfers of the peer. New transfers are refused
+// while the peer or the server has too many. Must be called with mu held.
+func (s *Server) acceptBlock(sess *session, token string, v uint32, now time.Time) bool {
+	_, _, more, err := blockwise.DecodeBlockOption(v)
+	if err != nil {
+		return false
+	}
+
+	key := transferKey{session: sess, token: token}
+	if !more {
+		delete(s.transfers, key)
+		return true
+	}
+
+	if _, exist := s.transfers[key]; !exist {
+		n := 0
+		for k, deadline := range s.transfers {
+			if now.After(deadline) {
+				delete(s.transfers, k)
+				continue
+			}
+			if k.session == sess {
+				n++
+			}
+		}
+		if len(s.transfers) >= maxTransfers || n >= maxPeerTransfers {
+			return false
+		}
+	}
+	s.transfers[key] = now.Add(transferTimeout)
+	return true
+}
+
+// publish submits the payload to the agent. Payloads sent with Block1 are
+// reassembled by the block-wise layer before reaching the handler.
+func (s *Server) publish(w mux.ResponseWriter, r *mux.Message) {
+	if r.Code() != codes.POST {
+		s.respond(w, codes.MethodNotAllowed, "")
+		return
+	}
+
+	deviceID, ok := s.deviceID(w.Conn(), r)
+	if !ok {
+		s.respond(w, codes.BadRequest, "invalid device id")
+		return
+	}
+
+	var payload []byte
+	if r.Body() != nil {
+		var err error
+		if payload, err = r.ReadBody(); err != nil {
+			s.respond(w, codes.BadRequest, err.Error())
+			return
+		}
+	}
+
+	msg := &message.Message{
+		ID:            message.NewID("coap"),
+		DeviceID:      deviceID,
+		Timestamp:     time.Now(),
+		Payload:       payload,
+		TargetBrokers: s.cfg.TargetBrokers,
+		Topic:         s.cfg.TopicPrefix + r.RouteParams.Vars["topic"],
+	}
+
+	err := s.agent.Submit(msg)
+	if err != nil {
+		s.logger.Error().Err(err).Str("message", msg.ID).Str("device_id", msg.DeviceID).Str("topic", msg.Topic).Msg("failed to submit coap message")
+	}
+	switch {
+	case errors.Is(err, agent.ErrAgentStopped):
+		s.respond(w, codes.ServiceUnavailable, err.Error())
+	case !agent.IsQueued(err):
+		s.respond(w, codes.BadRequest, err.Error())
+	default:
+		s.respond(w, codes.Changed, "")
+	}
+}
+
+// observe registers (Observe: 0) or removes (Observe: 1) the observation of the
+// device downlink topic. Each message received on the topic is notified to the
+// device. Only devices identified by their DTLS client certificate can observe.
+func (s *Server) observe(w mux.ResponseWriter, r *mux.Message) {
+	if r.Code() != codes.GET {
+		s.respond(w, codes.MethodNotAllowed, "")
+		return
+	}
+
+	s.mu.Lock()
+	sess, exist := s.sessions[w.Conn()]
+	s.mu.Unlock()
+	if !exist {
+		s.respond(w, codes.ServiceUnavailable, "")
+		return
+	}
+
+	token := string(r.Token())
+	flag, err := r.Observe()
+	if err != nil || flag == 1 {
+		s.mu.Lock()
+		if obs, exist := sess.observers[token]; exist {
+			s.cancelObserver(sess, token, obs)
+		}
+		s.mu.Unlock()
+		s.respond(w, codes.Content, "")
+		return
+	}
+
+	if s.cfg.DownlinkBroker == "" {
+		s.respond(w, codes.NotFound, "downlink is not configured")
+		return
+	}
+	if sess.deviceID == "" {
+		s.respond(w, codes.Unauthorized, "observe requires a dtls client certificate")
+		return
+	}
+	if !message.ValidTopicToken(sess.deviceID) {
+		s.respond(w, codes.BadRequest, "invalid device id")
+		return
+	}
+
+	obs := &observer{conn: w.Conn(), token: r.Token()}
+	topic := strings.ReplaceAll(s.cfg.DownlinkTopic, devicePlaceholder, sess.deviceID)
+	unsubscribe, err := s.agent.Subscribe(s.cfg.DownlinkBroker, topic, func(msg *message.Message) {
+		s.notify(sess, token, obs, msg)
+	})
+	if err != nil {
+		s.logger.Error().Err(err).Str("device_id", sess.deviceID).Str("topic", topic).Msg("failed to subscribe to downlink")
+		s.respond(w, codes.ServiceUnavailable, err.Error())
+		return
+	}
+	obs.unsubscribe = unsubscribe
+
+	if !s.addObserver(sess, token, obs) {
+		if err := unsubscribe(); err != nil {
+			s.logger.Error().Err(err).Str("device_id", sess.deviceID).Msg("failed to unsubscribe from downlink")
+		}
+		s.respond(w, codes.ServiceUnavailable, "too many observers")
+		return
+	}
+
+	s.logger.Debug().Str("device_id", sess.deviceID).Str("topic", topic).Msg("device observing downlink")
+	s.respond(w, codes.Content, "")
+	w.Message().SetObserve(0)
+}
+
+// addObserver registers the observation unless the peer or the server has too
+// many. An observation with the same token is replaced.
+func (s *Server) addObserver(sess *session, token string, obs *observer) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, exist := s.sessions[obs.conn]; !exist {
+		return false
+	}
+	if old, exist := sess.observers[token]; exist {
+		s.cancelObserver(sess, token, old)
+	}
+	if len(sess.observers) >= maxPeerObservers || s.observerCount >= maxObservers {
+		return false
+	}
+
+	if sess.observers == nil {
+		sess.observers = make(map[string]*observer)
+	}
+	sess.observers[token] = obs
+	s.observerCount++
+	return true
+}
+
+// notify sends the downlink message to the observer as a non-confirmable notification.
+func (s *Server) notify(sess *session, token string, obs *observer, msg *message.Message) {
+	s.mu.Lock()
+	if sess.observers[token] != obs {
+		s.mu.Unlock()
+		return
+	}
+	obs.seq = (obs.seq + 1) & 0xffffff
+	seq := obs.seq
+	s.mu.Unlock()
+
+	notification := obs.conn.AcquireMessage(obs.conn.Context())
+	defer obs.conn.ReleaseMessage(notification)
+	notification.SetType(coapmessage.NonConfirmable)
+	notification.SetCode(codes.Content)
+	notification.SetToken(obs.token)
+	notification.SetObserve(seq)
+	notification.SetBody(bytes.NewReader(msg.Payload))
+	err := obs.conn.WriteMessage(notification)
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if sess.observers[token] != obs {
+		return
+	}
+	if err != nil {
+		s.logger.Error().Err(err).Str("device_id", sess.deviceID).Msg("failed to notify coap observer")
+		s.cancelObserver(sess, token, obs)
+		return
+	}
+	obs.lastMID = notification.MessageID()
+}
+
+// cancelObserver removes the observation. Must be called with mu held.
+func (s *Server) cancelObserver(sess *session, token string, obs *observer) {
+	delete(sess.observers, token)
+	s.observerCount--
+	if err := obs.unsubscribe(); err != nil {
+		s.logger.Error().Err(err).Str("device_id", sess.deviceID).Msg("failed to unsubscribe from downlink")
+	}
+}
+
+// deviceID returns the DTLS identity of the peer or, without DTLS, the configured
+// device ID option. The option is chosen by the client so it is ignored with DTLS.
+// It returns false if the ID can't fill the {device} placeholder of a topic.
+func (s *Server) deviceID(conn mux.Conn, r *mux.Message) (string, bool) {
+	var id string
+	if s.cfg.DTLS != nil {
+		s.mu.Lock()
+		if sess, exist := s.sessions[conn]; exist {
+			id = sess.deviceID
+		}
+		s.mu.Unlock()
+	} else if s.cfg.DeviceIDOption != 0 {
+		if v, err := r.Options().GetBytes(coapmessage.OptionID(s.cfg.DeviceIDOption)); err == nil {
+			id = string(v)
+		}
+	}
+	if id == "" {
+		return "", true
+	}
+	return id, message.ValidTopicToken(id)
+}
+
+// respond sets the response of the request, with a diagnostic payload if any.
+func (s *Server) respond(w mux.ResponseWriter, code codes.Code, diagnostic string) {
+	var body io.ReadSeeker
+	if diagnostic != "" {
+		body = strings.NewReader(diagnostic)
+	}
+	if err := w.SetResponse(code, coapmessage.TextPlain, body); err != nil {
+		s.logger.Error().Err(err).Str("remote_addr", w.Conn().RemoteAddr().String()).Msg("failed to set coap response")
+	}
+}
+
+// dtlsIdentity returns the common name of the verified client certificate.
+func dtlsIdentity(conn *dtls.Conn) string {
+	state, ok := conn.ConnectionState()
+	if !ok || len(state.PeerCertificates) == 0 {
+		return ""
+	}
+	cert, err := x509.ParseCertificate(state.PeerCertificates[0])
+	if err != nil {
+		return ""
+	}
+	return cert.Subject.CommonName
+}
@@ -0,0 +1,444 @@
+package coap
+
+import (
+	"bytes"
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"errors"
+	"math/big"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/LincolnG4/iot-hydra/internal/agent"
+	"github.com/LincolnG4/iot-hydra/internal/config"
+	"github.com/LincolnG4/iot-hydra/internal/message"
+	"github.com/alecthomas/assert"
+	"github.com/pion/dtls/v3"
+	coapdtls "github.com/plgd-dev/go-coap/v3/dtls"
+	coapmessage "github.com/plgd-dev/go-coap/v3/message"
+	"github.com/plgd-dev/go-coap/v3/message/codes"
+	"github.com/plgd-dev/go-coap/v3/message/pool"
+	"github.com/plgd-dev/go-coap/v3/mux"
+	"github.com/plgd-dev/go-coap/v3/net/blockwise"
+	"github.com/plgd-dev/go-coap/v3/options"
+	"github.com/plgd-dev/go-coap/v3/udp"
+	udpclient "github.com/plgd-dev/go-coap/v3/udp/client"
+	"github.com/rs/zerolog"
+)
+
+const testDeviceIDOption = 65000
+
+// fakeAgent records the submitted messages and the downlink subscriptions.
+type fakeAgent struct {
+	mu           sync.Mutex
+	submitted    []*message.Message
+	err          error
+	handlers     map[string]func(*message.Message)
+	unsubscribed chan string
+}
+
+func newFakeAgent() *fakeAgent {
+	return &fakeAgent{handlers: make(map[string]func(*message.Message)), unsubscribed: make(chan string, 10)}
+}
+
+func (f *fakeAgent) Submit(msg *message.Message) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.submitted = append(f.submitted, msg)
+	return f.err
+}
+
+func (f *fakeAgent) setErr(err error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.err = err
+}
+
+func (f *fakeAgent) Submitted() []*message.Message {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return append([]*message.Message(nil), f.submitted...)
+}
+
+func (f *fakeAgent) Subscribe(_, topic string, handler func(*message.Message)) (func() error, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.handlers[topic] = handler
+	return func() error {
+		f.unsubscribed <- topic
+		return nil
+	}, nil
+}
+
+func (f *fakeAgent) handler(topic string) func(*message.Message) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.handlers[topic]
+}
+
+func newTestServer(t *testing.T, cfg config.CoAPServiceYAML, ag Agent) *Server {
+	t.Helper()
+	logger := zerolog.Nop()
+	cfg.Address = "127.0.0.1:0"
+	srv, err := NewServer(cfg, ag, &logger)
+	assert.NoError(t, err)
+	srv.Start()
+	t.Cleanup(func() { srv.Stop() })
+	return srv
+}
+
+func newTestClient(t *testing.T, addr string, opts ...udp.Option) *udpclient.Conn {
+	t.Helper()
+	cc, err := udp.Dial(addr, opts...)
+	assert.NoError(t, err)
+	t.Cleanup(func() { cc.Close() })
+	return cc
+}
+
+func testContext(t *testing.T) context.Context {
+	t.Helper()
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	t.Cleanup(cancel)
+	return ctx
+}
+
+func deviceIDOption(id string) coapmessage.Option {
+	return coapmessage.Option{ID: testDeviceIDOption, Value: []byte(id)}
+}
+
+// observeOption is the Observe: 0 option registering an observation.
+func observeOption() coapmessage.Option {
+	return coapmessage.Option{ID: coapmessage.Observe, Value: []byte{}}
+}
+
+func TestPublish(t *testing.T) {
+	ag := newFakeAgent()
+	cfg := config.CoAPServiceYAML{TopicPrefix: "coap/", TargetBrokers: []string{"nats"}, DeviceIDOption: testDeviceIDOption}
+	client := newTestClient(t, newTestServer(t, cfg, ag).Addr())
+
+	resp, err := client.Post(testContext(t), "/t/sensors/temp", coapmessage.AppJSON, bytes.NewReader([]byte(`{"value":21}`)), deviceIDOption("dev-1"))
+	assert.NoError(t, err)
+	assert.Equal(t, codes.Changed, resp.Code())
+
+	submitted := ag.Submitted()
+	assert.Equal(t, 1, len(submitted))
+	assert.Equal(t, "coap/sensors/temp", submitted[0].Topic)
+	assert.Equal(t, "dev-1", submitted[0].DeviceID)
+	assert.Equal(t, []string{"nats"}, submitted[0].TargetBrokers)
+	assert.Equal(t, `{"value":21}`, string(submitted[0].Payload))
+}
+
+func TestPublish_Errors(t *testing.T) {
+	ag := newFakeAgent()
+	client := newTestClient(t, newTestServer(t, config.CoAPServiceYAML{TargetBrokers: []string{"nats"}}, ag).Addr())
+	ctx := testContext(t)
+
+	resp, err := client.Post(ctx, "/unknown", coapmessage.TextPlain, nil)
+	assert.NoError(t, err)
+	assert.Equal(t, codes.NotFound, resp.Code())
+
+	resp, err = client.Get(ctx, "/t/sensors")
+	assert.NoError(t, err)
+	assert.Equal(t, codes.MethodNotAllowed, resp.Code())
+
+	ag.setErr(&agent.ValidationError{Action: agent.SchemaActionReject, Err: errors.New("invalid")})
+	resp, err = client.Post(ctx, "/t/sensors", coapmessage.TextPlain, nil)
+	assert.NoError(t, err)
+	assert.Equal(t, codes.BadRequest, resp.Code())
+
+	ag.setErr(agent.ErrAgentStopped)
+	resp, err = client.Post(ctx, "/t/sensors", coapmessage.TextPlain, nil)
+	assert.NoError(t, err)
+	assert.Equal(t, codes.ServiceUnavailable, resp.Code())
+}
+
+func TestPublish_InvalidDeviceID(t *testing.T) {
+	ag := newFakeAgent()
+	cfg := config.CoAPServiceYAML{TargetBrokers: []string{"nats"}, DeviceIDOption: testDeviceIDOption}
+	client := newTestClient(t, newTestServer(t, cfg, ag).Addr())
+
+	for _, id := range []string{"*", ">", "dev.1", "dev/1", "#"} {
+		resp, err := client.Post(testContext(t), "/t/sensors", coapmessage.TextPlain, nil, deviceIDOption(id))
+		assert.NoError(t, err)
+		assert.Equal(t, codes.BadRequest, resp.Code(), id)
+	}
+	assert.Equal(t, 0, len(ag.Submitted()))
+}
+
+func TestPublish_Blockwise(t *testing.T) {
+	ag := newFakeAgent()
+	srv := newTestServer(t, config.CoAPServiceYAML{TargetBrokers: []string{"nats"}}, ag)
+	client := newTestClient(t, srv.Addr(), options.WithBlockwise(true, blockwise.SZX16, time.Second))
+
+	payload := make([]byte, 40)
+	for i := range payload {
+		payload[i] = byte('a' + i%26)
+	}
+
+	resp, err := client.Post(testContext(t), "/t/firmware", coapmessage.AppOctets, bytes.NewReader(payload))
+	assert.NoError(t, err)
+	assert.Equal(t, codes.Changed, resp.Code())
+
+	submitted := ag.Submitted()
+	assert.Equal(t, 1, len(submitted))
+	assert.Equal(t, payload, submitted[0].Payload)
+}
+
+func TestAcceptBlock_Limits(t *testing.T) {
+	srv := newTestServer(t, config.CoAPServiceYAML{TargetBrokers: []string{"nats"}}, newFakeAgent())
+	first, err := blockwise.EncodeBlockOption(blockwise.SZX16, 0, true)
+	assert.NoError(t, err)
+	last, err := blockwise.EncodeBlockOption(blockwise.SZX16, 1, false)
+	assert.NoError(t, err)
+	now := time.Now()
+
+	srv.mu.Lock()
+	defer srv.mu.Unlock()
+
+	// A peer can't start more transfers than the limit
+	peer := &session{}
+	for i := 0; i < maxPeerTransfers; i++ {
+		assert.True(t, srv.acceptBlock(peer, string(rune('a'+i)), first, now))
+	}
+	assert.False(t, srv.acceptBlock(peer, "new", first, now))
+
+	// Blocks of a transfer in progress are still accepted, the last one ends it
+	assert.True(t, srv.acceptBlock(peer, "a", first, now))
+	assert.True(t, srv.acceptBlock(peer, "a", last, now))
+	assert.True(t, srv.acceptBlock(peer, "new", first, now))
+
+	// Nor the server more than its limit
+	for i := maxPeerTransfers; i < maxTransfers; i++ {
+		assert.True(t, srv.acceptBlock(&session{}, "a", first, now))
+	}
+	assert.False(t, srv.acceptBlock(&session{}, "a", first, now))
+
+	// Stale transfers are dropped
+	assert.True(t, srv.acceptBlock(&session{}, "a", first, now.Add(transferTimeout+time.Second)))
+}
+
+func TestMonitorRequest_Exchanges(t *testing.T) {
+	srv := newTestServer(t, config.CoAPServiceYAML{TargetBrokers: []string{"nats"}}, newFakeAgent())
+	var cc *udpclient.Conn
+	srv.mu.Lock()
+	srv.sessions[cc] = &session{}
+	srv.mu.Unlock()
+
+	req := pool.NewMessage(context.Background())
+	req.SetType(coapmessage.Confirmable)
+	req.SetCode(codes.POST)
+
+	// The confirmable requests over the limit are dropped so the responses
+	// cached for retransmissions are bounded
+	for i := 0; i < maxPeerExchanges; i++ {
+		drop, err := srv.monitorRequest(cc, req)
+		assert.NoError(t, err)
+		assert.False(t, drop)
+	}
+	drop, err := srv.monitorRequest(cc, req)
+	assert.NoError(t, err)
+	assert.True(t, drop)
+
+	// Unknown peers are dropped
+	delete(srv.sessions, cc)
+	drop, err = srv.monitorRequest(cc, req)
+	assert.NoError(t, err)
+	assert.True(t, drop)
+}
+
+func TestObserve(t *testing.T) {
+	ag := newFakeAgent()
+	client := newDTLSTestClient(t, ag, "dev-dtls")
+
+	notifications := make(chan *pool.Message, 10)
+	obs, err := client.Observe(testContext(t), "/cmd", func(n *pool.Message) {
+		n.Hijack()
+		notifications <- n
+	})
+	assert.NoError(t, err)
+
+	// The registration response is notified first
+	first := <-notifications
+	assert.Equal(t, codes.Content, first.Code())
+
+	handler := ag.handler("devices/dev-dtls/cmd")
+	assert.NotZero(t, handler)
+	handler(&message.Message{Topic: "devices/dev-dtls/cmd", Payload: []byte("reboot")})
+
+	select {
+	case n := <-notifications:
+		assert.Equal(t, codes.Content, n.Code())
+		body, err := n.ReadBody()
+		assert.NoError(t, err)
+		assert.Equal(t, "reboot", string(body))
+	case <-time.After(5 * time.Second):
+		t.Fatal("notification not received")
+	}
+
+	assert.NoError(t, obs.Cancel(testContext(t)))
+	select {
+	case topic := <-ag.unsubscribed:
+		assert.Equal(t, "devices/dev-dtls/cmd", topic)
+	case <-time.After(5 * time.Second):
+		t.Fatal("observation was not cancelled")
+	}
+}
+
+func TestObserve_RequiresDTLS(t *testing.T) {
+	ag := newFakeAgent()
+	cfg := config.CoAPServiceYAML{TargetBrokers: []string{"nats"}, DeviceIDOption: testDeviceIDOption, DownlinkBroker: "nats"}
+	client := newTestClient(t, newTestServer(t, cfg, ag).Addr())
+
+	// The device ID option is chosen by the client, it can't observe the
+	// commands of a device
+	resp, err := client.Get(testContext(t), "/cmd", observeOption(), deviceIDOption("dev-1"))
+	assert.NoError(t, err)
+	assert.Equal(t, codes.Unauthorized, resp.Code())
+	assert.Equal(t, 0, len(ag.handlers))
+}
+
+func TestObserve_NotConfigured(t *testing.T) {
+	client := newTestClient(t, newTestServer(t, config.CoAPServiceYAML{TargetBrokers: []string{"nats"}}, newFakeAgent()).Addr())
+
+	resp, err := client.Get(testContext(t), "/cmd", observeOption())
+	assert.NoError(t, err)
+	assert.Equal(t, codes.NotFound, resp.Code())
+}
+
+// fakeConn is a peer of the server that can't be written to.
+type fakeConn struct {
+	mux.Conn
+	id int
+}
+
+func TestAddObserver_Limits(t *testing.T) {
+	srv := newTestServer(t, config.CoAPServiceYAML{TargetBrokers: []string{"nats"}}, newFakeAgent())
+	newObserver := func(conn mux.Conn) *observer {
+		return &observer{conn: conn, unsubscribe: func() error { return nil }}
+	}
+
+	conn := &fakeConn{}
+	peer := &session{deviceID: "dev-1"}
+	srv.sessions[conn] = peer
+
+	for i := 0; i < maxPeerObservers; i++ {
+		assert.True(t, srv.addObserver(peer, string(rune('a'+i)), newObserver(conn)))
+	}
+	assert.False(t, srv.addObserver(peer, "new", newObserver(conn)))
+	// Replacing an observation of the peer is accepted
+	assert.True(t, srv.addObserver(peer, "a", newObserver(conn)))
+
+	// The server can't have more than maxObservers
+	for i := 1; srv.observerCount < maxObservers; i++ {
+		other := &fakeConn{id: i}
+		srv.sessions[other] = &session{}
+		assert.True(t, srv.addObserver(srv.sessions[other], "a", newObserver(other)))
+	}
+	other := &fakeConn{id: -1}
+	srv.sessions[other] = &session{}
+	assert.False(t, srv.addObserver(srv.sessions[other], "a", newObserver(other)))
+
+	// Observations of closed sessions are refused
+	assert.False(t, srv.addObserver(&session{}, "a", newObserver(&fakeConn{id: -2})))
+}
+
+func TestPing(t *testing.T) {
+	client := newTestClient(t, newTestServer(t, config.CoAPServiceYAML{TargetBrokers: []string{"nats"}}, newFakeAgent()).Addr())
+	assert.NoError(t, client.Ping(testContext(t)))
+}
+
+func TestPublish_DTLSIdentity(t *testing.T) {
+	ag := newFakeAgent()
+	client := newDTLSTestClient(t, ag, "dev-dtls")
+
+	// The device ID option can't override the DTLS identity
+	resp, err := client.Post(testContext(t), "/t/sensors", coapmessage.TextPlain, nil, deviceIDOption("dev-other"))
+	assert.NoError(t, err)
+	assert.Equal(t, codes.Changed, resp.Code())
+
+	submitted := ag.Submitted()
+	assert.Equal(t, 1, len(submitted))
+	assert.Equal(t, "dev-dtls", submitted[0].DeviceID)
+}
+
+// newDTLSTestClient starts a DTLS server with downlink and connects a client
+// whose certificate has the common name.
+func newDTLSTestClient(t *testing.T, ag Agent, commonName string) *udpclient.Conn {
+	t.Helper()
+
+	dir := t.TempDir()
+	caCert, caKey := writeCertificate(t, dir, "ca", "test-ca", nil, nil)
+	writeCertificate(t, dir, "server", "localhost", caCert, caKey)
+	writeCertificate(t, dir, "client", commonName, caCert, caKey)
+
+	cfg := config.CoAPServiceYAML{
+		TargetBrokers:  []string{"nats"},
+		DeviceIDOption: testDeviceIDOption,
+		DownlinkBroker: "nats",
+		DTLS: &config.TLSYAML{
+			CertFile:     filepath.Join(dir, "server.pem"),
+			KeyFile:      filepath.Join(dir, "server-key.pem"),
+			ClientCAFile: filepath.Join(dir, "ca.pem"),
+		},
+	}
+	srv := newTestServer(t, cfg, ag)
+
+	clientCert, err := tls.LoadX509KeyPair(filepath.Join(dir, "client.pem"), filepath.Join(dir, "client-key.pem"))
+	assert.NoError(t, err)
+	roots := x509.NewCertPool()
+	roots.AddCert(caCert)
+
+	cc, err := coapdtls.Dial(srv.Addr(), &dtls.Config{
+		Certificates:         []tls.Certificate{clientCert},
+		RootCAs:              roots,
+		ServerName:           "localhost",
+		ExtendedMasterSecret: dtls.RequireExtendedMasterSecret,
+	})
+	assert.NoError(t, err)
+	t.Cleanup(func() { cc.Close() })
+	return cc
+}
+
+// writeCertificate writes <name>.pem and <name>-key.pem signed by the parent, or
+// self-signed without parent.
+func writeCertificate(t *testing.T, dir, name, commonName string, parent *x509.Certificate, parentKey *ecdsa.PrivateKey) (*x509.Certificate, *ecdsa.PrivateKey) {
+	t.Helper()
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	assert.NoError(t, err)
+
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(time.Now().UnixNano()),
+		Subject:      pkix.Name{CommonName: commonName},
+		DNSNames:     []string{commonName},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth, x509.ExtKeyUsageClientAuth},
+	}
+	if parent == nil {
+		template.IsCA = true
+		template.BasicConstraintsValid = true
+		parent, parentKey = template, key
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, template, parent, &key.PublicKey, parentKey)
+	assert.NoError(t, err)
+	cert, err := x509.ParseCertificate(der)
+	assert.NoError(t, err)
+
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	assert.NoError(t, err)
+	assert.NoError(t, os.WriteFile(filepath.Join(dir, name+".pem"), pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0o600))
+	assert.NoError(t, os.WriteFile(filepath.Join(dir, name+"-key.pem"), pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER}), 0o600))
+	return cert, key
+}
@@ -0,0 +1,91 @@
+package grpc
+
+import (
+	"context"
+	"strings"
+
+	"github.com/LincolnG4/iot-hydra/internal/auth"
+	gogrpc "google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/status"
+)
+
+type deviceIDKey struct{}
+
+// deviceCredentials extracts the device credentials from the request metadata:
+// the authorization bearer token, the device_id/expires/signature keys and the
+// verified TLS client certificate.
+func deviceCredentials(ctx context.Context) auth.DeviceCredentials {
+	var creds auth.DeviceCredentials
+	md, _ := metadata.FromIncomingContext(ctx)
+	get := func(key string) string {
+		if values := md.Get(key); len(values) > 0 {
+			return values[0]
+		}
+		return ""
+	}
+
+	creds.DeviceID = get("device_id")
+	creds.Expires = get("expires")
+	creds.Signature = get("signature")
+	if token, found := strings.CutPrefix(get("authorization"), "Bearer "); found {
+		creds.Token = strings.TrimSpace(token)
+	}
+
+	if p, ok := peer.FromContext(ctx); ok {
+		if tlsInfo, ok := p.AuthInfo.(credentials.TLSInfo); ok && len(tlsInfo.State.VerifiedChains) > 0 {
+			creds.Certificates = tlsInfo.State.PeerCertificates
+		}
+	}
+	return creds
+}
+
+// authenticate returns the context with the authenticated device ID. It does
+// nothing when device authentication is not configured.
+func (s *Server) authenticate(ctx context.Context) (context.Context, error) {
+	if s.deviceAuth == nil {
+		return ctx, nil
+	}
+
+	deviceID, err := s.deviceAuth.Authenticate(deviceCredentials(ctx))
+	if err != nil {
+		s.logger.Warn().Err(err).Msg("device authentication failed")
+		return nil, status.Error(codes.Unauthenticated, err.Error())
+	}
+	return context.WithValue(ctx, deviceIDKey{}, deviceID), nil
+}
+
+func (s *Server) unaryAuthInterceptor(ctx context.Context, req any, _ *gogrpc.UnaryServerInfo, handler gogrpc.UnaryHandler) (any, error) {
+	ctx, err := s.authenticate(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return handler(ctx, req)
+}
+
+func (s *Server) streamAuthInterceptor(srv any, ss gogrpc.ServerStream, _ *gogrpc.StreamServerInfo, handler gogrpc.StreamHandler) error {
+	ctx, err := s.authenticate(ss.Context())
+	if err != nil {
+		return err
+	}
+	return handler(srv, &authenticatedStream{ServerStream: ss, ctx: ctx})
+}
+
+// authenticatedStream carries the context with the authenticated device ID.
+type authenticatedStream struct {
+	gogrpc.ServerStream
+	ctx context.Context
+}
+
+func (s *authenticatedStream) Context() context.Context {
+	return s.ctx
+}
+
+// deviceID returns the authenticated device ID of the request, or "" without authentication.
+func deviceID(ctx context.Context) string {
+	id, _ := ctx.Value(deviceIDKey{}).(string)
+	return id
+}
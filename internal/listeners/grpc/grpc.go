@@ -0,0 +1,242 @@
+package grpc
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"strings"
+	"time"
+
+	telemetryv1 "github.com/LincolnG4/iot-hydra/api/telemetry/v1"
+	"github.com/LincolnG4/iot-hydra/internal/agent"
+	"github.com/LincolnG4/iot-hydra/internal/auth"
+	"github.com/LincolnG4/iot-hydra/internal/config"
+	"github.com/LincolnG4/iot-hydra/internal/message"
+	"github.com/rs/zerolog"
+	"go.opentelemetry.io/contrib/instrumentation/google.golang.org/grpc/otelgrpc"
+	gogrpc "google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/status"
+)
+
+const (
+	devicePlaceholder = "{device}"
+
+	// messages buffered per subscription before dropping
+	subscriptionBuffer = 64
+)
+
+// Agent receives the published messages and provides the downlink subscriptions.
+type Agent interface {
+	Submit(*message.Message) error
+	Subscribe(broker, topic string, handler func(*message.Message)) (func() error, error)
+}
+
+// Options are the settings shared with the other ingestion services.
+type Options struct {
+	// Authenticates the devices, nil if disabled
+	DeviceAuth *auth.DeviceAuthenticator
+	// Policy for messages of another device: reject (default) or overwrite
+	Mismatch string
+	// TLS configuration with the server certificate, nil if disabled
+	TLSConfig *tls.Config
+}
+
+// Server is the gRPC ingestion service.
+type Server struct {
+	telemetryv1.UnimplementedTelemetryServiceServer
+
+	cfg        config.GRPCServiceYAML
+	agent      Agent
+	deviceAuth *auth.DeviceAuthenticator
+	mismatch   string
+
+	srv      *gogrpc.Server
+	listener net.Listener
+	done     chan struct{} // closed on Stop to end the subscriptions
+	logger   *zerolog.Logger
+}
+
+// NewServer creates the gRPC server listening on the configured address.
+func NewServer(cfg config.GRPCServiceYAML, agent Agent, opts Options, parentLogger *zerolog.Logger) (*Server, error) {
+	if parentLogger == nil {
+		return nil, errors.New("logger can't be nil")
+	}
+	logger := parentLogger.With().Str("component", "grpc").Logger()
+
+	listener, err := net.Listen("tcp", cfg.Address)
+	if err != nil {
+		return nil, fmt.Errorf("failed to listen on '%s': %w", cfg.Address, err)
+	}
+
+	s := &Server{
+		cfg:        cfg,
+		agent:      agent,
+		deviceAuth: opts.DeviceAuth,
+		mismatch:   opts.Mismatch,
+		listener:   listener,
+		done:       make(chan struct{}),
+		logger:     &logger,
+	}
+
+	serverOpts := []gogrpc.ServerOption{
+		gogrpc.StatsHandler(otelgrpc.NewServerHandler()),
+		gogrpc.UnaryInterceptor(s.unaryAuthInterceptor),
+		gogrpc.StreamInterceptor(s.streamAuthInterceptor),
+	}
+	if opts.TLSConfig != nil {
+		serverOpts = append(serverOpts, gogrpc.Creds(credentials.NewTLS(opts.TLSConfig)))
+	}
+
+	s.srv = gogrpc.NewServer(serverOpts...)
+	telemetryv1.RegisterTelemetryServiceServer(s.srv, s)
+	return s, nil
+}
+
+// Start serves the requests in background.
+func (s *Server) Start() {
+	s.logger.Info().Str("address", s.Addr()).Msg("starting grpc server")
+	go func() {
+		if err := s.srv.Serve(s.listener); err != nil {
+			s.logger.Error().Err(err).Msg("grpc server stopped")
+		}
+	}()
+}
+
+// Stop ends the subscriptions and waits for the pending requests.
+func (s *Server) Stop() {
+	s.logger.Info().Msg("stopping grpc server")
+	close(s.done)
+	s.srv.GracefulStop()
+}
+
+// Addr returns the address the server is listening on.
+func (s *Server) Addr() string {
+	return s.listener.Addr().String()
+}
+
+// Publish submits one message to the agent.
+func (s *Server) Publish(ctx context.Context, pb *telemetryv1.Message) (*telemetryv1.Ack, error) {
+	msg, err := s.ingest(ctx, pb)
+	switch {
+	case errors.Is(err, auth.ErrDeviceMismatch):
+		return nil, status.Error(codes.PermissionDenied, err.Error())
+	case errors.Is(err, agent.ErrAgentStopped):
+		return nil, status.Error(codes.Unavailable, err.Error())
+	case !agent.IsQueued(err):
+		return nil, status.Error(codes.InvalidArgument, err.Error())
+	}
+	return newAck(0, msg.ID, err), nil
+}
+
+// PublishStream submits the messages of the stream and returns the ack of each
+// one when the client closes the stream.
+func (s *Server) PublishStream(stream gogrpc.ClientStreamingServer[telemetryv1.Message, telemetryv1.PublishStreamResponse]) error {
+	var acks []*telemetryv1.Ack
+	for index := uint64(0); ; index++ {
+		pb, err := stream.Recv()
+		if errors.Is(err, io.EOF) {
+			return stream.SendAndClose(&telemetryv1.PublishStreamResponse{Acks: acks})
+		}
+		if err != nil {
+			return err
+		}
+
+		msg, err := s.ingest(stream.Context(), pb)
+		acks = append(acks, newAck(index, msg.ID, err))
+	}
+}
+
+// Subscribe streams the messages of the topic to the device. The topic must
+// match the subscribe ACL of the service.
+func (s *Server) Subscribe(req *telemetryv1.SubscribeRequest, stream gogrpc.ServerStreamingServer[telemetryv1.Message]) error {
+	ctx := stream.Context()
+	if !s.canSubscribe(deviceID(ctx), req.GetTopic()) {
+		return status.Errorf(codes.PermissionDenied, "subscription to topic '%s' is not allowed", req.GetTopic())
+	}
+
+	broker := req.GetBroker()
+	if broker == "" {
+		broker = s.cfg.DownlinkBroker
+	}
+
+	messages := make(chan *message.Message, subscriptionBuffer)
+	unsubscribe, err := s.agent.Subscribe(broker, req.GetTopic(), func(msg *message.Message) {
+		select {
+		case messages <- msg:
+		default:
+			s.logger.Warn().Str("device_id", deviceID(ctx)).Str("topic", msg.Topic).Msg("subscriber is too slow, dropping message")
+		}
+	})
+	if err != nil {
+		return status.Error(codes.InvalidArgument, err.Error())
+	}
+	defer func() {
+		if err := unsubscribe(); err != nil {
+			s.logger.Error().Err(err).Str("topic", req.GetTopic()).Msg("failed to unsubscribe")
+		}
+	}()
+
+	for {
+		select {
+		case msg := <-messages:
+			if err := stream.Send(telemetryv1.FromMessage(msg)); err != nil {
+				return err
+			}
+		case <-ctx.Done():
+			return nil
+		case <-s.done:
+			return nil
+		}
+	}
+}
+
+// ingest stamps the message received from a device, checks it against the
+// authenticated device and submits it to the agent.
+func (s *Server) ingest(ctx context.Context, pb *telemetryv1.Message) (*message.Message, error) {
+	msg := telemetryv1.ToMessage(pb)
+	msg.ID = message.NewID("grpc")
+	msg.Timestamp = time.Now()
+
+	if err := auth.BindDevice(deviceID(ctx), s.mismatch, msg); err != nil {
+		s.logger.Warn().Str("message", msg.ID).Str("device_id", msg.DeviceID).Str("authenticated_device", deviceID(ctx)).Msg("device_id doesn't match the authenticated device")
+		return msg, err
+	}
+
+	if err := s.agent.Submit(msg); err != nil {
+		s.logger.Error().Err(err).Str("message", msg.ID).Str("device_id", msg.DeviceID).Str("topic", msg.Topic).Msg("failed to enqueue publish job")
+		return msg, err
+	}
+	return msg, nil
+}
+
+// canSubscribe checks the topic against the subscribe ACL. Authenticated device
+// IDs that can't fill a topic placeholder, e.g. a certificate CN with wildcards,
+// can't subscribe.
+func (s *Server) canSubscribe(deviceID, topic string) bool {
+	if deviceID != "" && !message.ValidTopicToken(deviceID) {
+		return false
+	}
+	for _, filter := range s.cfg.SubscribeACL {
+		if message.MatchTopic(strings.ReplaceAll(filter, devicePlaceholder, deviceID), topic) {
+			return true
+		}
+	}
+	return false
+}
+
+// newAck returns the ack of the message submitted with the returned error.
+func newAck(index uint64, id string, err error) *telemetryv1.Ack {
+	ack := &telemetryv1.Ack{Index: index, Id: id, Status: telemetryv1.AckStatus_ACK_STATUS_ACCEPTED}
+	if err != nil {
+		ack.Error = err.Error()
+		if !agent.IsQueued(err) {
+			ack.Status = telemetryv1.AckStatus_ACK_STATUS_REJECTED
+		}
+	}
+	return ack
+}
@@ -0,0 +1,162 @@
+package grpc
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	telemetryv1 "github.com/LincolnG4/iot-hydra/api/telemetry/v1"
+	"github.com/LincolnG4/iot-hydra/internal/agent"
+	"github.com/LincolnG4/iot-hydra/internal/auth"
+	"github.com/LincolnG4/iot-hydra/internal/config"
+	"github.com/LincolnG4/iot-hydra/internal/message"
+	"github.com/alecthomas/assert"
+	"github.com/rs/zerolog"
+	gogrpc "google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+// fakeAgent records the submitted messages and the subscriptions.
+type fakeAgent struct {
+	mu         sync.Mutex
+	submitted  []*message.Message
+	err        error
+	subscribed chan func(*message.Message)
+}
+
+func (f *fakeAgent) Submit(msg *message.Message) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.submitted = append(f.submitted, msg)
+	return f.err
+}
+
+func (f *fakeAgent) Subscribe(broker, topic string, handler func(*message.Message)) (func() error, error) {
+	if broker != "nats" {
+		return nil, errors.New("broker is not configured")
+	}
+	f.subscribed <- handler
+	return func() error { return nil }, nil
+}
+
+func newTestClient(t *testing.T, cfg config.GRPCServiceYAML, ag Agent, opts Options) telemetryv1.TelemetryServiceClient {
+	t.Helper()
+
+	logger := zerolog.Nop()
+	cfg.Address = "127.0.0.1:0"
+	srv, err := NewServer(cfg, ag, opts, &logger)
+	assert.NoError(t, err)
+	srv.Start()
+	t.Cleanup(srv.Stop)
+
+	conn, err := gogrpc.NewClient(srv.Addr(), gogrpc.WithTransportCredentials(insecure.NewCredentials()))
+	assert.NoError(t, err)
+	t.Cleanup(func() { conn.Close() })
+	return telemetryv1.NewTelemetryServiceClient(conn)
+}
+
+func withToken(token string) context.Context {
+	return metadata.AppendToOutgoingContext(context.Background(), "authorization", "Bearer "+token)
+}
+
+func TestPublish(t *testing.T) {
+	ag := &fakeAgent{}
+	client := newTestClient(t, config.GRPCServiceYAML{}, ag, Options{})
+
+	ack, err := client.Publish(context.Background(), &telemetryv1.Message{DeviceId: "dev-1", Topic: "sensors/temp", Payload: []byte(`{"value":1}`), Priority: "alarm"})
+	assert.NoError(t, err)
+	assert.Equal(t, telemetryv1.AckStatus_ACK_STATUS_ACCEPTED, ack.GetStatus())
+	assert.NotEqual(t, "", ack.GetId())
+
+	assert.Equal(t, 1, len(ag.submitted))
+	assert.Equal(t, ack.GetId(), ag.submitted[0].ID)
+	assert.Equal(t, message.PriorityAlarm, ag.submitted[0].Priority)
+	assert.Equal(t, `{"value":1}`, string(ag.submitted[0].Payload))
+
+	ag.err = &agent.ValidationError{Action: agent.SchemaActionReject, Err: errors.New("invalid")}
+	_, err = client.Publish(context.Background(), &telemetryv1.Message{Topic: "sensors/temp"})
+	assert.Equal(t, codes.InvalidArgument, status.Code(err))
+}
+
+func TestPublish_DeviceAuth(t *testing.T) {
+	deviceAuth, err := auth.NewDeviceAuthenticator(config.DeviceAuthYAML{
+		Methods: []string{auth.DeviceTokenType},
+		Tokens:  []config.DeviceTokenYAML{{DeviceID: "dev-1", Token: "secret"}},
+	})
+	assert.NoError(t, err)
+
+	ag := &fakeAgent{}
+	client := newTestClient(t, config.GRPCServiceYAML{}, ag, Options{DeviceAuth: deviceAuth})
+
+	_, err = client.Publish(context.Background(), &telemetryv1.Message{Topic: "sensors/temp"})
+	assert.Equal(t, codes.Unauthenticated, status.Code(err))
+
+	_, err = client.Publish(withToken("secret"), &telemetryv1.Message{Topic: "sensors/temp"})
+	assert.NoError(t, err)
+	assert.Equal(t, "dev-1", ag.submitted[0].DeviceID)
+
+	_, err = client.Publish(withToken("secret"), &telemetryv1.Message{DeviceId: "dev-2", Topic: "sensors/temp"})
+	assert.Equal(t, codes.PermissionDenied, status.Code(err))
+}
+
+func TestPublishStream(t *testing.T) {
+	ag := &fakeAgent{}
+	client := newTestClient(t, config.GRPCServiceYAML{}, ag, Options{})
+
+	stream, err := client.PublishStream(context.Background())
+	assert.NoError(t, err)
+	for range 3 {
+		assert.NoError(t, stream.Send(&telemetryv1.Message{Topic: "sensors/temp"}))
+	}
+	resp, err := stream.CloseAndRecv()
+	assert.NoError(t, err)
+
+	assert.Equal(t, 3, len(resp.GetAcks()))
+	for i, ack := range resp.GetAcks() {
+		assert.Equal(t, uint64(i), ack.GetIndex())
+		assert.Equal(t, telemetryv1.AckStatus_ACK_STATUS_ACCEPTED, ack.GetStatus())
+		assert.Equal(t, ag.submitted[i].ID, ack.GetId())
+	}
+}
+
+func TestSubscribe(t *testing.T) {
+	ag := &fakeAgent{subscribed: make(chan func(*message.Message), 1)}
+	cfg := config.GRPCServiceYAML{DownlinkBroker: "nats", SubscribeACL: []string{"devices/+/cmd"}}
+	client := newTestClient(t, cfg, ag, Options{})
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	denied, err := client.Subscribe(ctx, &telemetryv1.SubscribeRequest{Topic: "other/topic"})
+	assert.NoError(t, err)
+	_, err = denied.Recv()
+	assert.Equal(t, codes.PermissionDenied, status.Code(err))
+
+	stream, err := client.Subscribe(ctx, &telemetryv1.SubscribeRequest{Topic: "devices/1/cmd"})
+	assert.NoError(t, err)
+
+	handler := <-ag.subscribed
+	handler(&message.Message{Topic: "devices/1/cmd", Payload: []byte("reboot"), SourceBroker: "nats"})
+
+	msg, err := stream.Recv()
+	assert.NoError(t, err)
+	assert.Equal(t, "devices/1/cmd", msg.GetTopic())
+	assert.Equal(t, "reboot", string(msg.GetPayload()))
+}
+
+func TestCanSubscribe(t *testing.T) {
+	s := &Server{cfg: config.GRPCServiceYAML{SubscribeACL: []string{"devices/{device}/#"}}}
+
+	assert.True(t, s.canSubscribe("dev-1", "devices/dev-1/cmd"))
+	assert.False(t, s.canSubscribe("dev-1", "devices/dev-2/cmd"))
+
+	// A certificate CN can hold wildcards or separators widening the filter
+	for _, id := range []string{"#", "+", "dev-1/..", "*", ">"} {
+		assert.False(t, s.canSubscribe(id, "devices/dev-2/cmd"), id)
+	}
+}
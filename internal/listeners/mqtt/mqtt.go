@@ -0,0 +1,198 @@
+package mqtt
+
+import (
+	"bytes"
+	"crypto/subtle"
+	"errors"
+	"fmt"
+	"log/slog"
+	"strings"
+	"time"
+
+	"github.com/LincolnG4/iot-hydra/internal/agent"
+	"github.com/LincolnG4/iot-hydra/internal/config"
+	"github.com/LincolnG4/iot-hydra/internal/message"
+	mochi "github.com/mochi-mqtt/server/v2"
+	"github.com/mochi-mqtt/server/v2/listeners"
+	"github.com/mochi-mqtt/server/v2/packets"
+	"github.com/rs/zerolog"
+)
+
+const (
+	devicePlaceholder = "{device}"
+)
+
+// Server is an embedded MQTT server that forwards the messages published by the
+// devices to the telemetry agent.
+type Server struct {
+	srv      *mochi.Server
+	listener *listeners.TCP
+	logger   *zerolog.Logger
+}
+
+// NewServer creates the MQTT server listening on the configured address.
+func NewServer(cfg config.MQTTServiceYAML, submitter agent.Submitter, parentLogger *zerolog.Logger) (*Server, error) {
+	if parentLogger == nil {
+		return nil, errors.New("logger can't be nil")
+	}
+	logger := parentLogger.With().Str("component", "mqtt").Logger()
+
+	srv := mochi.New(&mochi.Options{
+		Logger: slog.New(slog.NewTextHandler(logger, &slog.HandlerOptions{Level: slog.LevelWarn})),
+	})
+
+	h := newHook(cfg, submitter, &logger)
+	if err := srv.AddHook(h, nil); err != nil {
+		return nil, fmt.Errorf("failed to add mqtt hook: %w", err)
+	}
+
+	tcp := listeners.NewTCP(listeners.Config{ID: "tcp", Address: cfg.Address})
+	if err := srv.AddListener(tcp); err != nil {
+		return nil, fmt.Errorf("failed to listen on '%s': %w", cfg.Address, err)
+	}
+
+	return &Server{
+		srv:      srv,
+		listener: tcp,
+		logger:   &logger,
+	}, nil
+}
+
+// Start accepts the device connections in background.
+func (s *Server) Start() error {
+	s.logger.Info().Str("address", s.Addr()).Msg("starting mqtt server")
+	return s.srv.Serve()
+}
+
+// Stop disconnects all clients and closes the listener.
+func (s *Server) Stop() error {
+	s.logger.Info().Msg("stopping mqtt server")
+	return s.srv.Close()
+}
+
+// Addr returns the address the server is listening on.
+func (s *Server) Addr() string {
+	return s.listener.Address()
+}
+
+// hook authenticates the devices, checks the topic ACLs and submits the published
+// messages to the agent.
+type hook struct {
+	mochi.HookBase
+	cfg       config.MQTTServiceYAML
+	users     map[string]config.MQTTUserYAML
+	submitter agent.Submitter
+	logger    *zerolog.Logger
+}
+
+func newHook(cfg config.MQTTServiceYAML, submitter agent.Submitter, logger *zerolog.Logger) *hook {
+	users := make(map[string]config.MQTTUserYAML, len(cfg.Devices))
+	for _, u := range cfg.Devices {
+		users[u.Username] = u
+	}
+	return &hook{
+		cfg:       cfg,
+		users:     users,
+		submitter: submitter,
+		logger:    logger,
+	}
+}
+
+func (h *hook) ID() string {
+	return "iot-hydra"
+}
+
+func (h *hook) Provides(b byte) bool {
+	return bytes.Contains([]byte{
+		mochi.OnConnectAuthenticate,
+		mochi.OnACLCheck,
+		mochi.OnPublish,
+	}, []byte{b})
+}
+
+// OnConnectAuthenticate accepts the configured devices and, if allowed, anonymous
+// clients. Clients whose device ID can't fill a topic placeholder are rejected, as
+// are anonymous clients using the username of a configured device as client ID.
+func (h *hook) OnConnectAuthenticate(cl *mochi.Client, pk packets.Packet) bool {
+	username := string(pk.Connect.Username)
+	if username == "" {
+		if !h.cfg.AllowAnonymous {
+			return false
+		}
+		if _, exist := h.users[cl.ID]; exist {
+			h.logger.Warn().Str("client_id", cl.ID).Msg("mqtt anonymous client using the id of a configured device")
+			return false
+		}
+	} else {
+		user, exist := h.users[username]
+		if !exist || subtle.ConstantTimeCompare([]byte(user.Password), pk.Connect.Password) != 1 {
+			h.logger.Warn().Str("client_id", cl.ID).Str("username", username).Msg("mqtt authentication failed")
+			return false
+		}
+	}
+
+	if deviceID := h.deviceID(cl); !message.ValidTopicToken(deviceID) {
+		h.logger.Warn().Str("client_id", cl.ID).Str("username", username).Str("device_id", deviceID).Msg("mqtt invalid device id")
+		return false
+	}
+	return true
+}
+
+// OnACLCheck checks the topic against the publish (write) or subscribe ACL of the client.
+func (h *hook) OnACLCheck(cl *mochi.Client, topic string, write bool) bool {
+	acl := h.cfg.AnonymousACL
+	if user, exist := h.users[string(cl.Properties.Username)]; exist {
+		acl = user.ACL
+	}
+
+	filters := acl.Subscribe
+	if write {
+		filters = acl.Publish
+	}
+
+	deviceID := h.deviceID(cl)
+	for _, filter := range filters {
+		if message.MatchTopic(strings.ReplaceAll(filter, devicePlaceholder, deviceID), topic) {
+			return true
+		}
+	}
+	return false
+}
+
+// OnPublish submits the published message to the agent. Messages rejected by
+// the agent are rejected to the client.
+func (h *hook) OnPublish(cl *mochi.Client, pk packets.Packet) (packets.Packet, error) {
+	// Skip server internal messages
+	if cl.Net.Inline || strings.HasPrefix(pk.TopicName, "$") {
+		return pk, nil
+	}
+
+	msg := &message.Message{
+		ID:            message.NewID("mqtt"),
+		DeviceID:      h.deviceID(cl),
+		Timestamp:     time.Now(),
+		Payload:       pk.Payload,
+		TargetBrokers: h.cfg.TargetBrokers,
+		Topic:         h.cfg.TopicPrefix + pk.TopicName,
+	}
+
+	if err := h.submitter.Submit(msg); err != nil {
+		h.logger.Error().Err(err).Str("message", msg.ID).Str("device_id", msg.DeviceID).Str("topic", msg.Topic).Msg("failed to submit mqtt message")
+		if !agent.IsQueued(err) {
+			return pk, packets.ErrRejectPacket
+		}
+	}
+
+	h.logger.Debug().Str("message", msg.ID).Str("device_id", msg.DeviceID).Str("topic", msg.Topic).Msg("mqtt message received")
+	return pk, nil
+}
+
+// deviceID returns the identity of the client used as device_id. Only the
+// configured devices have a username, they are identified by it so they can't
+// claim the client ID of another device. Anonymous clients use their client ID.
+func (h *hook) deviceID(cl *mochi.Client) string {
+	if len(cl.Properties.Username) > 0 {
+		return string(cl.Properties.Username)
+	}
+	return cl.ID
+}
@@ -0,0 +1,123 @@
+package mqtt
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/LincolnG4/iot-hydra/internal/agent"
+	"github.com/LincolnG4/iot-hydra/internal/config"
+	"github.com/alecthomas/assert"
+	mochi "github.com/mochi-mqtt/server/v2"
+	"github.com/mochi-mqtt/server/v2/packets"
+	"github.com/rs/zerolog"
+)
+
+func newTestHook(cfg config.MQTTServiceYAML, submitter agent.Submitter) *hook {
+	logger := zerolog.Nop()
+	return newHook(cfg, submitter, &logger)
+}
+
+func newClient(id, username string) *mochi.Client {
+	return &mochi.Client{ID: id, Properties: mochi.ClientProperties{Username: []byte(username)}}
+}
+
+func connectPacket(username, password string) packets.Packet {
+	return packets.Packet{Connect: packets.ConnectParams{Username: []byte(username), Password: []byte(password)}}
+}
+
+func TestOnConnectAuthenticate(t *testing.T) {
+	cfg := config.MQTTServiceYAML{
+		Devices: []config.MQTTUserYAML{{Username: "sensor", Password: "secret"}},
+	}
+	h := newTestHook(cfg, &agent.MockSubmitter{})
+
+	assert.True(t, h.OnConnectAuthenticate(newClient("c1", "sensor"), connectPacket("sensor", "secret")))
+	assert.False(t, h.OnConnectAuthenticate(newClient("c1", "sensor"), connectPacket("sensor", "wrong")))
+	assert.False(t, h.OnConnectAuthenticate(newClient("c1", "other"), connectPacket("other", "secret")))
+	assert.False(t, h.OnConnectAuthenticate(newClient("c1", ""), connectPacket("", "")))
+
+	h.cfg.AllowAnonymous = true
+	assert.True(t, h.OnConnectAuthenticate(newClient("c1", ""), connectPacket("", "")))
+
+	// An anonymous client can't take the identity of a configured device
+	assert.False(t, h.OnConnectAuthenticate(newClient("sensor", ""), connectPacket("", "")))
+
+	// Client IDs that would widen the {device} ACL filters are rejected
+	for _, id := range []string{"+", "#", "dev/1", "dev.1", "*", ">"} {
+		assert.False(t, h.OnConnectAuthenticate(newClient(id, ""), connectPacket("", "")), id)
+	}
+}
+
+func TestOnACLCheck(t *testing.T) {
+	cfg := config.MQTTServiceYAML{
+		Devices: []config.MQTTUserYAML{{
+			Username: "sensor",
+			ACL: config.MQTTACLYAML{
+				Publish:   []string{"devices/{device}/#"},
+				Subscribe: []string{"commands/{device}"},
+			},
+		}},
+		AnonymousACL: config.MQTTACLYAML{Publish: []string{"public/+"}},
+	}
+	h := newTestHook(cfg, &agent.MockSubmitter{})
+
+	// The configured devices are identified by their username, not the client ID
+	cl := newClient("dev-2", "sensor")
+	assert.True(t, h.OnACLCheck(cl, "devices/sensor/temp", true))
+	assert.False(t, h.OnACLCheck(cl, "devices/dev-2/temp", true))
+	assert.True(t, h.OnACLCheck(cl, "commands/sensor", false))
+	assert.False(t, h.OnACLCheck(cl, "commands/dev-2", false))
+	assert.False(t, h.OnACLCheck(cl, "devices/sensor/temp", false))
+
+	anonymous := newClient("anon", "")
+	assert.True(t, h.OnACLCheck(anonymous, "public/temp", true))
+	assert.False(t, h.OnACLCheck(anonymous, "devices/anon/temp", true))
+}
+
+func TestOnPublish(t *testing.T) {
+	submitter := &agent.MockSubmitter{}
+	cfg := config.MQTTServiceYAML{
+		TopicPrefix:   "mqtt/",
+		TargetBrokers: []string{"nats"},
+	}
+	h := newTestHook(cfg, submitter)
+
+	pk := packets.Packet{TopicName: "sensors/temp", Payload: []byte(`{"value":21}`)}
+	_, err := h.OnPublish(newClient("c1", "sensor"), pk)
+	assert.NoError(t, err)
+
+	assert.Equal(t, 1, len(submitter.Messages()))
+	msg := submitter.Messages()[0]
+	assert.Equal(t, "sensor", msg.DeviceID)
+	assert.Equal(t, "mqtt/sensors/temp", msg.Topic)
+	assert.Equal(t, []string{"nats"}, msg.TargetBrokers)
+	assert.Equal(t, `{"value":21}`, string(msg.Payload))
+
+	// System topics are not forwarded
+	_, err = h.OnPublish(newClient("c1", "sensor"), packets.Packet{TopicName: "$SYS/uptime"})
+	assert.NoError(t, err)
+	assert.Equal(t, 1, len(submitter.Messages()))
+}
+
+func TestOnPublish_Rejected(t *testing.T) {
+	submitter := &agent.MockSubmitter{}
+	submitter.SetErr(&agent.ValidationError{Action: agent.SchemaActionReject, Err: errors.New("invalid")})
+	h := newTestHook(config.MQTTServiceYAML{}, submitter)
+
+	_, err := h.OnPublish(newClient("c1", ""), packets.Packet{TopicName: "sensors/temp"})
+	assert.Equal(t, packets.ErrRejectPacket, err)
+
+	// Tagged messages are still queued
+	submitter.SetErr(&agent.ValidationError{Action: agent.SchemaActionTag, Err: errors.New("invalid")})
+	_, err = h.OnPublish(newClient("c1", ""), packets.Packet{TopicName: "sensors/temp"})
+	assert.NoError(t, err)
+}
+
+func TestServer_StartStop(t *testing.T) {
+	logger := zerolog.Nop()
+	srv, err := NewServer(config.MQTTServiceYAML{Address: "127.0.0.1:0"}, &agent.MockSubmitter{}, &logger)
+	assert.NoError(t, err)
+	assert.NoError(t, srv.Start())
+	assert.NotEqual(t, "", srv.Addr())
+	assert.NoError(t, srv.Stop())
+}
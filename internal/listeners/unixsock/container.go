@@ -0,0 +1,122 @@
+package unixsock
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"sync"
+)
+
+// ErrNotContainer is returned when the peer process doesn't run in a container.
+var ErrNotContainer = errors.New("peer is not running in a container")
+
+// containerIDPattern matches the container ID in the cgroup paths of podman,
+// docker, cri-o and containerd, e.g. /machine.slice/libpod-<id>.scope/container.
+// The cgroup of conmon (libpod-conmon-<id>) is not a container.
+var containerIDPattern = regexp.MustCompile(`(?:libpod-|libpod/|docker-|docker/|crio-|cri-containerd-)([0-9a-f]{64})`)
+
+// parseContainerID returns the container ID found in the content of /proc/<pid>/cgroup.
+func parseContainerID(cgroup []byte) string {
+	match := containerIDPattern.FindSubmatch(cgroup)
+	if match == nil {
+		return ""
+	}
+	return string(match[1])
+}
+
+// ContainerID returns the ID of the container running the process, read from
+// <procRoot>/<pid>/cgroup.
+func ContainerID(procRoot string, pid int) (string, error) {
+	cgroup, err := os.ReadFile(filepath.Join(procRoot, strconv.Itoa(pid), "cgroup"))
+	if err != nil {
+		return "", fmt.Errorf("failed to read cgroup of pid %d: %w", pid, err)
+	}
+
+	id := parseContainerID(cgroup)
+	if id == "" {
+		return "", ErrNotContainer
+	}
+	return id, nil
+}
+
+// Resolver identifies the container of the peers connected to a Unix socket.
+type Resolver struct {
+	procRoot string
+	// lookup returns the name of the container ID
+	lookup func(id string) (string, error)
+
+	mu    sync.Mutex
+	names map[string]string // container ID -> name
+}
+
+// NewResolver creates a resolver using lookup to get the name of the containers.
+func NewResolver(lookup func(id string) (string, error)) *Resolver {
+	return &Resolver{
+		procRoot: "/proc",
+		lookup:   lookup,
+		names:    make(map[string]string),
+	}
+}
+
+// ContainerName returns the name of the container of the process connected to conn.
+func (r *Resolver) ContainerName(conn net.Conn) (string, error) {
+	unixConn, ok := conn.(*net.UnixConn)
+	if !ok {
+		return "", fmt.Errorf("connection is not a unix socket")
+	}
+
+	pid, err := PeerPID(unixConn)
+	if err != nil {
+		return "", err
+	}
+	return r.containerNameOfPID(pid)
+}
+
+func (r *Resolver) containerNameOfPID(pid int) (string, error) {
+	id, err := ContainerID(r.procRoot, pid)
+	if err != nil {
+		return "", err
+	}
+
+	r.mu.Lock()
+	name, cached := r.names[id]
+	r.mu.Unlock()
+	if cached {
+		return name, nil
+	}
+
+	name, err = r.lookup(id)
+	if err != nil {
+		return "", fmt.Errorf("failed to lookup container '%s': %w", id, err)
+	}
+
+	r.mu.Lock()
+	r.names[id] = name
+	r.mu.Unlock()
+	return name, nil
+}
+
+// Listen creates the Unix socket, removing a stale socket file left at the path.
+func Listen(path string) (*net.UnixListener, error) {
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return nil, fmt.Errorf("failed to create socket directory '%s': %w", filepath.Dir(path), err)
+	}
+	if err := os.Remove(path); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return nil, fmt.Errorf("failed to remove stale socket '%s': %w", path, err)
+	}
+
+	listener, err := net.ListenUnix("unix", &net.UnixAddr{Name: path, Net: "unix"})
+	if err != nil {
+		return nil, fmt.Errorf("failed to listen on '%s': %w", path, err)
+	}
+	// Containers may run with another user
+	if err := os.Chmod(path, 0o666); err != nil {
+		listener.Close()
+		return nil, fmt.Errorf("failed to set permissions of '%s': %w", path, err)
+	}
+	return listener, nil
+}
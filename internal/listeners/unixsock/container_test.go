@@ -0,0 +1,96 @@
+package unixsock
+
+import (
+	"errors"
+	"net"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strconv"
+	"testing"
+
+	"github.com/alecthomas/assert"
+)
+
+const testContainerID = "3f4e1c0a9b8d7e6f5a4b3c2d1e0f9a8b7c6d5e4f3a2b1c0d9e8f7a6b5c4d3e2f"
+
+func TestParseContainerID(t *testing.T) {
+	tests := map[string]string{
+		"podman systemd":  "0::/machine.slice/libpod-" + testContainerID + ".scope/container\n",
+		"podman cgroupfs": "0::/libpod_parent/libpod-" + testContainerID + "\n",
+		"podman rootless": "0::/user.slice/user-1000.slice/user@1000.service/user.slice/libpod-" + testContainerID + ".scope\n",
+		"docker v1":       "12:pids:/docker/" + testContainerID + "\n11:memory:/docker/" + testContainerID + "\n",
+		"docker systemd":  "0::/system.slice/docker-" + testContainerID + ".scope\n",
+	}
+	for name, cgroup := range tests {
+		t.Run(name, func(t *testing.T) {
+			assert.Equal(t, testContainerID, parseContainerID([]byte(cgroup)))
+		})
+	}
+
+	assert.Equal(t, "", parseContainerID([]byte("0::/user.slice/user-1000.slice/session-2.scope\n")))
+	assert.Equal(t, "", parseContainerID([]byte("0::/machine.slice/libpod-conmon-"+testContainerID+".scope\n")))
+}
+
+func writeCgroup(t *testing.T, procRoot string, pid int, content string) {
+	t.Helper()
+	dir := filepath.Join(procRoot, strconv.Itoa(pid))
+	assert.NoError(t, os.MkdirAll(dir, 0o755))
+	assert.NoError(t, os.WriteFile(filepath.Join(dir, "cgroup"), []byte(content), 0o644))
+}
+
+func TestResolver(t *testing.T) {
+	procRoot := t.TempDir()
+	writeCgroup(t, procRoot, 10, "0::/machine.slice/libpod-"+testContainerID+".scope/container\n")
+	writeCgroup(t, procRoot, 11, "0::/user.slice/session-2.scope\n")
+
+	lookups := 0
+	r := NewResolver(func(id string) (string, error) {
+		lookups++
+		if id != testContainerID {
+			return "", errors.New("no such container")
+		}
+		return "sensor-app", nil
+	})
+	r.procRoot = procRoot
+
+	for range 2 {
+		name, err := r.containerNameOfPID(10)
+		assert.NoError(t, err)
+		assert.Equal(t, "sensor-app", name)
+	}
+	assert.Equal(t, 1, lookups)
+
+	_, err := r.containerNameOfPID(11)
+	assert.True(t, errors.Is(err, ErrNotContainer))
+
+	_, err = r.containerNameOfPID(12)
+	assert.Error(t, err)
+}
+
+func TestListenAndPeerPID(t *testing.T) {
+	if runtime.GOOS != "linux" {
+		t.Skip("peer credentials are only supported on linux")
+	}
+
+	path := filepath.Join(t.TempDir(), "run", "agent.sock")
+	// Stale socket file of a previous run
+	assert.NoError(t, os.MkdirAll(filepath.Dir(path), 0o755))
+	assert.NoError(t, os.WriteFile(path, nil, 0o644))
+
+	listener, err := Listen(path)
+	assert.NoError(t, err)
+	defer listener.Close()
+
+	client, err := net.Dial("unix", path)
+	assert.NoError(t, err)
+	defer client.Close()
+
+	conn, err := listener.AcceptUnix()
+	assert.NoError(t, err)
+	defer conn.Close()
+
+	pid, err := PeerPID(conn)
+	assert.NoError(t, err)
+	assert.Equal(t, os.Getpid(), pid)
+}
@@ -0,0 +1,30 @@
+//go:build linux
+
+package unixsock
+
+import (
+	"fmt"
+	"net"
+	"syscall"
+)
+
+// PeerPID returns the PID of the process connected to the socket (SO_PEERCRED).
+func PeerPID(conn *net.UnixConn) (int, error) {
+	raw, err := conn.SyscallConn()
+	if err != nil {
+		return 0, err
+	}
+
+	var cred *syscall.Ucred
+	var credErr error
+	err = raw.Control(func(fd uintptr) {
+		cred, credErr = syscall.GetsockoptUcred(int(fd), syscall.SOL_SOCKET, syscall.SO_PEERCRED)
+	})
+	if err != nil {
+		return 0, err
+	}
+	if credErr != nil {
+		return 0, fmt.Errorf("failed to read peer credentials: %w", credErr)
+	}
+	return int(cred.Pid), nil
+}
@@ -0,0 +1,13 @@
+//go:build !linux
+
+package unixsock
+
+import (
+	"errors"
+	"net"
+)
+
+// PeerPID is only supported on Linux.
+func PeerPID(*net.UnixConn) (int, error) {
+	return 0, errors.New("peer credentials are not supported on this platform")
+}
@@ -0,0 +1,24 @@
+package message
+
+import (
+	"fmt"
+	"sync/atomic"
+	"time"
+)
+
+// lastID keeps the generated IDs unique and increasing.
+var lastID atomic.Int64
+
+// NewID returns a unique message ID with the given prefix, based on the current time.
+func NewID(prefix string) string {
+	for {
+		last := lastID.Load()
+		id := time.Now().UnixNano()
+		if id <= last {
+			id = last + 1
+		}
+		if lastID.CompareAndSwap(last, id) {
+			return fmt.Sprintf("%s-%d", prefix, id)
+		}
+	}
+}
@@ -0,0 +1,16 @@
+package message
+
+import (
+	"testing"
+
+	"github.com/alecthomas/assert"
+)
+
+func TestNewID_Unique(t *testing.T) {
+	seen := make(map[string]bool)
+	for range 1000 {
+		id := NewID("http")
+		assert.False(t, seen[id], "duplicated id %s", id)
+		seen[id] = true
+	}
+}
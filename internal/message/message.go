@@ -1,13 +1,19 @@
 package message
 
-import "time"
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"time"
+)
 
 type Message struct {
 	ID        string    `json:"id"`
 	DeviceID  string    `json:"device_id"`
 	Timestamp time.Time `json:"timestamp"`
 
-	// content of the message
+	// content of the message. In JSON it is a base64 string, or a raw JSON object
+	// or array that is kept as is
 	Payload []byte `json:"payload"`
 
 	// Slice of all brokers where the message will be fowarded
@@ -15,4 +21,70 @@ type Message struct {
 	// Slice of from which broker the message came
 	SourceBroker string `json:"source_broker"`
 	Topic        string `json:"topic"`
+
+	// Priority lane of the message (alarm, normal or low). Empty means normal
+	Priority Priority `json:"priority,omitempty"`
+
+	// Time after which the message is stale and must not be forwarded. Zero never expires
+	ExpiresAt time.Time `json:"expires_at,omitzero"`
+
+	// Extra information attached to the message by the runtime (e.g. validation tags)
+	Metadata map[string]string `json:"metadata,omitempty"`
+}
+
+// Metadata keys set by the brokers and listeners.
+const (
+	// Topic where the reply to the message is expected, e.g. the inbox of a NATS request
+	MetadataReplyTo = "reply_to"
+	// ID of a downlink command, set by the backend on the command and by the agent
+	// on the reply of the device
+	MetadataCorrelationID = "correlation_id"
+)
+
+type Priority string
+
+const (
+	PriorityAlarm  Priority = "alarm"
+	PriorityNormal Priority = "normal"
+	PriorityLow    Priority = "low"
+)
+
+// Expired reports whether the message has an expiration time before now.
+func (m *Message) Expired(now time.Time) bool {
+	return !m.ExpiresAt.IsZero() && now.After(m.ExpiresAt)
+}
+
+// SetMetadata adds the key/value to the message metadata, creating the map if needed.
+func (m *Message) SetMetadata(key, value string) {
+	if m.Metadata == nil {
+		m.Metadata = make(map[string]string)
+	}
+	m.Metadata[key] = value
+}
+
+// UnmarshalJSON decodes the message accepting a raw JSON object or array as payload,
+// besides the base64 string of []byte.
+func (m *Message) UnmarshalJSON(data []byte) error {
+	type plain Message
+	aux := struct {
+		*plain
+		Payload json.RawMessage `json:"payload"`
+	}{plain: (*plain)(m)}
+
+	if err := json.Unmarshal(data, &aux); err != nil {
+		return err
+	}
+
+	payload := bytes.TrimSpace(aux.Payload)
+	switch {
+	case len(payload) == 0 || bytes.Equal(payload, []byte("null")):
+		m.Payload = nil
+	case payload[0] == '{' || payload[0] == '[':
+		m.Payload = append([]byte(nil), payload...)
+	case payload[0] == '"':
+		return json.Unmarshal(payload, &m.Payload)
+	default:
+		return errors.New("payload must be a base64 string, a JSON object or a JSON array")
+	}
+	return nil
 }
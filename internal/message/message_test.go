@@ -0,0 +1,55 @@
+package message
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/alecthomas/assert"
+)
+
+func TestUnmarshalJSON_Payload(t *testing.T) {
+	tests := []struct {
+		name    string
+		data    string
+		payload string
+		wantErr bool
+	}{
+		{"base64", `{"topic": "t", "payload": "eyJ2IjoxfQ=="}`, `{"v":1}`, false},
+		{"raw object", `{"topic": "t", "payload": {"v": 1}}`, `{"v": 1}`, false},
+		{"raw array", `{"topic": "t", "payload": [1, 2]}`, `[1, 2]`, false},
+		{"null", `{"topic": "t", "payload": null}`, "", false},
+		{"missing", `{"topic": "t"}`, "", false},
+		{"number", `{"topic": "t", "payload": 1}`, "", true},
+		{"invalid base64", `{"topic": "t", "payload": "%%%"}`, "", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var msg Message
+			err := json.Unmarshal([]byte(tt.data), &msg)
+			if tt.wantErr {
+				assert.Error(t, err)
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, "t", msg.Topic)
+			assert.Equal(t, tt.payload, string(msg.Payload))
+		})
+	}
+}
+
+func TestUnmarshalJSON_Fields(t *testing.T) {
+	var msg Message
+	err := json.Unmarshal([]byte(`{"device_id": "dev1", "topic": "t", "priority": "alarm", "target_brokers": ["nats"], "metadata": {"k": "v"}, "payload": {"v": 1}}`), &msg)
+	assert.NoError(t, err)
+	assert.Equal(t, "dev1", msg.DeviceID)
+	assert.Equal(t, PriorityAlarm, msg.Priority)
+	assert.Equal(t, []string{"nats"}, msg.TargetBrokers)
+	assert.Equal(t, map[string]string{"k": "v"}, msg.Metadata)
+
+	// Marshalled messages decode to the same payload
+	raw, err := json.Marshal(&Message{Topic: "t", Payload: []byte{0x00, 0xff}})
+	assert.NoError(t, err)
+	var decoded Message
+	assert.NoError(t, json.Unmarshal(raw, &decoded))
+	assert.Equal(t, []byte{0x00, 0xff}, decoded.Payload)
+}
@@ -0,0 +1,58 @@
+package message
+
+import (
+	"slices"
+	"strings"
+	"unicode"
+)
+
+// MatchTopic reports whether topic matches pattern. Topics are split in tokens
+// by '/' or '.', so both MQTT and NATS subjects are supported. In the pattern,
+// '+' or '*' matches exactly one token and '#' or '>' matches all remaining tokens.
+func MatchTopic(pattern, topic string) bool {
+	p := splitTopic(pattern)
+	t := splitTopic(topic)
+
+	for i, token := range p {
+		switch token {
+		case "#", ">":
+			// Tail wildcard needs at least one token left
+			return len(t) > i
+		case "+", "*":
+			if i >= len(t) {
+				return false
+			}
+		default:
+			if i >= len(t) || t[i] != token {
+				return false
+			}
+		}
+	}
+	return len(p) == len(t)
+}
+
+// TopicToken returns the token of topic at the position of placeholder in pattern,
+// e.g. dev1 for devices.{device}.cmd and devices.dev1.cmd. The placeholder matches
+// any token; it returns false if the topic doesn't match the pattern.
+func TopicToken(pattern, topic, placeholder string) (string, bool) {
+	i := slices.Index(splitTopic(pattern), placeholder)
+	if i < 0 || !MatchTopic(strings.ReplaceAll(pattern, placeholder, "*"), topic) {
+		return "", false
+	}
+	return splitTopic(topic)[i], true
+}
+
+// ValidTopicToken reports whether s can be put in a topic as a single token, e.g.
+// a device ID filling a {device} placeholder. It must not be empty nor contain
+// separators, wildcards or spaces that would change what the topic matches.
+func ValidTopicToken(s string) bool {
+	return s != "" && !strings.ContainsFunc(s, func(r rune) bool {
+		return strings.ContainsRune("/.+*#>$", r) || unicode.IsSpace(r) || unicode.IsControl(r)
+	})
+}
+
+func splitTopic(topic string) []string {
+	return strings.FieldsFunc(topic, func(r rune) bool {
+		return r == '/' || r == '.'
+	})
+}
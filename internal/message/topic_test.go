@@ -0,0 +1,63 @@
+package message
+
+import (
+	"testing"
+
+	"github.com/alecthomas/assert"
+)
+
+func TestMatchTopic(t *testing.T) {
+	tests := []struct {
+		pattern string
+		topic   string
+		match   bool
+	}{
+		{"sensors/temp", "sensors/temp", true},
+		{"sensors/temp", "sensors/humidity", false},
+		{"sensors/+/temp", "sensors/dev1/temp", true},
+		{"sensors.*.temp", "sensors.dev1.temp", true},
+		{"sensors/+", "sensors/dev1/temp", false},
+		{"sensors/#", "sensors/dev1/temp", true},
+		{"sensors.>", "sensors.dev1", true},
+		{"sensors/#", "sensors", false},
+		{"sensors/temp", "sensors/temp/extra", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.pattern+" "+tt.topic, func(t *testing.T) {
+			assert.Equal(t, tt.match, MatchTopic(tt.pattern, tt.topic))
+		})
+	}
+}
+
+func TestTopicToken(t *testing.T) {
+	tests := []struct {
+		pattern string
+		topic   string
+		token   string
+		found   bool
+	}{
+		{"devices.{device}.cmd", "devices.dev1.cmd", "dev1", true},
+		{"devices/{device}/cmd/#", "devices/dev1/cmd/reboot", "dev1", true},
+		{"devices.{device}.cmd", "devices.dev1.config", "", false},
+		{"devices.{device}.cmd", "devices.cmd", "", false},
+		{"devices.cmd", "devices.cmd", "", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.pattern+" "+tt.topic, func(t *testing.T) {
+			token, found := TopicToken(tt.pattern, tt.topic, "{device}")
+			assert.Equal(t, tt.found, found)
+			assert.Equal(t, tt.token, token)
+		})
+	}
+}
+
+func TestValidTopicToken(t *testing.T) {
+	for _, s := range []string{"dev1", "plc-01_a", "Sensor:7"} {
+		assert.True(t, ValidTopicToken(s), s)
+	}
+	for _, s := range []string{"", "+", "#", "*", ">", "dev/1", "dev.1", "dev 1", "$SYS", "dev\n"} {
+		assert.False(t, ValidTopicToken(s), s)
+	}
+}
@@ -0,0 +1,363 @@
+package runtimer
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"regexp"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/LincolnG4/iot-hydra/internal/agent"
+	"github.com/LincolnG4/iot-hydra/internal/config"
+	"github.com/LincolnG4/iot-hydra/internal/message"
+	"github.com/rs/zerolog"
+	"golang.org/x/time/rate"
+)
+
+const (
+	// ManagedLabel marks the containers created by CreateContainer
+	ManagedLabel = "io.iot-hydra.managed"
+
+	StreamStdout = "stdout"
+	StreamStderr = "stderr"
+
+	// Metadata keys of the log records
+	MetadataContainer = "container"
+	MetadataImage     = "image"
+	MetadataStream    = "stream"
+
+	containerPlaceholder = "{container}"
+
+	defaultDiscoveryInterval = 10 * time.Second
+	defaultLogRateLimit      = 100
+	defaultMultilineMaxLines = 500
+	defaultMultilineTimeout  = time.Second
+)
+
+// LogLine is a line written by a container.
+type LogLine struct {
+	Stream    string
+	Text      string
+	Timestamp time.Time
+}
+
+// parseLogLine splits the timestamp added by the runtime from the text of the line.
+// Lines without timestamp are stamped with the current time.
+func parseLogLine(stream, line string) LogLine {
+	if prefix, text, found := strings.Cut(line, " "); found {
+		if ts, err := time.Parse(time.RFC3339Nano, prefix); err == nil {
+			return LogLine{Stream: stream, Text: text, Timestamp: ts}
+		}
+	}
+	return LogLine{Stream: stream, Text: line, Timestamp: time.Now()}
+}
+
+// LogSource lists the managed containers and follows their logs.
+type LogSource interface {
+	ManagedContainers() ([]Container, error)
+	FollowLogs(ctx context.Context, nameOrID string, since time.Time, lines chan<- LogLine) error
+}
+
+// LogCollector follows the logs of the managed containers and submits their records.
+type LogCollector struct {
+	cfg       config.ContainerLogsYAML
+	start     *regexp.Regexp // first line of a multiline record, nil if lines aren't joined
+	source    LogSource
+	submitter agent.Submitter
+	logger    *zerolog.Logger
+
+	mu       sync.Mutex
+	followed map[string]bool      // IDs of the followed containers
+	since    map[string]time.Time // after the last line of each container, to resume without duplicates
+}
+
+// NewLogCollector creates the collector of the container logs.
+func NewLogCollector(cfg config.ContainerLogsYAML, source LogSource, submitter agent.Submitter, parentLogger *zerolog.Logger) (*LogCollector, error) {
+	if parentLogger == nil {
+		return nil, errors.New("logger can't be nil")
+	}
+	if cfg.DiscoveryInterval == 0 {
+		cfg.DiscoveryInterval = defaultDiscoveryInterval
+	}
+	if cfg.RateLimit == 0 {
+		cfg.RateLimit = defaultLogRateLimit
+	}
+	if cfg.Burst == 0 {
+		cfg.Burst = cfg.RateLimit
+	}
+
+	var start *regexp.Regexp
+	if m := cfg.Multiline; m != nil {
+		var err error
+		start, err = regexp.Compile(m.Start)
+		if err != nil {
+			return nil, fmt.Errorf("failed to compile multiline start '%s': %w", m.Start, err)
+		}
+		multiline := *m
+		if multiline.MaxLines == 0 {
+			multiline.MaxLines = defaultMultilineMaxLines
+		}
+		if multiline.Timeout == 0 {
+			multiline.Timeout = defaultMultilineTimeout
+		}
+		cfg.Multiline = &multiline
+	}
+	logger := parentLogger.With().Str("component", "container_logs").Logger()
+
+	return &LogCollector{
+		cfg:       cfg,
+		start:     start,
+		source:    source,
+		submitter: submitter,
+		logger:    &logger,
+		followed:  make(map[string]bool),
+		since:     make(map[string]time.Time),
+	}, nil
+}
+
+// Run looks for started containers every discovery interval and follows their
+// logs until ctx is done.
+func (l *LogCollector) Run(ctx context.Context) {
+	var wg sync.WaitGroup
+	defer wg.Wait()
+
+	ticker := time.NewTicker(l.cfg.DiscoveryInterval)
+	defer ticker.Stop()
+
+	for {
+		containers, err := l.source.ManagedContainers()
+		if err != nil {
+			l.logger.Warn().Err(err).Msg("failed to list managed containers")
+		} else {
+			l.prune(containers)
+		}
+		for _, c := range containers {
+			if !l.track(c) {
+				continue
+			}
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				l.follow(ctx, c)
+			}()
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// track marks the container as followed. It returns false if it is already
+// followed or not selected by the configuration.
+func (l *LogCollector) track(c Container) bool {
+	if len(l.cfg.Containers) > 0 && !slices.Contains(l.cfg.Containers, c.Name) {
+		return false
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.followed[c.ID] {
+		return false
+	}
+	l.followed[c.ID] = true
+	return true
+}
+
+// prune forgets the position in the logs of the containers that are no longer
+// running, so removed containers don't stay in memory.
+func (l *LogCollector) prune(running []Container) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	for id := range l.since {
+		if l.followed[id] {
+			continue
+		}
+		if !slices.ContainsFunc(running, func(c Container) bool { return c.ID == id }) {
+			delete(l.since, id)
+		}
+	}
+}
+
+// follow submits the records of the container until it stops or ctx is done.
+func (l *LogCollector) follow(ctx context.Context, c Container) {
+	logger := l.logger.With().Str("container", c.Name).Logger()
+	logger.Info().Msg("following container logs")
+
+	l.mu.Lock()
+	since := l.since[c.ID]
+	l.mu.Unlock()
+
+	lines := make(chan LogLine)
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		l.collect(c, lines, &logger)
+	}()
+
+	err := l.source.FollowLogs(ctx, c.ID, since, lines)
+	close(lines)
+	<-done
+	if err != nil {
+		logger.Warn().Err(err).Msg("failed to follow container logs")
+	}
+
+	// Looked up again by the next discovery if it is still running
+	l.mu.Lock()
+	delete(l.followed, c.ID)
+	l.mu.Unlock()
+}
+
+// collect joins the lines in records and submits them, within the rate limit,
+// until lines is closed.
+func (l *LogCollector) collect(c Container, lines <-chan LogLine, logger *zerolog.Logger) {
+	limiter := rate.NewLimiter(rate.Limit(l.cfg.RateLimit), l.cfg.Burst)
+	dropped := 0
+	submit := func(record LogLine) {
+		if !limiter.Allow() {
+			dropped++
+			return
+		}
+		if dropped > 0 {
+			logger.Warn().Int("dropped", dropped).Msg("container log records dropped by the rate limit")
+			dropped = 0
+		}
+		l.submit(c, record, logger)
+	}
+
+	joiners := map[string]*logJoiner{
+		StreamStdout: newLogJoiner(l.start, l.cfg.Multiline),
+		StreamStderr: newLogJoiner(l.start, l.cfg.Multiline),
+	}
+	// The pending records of both streams are sent in the order they were written
+	flushAll := func() {
+		var records []LogLine
+		for _, j := range joiners {
+			if record, ok := j.flush(); ok {
+				records = append(records, record)
+			}
+		}
+		slices.SortStableFunc(records, func(a, b LogLine) int { return a.Timestamp.Compare(b.Timestamp) })
+		for _, record := range records {
+			submit(record)
+		}
+	}
+	defer flushAll()
+
+	// Pending records are sent after the multiline timeout without new lines
+	var timeout <-chan time.Time
+	var timer *time.Timer
+	if l.cfg.Multiline != nil {
+		timer = time.NewTimer(l.cfg.Multiline.Timeout)
+		defer timer.Stop()
+		timeout = timer.C
+	}
+
+	for {
+		select {
+		case line, ok := <-lines:
+			if !ok {
+				return
+			}
+			l.mu.Lock()
+			l.since[c.ID] = line.Timestamp.Add(time.Nanosecond)
+			l.mu.Unlock()
+
+			j, found := joiners[line.Stream]
+			if !found {
+				j = joiners[StreamStdout]
+			}
+			for _, record := range j.add(line) {
+				submit(record)
+			}
+			if timer != nil {
+				timer.Reset(l.cfg.Multiline.Timeout)
+			}
+		case <-timeout:
+			flushAll()
+		}
+	}
+}
+
+// submit sends the record as a message of the container.
+func (l *LogCollector) submit(c Container, record LogLine, logger *zerolog.Logger) {
+	payload, err := json.Marshal(map[string]string{"log": record.Text})
+	if err != nil {
+		logger.Error().Err(err).Msg("failed to encode container log record")
+		return
+	}
+
+	msg := &message.Message{
+		ID:            message.NewID("logs"),
+		DeviceID:      c.Name,
+		Timestamp:     record.Timestamp,
+		Payload:       payload,
+		TargetBrokers: l.cfg.TargetBrokers,
+		Topic:         strings.ReplaceAll(l.cfg.Topic, containerPlaceholder, c.Name),
+		Metadata: map[string]string{
+			MetadataContainer: c.Name,
+			MetadataImage:     c.Image,
+			MetadataStream:    record.Stream,
+		},
+	}
+	if err := l.submitter.Submit(msg); err != nil && !agent.IsQueued(err) {
+		logger.Error().Err(err).Str("message", msg.ID).Str("topic", msg.Topic).Msg("failed to submit container log record")
+	}
+}
+
+// logJoiner joins the lines of a stream in records. Without start pattern, every
+// line is a record.
+type logJoiner struct {
+	start    *regexp.Regexp
+	maxLines int
+	pending  []string
+	first    LogLine // first line of the pending record
+}
+
+func newLogJoiner(start *regexp.Regexp, cfg *config.MultilineYAML) *logJoiner {
+	j := &logJoiner{start: start}
+	if cfg != nil {
+		j.maxLines = cfg.MaxLines
+	}
+	return j
+}
+
+// add appends the line and returns the records it completed.
+func (j *logJoiner) add(line LogLine) []LogLine {
+	if j.start == nil {
+		return []LogLine{line}
+	}
+
+	var records []LogLine
+	if j.start.MatchString(line.Text) {
+		if record, ok := j.flush(); ok {
+			records = append(records, record)
+		}
+	}
+	if len(j.pending) == 0 {
+		j.first = line
+	}
+	j.pending = append(j.pending, line.Text)
+	if len(j.pending) >= j.maxLines {
+		record, _ := j.flush()
+		records = append(records, record)
+	}
+	return records
+}
+
+// flush returns the pending record, if any.
+func (j *logJoiner) flush() (LogLine, bool) {
+	if len(j.pending) == 0 {
+		return LogLine{}, false
+	}
+	record := j.first
+	record.Text = strings.Join(j.pending, "\n")
+	j.pending = j.pending[:0]
+	return record, true
+}
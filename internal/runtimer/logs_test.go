@@ -0,0 +1,217 @@
+package runtimer
+
+import (
+	"context"
+	"encoding/json"
+	"regexp"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/LincolnG4/iot-hydra/internal/agent"
+	"github.com/LincolnG4/iot-hydra/internal/config"
+	"github.com/alecthomas/assert"
+	"github.com/rs/zerolog"
+)
+
+// fakeLogSource writes the lines of each container once, then ends the follow.
+type fakeLogSource struct {
+	containers []Container
+	lines      map[string][]LogLine
+
+	mu     sync.Mutex
+	sinces []time.Time
+}
+
+func (f *fakeLogSource) ManagedContainers() ([]Container, error) {
+	return f.containers, nil
+}
+
+func (f *fakeLogSource) FollowLogs(ctx context.Context, nameOrID string, since time.Time, lines chan<- LogLine) error {
+	f.mu.Lock()
+	f.sinces = append(f.sinces, since)
+	f.mu.Unlock()
+
+	for _, line := range f.lines[nameOrID] {
+		if line.Timestamp.Before(since) {
+			continue
+		}
+		select {
+		case lines <- line:
+		case <-ctx.Done():
+			return nil
+		}
+	}
+	return nil
+}
+
+func TestParseLogLine(t *testing.T) {
+	line := parseLogLine(StreamStderr, "2025-03-01T10:00:00.123456789Z panic: boom")
+	assert.Equal(t, StreamStderr, line.Stream)
+	assert.Equal(t, "panic: boom", line.Text)
+	assert.Equal(t, time.Date(2025, 3, 1, 10, 0, 0, 123456789, time.UTC), line.Timestamp)
+
+	line = parseLogLine(StreamStdout, "no timestamp here")
+	assert.Equal(t, "no timestamp here", line.Text)
+	assert.False(t, line.Timestamp.IsZero())
+}
+
+func TestForwardLogs(t *testing.T) {
+	stdout, stderr := make(chan string), make(chan string)
+	lines := make(chan LogLine, 10)
+	go func() {
+		stdout <- "2025-03-01T10:00:00Z first\n2025-03-01T10:00:01Z sec"
+		stderr <- "2025-03-01T10:00:02Z error\n"
+		stdout <- "ond\n2025-03-01T10:00:03Z last"
+		close(stdout)
+		close(stderr)
+	}()
+	forwardLogs(context.Background(), stdout, stderr, lines)
+	close(lines)
+
+	var got []string
+	for line := range lines {
+		got = append(got, line.Stream+":"+line.Text)
+	}
+	assert.Equal(t, []string{"stdout:first", "stderr:error", "stdout:second", "stdout:last"}, got)
+}
+
+func TestLogJoiner(t *testing.T) {
+	start := regexp.MustCompile(`^\d{4}-`)
+	j := newLogJoiner(start, &config.MultilineYAML{MaxLines: 3})
+	ts := time.Now()
+
+	assert.Equal(t, 0, len(j.add(LogLine{Text: "2025- exception", Timestamp: ts})))
+	assert.Equal(t, 0, len(j.add(LogLine{Text: "  at main()"})))
+	records := j.add(LogLine{Text: "2025- next"})
+	assert.Equal(t, 1, len(records))
+	assert.Equal(t, "2025- exception\n  at main()", records[0].Text)
+	assert.Equal(t, ts, records[0].Timestamp)
+
+	// Records are cut at the max lines
+	j.add(LogLine{Text: "  a"})
+	records = j.add(LogLine{Text: "  b"})
+	assert.Equal(t, 1, len(records))
+	assert.Equal(t, "2025- next\n  a\n  b", records[0].Text)
+	_, ok := j.flush()
+	assert.False(t, ok)
+
+	// Without start pattern every line is a record
+	j = newLogJoiner(nil, nil)
+	assert.Equal(t, 1, len(j.add(LogLine{Text: "  indented"})))
+}
+
+func TestLogCollector_Run(t *testing.T) {
+	ts := time.Date(2025, 3, 1, 10, 0, 0, 0, time.UTC)
+	source := &fakeLogSource{
+		containers: []Container{
+			{ID: "abc", Name: "app", Image: "docker.io/library/app:1"},
+			{ID: "def", Name: "ignored", Image: "docker.io/library/other:1"},
+		},
+		lines: map[string][]LogLine{
+			"abc": {
+				{Stream: StreamStdout, Text: "INFO started", Timestamp: ts},
+				{Stream: StreamStderr, Text: "ERROR failed", Timestamp: ts.Add(time.Second)},
+				{Stream: StreamStderr, Text: "  at main()", Timestamp: ts.Add(2 * time.Second)},
+			},
+		},
+	}
+	submitter := &agent.MockSubmitter{}
+	logger := zerolog.Nop()
+	collector, err := NewLogCollector(config.ContainerLogsYAML{
+		Topic:             "logs/{container}",
+		TargetBrokers:     []string{"nats"},
+		Containers:        []string{"app"},
+		DiscoveryInterval: 10 * time.Millisecond,
+		Multiline:         &config.MultilineYAML{Start: `^(INFO|ERROR)`},
+	}, source, submitter, &logger)
+	assert.NoError(t, err)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		collector.Run(ctx)
+		close(done)
+	}()
+
+	// The container is followed again after the end of the first follow
+	deadline := time.Now().Add(5 * time.Second)
+	for time.Now().Before(deadline) {
+		source.mu.Lock()
+		n := len(source.sinces)
+		source.mu.Unlock()
+		if n >= 2 {
+			break
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+	cancel()
+	<-done
+
+	msgs := submitter.Messages()
+	assert.Equal(t, 2, len(msgs))
+	assert.Equal(t, "app", msgs[0].DeviceID)
+	assert.Equal(t, "logs/app", msgs[0].Topic)
+	assert.Equal(t, []string{"nats"}, msgs[0].TargetBrokers)
+	assert.Equal(t, map[string]string{
+		MetadataContainer: "app",
+		MetadataImage:     "docker.io/library/app:1",
+		MetadataStream:    StreamStdout,
+	}, msgs[0].Metadata)
+
+	var payload map[string]string
+	assert.NoError(t, json.Unmarshal(msgs[1].Payload, &payload))
+	assert.Equal(t, "ERROR failed\n  at main()", payload["log"])
+	assert.Equal(t, StreamStderr, msgs[1].Metadata[MetadataStream])
+	assert.Equal(t, ts.Add(time.Second), msgs[1].Timestamp)
+
+	// The next follow resumes after the last line
+	source.mu.Lock()
+	defer source.mu.Unlock()
+	assert.True(t, source.sinces[0].IsZero())
+	assert.Equal(t, ts.Add(2*time.Second+time.Nanosecond), source.sinces[1])
+}
+
+func TestLogCollector_RateLimit(t *testing.T) {
+	submitter := &agent.MockSubmitter{}
+	logger := zerolog.Nop()
+	collector, err := NewLogCollector(config.ContainerLogsYAML{
+		Topic:         "logs",
+		TargetBrokers: []string{"nats"},
+		RateLimit:     1,
+		Burst:         2,
+	}, &fakeLogSource{}, submitter, &logger)
+	assert.NoError(t, err)
+
+	lines := make(chan LogLine, 5)
+	for range 5 {
+		lines <- LogLine{Stream: StreamStdout, Text: "spam", Timestamp: time.Now()}
+	}
+	close(lines)
+	collector.collect(Container{ID: "abc", Name: "app"}, lines, &logger)
+
+	assert.Equal(t, 2, len(submitter.Messages()))
+}
+
+func TestNewLogCollector_InvalidMultiline(t *testing.T) {
+	logger := zerolog.Nop()
+	_, err := NewLogCollector(config.ContainerLogsYAML{
+		Topic:         "logs",
+		TargetBrokers: []string{"nats"},
+		Multiline:     &config.MultilineYAML{Start: "("},
+	}, &fakeLogSource{}, &agent.MockSubmitter{}, &logger)
+	assert.Error(t, err)
+}
+
+func TestLogCollector_Prune(t *testing.T) {
+	logger := zerolog.Nop()
+	collector, err := NewLogCollector(config.ContainerLogsYAML{Topic: "logs", TargetBrokers: []string{"nats"}}, &fakeLogSource{}, &agent.MockSubmitter{}, &logger)
+	assert.NoError(t, err)
+
+	now := time.Now()
+	collector.since = map[string]time.Time{"running": now, "followed": now, "removed": now}
+	collector.followed["followed"] = true
+
+	collector.prune([]Container{{ID: "running"}})
+	assert.Equal(t, map[string]time.Time{"running": now, "followed": now}, collector.since)
+}
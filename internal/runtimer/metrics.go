@@ -0,0 +1,94 @@
+package runtimer
+
+import (
+	"fmt"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/metric"
+)
+
+const name = "runtimer"
+
+// statsGauges are the OTel instruments of the container stats. The network and
+// block I/O bytes are counted since the start of the container, so they are
+// reported as counters.
+type statsGauges struct {
+	meter      metric.Meter
+	cpu        metric.Float64ObservableGauge
+	memory     metric.Int64ObservableGauge
+	memLimit   metric.Int64ObservableGauge
+	pids       metric.Int64ObservableGauge
+	networkRx  metric.Int64ObservableCounter
+	networkTx  metric.Int64ObservableCounter
+	blockRead  metric.Int64ObservableCounter
+	blockWrite metric.Int64ObservableCounter
+}
+
+// newStatsGauges creates the instruments with the global meter provider.
+func newStatsGauges() (*statsGauges, error) {
+	g := &statsGauges{meter: otel.Meter(name)}
+
+	var err error
+	g.cpu, err = g.meter.Float64ObservableGauge("runtimer.container_cpu",
+		metric.WithDescription("CPU usage of the container"),
+		metric.WithUnit("%"),
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create gauge 'runtimer.container_cpu': %w", err)
+	}
+
+	int64Gauges := []struct {
+		gauge       *metric.Int64ObservableGauge
+		name        string
+		description string
+	}{
+		{&g.memory, "runtimer.container_memory_usage", "Memory used by the container"},
+		{&g.memLimit, "runtimer.container_memory_limit", "Memory limit of the container"},
+	}
+	for _, ig := range int64Gauges {
+		*ig.gauge, err = g.meter.Int64ObservableGauge(ig.name,
+			metric.WithDescription(ig.description),
+			metric.WithUnit("By"),
+		)
+		if err != nil {
+			return nil, fmt.Errorf("failed to create gauge '%s': %w", ig.name, err)
+		}
+	}
+
+	g.pids, err = g.meter.Int64ObservableGauge("runtimer.container_pids",
+		metric.WithDescription("Processes running in the container"),
+		metric.WithUnit("{process}"),
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create gauge 'runtimer.container_pids': %w", err)
+	}
+
+	int64Counters := []struct {
+		counter     *metric.Int64ObservableCounter
+		name        string
+		description string
+	}{
+		{&g.networkRx, "runtimer.container_network_rx", "Bytes received by the container since its start"},
+		{&g.networkTx, "runtimer.container_network_tx", "Bytes sent by the container since its start"},
+		{&g.blockRead, "runtimer.container_block_read", "Bytes read from block devices by the container since its start"},
+		{&g.blockWrite, "runtimer.container_block_write", "Bytes written to block devices by the container since its start"},
+	}
+	for _, ic := range int64Counters {
+		*ic.counter, err = g.meter.Int64ObservableCounter(ic.name,
+			metric.WithDescription(ic.description),
+			metric.WithUnit("By"),
+		)
+		if err != nil {
+			return nil, fmt.Errorf("failed to create counter '%s': %w", ic.name, err)
+		}
+	}
+	return g, nil
+}
+
+// instruments returns the instruments to register with the callback.
+func (g *statsGauges) instruments() []metric.Observable {
+	return []metric.Observable{
+		g.cpu, g.memory, g.memLimit, g.pids,
+		g.networkRx, g.networkTx, g.blockRead, g.blockWrite,
+	}
+}
@@ -44,3 +44,8 @@ func (_m *MockPodmanManager) ListContainers() ([]Container, error) {
 	ret := _m.Called()
 	return ret.Get(0).([]Container), ret.Error(1)
 }
+
+func (_m *MockPodmanManager) AppContainers() ([]Container, error) {
+	ret := _m.Called()
+	return ret.Get(0).([]Container), ret.Error(1)
+}
@@ -2,12 +2,16 @@ package runtimer
 
 import (
 	"context"
+	"maps"
+	"strings"
 	"time"
 
+	nettypes "github.com/containers/common/libnetwork/types"
 	"github.com/containers/podman/v5/pkg/bindings"
 	"github.com/containers/podman/v5/pkg/bindings/containers"
 	"github.com/containers/podman/v5/pkg/bindings/images"
 	"github.com/containers/podman/v5/pkg/specgen"
+	spec "github.com/opencontainers/runtime-spec/specs-go"
 	"github.com/rs/zerolog/log"
 )
 
@@ -83,17 +87,64 @@ func NewPodmanManager(opt *ManagerOptions) (PodmanManager, error) {
 }
 
 type Container struct {
+	ID     string
 	Name   string
 	Image  string
 	Config map[string]any
 	State  string
+	Mounts []Mount
+
+	Env        map[string]string
+	Ports      []PortMapping
+	Command    []string
+	Entrypoint []string
+	Labels     map[string]string
+	// no, always, on-failure or unless-stopped. RestartRetries only applies to on-failure
+	RestartPolicy  string
+	RestartRetries uint
+	// bridge, host, none, private, slirp4netns or pasta. Podman default if empty
+	NetworkMode string
+	User        string
+	// Host devices, e.g. /dev/ttyUSB0 or /dev/ttyUSB0:/dev/ttyS0:rw
+	Devices   []string
+	Resources *Resources
+}
+
+// Mount binds a host path into the container, or mounts a named volume if
+// Type is volume. Source is then the name of the volume.
+type Mount struct {
+	Type        string
+	Source      string
+	Destination string
+	ReadOnly    bool
+}
+
+// Mount types
+const (
+	MountBind   = "bind"
+	MountVolume = "volume"
+)
+
+// PortMapping forwards a host port to a port of the container.
+type PortMapping struct {
+	// Host address, all interfaces if empty
+	HostIP        string
+	HostPort      uint16
+	ContainerPort uint16
+	// tcp (default), udp or sctp
+	Protocol string
 }
 
-type ContainerConfig struct {
-	// Ports to be expose hostPort:cointanerPort
-	ExposedPort map[int]int
+// Resources limits the CPU and memory of the container. Zero values are unlimited.
+type Resources struct {
+	// Number of CPUs, e.g. 0.5
+	CPUs        float64
+	MemoryBytes int64
 }
 
+// cpuPeriod is the CFS period of the CPU quota, in microseconds
+const cpuPeriod = 100000
+
 // CreateContainer trigger all the steps to start a container:
 // pull image -> Create the container -> Start
 func (p PodmanManager) CreateContainer(container Container) error {
@@ -101,8 +152,7 @@ func (p PodmanManager) CreateContainer(container Container) error {
 	if err != nil {
 		return err
 	}
-	s := specgen.NewSpecGenerator(container.Image, false)
-	s.Name = container.Name
+	s := newSpec(container)
 	createResponse, err := containers.CreateWithSpec(p.Connection(), s, nil)
 	if err != nil {
 		return err
@@ -115,6 +165,74 @@ func (p PodmanManager) CreateContainer(container Container) error {
 	return nil
 }
 
+// newSpec maps the container on the spec of podman.
+func newSpec(container Container) *specgen.SpecGenerator {
+	s := specgen.NewSpecGenerator(container.Image, false)
+	s.Name = container.Name
+	s.Env = container.Env
+	s.Command = container.Command
+	s.Entrypoint = container.Entrypoint
+	s.User = container.User
+
+	// The managed label can't be overridden, the log collector relies on it
+	s.Labels = make(map[string]string, len(container.Labels)+1)
+	maps.Copy(s.Labels, container.Labels)
+	s.Labels[ManagedLabel] = "true"
+
+	for _, m := range container.Mounts {
+		if m.Type == MountVolume {
+			var options []string
+			if m.ReadOnly {
+				options = append(options, "ro")
+			}
+			s.Volumes = append(s.Volumes, &specgen.NamedVolume{Name: m.Source, Dest: m.Destination, Options: options})
+			continue
+		}
+		options := []string{"rbind"}
+		if m.ReadOnly {
+			options = append(options, "ro")
+		}
+		s.Mounts = append(s.Mounts, spec.Mount{Type: MountBind, Source: m.Source, Destination: m.Destination, Options: options})
+	}
+
+	for _, p := range container.Ports {
+		s.PortMappings = append(s.PortMappings, nettypes.PortMapping{
+			HostIP:        p.HostIP,
+			HostPort:      p.HostPort,
+			ContainerPort: p.ContainerPort,
+			Protocol:      p.Protocol,
+		})
+	}
+
+	if container.RestartPolicy != "" {
+		s.RestartPolicy = container.RestartPolicy
+		if container.RestartRetries > 0 {
+			retries := container.RestartRetries
+			s.RestartRetries = &retries
+		}
+	}
+	if container.NetworkMode != "" {
+		s.NetNS = specgen.Namespace{NSMode: specgen.NamespaceMode(container.NetworkMode)}
+	}
+	for _, d := range container.Devices {
+		s.Devices = append(s.Devices, spec.LinuxDevice{Path: d})
+	}
+
+	if r := container.Resources; r != nil && (r.CPUs > 0 || r.MemoryBytes > 0) {
+		s.ResourceLimits = &spec.LinuxResources{}
+		if r.CPUs > 0 {
+			quota := int64(r.CPUs * cpuPeriod)
+			period := uint64(cpuPeriod)
+			s.ResourceLimits.CPU = &spec.LinuxCPU{Quota: &quota, Period: &period}
+		}
+		if r.MemoryBytes > 0 {
+			limit := r.MemoryBytes
+			s.ResourceLimits.Memory = &spec.LinuxMemory{Limit: &limit}
+		}
+	}
+	return s
+}
+
 // CheckContainer inspect the status of a container by their name
 func (p PodmanManager) CheckContainer(name string) (Container, error) {
 	inspectData, err := containers.Inspect(p.Connection(), name, new(containers.InspectOptions).WithSize(true))
@@ -123,7 +241,8 @@ func (p PodmanManager) CheckContainer(name string) (Container, error) {
 	}
 
 	container := Container{
-		Name:  name,
+		ID:    inspectData.ID,
+		Name:  strings.TrimPrefix(inspectData.Name, "/"),
 		Image: inspectData.ImageName,
 		State: inspectData.State.Status,
 	}
@@ -157,12 +276,172 @@ func (p PodmanManager) ListContainers() ([]Container, error) {
 	containers := make([]Container, 0)
 	for _, con := range listContainers {
 		container := Container{
+			ID:     con.ID,
+			Name:   con.Names[0],
+			Image:  con.Image,
+			State:  con.State,
+			Labels: con.Labels,
+		}
+		containers = append(containers, container)
+	}
+
+	return containers, err
+}
+
+// AppContainers returns the containers of the deployment apps, the stopped ones
+// included.
+func (p PodmanManager) AppContainers() ([]Container, error) {
+	filters := map[string][]string{"label": {AppLabel}}
+	listContainers, err := containers.List(p.Connection(), new(containers.ListOptions).WithAll(true).WithFilters(filters))
+	if err != nil {
+		return nil, err
+	}
+
+	apps := make([]Container, 0, len(listContainers))
+	for _, con := range listContainers {
+		apps = append(apps, Container{
+			ID:     con.ID,
+			Name:   con.Names[0],
+			Image:  con.Image,
+			State:  con.State,
+			Labels: con.Labels,
+		})
+	}
+	return apps, nil
+}
+
+// ManagedContainers returns the running containers created by CreateContainer.
+func (p PodmanManager) ManagedContainers() ([]Container, error) {
+	filters := map[string][]string{
+		"label":  {ManagedLabel + "=true"},
+		"status": {"running"},
+	}
+	listContainers, err := containers.List(p.Connection(), new(containers.ListOptions).WithFilters(filters))
+	if err != nil {
+		return nil, err
+	}
+
+	managed := make([]Container, 0, len(listContainers))
+	for _, con := range listContainers {
+		managed = append(managed, Container{
+			ID:    con.ID,
 			Name:  con.Names[0],
 			Image: con.Image,
 			State: con.State,
+		})
+	}
+	return managed, nil
+}
+
+// FollowLogs sends the stdout and stderr lines of the container written after since
+// until ctx is done or the container stops.
+func (p PodmanManager) FollowLogs(ctx context.Context, nameOrID string, since time.Time, lines chan<- LogLine) error {
+	options := new(containers.LogOptions).WithFollow(true).WithTimestamps(true).WithStdout(true).WithStderr(true)
+	if !since.IsZero() {
+		options = options.WithSince(since.Format(time.RFC3339Nano))
+	}
+
+	// The connection context holds the client, ctx only cancels the request
+	conn, cancel := context.WithCancel(p.Connection())
+	defer cancel()
+	stop := context.AfterFunc(ctx, cancel)
+	defer stop()
+
+	stdout, stderr := make(chan string), make(chan string)
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		forwardLogs(ctx, stdout, stderr, lines)
+	}()
+
+	err := containers.Logs(conn, nameOrID, options, stdout, stderr)
+	close(stdout)
+	close(stderr)
+	<-done
+	if ctx.Err() != nil {
+		return nil
+	}
+	return err
+}
+
+// forwardLogs splits the frames of the streams in lines until both are closed.
+// Lines are dropped once ctx is done so the reader of the logs is never blocked.
+func forwardLogs(ctx context.Context, stdout, stderr <-chan string, lines chan<- LogLine) {
+	send := func(stream, line string) {
+		select {
+		case lines <- parseLogLine(stream, line):
+		case <-ctx.Done():
 		}
-		containers = append(containers, container)
 	}
 
-	return containers, err
+	// A frame may hold several lines or end in the middle of one
+	partial := make(map[string]string, 2)
+	for stdout != nil || stderr != nil {
+		var frame, stream string
+		var ok bool
+		select {
+		case frame, ok = <-stdout:
+			if !ok {
+				stdout = nil
+				continue
+			}
+			stream = StreamStdout
+		case frame, ok = <-stderr:
+			if !ok {
+				stderr = nil
+				continue
+			}
+			stream = StreamStderr
+		}
+
+		text := partial[stream] + frame
+		for {
+			line, rest, found := strings.Cut(text, "\n")
+			if !found {
+				break
+			}
+			send(stream, line)
+			text = rest
+		}
+		partial[stream] = text
+	}
+
+	for stream, line := range partial {
+		if line != "" {
+			send(stream, line)
+		}
+	}
+}
+
+// ContainerStats returns the resource usage of the running containers.
+func (p PodmanManager) ContainerStats() ([]ContainerStats, error) {
+	reports, err := containers.Stats(p.Connection(), nil, new(containers.StatsOptions).WithStream(false))
+	if err != nil {
+		return nil, err
+	}
+
+	var stats []ContainerStats
+	for report := range reports {
+		if report.Error != nil {
+			return nil, report.Error
+		}
+		for _, s := range report.Stats {
+			cs := ContainerStats{
+				ID:          s.ContainerID,
+				Name:        s.Name,
+				CPUPercent:  s.CPU,
+				MemoryUsage: s.MemUsage,
+				MemoryLimit: s.MemLimit,
+				BlockRead:   s.BlockInput,
+				BlockWrite:  s.BlockOutput,
+				PIDs:        s.PIDs,
+			}
+			for _, n := range s.Network {
+				cs.NetworkRx += n.RxBytes
+				cs.NetworkTx += n.TxBytes
+			}
+			stats = append(stats, cs)
+		}
+	}
+	return stats, nil
 }
@@ -0,0 +1,61 @@
+package runtimer
+
+import (
+	"testing"
+
+	"github.com/alecthomas/assert"
+	nettypes "github.com/containers/common/libnetwork/types"
+	"github.com/containers/podman/v5/pkg/specgen"
+	spec "github.com/opencontainers/runtime-spec/specs-go"
+)
+
+func TestNewSpec(t *testing.T) {
+	s := newSpec(Container{
+		Name:       "collector",
+		Image:      "docker.io/acme/collector:1.2",
+		Env:        map[string]string{"LOG_LEVEL": "debug"},
+		Ports:      []PortMapping{{HostIP: "127.0.0.1", HostPort: 5020, ContainerPort: 502, Protocol: "udp"}},
+		Command:    []string{"--interval", "5s"},
+		Entrypoint: []string{"/bin/collector"},
+		Labels:     map[string]string{"app": "collector", ManagedLabel: "false"},
+		Mounts: []Mount{
+			{Source: "/srv/data", Destination: "/data", ReadOnly: true},
+			{Type: MountVolume, Source: "cache", Destination: "/cache"},
+		},
+		RestartPolicy:  "on-failure",
+		RestartRetries: 3,
+		NetworkMode:    "host",
+		User:           "1000:1000",
+		Devices:        []string{"/dev/ttyUSB0"},
+		Resources:      &Resources{CPUs: 0.5, MemoryBytes: 128 << 20},
+	})
+
+	assert.Equal(t, "collector", s.Name)
+	assert.Equal(t, "docker.io/acme/collector:1.2", s.Image)
+	assert.Equal(t, map[string]string{"LOG_LEVEL": "debug"}, s.Env)
+	assert.Equal(t, []nettypes.PortMapping{{HostIP: "127.0.0.1", HostPort: 5020, ContainerPort: 502, Protocol: "udp"}}, s.PortMappings)
+	assert.Equal(t, []string{"--interval", "5s"}, s.Command)
+	assert.Equal(t, []string{"/bin/collector"}, s.Entrypoint)
+	assert.Equal(t, map[string]string{"app": "collector", ManagedLabel: "true"}, s.Labels)
+	assert.Equal(t, []spec.Mount{{Type: "bind", Source: "/srv/data", Destination: "/data", Options: []string{"rbind", "ro"}}}, s.Mounts)
+	assert.Equal(t, []*specgen.NamedVolume{{Name: "cache", Dest: "/cache"}}, s.Volumes)
+	assert.Equal(t, "on-failure", s.RestartPolicy)
+	assert.Equal(t, uint(3), *s.RestartRetries)
+	assert.Equal(t, specgen.Host, s.NetNS.NSMode)
+	assert.Equal(t, "1000:1000", s.User)
+	assert.Equal(t, []spec.LinuxDevice{{Path: "/dev/ttyUSB0"}}, s.Devices)
+	assert.Equal(t, int64(50000), *s.ResourceLimits.CPU.Quota)
+	assert.Equal(t, uint64(100000), *s.ResourceLimits.CPU.Period)
+	assert.Equal(t, int64(128<<20), *s.ResourceLimits.Memory.Limit)
+}
+
+func TestNewSpec_Defaults(t *testing.T) {
+	s := newSpec(Container{Name: "foo", Image: "docker/bar"})
+
+	assert.Equal(t, map[string]string{ManagedLabel: "true"}, s.Labels)
+	assert.Equal(t, specgen.NamespaceMode(""), s.NetNS.NSMode)
+	assert.Equal(t, "", s.RestartPolicy)
+	assert.Zero(t, s.RestartRetries)
+	assert.Zero(t, s.ResourceLimits)
+	assert.Equal(t, 0, len(s.PortMappings))
+}
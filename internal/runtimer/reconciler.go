@@ -0,0 +1,381 @@
+package runtimer
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"maps"
+	"os"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/LincolnG4/iot-hydra/internal/config"
+	"github.com/LincolnG4/iot-hydra/internal/utils"
+	"github.com/rs/zerolog"
+)
+
+const (
+	// AppLabel holds the app of the containers created by the reconciler
+	AppLabel = "io.iot-hydra.app"
+	// SpecLabel holds the hash of the app spec the container was created with
+	SpecLabel = "io.iot-hydra.spec"
+
+	defaultReconcileInterval = 30 * time.Second
+
+	stateRunning = "running"
+)
+
+// Drifts between the desired and the actual containers
+const (
+	DriftMissing    = "missing"     // replica not created
+	DriftStopped    = "stopped"     // replica not running
+	DriftOutdated   = "outdated"    // replica created with another spec
+	DriftExtra      = "extra"       // replica over the desired count
+	DriftUnexpected = "not_desired" // container of an app removed from the manifest
+)
+
+// Drift is a difference found between the desired and the actual state.
+type Drift struct {
+	Container string `json:"container"`
+	Reason    string `json:"reason"`
+}
+
+// AppStatus is the state of an app after the last reconciliation.
+type AppStatus struct {
+	Name      string  `json:"name"`
+	Desired   int     `json:"desired"`
+	Running   int     `json:"running"`
+	Drifts    []Drift `json:"drifts,omitempty"`
+	Error     string  `json:"error,omitempty"`
+	Converged bool    `json:"converged"`
+	// Time of the last reconciliation
+	ReconciledAt time.Time `json:"reconciled_at"`
+}
+
+// AppRuntime creates and removes the containers of the apps.
+type AppRuntime interface {
+	CreateContainer(container Container) error
+	StartContainer(name string) error
+	StopContainer(name string) error
+	DeleteContainer(name string) error
+	AppContainers() ([]Container, error)
+}
+
+// Reconciler converges the containers of the apps to the desired manifest.
+type Reconciler struct {
+	runtime      AppRuntime
+	interval     time.Duration
+	manifestFile string
+	mounts       []Mount // added to every container, e.g. the unix sockets
+	logger       *zerolog.Logger
+
+	mu      sync.Mutex
+	apps    []config.AppYAML
+	status  map[string]AppStatus
+	trigger chan struct{}
+}
+
+// NewReconciler creates the reconciler of the deployment. The apps saved in the
+// manifest file replace the ones of the configuration.
+func NewReconciler(cfg config.DeploymentYAML, runtime AppRuntime, mounts []Mount, parentLogger *zerolog.Logger) (*Reconciler, error) {
+	if parentLogger == nil {
+		return nil, errors.New("logger can't be nil")
+	}
+	if cfg.Interval == 0 {
+		cfg.Interval = defaultReconcileInterval
+	}
+	logger := parentLogger.With().Str("component", "reconciler").Logger()
+
+	r := &Reconciler{
+		runtime:      runtime,
+		interval:     cfg.Interval,
+		manifestFile: cfg.ManifestFile,
+		mounts:       mounts,
+		logger:       &logger,
+		apps:         cfg.Apps,
+		status:       make(map[string]AppStatus),
+		trigger:      make(chan struct{}, 1),
+	}
+
+	if r.manifestFile != "" {
+		data, err := os.ReadFile(r.manifestFile)
+		switch {
+		case errors.Is(err, os.ErrNotExist):
+		case err != nil:
+			return nil, fmt.Errorf("failed to read manifest file '%s': %w", r.manifestFile, err)
+		default:
+			var apps []config.AppYAML
+			if err := json.Unmarshal(data, &apps); err != nil {
+				return nil, fmt.Errorf("failed to decode manifest file '%s': %w", r.manifestFile, err)
+			}
+			r.apps = apps
+		}
+	}
+	return r, nil
+}
+
+// Apps returns the desired apps.
+func (r *Reconciler) Apps() []config.AppYAML {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return slices.Clone(r.apps)
+}
+
+// SetApps replaces the desired apps, saves them in the manifest file and starts a
+// reconciliation.
+func (r *Reconciler) SetApps(apps []config.AppYAML) error {
+	if r.manifestFile != "" {
+		if err := saveManifest(r.manifestFile, apps); err != nil {
+			return err
+		}
+	}
+
+	r.mu.Lock()
+	r.apps = slices.Clone(apps)
+	r.mu.Unlock()
+
+	select {
+	case r.trigger <- struct{}{}:
+	default:
+	}
+	return nil
+}
+
+// Status returns the status of the apps after the last reconciliation, sorted by name.
+func (r *Reconciler) Status() []AppStatus {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	status := slices.Collect(maps.Values(r.status))
+	slices.SortFunc(status, func(a, b AppStatus) int { return strings.Compare(a.Name, b.Name) })
+	return status
+}
+
+// Run reconciles every interval, and when the apps change, until ctx is done.
+func (r *Reconciler) Run(ctx context.Context) {
+	ticker := time.NewTicker(r.interval)
+	defer ticker.Stop()
+
+	for {
+		if err := r.Reconcile(); err != nil {
+			r.logger.Warn().Err(err).Msg("failed to reconcile deployment")
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		case <-r.trigger:
+		}
+	}
+}
+
+// Reconcile compares the containers with the desired apps once: missing replicas
+// are created, stopped ones started, outdated ones recreated and the extra ones
+// removed. A failing app doesn't stop the others.
+func (r *Reconciler) Reconcile() error {
+	list, err := r.runtime.AppContainers()
+	if err != nil {
+		return fmt.Errorf("failed to list containers: %w", err)
+	}
+
+	// Containers created by the reconciler by app
+	actual := make(map[string][]Container)
+	for _, c := range list {
+		if app, ok := c.Labels[AppLabel]; ok {
+			actual[app] = append(actual[app], c)
+		}
+	}
+
+	apps := r.Apps()
+	now := time.Now()
+	status := make(map[string]AppStatus, len(apps))
+	for _, app := range apps {
+		s := r.reconcileApp(app, actual[app.Name])
+		s.ReconciledAt = now
+		status[app.Name] = s
+		delete(actual, app.Name)
+	}
+
+	// Apps removed from the manifest, reported until their containers are gone
+	for app, containers := range actual {
+		s := AppStatus{Name: app, ReconciledAt: now}
+		var errs []error
+		for _, c := range containers {
+			s.Drifts = append(s.Drifts, Drift{Container: c.Name, Reason: DriftUnexpected})
+			r.logger.Info().Str("app", app).Str("container", c.Name).Str("drift", DriftUnexpected).Msg("deployment drift")
+			if err := r.remove(c); err != nil {
+				errs = append(errs, err)
+				r.logger.Error().Err(err).Str("app", app).Str("container", c.Name).Msg("failed to remove container")
+			}
+		}
+		if err := errors.Join(errs...); err != nil {
+			s.Error = err.Error()
+		}
+		s.Converged = s.Error == ""
+		status[app] = s
+	}
+
+	r.mu.Lock()
+	r.status = status
+	r.mu.Unlock()
+	return nil
+}
+
+// reconcileApp converges the containers of the app and returns its status.
+func (r *Reconciler) reconcileApp(app config.AppYAML, containers []Container) AppStatus {
+	replicas := 1
+	if app.Replicas != nil {
+		replicas = *app.Replicas
+	}
+	hash, err := specHash(app)
+	status := AppStatus{Name: app.Name, Desired: replicas}
+	if err != nil {
+		status.Error = err.Error()
+		return status
+	}
+
+	logger := r.logger.With().Str("app", app.Name).Logger()
+	var errs []error
+	drift := func(name, reason string) {
+		status.Drifts = append(status.Drifts, Drift{Container: name, Reason: reason})
+		logger.Info().Str("container", name).Str("drift", reason).Msg("deployment drift")
+	}
+
+	existing := make(map[string]Container, len(containers))
+	for _, c := range containers {
+		existing[c.Name] = c
+	}
+
+	for i := 1; i <= replicas; i++ {
+		name := replicaName(app.Name, i)
+		c, found := existing[name]
+		delete(existing, name)
+
+		switch {
+		case !found:
+			drift(name, DriftMissing)
+		case c.Labels[SpecLabel] != hash:
+			drift(name, DriftOutdated)
+			if err := r.remove(c); err != nil {
+				errs = append(errs, err)
+				continue
+			}
+		case c.State != stateRunning:
+			drift(name, DriftStopped)
+			if err := r.runtime.StartContainer(c.ID); err != nil {
+				errs = append(errs, fmt.Errorf("failed to start container '%s': %w", name, err))
+				continue
+			}
+			status.Running++
+			continue
+		default:
+			status.Running++
+			continue
+		}
+
+		if err := r.runtime.CreateContainer(r.container(app, name, hash)); err != nil {
+			errs = append(errs, fmt.Errorf("failed to create container '%s': %w", name, err))
+			continue
+		}
+		status.Running++
+	}
+
+	// Replicas over the desired count, or with a name of another scheme
+	for _, c := range existing {
+		drift(c.Name, DriftExtra)
+		if err := r.remove(c); err != nil {
+			errs = append(errs, err)
+		}
+	}
+
+	if err := errors.Join(errs...); err != nil {
+		status.Error = err.Error()
+		logger.Error().Err(err).Msg("failed to reconcile app")
+	}
+	status.Converged = status.Error == "" && status.Running == status.Desired
+	return status
+}
+
+// remove stops and deletes the container.
+func (r *Reconciler) remove(c Container) error {
+	if c.State == stateRunning {
+		if err := r.runtime.StopContainer(c.ID); err != nil {
+			return fmt.Errorf("failed to stop container '%s': %w", c.Name, err)
+		}
+	}
+	if err := r.runtime.DeleteContainer(c.ID); err != nil {
+		return fmt.Errorf("failed to delete container '%s': %w", c.Name, err)
+	}
+	return nil
+}
+
+// container returns the replica of the app, labeled with the app and its spec hash.
+func (r *Reconciler) container(app config.AppYAML, name, hash string) Container {
+	c := Container{
+		Name:           name,
+		Image:          app.Image,
+		Env:            app.Env,
+		Command:        app.Command,
+		Entrypoint:     app.Entrypoint,
+		RestartPolicy:  app.RestartPolicy,
+		RestartRetries: app.RestartRetries,
+		NetworkMode:    app.NetworkMode,
+		User:           app.User,
+		Devices:        app.Devices,
+	}
+
+	c.Labels = make(map[string]string, len(app.Labels)+2)
+	maps.Copy(c.Labels, app.Labels)
+	c.Labels[AppLabel] = app.Name
+	c.Labels[SpecLabel] = hash
+
+	for _, p := range app.Ports {
+		c.Ports = append(c.Ports, PortMapping(p))
+	}
+	for _, v := range app.Volumes {
+		mountType := v.Type
+		if mountType == "" {
+			mountType = MountBind
+		}
+		c.Mounts = append(c.Mounts, Mount{Type: mountType, Source: v.Source, Destination: v.Destination, ReadOnly: v.ReadOnly})
+	}
+	c.Mounts = append(c.Mounts, r.mounts...)
+	if app.Resources != nil {
+		c.Resources = &Resources{CPUs: app.Resources.CPUs, MemoryBytes: app.Resources.MemoryBytes}
+	}
+	return c
+}
+
+// replicaName returns the container name of the replica, counted from 1.
+func replicaName(app string, replica int) string {
+	return app + "-" + strconv.Itoa(replica)
+}
+
+// specHash identifies the spec of the app, the replicas apart, to find outdated containers.
+func specHash(app config.AppYAML) (string, error) {
+	app.Replicas = nil
+	data, err := json.Marshal(app)
+	if err != nil {
+		return "", fmt.Errorf("failed to encode spec of app '%s': %w", app.Name, err)
+	}
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:8]), nil
+}
+
+// saveManifest writes the apps to the file.
+func saveManifest(path string, apps []config.AppYAML) error {
+	data, err := json.MarshalIndent(apps, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to encode manifest: %w", err)
+	}
+	if err := utils.WriteFileAtomic(path, data); err != nil {
+		return fmt.Errorf("failed to save manifest file '%s': %w", path, err)
+	}
+	return nil
+}
@@ -0,0 +1,313 @@
+package runtimer
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"slices"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/LincolnG4/iot-hydra/internal/config"
+	"github.com/alecthomas/assert"
+	"github.com/rs/zerolog"
+)
+
+// fakeRuntime keeps the containers in memory and records the calls made to it.
+type fakeRuntime struct {
+	mu         sync.Mutex
+	containers map[string]Container
+	calls      []string
+	failCreate error
+}
+
+func newFakeRuntime(containers ...Container) *fakeRuntime {
+	f := &fakeRuntime{containers: make(map[string]Container)}
+	for _, c := range containers {
+		c.ID = c.Name
+		f.containers[c.Name] = c
+	}
+	return f
+}
+
+func (f *fakeRuntime) record(call string) {
+	f.calls = append(f.calls, call)
+}
+
+func (f *fakeRuntime) CreateContainer(c Container) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.record("create " + c.Name)
+	if f.failCreate != nil {
+		return f.failCreate
+	}
+	c.ID = c.Name
+	c.State = stateRunning
+	f.containers[c.Name] = c
+	return nil
+}
+
+func (f *fakeRuntime) CheckContainer(name string) (Container, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.containers[name], nil
+}
+
+func (f *fakeRuntime) StartContainer(name string) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.record("start " + name)
+	c := f.containers[name]
+	c.State = stateRunning
+	f.containers[name] = c
+	return nil
+}
+
+func (f *fakeRuntime) StopContainer(name string) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.record("stop " + name)
+	c := f.containers[name]
+	c.State = "exited"
+	f.containers[name] = c
+	return nil
+}
+
+func (f *fakeRuntime) DeleteContainer(name string) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.record("delete " + name)
+	delete(f.containers, name)
+	return nil
+}
+
+func (f *fakeRuntime) AppContainers() ([]Container, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	list := make([]Container, 0, len(f.containers))
+	for _, c := range f.containers {
+		if _, ok := c.Labels[AppLabel]; ok {
+			list = append(list, c)
+		}
+	}
+	return list, nil
+}
+
+// Calls returns the calls made since the last one, sorted.
+func (f *fakeRuntime) Calls() []string {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	calls := f.calls
+	f.calls = nil
+	slices.Sort(calls)
+	return calls
+}
+
+func newTestReconciler(t *testing.T, cfg config.DeploymentYAML, runtime AppRuntime) *Reconciler {
+	t.Helper()
+	logger := zerolog.Nop()
+	r, err := NewReconciler(cfg, runtime, []Mount{{Source: "/run/hydra.sock", Destination: "/run/hydra.sock"}}, &logger)
+	assert.NoError(t, err)
+	return r
+}
+
+func replicaCount(n int) *int {
+	return &n
+}
+
+// replica returns the container of the app as created by the reconciler.
+func replica(t *testing.T, app config.AppYAML, i int, state string) Container {
+	t.Helper()
+	hash, err := specHash(app)
+	assert.NoError(t, err)
+	name := replicaName(app.Name, i)
+	return Container{ID: name, Name: name, Image: app.Image, State: state, Labels: map[string]string{AppLabel: app.Name, SpecLabel: hash}}
+}
+
+func TestReconciler_Create(t *testing.T) {
+	app := config.AppYAML{
+		Name:     "collector",
+		Image:    "docker.io/acme/collector:1.2",
+		Replicas: replicaCount(2),
+		Env:      map[string]string{"LOG_LEVEL": "debug"},
+		Labels:   map[string]string{"team": "ops"},
+		Volumes:  []config.AppVolumeYAML{{Source: "/srv/data", Destination: "/data"}},
+	}
+	runtime := newFakeRuntime(Container{Name: "manual", State: stateRunning})
+	r := newTestReconciler(t, config.DeploymentYAML{Apps: []config.AppYAML{app}}, runtime)
+
+	assert.NoError(t, r.Reconcile())
+	assert.Equal(t, []string{"create collector-1", "create collector-2"}, runtime.Calls())
+
+	c := runtime.containers["collector-1"]
+	assert.Equal(t, "docker.io/acme/collector:1.2", c.Image)
+	assert.Equal(t, map[string]string{"LOG_LEVEL": "debug"}, c.Env)
+	assert.Equal(t, "collector", c.Labels[AppLabel])
+	assert.Equal(t, "ops", c.Labels["team"])
+	assert.Equal(t, []Mount{
+		{Type: MountBind, Source: "/srv/data", Destination: "/data"},
+		{Source: "/run/hydra.sock", Destination: "/run/hydra.sock"},
+	}, c.Mounts)
+
+	status := r.Status()
+	assert.Equal(t, 1, len(status))
+	assert.Equal(t, 2, status[0].Running)
+	assert.True(t, status[0].Converged)
+	assert.Equal(t, []Drift{{"collector-1", DriftMissing}, {"collector-2", DriftMissing}}, status[0].Drifts)
+
+	// Converged: nothing to do, the container not created by the reconciler is kept
+	assert.NoError(t, r.Reconcile())
+	assert.Equal(t, 0, len(runtime.Calls()))
+	assert.Equal(t, 0, len(r.Status()[0].Drifts))
+	_, ok := runtime.containers["manual"]
+	assert.True(t, ok)
+}
+
+func TestReconciler_Drifts(t *testing.T) {
+	app := config.AppYAML{Name: "collector", Image: "docker.io/acme/collector:1.2", Replicas: replicaCount(2)}
+	outdated := replica(t, app, 1, stateRunning)
+	outdated.Labels[SpecLabel] = "old"
+	runtime := newFakeRuntime(
+		outdated,
+		replica(t, app, 2, "exited"),
+		replica(t, app, 3, stateRunning),
+		replica(t, config.AppYAML{Name: "removed", Image: "docker/bar"}, 1, "exited"),
+	)
+	r := newTestReconciler(t, config.DeploymentYAML{Apps: []config.AppYAML{app}}, runtime)
+
+	assert.NoError(t, r.Reconcile())
+	assert.Equal(t, []string{
+		"create collector-1",
+		"delete collector-1",
+		"delete collector-3",
+		"delete removed-1",
+		"start collector-2",
+		"stop collector-1",
+		"stop collector-3",
+	}, runtime.Calls())
+
+	status := r.Status()
+	assert.Equal(t, 2, len(status))
+	assert.Equal(t, []Drift{{"collector-1", DriftOutdated}, {"collector-2", DriftStopped}, {"collector-3", DriftExtra}}, status[0].Drifts)
+	assert.True(t, status[0].Converged)
+	assert.Equal(t, 2, len(runtime.containers))
+
+	// The removed app is reported with its containers
+	assert.Equal(t, "removed", status[1].Name)
+	assert.Equal(t, 0, status[1].Desired)
+	assert.Equal(t, []Drift{{"removed-1", DriftUnexpected}}, status[1].Drifts)
+	assert.True(t, status[1].Converged)
+
+	// and is gone once they are removed
+	assert.NoError(t, r.Reconcile())
+	assert.Equal(t, 1, len(r.Status()))
+}
+
+func TestReconciler_ScaleToZero(t *testing.T) {
+	app := config.AppYAML{Name: "collector", Image: "docker.io/acme/collector:1.2"}
+	runtime := newFakeRuntime(replica(t, app, 1, stateRunning))
+	app.Replicas = replicaCount(0)
+	r := newTestReconciler(t, config.DeploymentYAML{Apps: []config.AppYAML{app}}, runtime)
+
+	assert.NoError(t, r.Reconcile())
+	assert.Equal(t, []string{"delete collector-1", "stop collector-1"}, runtime.Calls())
+
+	status := r.Status()
+	assert.Equal(t, 1, len(status))
+	assert.Equal(t, 0, status[0].Desired)
+	assert.Equal(t, []Drift{{"collector-1", DriftExtra}}, status[0].Drifts)
+	assert.True(t, status[0].Converged)
+	assert.Equal(t, []config.AppYAML{app}, r.Apps())
+}
+
+func TestReconciler_Error(t *testing.T) {
+	runtime := newFakeRuntime()
+	runtime.failCreate = errors.New("image not found")
+	r := newTestReconciler(t, config.DeploymentYAML{Apps: []config.AppYAML{
+		{Name: "foo", Image: "docker/foo"},
+		{Name: "bar", Image: "docker/bar"},
+	}}, runtime)
+
+	assert.NoError(t, r.Reconcile())
+	assert.Equal(t, []string{"create bar-1", "create foo-1"}, runtime.Calls())
+
+	status := r.Status()
+	assert.Equal(t, "bar", status[0].Name)
+	assert.Equal(t, "foo", status[1].Name)
+	assert.False(t, status[1].Converged)
+	assert.Equal(t, 0, status[1].Running)
+	assert.Contains(t, status[1].Error, "image not found")
+}
+
+func TestReconciler_Manifest(t *testing.T) {
+	manifest := filepath.Join(t.TempDir(), "apps.json")
+	cfg := config.DeploymentYAML{
+		Interval:     time.Hour,
+		ManifestFile: manifest,
+		Apps:         []config.AppYAML{{Name: "foo", Image: "docker/foo"}},
+	}
+	runtime := newFakeRuntime()
+	r := newTestReconciler(t, cfg, runtime)
+	assert.Equal(t, cfg.Apps, r.Apps())
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		r.Run(ctx)
+		close(done)
+	}()
+	defer func() {
+		cancel()
+		<-done
+	}()
+
+	// New apps are saved and reconciled without waiting for the interval
+	apps := []config.AppYAML{{Name: "bar", Image: "docker/bar", Replicas: replicaCount(2)}}
+	assert.NoError(t, r.SetApps(apps))
+
+	deadline := time.Now().Add(5 * time.Second)
+	for time.Now().Before(deadline) {
+		status := r.Status()
+		if len(status) == 1 && status[0].Name == "bar" && status[0].Converged {
+			break
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+	list, err := runtime.AppContainers()
+	assert.NoError(t, err)
+	names := make([]string, 0, len(list))
+	for _, c := range list {
+		names = append(names, c.Name)
+	}
+	slices.Sort(names)
+	assert.Equal(t, []string{"bar-1", "bar-2"}, names)
+
+	data, err := os.ReadFile(manifest)
+	assert.NoError(t, err)
+	var saved []config.AppYAML
+	assert.NoError(t, json.Unmarshal(data, &saved))
+	assert.Equal(t, apps, saved)
+
+	// The saved apps replace the ones of the configuration
+	r = newTestReconciler(t, cfg, newFakeRuntime())
+	assert.Equal(t, apps, r.Apps())
+}
+
+func TestSpecHash(t *testing.T) {
+	app := config.AppYAML{Name: "foo", Image: "docker/foo:1"}
+	hash, err := specHash(app)
+	assert.NoError(t, err)
+
+	app.Replicas = replicaCount(3)
+	scaled, err := specHash(app)
+	assert.NoError(t, err)
+	assert.Equal(t, hash, scaled)
+
+	app.Image = "docker/foo:2"
+	updated, err := specHash(app)
+	assert.NoError(t, err)
+	assert.NotEqual(t, hash, updated)
+}
@@ -0,0 +1,175 @@
+package runtimer
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/LincolnG4/iot-hydra/internal/agent"
+	"github.com/LincolnG4/iot-hydra/internal/config"
+	"github.com/LincolnG4/iot-hydra/internal/message"
+	"github.com/rs/zerolog"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/metric"
+)
+
+const defaultStatsInterval = 30 * time.Second
+
+// ContainerStats is the resource usage of a container. Network and block I/O are
+// counted since the start of the container.
+type ContainerStats struct {
+	ID          string  `json:"id"`
+	Name        string  `json:"name"`
+	CPUPercent  float64 `json:"cpu_percent"`
+	MemoryUsage uint64  `json:"memory_usage"`
+	MemoryLimit uint64  `json:"memory_limit"`
+	NetworkRx   uint64  `json:"network_rx"`
+	NetworkTx   uint64  `json:"network_tx"`
+	BlockRead   uint64  `json:"block_read"`
+	BlockWrite  uint64  `json:"block_write"`
+	PIDs        uint64  `json:"pids"`
+}
+
+// StatsSource reads the resource usage of the running containers.
+type StatsSource interface {
+	ContainerStats() ([]ContainerStats, error)
+}
+
+// StatsCollector submits the resource usage of the containers every interval and
+// exports the last reading as OTel gauges.
+type StatsCollector struct {
+	cfg       config.ContainerStatsYAML
+	source    StatsSource
+	submitter agent.Submitter
+	gauges    *statsGauges
+	logger    *zerolog.Logger
+
+	mu   sync.Mutex
+	last []ContainerStats
+}
+
+// NewStatsCollector creates the collector of the container stats.
+func NewStatsCollector(cfg config.ContainerStatsYAML, source StatsSource, submitter agent.Submitter, parentLogger *zerolog.Logger) (*StatsCollector, error) {
+	if parentLogger == nil {
+		return nil, errors.New("logger can't be nil")
+	}
+	if cfg.Interval == 0 {
+		cfg.Interval = defaultStatsInterval
+	}
+	logger := parentLogger.With().Str("component", "container_stats").Logger()
+
+	gauges, err := newStatsGauges()
+	if err != nil {
+		return nil, err
+	}
+
+	return &StatsCollector{
+		cfg:       cfg,
+		source:    source,
+		submitter: submitter,
+		gauges:    gauges,
+		logger:    &logger,
+	}, nil
+}
+
+// Run reads the stats every interval until ctx is done.
+func (s *StatsCollector) Run(ctx context.Context) {
+	registration, err := s.gauges.meter.RegisterCallback(s.observe, s.gauges.instruments()...)
+	if err != nil {
+		s.logger.Error().Err(err).Msg("failed to register container stats gauges")
+	} else {
+		defer func() {
+			if err := registration.Unregister(); err != nil {
+				s.logger.Error().Err(err).Msg("failed to unregister container stats gauges")
+			}
+		}()
+	}
+
+	ticker := time.NewTicker(s.cfg.Interval)
+	defer ticker.Stop()
+
+	for {
+		if err := s.collect(); err != nil {
+			s.logger.Warn().Err(err).Msg("failed to read container stats")
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// collect reads the stats and submits one message per container.
+func (s *StatsCollector) collect() error {
+	stats, err := s.source.ContainerStats()
+	if err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	s.last = stats
+	s.mu.Unlock()
+
+	now := time.Now()
+	for _, cs := range stats {
+		if err := s.submit(cs, now); err != nil {
+			s.logger.Error().Err(err).Str("container", cs.Name).Msg("failed to submit container stats")
+		}
+	}
+	return nil
+}
+
+// submit sends the stats as a message of the container.
+func (s *StatsCollector) submit(cs ContainerStats, now time.Time) error {
+	payload, err := json.Marshal(cs)
+	if err != nil {
+		return fmt.Errorf("failed to encode stats of container '%s': %w", cs.Name, err)
+	}
+
+	msg := &message.Message{
+		ID:            message.NewID("stats"),
+		DeviceID:      cs.Name,
+		Timestamp:     now,
+		Payload:       payload,
+		TargetBrokers: s.cfg.TargetBrokers,
+		Topic:         strings.ReplaceAll(s.cfg.Topic, containerPlaceholder, cs.Name),
+		Metadata:      map[string]string{MetadataContainer: cs.Name},
+	}
+	if err := s.submitter.Submit(msg); err != nil && !agent.IsQueued(err) {
+		return err
+	}
+	return nil
+}
+
+// observe reports the last reading of each container to the instruments.
+func (s *StatsCollector) observe(_ context.Context, o metric.Observer) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	g := s.gauges
+	for _, cs := range s.last {
+		attrs := metric.WithAttributes(attribute.String("container", cs.Name))
+		o.ObserveFloat64(g.cpu, cs.CPUPercent, attrs)
+		o.ObserveInt64(g.memory, gaugeValue(cs.MemoryUsage), attrs)
+		o.ObserveInt64(g.memLimit, gaugeValue(cs.MemoryLimit), attrs)
+		o.ObserveInt64(g.pids, gaugeValue(cs.PIDs), attrs)
+		o.ObserveInt64(g.networkRx, gaugeValue(cs.NetworkRx), attrs)
+		o.ObserveInt64(g.networkTx, gaugeValue(cs.NetworkTx), attrs)
+		o.ObserveInt64(g.blockRead, gaugeValue(cs.BlockRead), attrs)
+		o.ObserveInt64(g.blockWrite, gaugeValue(cs.BlockWrite), attrs)
+	}
+	return nil
+}
+
+// gaugeValue converts the counter for the int64 gauges, e.g. the memory limit of
+// unlimited containers is the largest uint64.
+func gaugeValue(v uint64) int64 {
+	return int64(min(v, math.MaxInt64))
+}
@@ -0,0 +1,123 @@
+package runtimer
+
+import (
+	"context"
+	"encoding/json"
+	"math"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/LincolnG4/iot-hydra/internal/agent"
+	"github.com/LincolnG4/iot-hydra/internal/config"
+	"github.com/alecthomas/assert"
+	"github.com/rs/zerolog"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	sdkmetric "go.opentelemetry.io/otel/sdk/metric"
+	"go.opentelemetry.io/otel/sdk/metric/metricdata"
+)
+
+type fakeStatsSource struct {
+	stats []ContainerStats
+}
+
+func (f *fakeStatsSource) ContainerStats() ([]ContainerStats, error) {
+	return f.stats, nil
+}
+
+// metricReader reads the gauges of the collectors created after its first call,
+// which sets the global meter provider.
+var metricReader = sync.OnceValue(func() *sdkmetric.ManualReader {
+	reader := sdkmetric.NewManualReader()
+	otel.SetMeterProvider(sdkmetric.NewMeterProvider(sdkmetric.WithReader(reader)))
+	return reader
+})
+
+func TestStatsCollector_Run(t *testing.T) {
+	reader := metricReader()
+
+	source := &fakeStatsSource{stats: []ContainerStats{{
+		ID:          "abc",
+		Name:        "app",
+		CPUPercent:  12.5,
+		MemoryUsage: 64 << 20,
+		MemoryLimit: math.MaxUint64,
+		NetworkRx:   1000,
+		NetworkTx:   2000,
+		BlockRead:   3000,
+		BlockWrite:  4000,
+		PIDs:        7,
+	}}}
+	submitter := &agent.MockSubmitter{}
+	logger := zerolog.Nop()
+	collector, err := NewStatsCollector(config.ContainerStatsYAML{
+		Interval:      time.Hour,
+		Topic:         "stats/{container}",
+		TargetBrokers: []string{"nats"},
+	}, source, submitter, &logger)
+	assert.NoError(t, err)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		collector.Run(ctx)
+		close(done)
+	}()
+
+	deadline := time.Now().Add(5 * time.Second)
+	for len(submitter.Messages()) == 0 && time.Now().Before(deadline) {
+		time.Sleep(5 * time.Millisecond)
+	}
+
+	msgs := submitter.Messages()
+	assert.Equal(t, 1, len(msgs))
+	assert.Equal(t, "app", msgs[0].DeviceID)
+	assert.Equal(t, "stats/app", msgs[0].Topic)
+	assert.Equal(t, []string{"nats"}, msgs[0].TargetBrokers)
+
+	var stats ContainerStats
+	assert.NoError(t, json.Unmarshal(msgs[0].Payload, &stats))
+	assert.Equal(t, source.stats[0], stats)
+
+	// The gauges report the last reading until the collector stops
+	var rm metricdata.ResourceMetrics
+	assert.NoError(t, reader.Collect(context.Background(), &rm))
+	gauges := make(map[string]any)
+	for _, sm := range rm.ScopeMetrics {
+		for _, m := range sm.Metrics {
+			switch data := m.Data.(type) {
+			case metricdata.Gauge[float64]:
+				assert.Equal(t, attribute.NewSet(attribute.String("container", "app")), data.DataPoints[0].Attributes)
+				gauges[m.Name] = data.DataPoints[0].Value
+			case metricdata.Gauge[int64]:
+				gauges[m.Name] = data.DataPoints[0].Value
+			case metricdata.Sum[int64]:
+				assert.True(t, data.IsMonotonic)
+				assert.Equal(t, metricdata.CumulativeTemporality, data.Temporality)
+				gauges[m.Name] = data.DataPoints[0].Value
+			}
+		}
+	}
+	assert.Equal(t, 12.5, gauges["runtimer.container_cpu"])
+	assert.Equal(t, int64(64<<20), gauges["runtimer.container_memory_usage"])
+	assert.Equal(t, int64(math.MaxInt64), gauges["runtimer.container_memory_limit"])
+	assert.Equal(t, int64(7), gauges["runtimer.container_pids"])
+	assert.Equal(t, int64(1000), gauges["runtimer.container_network_rx"])
+	assert.Equal(t, int64(4000), gauges["runtimer.container_block_write"])
+
+	cancel()
+	<-done
+	rm = metricdata.ResourceMetrics{}
+	assert.NoError(t, reader.Collect(context.Background(), &rm))
+	for _, sm := range rm.ScopeMetrics {
+		for _, m := range sm.Metrics {
+			switch data := m.Data.(type) {
+			case metricdata.Gauge[int64]:
+				assert.Equal(t, 0, len(data.DataPoints))
+			case metricdata.Sum[int64]:
+				assert.Equal(t, 0, len(data.DataPoints))
+			}
+		}
+	}
+}
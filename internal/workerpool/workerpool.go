@@ -27,7 +27,7 @@ type Workerpool struct {
 	maxWorkers  int      // Number of workers in the pool
 	JobQueue    chan Job // Receives the worker's jobs
 	isClosed    bool
-	mu          sync.Mutex
+	mu          sync.RWMutex
 	ResultQueue chan FailedResult // Output of the workers
 }
 
@@ -117,12 +117,13 @@ func (w *Workerpool) worker(id int) {
 func (w *Workerpool) Stop() {
 	w.logger.Info().Msg("stopping workerpool")
 
-	// Signal that no more jobs will be submitted
-	close(w.JobQueue)
+	// Release the workers and any Submit waiting for room in the queue
 	w.cancel()
 
+	// Signal that no more jobs will be submitted
 	w.mu.Lock()
 	w.isClosed = true
+	close(w.JobQueue)
 	w.mu.Unlock()
 
 	// Wait for all workers to finish processing remaining jobs
@@ -137,12 +138,12 @@ func (w *Workerpool) Stop() {
 // Submit enqueues a job for execution. It returns an error if the queue
 // is closed or full.
 func (w *Workerpool) Submit(j Job) error {
-	w.mu.Lock()
-	isClosed := w.isClosed
-	w.mu.Unlock()
+	// Holding the read lock prevents Stop from closing the queue while sending
+	w.mu.RLock()
+	defer w.mu.RUnlock()
 
 	// Check if the queue still open
-	if isClosed {
+	if w.isClosed {
 		return errors.New("workerpool is closed")
 	}
 
@@ -159,3 +160,26 @@ func (w *Workerpool) Submit(j Job) error {
 		return errors.New("workerpool queue is full")
 	}
 }
+
+// SubmitWait enqueues a job for execution, waiting for room in the queue until
+// ctx is done. It returns an error if the workerpool is closed.
+func (w *Workerpool) SubmitWait(ctx context.Context, j Job) error {
+	w.mu.RLock()
+	defer w.mu.RUnlock()
+
+	if w.isClosed {
+		return errors.New("workerpool is closed")
+	}
+
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-w.ctx.Done():
+		return w.ctx.Err()
+	case w.JobQueue <- j:
+		w.logger.Debug().Msg("job added to the queue")
+		// Increase queue metric
+		jobQueueCnt.Add(w.ctx, 1)
+		return nil
+	}
+}
@@ -99,4 +99,37 @@ func TestNewWorkerPool(t *testing.T) {
 		assert.Error(t, err.Error, "must return error")
 		assert.Contains(t, err.Error.Error(), "some error", "must return a error `some error`")
 	})
+
+	t.Run("SubmitWait: waits for room in the queue", func(t *testing.T) {
+		wp, _ := NewPool(context.Background(), 1, 1, &logger)
+		wp.Start()
+		defer wp.Stop()
+
+		release := make(chan struct{})
+		blocking := func() error {
+			<-release
+			return nil
+		}
+
+		// Worker busy and queue full
+		assert.NoError(t, wp.SubmitWait(context.Background(), blocking))
+		assert.NoError(t, wp.SubmitWait(context.Background(), blocking))
+
+		ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+		defer cancel()
+		err := wp.SubmitWait(ctx, blocking)
+		assert.Error(t, err, "should time out while the queue is full")
+
+		close(release)
+		assert.NoError(t, wp.SubmitWait(context.Background(), func() error { return nil }))
+	})
+
+	t.Run("SubmitWait failed: workerpool stopped", func(t *testing.T) {
+		wp, _ := NewPool(context.Background(), 1, 1, &logger)
+		wp.Start()
+		wp.Stop()
+
+		err := wp.SubmitWait(context.Background(), func() error { return nil })
+		assert.Error(t, err, "workerpool queue must be closed")
+	})
 }